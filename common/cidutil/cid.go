@@ -0,0 +1,138 @@
+package cidutil
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// the multicodecs of the cids made or read here
+const (
+	CODEC_RAW               = 0x55
+	CODEC_DAG_PB            = 0x70
+	MULTIHASH_SHA2_256      = 0x12
+	MULTIHASH_SHA2_256_SIZE = 0x20
+)
+
+var ErrInvalidCid = errors.New("invalid cid")
+
+var base32Encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Decode returns the bytes of the cid string, which is a cid v0 in base58, or a cid v1 in base32 or base58btc
+func Decode(cid string) ([]byte, error) {
+	var cidBytes []byte
+	var err error
+	switch {
+	case len(cid) == 46 && strings.HasPrefix(cid, "Qm"):
+		cidBytes, err = decodeBase58(cid)
+	case strings.HasPrefix(cid, "b"), strings.HasPrefix(cid, "B"):
+		cidBytes, err = base32Encoding.DecodeString(strings.ToLower(cid[1:]))
+	case strings.HasPrefix(cid, "z"):
+		cidBytes, err = decodeBase58(cid[1:])
+	default:
+		err = errors.New("multibase not supported")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w:%s, %s", ErrInvalidCid, cid, err.Error())
+	}
+
+	_, _, cidSize, err := Parse(cidBytes)
+	if err != nil || cidSize != len(cidBytes) {
+		return nil, fmt.Errorf("%w:%s", ErrInvalidCid, cid)
+	}
+
+	return cidBytes, nil
+}
+
+// Parse returns the codec and the multihash of the cid at the beginning of the bytes, and the size of the cid
+func Parse(data []byte) (uint64, []byte, int, error) {
+	if len(data) >= 2+MULTIHASH_SHA2_256_SIZE && data[0] == MULTIHASH_SHA2_256 && data[1] == MULTIHASH_SHA2_256_SIZE {
+		return CODEC_DAG_PB, data[:2+MULTIHASH_SHA2_256_SIZE], 2 + MULTIHASH_SHA2_256_SIZE, nil
+	}
+
+	reader := bytes.NewReader(data)
+	version, err := binary.ReadUvarint(reader)
+	if err != nil || version != 1 {
+		return 0, nil, 0, ErrInvalidCid
+	}
+
+	codec, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, nil, 0, ErrInvalidCid
+	}
+
+	multihashStart := len(data) - reader.Len()
+	_, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, nil, 0, ErrInvalidCid
+	}
+
+	digestSize, err := binary.ReadUvarint(reader)
+	if err != nil || digestSize > uint64(reader.Len()) {
+		return 0, nil, 0, ErrInvalidCid
+	}
+
+	cidSize := len(data) - reader.Len() + int(digestSize)
+	return codec, data[multihashStart:cidSize], cidSize, nil
+}
+
+// GetMultihash returns the multihash of the cid string, the same content has the same multihash in cid v0 and v1
+func GetMultihash(cid string) ([]byte, error) {
+	cidBytes, err := Decode(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	_, multihash, _, err := Parse(cidBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return multihash, nil
+}
+
+// NewV1 returns the bytes of the cid v1 of the codec and the multihash
+func NewV1(codec uint64, multihash []byte) []byte {
+	codecBytes := make([]byte, binary.MaxVarintLen64)
+	codecSize := binary.PutUvarint(codecBytes, codec)
+
+	cidBytes := append([]byte{0x01}, codecBytes[:codecSize]...)
+	return append(cidBytes, multihash...)
+}
+
+// Encode returns the cid v1 in base32 of the cid bytes, a cid v0 is converted to the cid v1 of dag-pb first,
+// such as Qm... to bafy...
+func Encode(cidBytes []byte) string {
+	if len(cidBytes) == 2+MULTIHASH_SHA2_256_SIZE && cidBytes[0] == MULTIHASH_SHA2_256 && cidBytes[1] == MULTIHASH_SHA2_256_SIZE {
+		cidBytes = NewV1(CODEC_DAG_PB, cidBytes)
+	}
+
+	return "b" + base32Encoding.EncodeToString(cidBytes)
+}
+
+func decodeBase58(str string) ([]byte, error) {
+	value := big.NewInt(0)
+	radix := big.NewInt(58)
+	for _, c := range str {
+		index := strings.IndexRune(base58Alphabet, c)
+		if index < 0 {
+			err := fmt.Errorf("invalid base58 character:%c", c)
+			return nil, err
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(index)))
+	}
+
+	leadingZeros := 0
+	for leadingZeros < len(str) && str[leadingZeros] == base58Alphabet[0] {
+		leadingZeros++
+	}
+
+	return append(make([]byte, leadingZeros), value.Bytes()...), nil
+}
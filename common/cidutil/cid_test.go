@@ -0,0 +1,58 @@
+package cidutil
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeEncode(t *testing.T) {
+	tests := []struct {
+		name      string
+		cid       string
+		encoded   string
+		wantError error
+	}{
+		{name: "cid v0", cid: "QmY7Yh4UquoXHLPFo2XbhXkhBvFoPwmQUSa92pxnxjQuPU", encoded: "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4"},
+		{name: "cid v1 in base32", cid: "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4", encoded: "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4"},
+		{name: "cid v1 in base32 upper", cid: "BAFYBEIERHGBZ4ZP2X2U67URQRGFNRNLUKCIUPZENPQPIPIZ5NWTQ7UXPX4", encoded: "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4"},
+		{name: "cid v1 in base58btc", cid: "zdj7WfCo4VYhPH8A3hBXmVDZubFp8TF7VBYLkyfhdMTnAyoZQ", encoded: "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4"},
+		{name: "raw cid v1 in base58btc", cid: "zb2rhgRBB7h5m4YEXEon8HtPS99xByJ7S69PDNDLVrNj1P5bC", encoded: "bafkreierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4"},
+		{name: "truncated", cid: "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxp", wantError: ErrInvalidCid},
+		{name: "not base58", cid: "zdj7WfCo4VYhPH8A3hBXmVDZubFp8TF7VBYLkyfhdMTnAyoZ0", wantError: ErrInvalidCid},
+		{name: "multibase not supported", cid: "mAXASIA", wantError: ErrInvalidCid},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cidBytes, err := Decode(test.cid)
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("error:%v, want:%v", err, test.wantError)
+			}
+
+			if err != nil {
+				return
+			}
+
+			encoded := Encode(cidBytes)
+			if encoded != test.encoded {
+				t.Errorf("encoded:%s, want:%s", encoded, test.encoded)
+			}
+		})
+	}
+}
+
+func TestGetMultihash(t *testing.T) {
+	multihashV0, err := GetMultihash("QmY7Yh4UquoXHLPFo2XbhXkhBvFoPwmQUSa92pxnxjQuPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	multihashV1, err := GetMultihash("zb2rhgRBB7h5m4YEXEon8HtPS99xByJ7S69PDNDLVrNj1P5bC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(multihashV0) != string(multihashV1) || len(multihashV0) != 2+MULTIHASH_SHA2_256_SIZE {
+		t.Errorf("multihash:%x of cid v0 differs from multihash:%x of raw cid v1 of the same digest", multihashV0, multihashV1)
+	}
+}
@@ -28,18 +28,22 @@ const (
 	SOURCE_FILE_UPLOAD_STATUS_COMPLETED    = "Completed"
 	SOURCE_FILE_UPLOAD_STATUS_SUCCESS      = "Success"
 
-	OFFLINE_DEAL_STATUS_CREATED = "Created"
-	OFFLINE_DEAL_STATUS_SUCCESS = "Success"
-	OFFLINE_DEAL_STATUS_ACTIVE  = "Active"
-	OFFLINE_DEAL_STATUS_FAILED  = "Failed"
+	OFFLINE_DEAL_STATUS_CREATED           = "Created"
+	OFFLINE_DEAL_STATUS_SUCCESS           = "Success"
+	OFFLINE_DEAL_STATUS_ACTIVE            = "Active"
+	OFFLINE_DEAL_STATUS_FAILED            = "Failed"
+	OFFLINE_DEAL_STATUS_MINER_BLOCKLISTED = "MinerBlocklisted" // sent to a blocklisted miner chosen by swan auto-bid, not tracked nor counted in the miner reputation
 
-	ON_CHAIN_DEAL_STATUS_ACTIVE = "StorageDealActive"
-	ON_CHAIN_DEAL_STATUS_ERROR  = "StorageDealError"
+	ON_CHAIN_DEAL_STATUS_ACTIVE  = "StorageDealActive"
+	ON_CHAIN_DEAL_STATUS_ERROR   = "StorageDealError"
+	ON_CHAIN_DEAL_STATUS_SLASHED = "StorageDealSlashed"
+	ON_CHAIN_DEAL_STATUS_EXPIRED = "StorageDealExpired"
 
 	ON_CHAIN_MESSAGE_NOT_COMPLETED = "deal may not have completed sealing before deal proposal start epoch, or deal may have been slashed"
 
 	IPFS_URL_PREFIX_BEFORE_HASH = "/ipfs/"
 	IPFS_File_PINNED_STATUS     = "Pinned"
+	IPFS_File_UNPINNING_STATUS  = "Unpinning" // of uploads: unpin scheduled, still pinned till the grace period ends, of source files: being unpinned from the hot storage
 	IPFS_File_UNPINNED_STATUS   = "UnPinned"
 
 	DAO_SIGNATURE_STATUS_SUCCESS = "Success"
@@ -53,10 +57,11 @@ const (
 	SOURCE_FILE_TYPE_NORMAL = 0
 	SOURCE_FILE_TYPE_MINT   = 1
 
-	BYTES_1GB     = 1024 * 1024 * 1024
-	BYTES_1MB     = 1024 * 1024
-	BYTES_1KB     = 1024
-	EPOCH_PER_DAY = 24 * 60 * 2
+	BYTES_1GB      = 1024 * 1024 * 1024
+	BYTES_1MB      = 1024 * 1024
+	BYTES_1KB      = 1024
+	EPOCH_PER_DAY  = 24 * 60 * 2
+	EPOCH_PER_HOUR = 60 * 2
 
 	PRIVATE_KEY_ON_POLYGON = "privateKeyOnPolygon"
 
@@ -78,7 +83,260 @@ const (
 
 	CONFIG_PATH = ".swan/mcs"
 
-	FREE_SIZE_PER_WALLET_MONTH = 10 * BYTES_1GB
-
 	SECOND_PER_DAY = 24 * 60 * 60
+
+	REPLICA_COUNT_DEFAULT                   = 5
+	REPLICA_REPAIR_MAX_TIMES                = 3
+	MONITOR_REPLICA_INTERVAL_SECOND_DEFAULT = 3600
+
+	REPLICA_REPAIR_STATUS_TASK_CREATED = "TaskCreated" // new swan task created for the car file, wait for deals to be sent
+	REPLICA_REPAIR_STATUS_COMPLETED    = "Completed"   // active replicas reached the target again
+	REPLICA_REPAIR_STATUS_FAILED       = "Failed"      // no pending deals left and active replicas still below the target
+
+	RENEWAL_WINDOW_DAYS_DEFAULT          = 30
+	SCAN_RENEWAL_INTERVAL_SECOND_DEFAULT = 3600
+
+	RENEWAL_STATUS_QUOTED       = "Quoted"      // deals approaching end epoch, price quoted, wait for user to lock payment
+	RENEWAL_STATUS_PAID         = "Paid"        // payment locked, the piece will be dealt again
+	RENEWAL_STATUS_TASK_CREATED = "TaskCreated" // new car file and swan task created, deals sent by SendDeal
+	RENEWAL_STATUS_EXPIRED      = "Expired"     // not paid before the deals end
+	RENEWAL_STATUS_FAILED       = "Failed"      // failed permanently, or still failing after RENEWAL_ATTEMPT_MAX attempts
+
+	RENEWAL_ATTEMPT_MAX                = 10
+	RENEWAL_RETRY_INTERVAL_SECOND_BASE = 600 // doubled after each failed attempt
+	RENEWAL_RETRY_INTERVAL_SECOND_MAX  = 86400
+
+	UPDATE_MINER_REPUTATION_INTERVAL_SECOND_DEFAULT = 3600
+	MINER_SLASH_PENALTY                             = 2 // each slashed deal weighs as this many failed deals in the score
+
+	MINER_STATUS_NORMAL      = "Normal"
+	MINER_STATUS_ALLOWLISTED = "Allowlisted" // preferred over the normal miners regardless of the score
+	MINER_STATUS_BLOCKLISTED = "Blocklisted" // deals sent to the miner are not accepted
+
+	SCAN_DEAL_WORKER_COUNT_DEFAULT        = 10
+	SCAN_DEAL_BATCH_SIZE_DEFAULT          = 1000
+	SCAN_DEAL_INTERVAL_MAX_SECOND_DEFAULT = 24 * 60 * 60
+
+	JOB_JITTER_PERCENT      = 10
+	SHUTDOWN_TIMEOUT_SECOND = 5 * 60
+	JOB_LEASE_SECOND_MIN    = 10 * 60
+	ROW_LEASE_SECOND        = 60 * 60 // rows claimed by a crashed instance are picked up again after it
+
+	DISPATCH_EVENT_INTERVAL_SECOND_DEFAULT = 5
+	EVENT_DISPATCH_BATCH_SIZE              = 1000
+	EVENT_ATTEMPT_MAX                      = 5
+	EVENT_RETENTION_SECOND                 = 7 * 24 * 60 * 60
+
+	EVENT_TYPE_UPLOAD_PAID = "UploadPaid" // published by trigger of table source_file_upload, for paid and free uploads
+	EVENT_TYPE_CAR_CREATED = "CarCreated" // swan task created for the car file, including renewal and replica repair
+	EVENT_TYPE_DEAL_SENT   = "DealSent"
+	EVENT_TYPE_DEAL_ACTIVE = "DealActive"
+
+	EVENT_STATUS_PENDING    = "Pending"
+	EVENT_STATUS_DISPATCHED = "Dispatched"
+	EVENT_STATUS_FAILED     = "Failed"
+
+	SWEEP_CAR_CREATION_INTERVAL_SECOND_DEFAULT = 3600
+	CAR_CREATION_JOB_ATTEMPT_MAX               = 3
+	CAR_CREATION_ORPHAN_DIR_SECOND             = 24 * 60 * 60 // work directories not used and not modified for this long are removed
+
+	CAR_CREATION_STEP_CREATED      = "Created"     // work directories recorded, source files being copied
+	CAR_CREATION_STEP_COPIED       = "Copied"      // source files copied to the source directory
+	CAR_CREATION_STEP_CAR_CREATED  = "CarCreated"  // car file created in the car directory
+	CAR_CREATION_STEP_UPLOADED     = "Uploaded"    // car file uploaded and pinned on ipfs
+	CAR_CREATION_STEP_TASK_CREATED = "TaskCreated" // swan task created
+	CAR_CREATION_STEP_SAVED        = "Saved"       // car file saved to db
+
+	CAR_CREATION_JOB_STATUS_RUNNING      = "Running"
+	CAR_CREATION_JOB_STATUS_SUCCEEDED    = "Succeeded"
+	CAR_CREATION_JOB_STATUS_ROLLING_BACK = "RollingBack" // rollback failed, retried by SweepCarCreation
+	CAR_CREATION_JOB_STATUS_ROLLED_BACK  = "RolledBack"
+
+	GC_LOCAL_STORAGE_INTERVAL_SECOND_DEFAULT      = 3600
+	DISK_HIGH_WATERMARK_PERCENT_DEFAULT           = 90
+	DISK_LOW_WATERMARK_PERCENT_DEFAULT            = 80
+	CAR_REPLICA_ACTIVE_MIN_UNDER_PRESSURE_DEFAULT = 1
+
+	GC_ITEM_KIND_SOURCE_FILE = "SourceFile"
+	GC_ITEM_KIND_CAR_FILE    = "CarFile"
+	GC_ITEM_KIND_MULTIPART   = "MultipartUpload"
+
+	HOT_STORAGE_TYPE_IPFS         = "ipfs"         // ipfs kubo node at [ipfs_server].upload_url_prefix
+	HOT_STORAGE_TYPE_IPFS_CLUSTER = "ipfs_cluster" // ipfs cluster rest api
+	HOT_STORAGE_TYPE_LOCAL        = "local"        // files under a local directory
+	HOT_STORAGE_TYPE_MEMORY       = "memory"       // in memory, for testing only
+
+	IPFS_API_TIMEOUT_SECOND                 = 60      // rpc calls of the ipfs node answered in json, such as stat and pin
+	IPFS_API_PIN_TIMEOUT_SECOND             = 60 * 60 // pinning fetches the content not on the node from the network
+	IPFS_API_RESPONSE_HEADER_TIMEOUT_SECOND = 60      // rpc calls reading the content, whose body may take longer
+
+	CAR_FILE_DESC_JSON_FILE_NAME = "car.json" // written to the car directory by go-swan-client, read when creating swan tasks
+
+	DEAL_CLIENT_TYPE_SWAN  = "swan"  // swan auto-bid, miners chosen by swan
+	DEAL_CLIENT_TYPE_LOTUS = "lotus" // lotus ClientStartDeal with manual transfer
+	DEAL_CLIENT_TYPE_BOOST = "boost" // boost json-rpc with http transfer
+	DEAL_CLIENT_TYPE_FAKE  = "fake"  // in memory, no network
+
+	RETRIEVAL_CLIENT_TYPE_LOTUS = "lotus" // lotus ClientRetrieve, exported to local files
+	RETRIEVAL_CLIENT_TYPE_HTTP  = "http"  // piece downloaded from the http endpoint of the miner, the file extracted from the car
+
+	// where the content of a source file upload is retrieved from
+	RETRIEVED_FROM_HOT_STORAGE = "HotStorage"
+	RETRIEVED_FROM_LOCAL       = "Local"
+	RETRIEVED_FROM_FILECOIN    = "Filecoin"
+
+	RETRIEVED_FILE_CACHE_SECOND = 10 * 60 // files retrieved from deals are kept for the requests following the last one
+
+	WALLET_ACCESS_KEY_STATUS_ACTIVE  = "Active"
+	WALLET_ACCESS_KEY_STATUS_REVOKED = "Revoked"
+
+	PROCESS_PIN_REQUEST_INTERVAL_SECOND_DEFAULT = 10
+	PIN_REQUEST_BATCH_SIZE                      = 100
+	PIN_LIST_LIMIT_DEFAULT                      = 10
+	PIN_LIST_LIMIT_MAX                          = 1000
+	PIN_META_KEY_DEAL                           = "mcs_deal" // meta "true" to store the pinned content on filecoin too
+
+	// statuses of the ipfs pinning service api
+	PIN_REQUEST_STATUS_QUEUED  = "queued"
+	PIN_REQUEST_STATUS_PINNING = "pinning"
+	PIN_REQUEST_STATUS_PINNED  = "pinned"
+	PIN_REQUEST_STATUS_FAILED  = "failed"
+
+	RECONCILE_PIN_INTERVAL_SECOND_DEFAULT = 3600
+	RECONCILE_PIN_BATCH_SIZE              = 100
+	PIN_DRIFT_KIND_MISSING                = "Missing"    // pinned in the database but not on the hot storage
+	PIN_DRIFT_KIND_UNEXPECTED             = "Unexpected" // unpinned in the database but still on the hot storage
+	PIN_DRIFT_STATUS_REPAIRED             = "Repaired"
+	PIN_DRIFT_STATUS_FAILED               = "Failed"
+
+	UNPIN_SOURCE_FILE_INTERVAL_SECOND_DEFAULT = 600
+	UNPIN_SOURCE_FILE_BATCH_SIZE              = 100
+	UNPIN_GRACE_PERIOD_HOURS_DEFAULT          = 72
+
+	CHECK_RETRIEVAL_INTERVAL_SECOND_DEFAULT = 6 * 60 * 60
+	RETRIEVAL_CHECK_DEAL_CNT_DEFAULT        = 10                // active deals checked each time
+	RETRIEVAL_CHECK_RANGE_LENGTH_DEFAULT    = 1024 * 1024       // files larger than it are checked by a random range of it
+	RETRIEVAL_CHECK_STAT_WINDOW_SECOND      = 30 * 24 * 60 * 60 // checks counted in the miner reputation
+	RETRIEVAL_CHECK_DEAL_DETAIL_LIMIT       = 10                // latest checks shown in the deal detail
+	MINER_RETRIEVAL_WEIGHT                  = 0.5               // share of the miner score scaled by the retrieval success rate
+	RETRIEVAL_CHECK_MODE_FULL               = "Full"
+	RETRIEVAL_CHECK_MODE_RANGE              = "Range"
+	RETRIEVAL_CHECK_STATUS_SUCCEEDED        = "Succeeded"
+	RETRIEVAL_CHECK_STATUS_FAILED           = "Failed"
+
+	// encryption of the uploads, by the form field encryption of /ipfs/upload
+	ENCRYPTION_TYPE_WALLET        = "wallet"          // data key wrapped to the encryption public key of the wallet
+	ENCRYPTION_TYPE_KMS           = "kms"             // data key wrapped by the kms key of the wallet
+	ENCRYPTION_SCHEME_AES_256_GCM = "aes-256-gcm-64k" // AES-256-GCM sealing each chunk of ENCRYPTION_CHUNK_SIZE
+	ENCRYPTION_CHUNK_SIZE         = 64 * 1024
+	KEY_WRAP_SCHEME_WALLET        = "x25519-xsalsa20-poly1305" // the version of eth_decrypt of metamask
+	KEY_WRAP_SCHEME_KMS           = "kms"
+	KMS_TYPE_LOCAL                = "local" // keys derived from [encryption].kms_master_key
+
+	// kinds of the denylist entries
+	DENYLIST_KIND_CID         = "Cid"        // cid v1 in base32
+	DENYLIST_KIND_DOUBLE_HASH = "DoubleHash" // sha256 in hex of the cid v1 in base32 followed by /, as in the compact denylist format
+	DENYLIST_KIND_SHA256      = "Sha256"     // sha256 in hex of the content
+	DENYLIST_SOURCE_ADMIN     = "admin"      // added by the admin, otherwise the url of the list imported
+
+	SYNC_DENYLIST_INTERVAL_SECOND_DEFAULT = 24 * 60 * 60
+
+	ABUSE_REPORT_STATUS_OPEN      = "Open"
+	ABUSE_REPORT_STATUS_REMOVED   = "Removed"   // content removed
+	ABUSE_REPORT_STATUS_DISMISSED = "Dismissed" // no action taken
+
+	// actions of the abuse report review
+	ABUSE_REPORT_ACTION_REMOVE  = "remove"
+	ABUSE_REPORT_ACTION_DISMISS = "dismiss"
+
+	AUDIT_LOG_ACTOR_ADMIN    = "admin"
+	AUDIT_LOG_ACTOR_SYSTEM   = "system"
+	AUDIT_LOG_ACTOR_REPORTER = "reporter" // anyone reporting abuse
+
+	AUDIT_LOG_ACTION_DENYLIST_ADD        = "DenylistAdd"
+	AUDIT_LOG_ACTION_DENYLIST_REMOVE     = "DenylistRemove"
+	AUDIT_LOG_ACTION_DENYLIST_IMPORT     = "DenylistImport"
+	AUDIT_LOG_ACTION_ABUSE_REPORT_CREATE = "AbuseReportCreate"
+	AUDIT_LOG_ACTION_ABUSE_REPORT_REVIEW = "AbuseReportReview"
+	AUDIT_LOG_ACTION_CONTENT_REMOVE      = "ContentRemove"
+	AUDIT_LOG_ACTION_CONTENT_DENIED      = "ContentDenied"
+	AUDIT_LOG_ACTION_WALLET_BLOCK        = "WalletBlock"
+	AUDIT_LOG_ACTION_WALLET_UNBLOCK      = "WalletUnblock"
+	AUDIT_LOG_TARGET_TYPE_DENYLIST       = "denylist"
+	AUDIT_LOG_TARGET_TYPE_ABUSE_REPORT   = "abuse_report"
+	AUDIT_LOG_TARGET_TYPE_SOURCE_FILE    = "source_file"
+	AUDIT_LOG_TARGET_TYPE_WALLET         = "wallet"
+	AUDIT_LOG_TARGET_TYPE_PAYLOAD_CID    = "payload_cid"
+
+	// hooks scanning the files uploaded before put to the hot storage, run in the order of [scan].hooks
+	SCAN_HOOK_MIME    = "mime"    // sniffs the mime type of the content
+	SCAN_HOOK_POLICY  = "policy"  // max file size and mime types of the tier
+	SCAN_HOOK_MALWARE = "malware" // scans the content by the scanner of [scan].scanner_type
+
+	SCANNER_TYPE_CLAMD = "clamd" // clamav daemon at [scan].clamd_address
+	SCANNER_TYPE_STUB  = "stub"  // flags the eicar test file only, when no clamav daemon is available
+
+	CLAMD_TIMEOUT_SECOND_DEFAULT  = 60
+	MALWARE_MAX_FILE_SIZE_DEFAULT = 25 * 1024 * 1024 // StreamMaxLength of clamd by default
+
+	SCAN_VERDICT_PASSED   = "Passed"
+	SCAN_VERDICT_REJECTED = "Rejected"
+	SCAN_VERDICT_ERROR    = "Error"   // the hook failed, the upload is rejected unless [scan].fail_open
+	SCAN_VERDICT_SKIPPED  = "Skipped" // the hook did not inspect the file, such as a file too large to scan for malware
+
+	SCAN_STATUS_PASSED            = "Passed"
+	SCAN_STATUS_PASSED_WITH_ERROR = "PassedWithError" // some hook failed, passed by [scan].fail_open
+
+	// tiers of the uploads, whose rules are in [scan.tiers.<tier>]
+	SCAN_TIER_FREE = "free" // within the monthly free bytes of the plan of the wallet
+	SCAN_TIER_PAID = "paid"
+
+	AUDIT_LOG_ACTION_UPLOAD_REJECTED = "UploadRejected"
+
+	// plans seeded by create_table.sql, the monthly free bytes and the limits are in table plan
+	PLAN_NAME_FREE       = "free"
+	PLAN_NAME_PRO        = "pro"
+	PLAN_NAME_ENTERPRISE = "enterprise"
+
+	PLAN_SUBJECT_TYPE_WALLET       = "wallet"
+	PLAN_SUBJECT_TYPE_ORGANIZATION = "organization"
+
+	PLAN_CACHE_SECOND = 60 // plans of the wallets and organizations are cached for the rate limits
+
+	AUDIT_LOG_ACTION_PLAN_SAVE   = "PlanSave"
+	AUDIT_LOG_ACTION_PLAN_ASSIGN = "PlanAssign"
+	AUDIT_LOG_TARGET_TYPE_PLAN   = "plan"
+
+	AUDIT_LOG_TARGET_TYPE_ORGANIZATION = "organization"
+
+	// roles of the member wallets of an organization, from the most privileged
+	ORGANIZATION_ROLE_OWNER    = "owner"    // the wallet creating it, manages all the members
+	ORGANIZATION_ROLE_ADMIN    = "admin"    // manages the uploaders and viewers
+	ORGANIZATION_ROLE_UPLOADER = "uploader" // uploads files owned by the organization
+	ORGANIZATION_ROLE_VIEWER   = "viewer"   // views the uploads and billing of the organization
+
+	S3_REGION_DEFAULT                  = "us-east-1"
+	S3_LIST_MAX_KEYS_DEFAULT           = 1000
+	S3_LIST_BATCH_SIZE                 = 1000
+	S3_MULTIPART_PART_SIZE_MIN         = 5 * 1024 * 1024
+	S3_MULTIPART_PART_NUMBER_MAX       = 10000
+	S3_MULTIPART_UPLOAD_EXPIRE_SECOND  = 7 * 24 * 60 * 60 // multipart uploads not completed by then are aborted
+	S3_MULTIPART_UPLOAD_ORPHAN_SECOND  = 60 * 60          // local parts of multipart uploads not recorded are removed after it
+	S3_REQUEST_TIME_SKEW_SECOND_MAX    = 15 * 60
+	S3_PRESIGNED_URL_EXPIRE_SECOND_MAX = 7 * 24 * 60 * 60
+	S3_AWS_CHUNK_SIZE_MAX              = 16 * 1024 * 1024
+	S3_OBJECT_KEY_LEN_MAX              = 1024
+	S3_CONTENT_TYPE_DEFAULT            = "binary/octet-stream"
+
+	BUCKET_FOLDER_DELIMITER = "/" // keys in buckets are paths of folders split by it on the web
+
+	SOURCE_FILE_UPLOAD_TAG_CNT_MAX       = 50
+	SOURCE_FILE_UPLOAD_TAG_KEY_LEN_MAX   = 128
+	SOURCE_FILE_UPLOAD_TAG_VALUE_LEN_MAX = 256
+
+	SEARCH_QUERY_LEN_MAX        = 200
+	SEARCH_SCORE_EXACT_MATCH    = 100 // score of a cid, wcid, tx hash or deal id matched, above those of the words matched
+	SOURCE_FILE_UPLOAD_UUID_LEN = 36  // wcid is the uuid of the upload followed by the payload cid
+
+	SAVE_SOURCE_FILE_UPLOAD_ATTEMPT_MAX = 3 // saving the same new content at the same time may fail on a deadlock or a duplicate key
 )
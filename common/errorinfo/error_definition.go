@@ -6,6 +6,17 @@ const (
 	ERROR_PARAM_INVALID_VALUE   = 10003
 	ERROR_PARAM_PARSE_TO_STRUCT = 10004
 	ERROR_INTERNAL              = 20001
+	ERROR_UNAUTHORIZED          = 30001
+
+	// uploads rejected by the scan hooks
+	ERROR_UPLOAD_REJECTED_FILE_SIZE = 40001
+	ERROR_UPLOAD_REJECTED_MIME_TYPE = 40002
+	ERROR_UPLOAD_REJECTED_MALWARE   = 40003
+	ERROR_UPLOAD_SCAN_FAILED        = 40004
+
+	// limits of the plan of the wallet
+	ERROR_RATE_LIMITED        = 50001
+	ERROR_PLAN_LIMIT_EXCEEDED = 50002
 )
 
 var errorMap map[int]string
@@ -17,6 +28,15 @@ func init() {
 		ERROR_PARAM_INVALID_VALUE:   "invalid param value",
 		ERROR_PARAM_PARSE_TO_STRUCT: "params parse to structure fail",
 		ERROR_INTERNAL:              "Internal error",
+		ERROR_UNAUTHORIZED:          "unauthorized",
+
+		ERROR_UPLOAD_REJECTED_FILE_SIZE: "file size not allowed",
+		ERROR_UPLOAD_REJECTED_MIME_TYPE: "file type not allowed",
+		ERROR_UPLOAD_REJECTED_MALWARE:   "malware detected",
+		ERROR_UPLOAD_SCAN_FAILED:        "file scan failed",
+
+		ERROR_RATE_LIMITED:        "too many requests",
+		ERROR_PLAN_LIMIT_EXCEEDED: "plan limit exceeded",
 	}
 }
 
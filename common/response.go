@@ -8,6 +8,7 @@ import (
 
 type Response struct {
 	Status  string      `json:"status"`
+	Code    int         `json:"code,omitempty"` // code from errorinfo of the error
 	Data    interface{} `json:"data,omitempty"`
 	Message string      `json:"message,omitempty"`
 }
@@ -32,6 +33,7 @@ func CreateErrorResponse(errCode int, errMsg ...string) Response {
 	}
 	return Response{
 		Status:  constants.HTTP_STATUS_ERROR,
+		Code:    errCode,
 		Message: message,
 	}
 }
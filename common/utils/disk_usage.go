@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"syscall"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+type DiskUsage struct {
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// GetDiskUsage returns the usage of the file system the dir is on
+func GetDiskUsage(dir string) (*DiskUsage, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	total := uint64(stat.Blocks) * uint64(stat.Bsize)
+	free := uint64(stat.Bavail) * uint64(stat.Bsize)
+	diskUsage := DiskUsage{
+		Total: total,
+		Used:  total - free,
+	}
+	if total > 0 {
+		diskUsage.UsedPercent = float64(diskUsage.Used) * 100 / float64(total)
+	}
+
+	return &diskUsage, nil
+}
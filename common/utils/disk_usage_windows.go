@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+type DiskUsage struct {
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+func GetDiskUsage(dir string) (*DiskUsage, error) {
+	err := fmt.Errorf("disk usage of %s not supported on windows", dir)
+	logs.GetLogger().Error(err)
+	return nil, err
+}
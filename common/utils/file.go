@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,9 +11,11 @@ import (
 const (
 	LOTUS_JSON_RPC_ID      = 7878
 	LOTUS_JSON_RPC_VERSION = "2.0"
+
+	LOTUS_MESSAGE_DEAL_NOT_FOUND = "not found" // in the error of StateMarketStorageDeal for the deals not in the market state
 )
 
-func DownloadFile(sourceUrl string, destFilepath string) error {
+func DownloadFile(ctx context.Context, sourceUrl string, destFilepath string) error {
 	// Create the file
 	out, err := os.Create(destFilepath)
 	if err != nil {
@@ -20,8 +23,13 @@ func DownloadFile(sourceUrl string, destFilepath string) error {
 	}
 	defer out.Close()
 
-	// Get the data
-	resp, err := http.Get(sourceUrl)
+	// Get the data, cancelled once ctx is done
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
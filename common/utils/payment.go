@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/client/web"
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const (
+	EVM_TX_STATUS_SUCCESS = "0x1"
+
+	// first 4 bytes of keccak256("getLockedPaymentInfo(string)")
+	EVM_METHOD_ID_GET_LOCKED_PAYMENT_INFO = "e063922b"
+
+	evmWordSize = 32
+)
+
+type EvmJsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type EvmTxReceipt struct {
+	TransactionHash string `json:"transactionHash"`
+	BlockNumber     string `json:"blockNumber"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Status          string `json:"status"`
+}
+
+type evmTxReceiptResponse struct {
+	Result *EvmTxReceipt    `json:"result"`
+	Error  *EvmJsonRpcError `json:"error"`
+}
+
+// GetEvmTxReceipt returns the receipt of the tx from the json rpc api of the payment chain, nil if the tx is not mined yet
+func GetEvmTxReceipt(rpcUrl, txHash string) (*EvmTxReceipt, error) {
+	jsonRpcParams := LotusJsonRpcParams{
+		JsonRpc: LOTUS_JSON_RPC_VERSION,
+		Method:  "eth_getTransactionReceipt",
+		Params:  []interface{}{txHash},
+		Id:      LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := web.HttpPostNoToken(rpcUrl, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var receiptResponse evmTxReceiptResponse
+	err = json.Unmarshal(response, &receiptResponse)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if receiptResponse.Error != nil {
+		err := fmt.Errorf("get receipt of tx:%s failed, code:%d,message:%s", txHash, receiptResponse.Error.Code, receiptResponse.Error.Message)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return receiptResponse.Result, nil
+}
+
+// LockedPaymentInfo is the payment locked in the payment contract for an id, as returned by getLockedPaymentInfo
+type LockedPaymentInfo struct {
+	Token       string
+	MinPayment  *big.Int
+	LockedFee   *big.Int
+	Owner       string
+	Recipient   string
+	IsExisted   bool
+	BlockNumber *big.Int
+}
+
+type evmCallResponse struct {
+	Result *string          `json:"result"`
+	Error  *EvmJsonRpcError `json:"error"`
+}
+
+// GetLockedPaymentInfo calls getLockedPaymentInfo of the payment contract for the id at the latest block
+func GetLockedPaymentInfo(rpcUrl, contractAddress, id string) (*LockedPaymentInfo, error) {
+	callParams := map[string]string{
+		"to":   contractAddress,
+		"data": "0x" + EVM_METHOD_ID_GET_LOCKED_PAYMENT_INFO + encodeEvmStringParam(id),
+	}
+
+	jsonRpcParams := LotusJsonRpcParams{
+		JsonRpc: LOTUS_JSON_RPC_VERSION,
+		Method:  "eth_call",
+		Params:  []interface{}{callParams, "latest"},
+		Id:      LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := web.HttpPostNoToken(rpcUrl, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var callResponse evmCallResponse
+	err = json.Unmarshal(response, &callResponse)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if callResponse.Error != nil {
+		err := fmt.Errorf("get locked payment info of:%s failed, code:%d,message:%s", id, callResponse.Error.Code, callResponse.Error.Message)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if callResponse.Result == nil {
+		err := fmt.Errorf("no locked payment info returned for:%s", id)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	lockedPaymentInfo, err := decodeLockedPaymentInfo(*callResponse.Result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return lockedPaymentInfo, nil
+}
+
+// encodeEvmStringParam abi encodes a string as the only param of a call, in hex without 0x
+func encodeEvmStringParam(value string) string {
+	length := len(value)
+	paddedLength := (length + evmWordSize - 1) / evmWordSize * evmWordSize
+
+	encoded := make([]byte, evmWordSize*2+paddedLength)
+	big.NewInt(evmWordSize).FillBytes(encoded[:evmWordSize])
+	big.NewInt(int64(length)).FillBytes(encoded[evmWordSize : evmWordSize*2])
+	copy(encoded[evmWordSize*2:], value)
+
+	return hex.EncodeToString(encoded)
+}
+
+// decodeLockedPaymentInfo decodes the TxInfo tuple returned by getLockedPaymentInfo, its fields are: id, token,
+// minPayment, lockedFee, owner, recipient, deadline, _isExisted, size, copyLimit, blockNumber
+func decodeLockedPaymentInfo(result string) (*LockedPaymentInfo, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(data) < evmWordSize {
+		err := fmt.Errorf("locked payment info:%s too short", result)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	tupleOffset := new(big.Int).SetBytes(data[:evmWordSize])
+	if !tupleOffset.IsInt64() || tupleOffset.Int64()+evmWordSize*11 > int64(len(data)) {
+		err := fmt.Errorf("locked payment info:%s too short", result)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	tuple := data[tupleOffset.Int64():]
+	word := func(index int) []byte {
+		return tuple[index*evmWordSize : (index+1)*evmWordSize]
+	}
+	address := func(index int) string {
+		return "0x" + hex.EncodeToString(word(index)[evmWordSize-20:])
+	}
+
+	lockedPaymentInfo := &LockedPaymentInfo{
+		Token:       address(1),
+		MinPayment:  new(big.Int).SetBytes(word(2)),
+		LockedFee:   new(big.Int).SetBytes(word(3)),
+		Owner:       address(4),
+		Recipient:   address(5),
+		IsExisted:   new(big.Int).SetBytes(word(7)).Sign() != 0,
+		BlockNumber: new(big.Int).SetBytes(word(10)),
+	}
+
+	return lockedPaymentInfo, nil
+}
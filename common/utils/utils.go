@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/config"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -78,8 +82,15 @@ func GetSystemParam(web3ApiUrlPrefix string) (*SystemParam, error) {
 
 type DealState struct {
 	Result *struct {
+		Proposal struct {
+			PieceSize            int64
+			StoragePricePerEpoch string
+			StartEpoch           int64
+			EndEpoch             int64
+		}
 		State struct {
 			SectorStartEpoch int
+			SlashEpoch       int64
 		}
 	} `json:"result"`
 	Error *struct {
@@ -95,7 +106,82 @@ type LotusJsonRpcParams struct {
 	Id      int           `json:"id"`
 }
 
-func IsDealActive(dealId int64) (*bool, error) {
+// HttpPostJsonRpc posts the json rpc request to the api, with the access token if not empty, the request is cancelled
+// once ctx is done. The body is returned whatever the status, since the errors of the methods are in it
+func HttpPostJsonRpc(ctx context.Context, apiUrl, accessToken string, jsonRpcParams LotusJsonRpcParams) ([]byte, error) {
+	requestBody, err := json.Marshal(jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, apiUrl, bytes.NewReader(requestBody))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK && !json.Valid(responseBody) {
+		err := fmt.Errorf("%s of %s failed, status:%s", jsonRpcParams.Method, apiUrl, response.Status)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return responseBody, nil
+}
+
+func IsDealActive(ctx context.Context, dealId int64) (*bool, error) {
+	dealState, err := GetDealState(ctx, dealId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if dealState.Error != nil {
+		if !IsDealNotFound(dealState) {
+			err := fmt.Errorf("get state of deal:%d failed, code:%d,message:%s", dealId, dealState.Error.Code, dealState.Error.Message)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		message := fmt.Sprintf("no deal state, code:%d,message:%s", dealState.Error.Code, dealState.Error.Message)
+		logs.GetLogger().Info(message)
+		dealStateBool := false
+		return &dealStateBool, nil
+	}
+
+	dealStateBool := dealState.Result.State.SectorStartEpoch > -1
+
+	return &dealStateBool, nil
+}
+
+// IsDealNotFound returns whether the error of the deal state is lotus telling the deal is not in the market state,
+// other errors do not tell anything about the deal
+func IsDealNotFound(dealState *DealState) bool {
+	return dealState.Error != nil && strings.Contains(dealState.Error.Message, LOTUS_MESSAGE_DEAL_NOT_FOUND)
+}
+
+// GetDealState returns the market state of a deal, when the deal is not in the market state(never published, slashed or expired),
+// the Error field of the result is set
+func GetDealState(ctx context.Context, dealId int64) (*DealState, error) {
 	lotusApiUrl := config.GetConfig().Lotus.ClientApiUrl
 
 	var params []interface{}
@@ -109,7 +195,7 @@ func IsDealActive(dealId int64) (*bool, error) {
 		Id:      LOTUS_JSON_RPC_ID,
 	}
 
-	response, err := web.HttpGetNoToken(lotusApiUrl, jsonRpcParams)
+	response, err := HttpPostJsonRpc(ctx, lotusApiUrl, "", jsonRpcParams)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -122,16 +208,61 @@ func IsDealActive(dealId int64) (*bool, error) {
 		return nil, err
 	}
 
-	if dealState.Error != nil {
-		message := fmt.Sprintf("no deal state, code:%d,message:%s", dealState.Error.Code, dealState.Error.Message)
-		logs.GetLogger().Info(message)
-		dealStateBool := false
-		return &dealStateBool, nil
+	if dealState.Error == nil && dealState.Result == nil {
+		err := fmt.Errorf("no result returned for deal:%d", dealId)
+		logs.GetLogger().Error(err)
+		return nil, err
 	}
 
-	dealStateBool := dealState.Result.State.SectorStartEpoch > -1
+	return &dealState, nil
+}
 
-	return &dealStateBool, nil
+type ChainHead struct {
+	Result *struct {
+		Height int64
+	} `json:"result"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func GetCurrentEpoch(ctx context.Context) (*int64, error) {
+	lotusApiUrl := config.GetConfig().Lotus.ClientApiUrl
+
+	jsonRpcParams := LotusJsonRpcParams{
+		JsonRpc: LOTUS_JSON_RPC_VERSION,
+		Method:  "Filecoin.ChainHead",
+		Params:  []interface{}{},
+		Id:      LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := HttpPostJsonRpc(ctx, lotusApiUrl, "", jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var chainHead ChainHead
+	err = json.Unmarshal(response, &chainHead)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if chainHead.Error != nil {
+		err := fmt.Errorf("get chain head failed, code:%d,message:%s", chainHead.Error.Code, chainHead.Error.Message)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if chainHead.Result == nil {
+		err := fmt.Errorf("no chain head returned")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &chainHead.Result.Height, nil
 }
 
 func GetMonthStart() int64 {
@@ -140,3 +271,9 @@ func GetMonthStart() int64 {
 	monthStartUtc := monthStart.Unix()
 	return monthStartUtc
 }
+
+// EscapeLike escapes the wildcards of like in the value, so that it is matched as it is
+func EscapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return replacer.Replace(value)
+}
@@ -16,18 +16,31 @@ import (
 type Configuration struct {
 	Port                     int          `toml:"port"`
 	Release                  bool         `toml:"release"`
+	AdminToken               string       `toml:"admin_token"`
 	FilecoinNetwork          string       `toml:"filecoin_network"`
 	FilecoinWallet           string       `toml:"filecoin_wallet"`
 	FlinkUrl                 string       `toml:"flink_url"`
 	Web3ApiUrlPolygonMumbai  string       `toml:"web3_api_url_polygon_mumbai"`
 	Web3ApiUrlBscTestnet     string       `toml:"web3_api_url_bsc_testnet"`
 	Web3ApiUrlPolygonMainnet string       `toml:"web3_api_url_polygon_mainnet"`
+	PaymentChainRpcUrl       string       `toml:"payment_chain_rpc_url"` // json rpc api of the payment chain, to verify the payments
 	Database                 database     `toml:"database"`
 	SwanApi                  swanApi      `toml:"swan_api"`
 	Lotus                    lotus        `toml:"lotus"`
 	IpfsServer               ipfsServer   `toml:"ipfs_server"`
 	SwanTask                 swanTask     `toml:"swan_task"`
 	ScheduleRule             ScheduleRule `toml:"schedule_rule"`
+	Renewal                  renewal      `toml:"renewal"`
+	DealClient               dealClient   `toml:"deal_client"`
+	HotStorage               hotStorage   `toml:"hot_storage"`
+	Retention                retention    `toml:"retention"`
+	S3Gateway                s3Gateway    `toml:"s3_gateway"`
+	Retrieval                retrieval    `toml:"retrieval"`
+	Unpin                    unpin        `toml:"unpin"`
+	Encryption               encryption   `toml:"encryption"`
+	Denylist                 denylist     `toml:"denylist"`
+	Scan                     scan         `toml:"scan"`
+	Plan                     plan         `toml:"plan"`
 	PaymentChainName         string
 }
 
@@ -56,6 +69,7 @@ type swanTask struct {
 	StartEpochHours  int             `toml:"start_epoch_hours"`
 	MinFileSize      int64           `toml:"min_file_size"`
 	MaxFileNumPerCar int             `toml:"max_file_num_per_car"`
+	ReplicaCount     int             `toml:"replica_count"`
 }
 
 type swanApi struct {
@@ -69,10 +83,102 @@ type ipfsServer struct {
 	UploadUrlPrefix   string `toml:"upload_url_prefix"`
 }
 
+type renewal struct {
+	WindowDays int `toml:"window_days"`
+}
+
+type hotStorage struct {
+	Type               string   `toml:"type"`
+	ClusterApiUrl      string   `toml:"cluster_api_url"`
+	ClusterAccessToken string   `toml:"cluster_access_token"`
+	LocalDir           string   `toml:"local_dir"`
+	DownloadUrlPrefix  string   `toml:"download_url_prefix"`
+	Delegates          []string `toml:"delegates"`
+}
+
+type retention struct {
+	DryRun                           bool `toml:"dry_run"`
+	KeepSrcFiles                     bool `toml:"keep_src_files"`
+	KeepCarFiles                     bool `toml:"keep_car_files"`
+	CarReplicaActiveMin              int  `toml:"car_replica_active_min"`
+	CarReplicaActiveMinUnderPressure int  `toml:"car_replica_active_min_under_pressure"`
+	DiskHighWatermarkPercent         int  `toml:"disk_high_watermark_percent"`
+	DiskLowWatermarkPercent          int  `toml:"disk_low_watermark_percent"`
+}
+
+type retrieval struct {
+	Type             string            `toml:"type"`
+	MinerUrls        map[string]string `toml:"miner_urls"` // miner fid to the url of its http retrieval endpoint
+	CheckDealCount   int               `toml:"check_deal_count"`
+	CheckRangeLength int64             `toml:"check_range_length"`
+}
+
+type unpin struct {
+	GracePeriodHours    int  `toml:"grace_period_hours"`
+	KeepUntilDealActive bool `toml:"keep_until_deal_active"`
+}
+
+type encryption struct {
+	KmsType      string `toml:"kms_type"`
+	KmsMasterKey string `toml:"kms_master_key"` // 32 bytes in hex, for the local kms
+}
+
+type denylist struct {
+	Urls []string `toml:"urls"` // lists in the compact denylist format, imported by the job SyncDenylist
+}
+
+type scan struct {
+	Hooks              []string            `toml:"hooks"`     // in the order run, default: mime, policy
+	FailOpen           bool                `toml:"fail_open"` // accept the upload when a hook fails
+	ScannerType        string              `toml:"scanner_type"`
+	ClamdAddress       string              `toml:"clamd_address"` // tcp://host:port or unix:///path
+	ClamdTimeoutSecond int                 `toml:"clamd_timeout_second"`
+	MalwareMaxFileSize int64               `toml:"malware_max_file_size"` // larger files are not scanned for malware, no limit if negative
+	Tiers              map[string]ScanTier `toml:"tiers"`
+}
+
+// ScanTier is the rule of the uploads of the tier, no limit if not set
+type ScanTier struct {
+	MaxFileSize      int64    `toml:"max_file_size"`
+	AllowedMimeTypes []string `toml:"allowed_mime_types"` // such as image/*, any type if empty
+	DeniedMimeTypes  []string `toml:"denied_mime_types"`
+}
+
+type plan struct {
+	DefaultPlan string `toml:"default_plan"` // plan of the wallets not assigned one
+}
+
+type s3Gateway struct {
+	Port   int    `toml:"port"` // 0 to disable the gateway
+	Region string `toml:"region"`
+}
+
+type dealClient struct {
+	Type                 string            `toml:"type"`
+	MinerFids            []string          `toml:"miner_fids"`
+	BoostApiUrls         map[string]string `toml:"boost_api_urls"`      // miner fid to the json-rpc url of its boost node
+	BoostAccessTokens    map[string]string `toml:"boost_access_tokens"` // miner fid to the admin token of its boost node
+	CarDownloadUrlPrefix string            `toml:"car_download_url_prefix"`
+}
+
 type ScheduleRule struct {
-	CreateTaskIntervalSecond     time.Duration `toml:"create_task_interval_second"`
-	SendDealIntervalSecond       time.Duration `toml:"send_deal_interval_second"`
-	ScanDealStatusIntervalSecond time.Duration `toml:"scan_deal_status_interval_second"`
+	CreateTaskIntervalSecond            time.Duration `toml:"create_task_interval_second"`
+	SendDealIntervalSecond              time.Duration `toml:"send_deal_interval_second"`
+	ScanDealStatusIntervalSecond        time.Duration `toml:"scan_deal_status_interval_second"`
+	ScanDealIntervalMaxSecond           time.Duration `toml:"scan_deal_interval_max_second"`
+	ScanDealWorkerCount                 int           `toml:"scan_deal_worker_count"`
+	ScanDealBatchSize                   int           `toml:"scan_deal_batch_size"`
+	MonitorReplicaIntervalSecond        time.Duration `toml:"monitor_replica_interval_second"`
+	DispatchEventIntervalSecond         time.Duration `toml:"dispatch_event_interval_second"`
+	SweepCarCreationIntervalSecond      time.Duration `toml:"sweep_car_creation_interval_second"`
+	GcLocalStorageIntervalSecond        time.Duration `toml:"gc_local_storage_interval_second"`
+	ProcessPinRequestIntervalSecond     time.Duration `toml:"process_pin_request_interval_second"`
+	ReconcilePinIntervalSecond          time.Duration `toml:"reconcile_pin_interval_second"`
+	UnpinSourceFileIntervalSecond       time.Duration `toml:"unpin_source_file_interval_second"`
+	CheckRetrievalIntervalSecond        time.Duration `toml:"check_retrieval_interval_second"`
+	SyncDenylistIntervalSecond          time.Duration `toml:"sync_denylist_interval_second"`
+	ScanRenewalIntervalSecond           time.Duration `toml:"scan_renewal_interval_second"`
+	UpdateMinerReputationIntervalSecond time.Duration `toml:"update_miner_reputation_interval_second"`
 }
 
 var config *Configuration
@@ -101,6 +207,149 @@ func InitConfig(paymentChainName string) {
 	}
 
 	config.PaymentChainName = paymentChainName
+
+	setDefaultValues()
+}
+
+func setDefaultValues() {
+	if config.SwanTask.ReplicaCount <= 0 {
+		config.SwanTask.ReplicaCount = constants.REPLICA_COUNT_DEFAULT
+	}
+
+	if config.ScheduleRule.MonitorReplicaIntervalSecond <= 0 {
+		config.ScheduleRule.MonitorReplicaIntervalSecond = constants.MONITOR_REPLICA_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.DispatchEventIntervalSecond <= 0 {
+		config.ScheduleRule.DispatchEventIntervalSecond = constants.DISPATCH_EVENT_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.SweepCarCreationIntervalSecond <= 0 {
+		config.ScheduleRule.SweepCarCreationIntervalSecond = constants.SWEEP_CAR_CREATION_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.ScanRenewalIntervalSecond <= 0 {
+		config.ScheduleRule.ScanRenewalIntervalSecond = constants.SCAN_RENEWAL_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.UpdateMinerReputationIntervalSecond <= 0 {
+		config.ScheduleRule.UpdateMinerReputationIntervalSecond = constants.UPDATE_MINER_REPUTATION_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.ScanDealIntervalMaxSecond < config.ScheduleRule.ScanDealStatusIntervalSecond {
+		config.ScheduleRule.ScanDealIntervalMaxSecond = constants.SCAN_DEAL_INTERVAL_MAX_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.ScanDealWorkerCount <= 0 {
+		config.ScheduleRule.ScanDealWorkerCount = constants.SCAN_DEAL_WORKER_COUNT_DEFAULT
+	}
+
+	if config.ScheduleRule.ScanDealBatchSize <= 0 {
+		config.ScheduleRule.ScanDealBatchSize = constants.SCAN_DEAL_BATCH_SIZE_DEFAULT
+	}
+
+	if config.DealClient.Type == "" {
+		config.DealClient.Type = constants.DEAL_CLIENT_TYPE_SWAN
+	}
+
+	if config.HotStorage.Type == "" {
+		config.HotStorage.Type = constants.HOT_STORAGE_TYPE_IPFS
+	}
+
+	if config.HotStorage.DownloadUrlPrefix == "" {
+		config.HotStorage.DownloadUrlPrefix = config.IpfsServer.DownloadUrlPrefix
+	}
+
+	if config.ScheduleRule.GcLocalStorageIntervalSecond <= 0 {
+		config.ScheduleRule.GcLocalStorageIntervalSecond = constants.GC_LOCAL_STORAGE_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.ProcessPinRequestIntervalSecond <= 0 {
+		config.ScheduleRule.ProcessPinRequestIntervalSecond = constants.PROCESS_PIN_REQUEST_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.ReconcilePinIntervalSecond <= 0 {
+		config.ScheduleRule.ReconcilePinIntervalSecond = constants.RECONCILE_PIN_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.UnpinSourceFileIntervalSecond <= 0 {
+		config.ScheduleRule.UnpinSourceFileIntervalSecond = constants.UNPIN_SOURCE_FILE_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.CheckRetrievalIntervalSecond <= 0 {
+		config.ScheduleRule.CheckRetrievalIntervalSecond = constants.CHECK_RETRIEVAL_INTERVAL_SECOND_DEFAULT
+	}
+
+	if config.ScheduleRule.SyncDenylistIntervalSecond <= 0 {
+		config.ScheduleRule.SyncDenylistIntervalSecond = constants.SYNC_DENYLIST_INTERVAL_SECOND_DEFAULT
+	}
+
+	if len(config.Scan.Hooks) == 0 {
+		config.Scan.Hooks = []string{constants.SCAN_HOOK_MIME, constants.SCAN_HOOK_POLICY}
+	}
+
+	if config.Scan.ScannerType == "" {
+		config.Scan.ScannerType = constants.SCANNER_TYPE_STUB
+	}
+
+	if config.Scan.ClamdTimeoutSecond <= 0 {
+		config.Scan.ClamdTimeoutSecond = constants.CLAMD_TIMEOUT_SECOND_DEFAULT
+	}
+
+	if config.Scan.MalwareMaxFileSize == 0 {
+		config.Scan.MalwareMaxFileSize = constants.MALWARE_MAX_FILE_SIZE_DEFAULT
+	}
+
+	if config.Plan.DefaultPlan == "" {
+		config.Plan.DefaultPlan = constants.PLAN_NAME_FREE
+	}
+
+	if config.Unpin.GracePeriodHours <= 0 {
+		config.Unpin.GracePeriodHours = constants.UNPIN_GRACE_PERIOD_HOURS_DEFAULT
+	}
+
+	if config.Retrieval.Type == "" {
+		config.Retrieval.Type = constants.RETRIEVAL_CLIENT_TYPE_LOTUS
+	}
+
+	if config.Encryption.KmsType == "" {
+		config.Encryption.KmsType = constants.KMS_TYPE_LOCAL
+	}
+
+	if config.Retrieval.CheckDealCount <= 0 {
+		config.Retrieval.CheckDealCount = constants.RETRIEVAL_CHECK_DEAL_CNT_DEFAULT
+	}
+
+	if config.Retrieval.CheckRangeLength <= 0 {
+		config.Retrieval.CheckRangeLength = constants.RETRIEVAL_CHECK_RANGE_LENGTH_DEFAULT
+	}
+
+	if config.Retention.CarReplicaActiveMin <= 0 {
+		config.Retention.CarReplicaActiveMin = config.SwanTask.ReplicaCount
+	}
+
+	if config.Retention.CarReplicaActiveMinUnderPressure <= 0 {
+		config.Retention.CarReplicaActiveMinUnderPressure = constants.CAR_REPLICA_ACTIVE_MIN_UNDER_PRESSURE_DEFAULT
+	}
+
+	if config.Retention.DiskHighWatermarkPercent <= 0 || config.Retention.DiskHighWatermarkPercent > 100 {
+		config.Retention.DiskHighWatermarkPercent = constants.DISK_HIGH_WATERMARK_PERCENT_DEFAULT
+	}
+
+	if config.Retention.DiskLowWatermarkPercent <= 0 || config.Retention.DiskLowWatermarkPercent >= config.Retention.DiskHighWatermarkPercent {
+		config.Retention.DiskLowWatermarkPercent = constants.DISK_LOW_WATERMARK_PERCENT_DEFAULT
+		if config.Retention.DiskLowWatermarkPercent >= config.Retention.DiskHighWatermarkPercent {
+			config.Retention.DiskLowWatermarkPercent = config.Retention.DiskHighWatermarkPercent / 2
+		}
+	}
+
+	if config.S3Gateway.Region == "" {
+		config.S3Gateway.Region = constants.S3_REGION_DEFAULT
+	}
+
+	if config.Renewal.WindowDays <= 0 {
+		config.Renewal.WindowDays = constants.RENEWAL_WINDOW_DAYS_DEFAULT
+	}
 }
 
 func GetConfig() Configuration {
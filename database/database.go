@@ -2,15 +2,21 @@ package database
 
 import (
 	"context"
+	"errors"
 	"multi-chain-storage/config"
 
 	"github.com/filswan/go-swan-lib/logs"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
 )
 
+const (
+	MYSQL_ER_DUP_ENTRY     = 1062
+	MYSQL_ER_LOCK_DEADLOCK = 1213
+)
+
 type Database struct {
 	*gorm.DB
 }
@@ -84,7 +90,11 @@ func SaveOneWithTransaction(data interface{}) error {
 }
 
 func GetDBTransaction() *gorm.DB {
-	ctx := context.Background()
+	return GetDBTransactionContext(context.Background())
+}
+
+// GetDBTransactionContext begins a transaction rolled back once ctx is done before it is committed
+func GetDBTransactionContext(ctx context.Context) *gorm.DB {
 	db := GetDB().BeginTx(ctx, nil)
 	return db
 }
@@ -95,3 +105,14 @@ func CloseDB(db *gorm.DB) {
 		logs.GetLogger().Error(err)
 	}
 }
+
+// IsRetryableError returns whether the transaction failed on a deadlock or a duplicate key, such as when two transactions
+// insert the same new row after locking its gap, the transaction may succeed when run again
+func IsRetryableError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+
+	return mysqlErr.Number == MYSQL_ER_DUP_ENTRY || mysqlErr.Number == MYSQL_ER_LOCK_DEADLOCK
+}
@@ -49,6 +49,7 @@ create table wallet (
     address       varchar(100) not null,
     is_dao        boolean,
     nonce         varchar(64),
+    is_blocked    boolean      not null default false,
     create_at     bigint       not null,
     update_at     bigint       not null,
     primary key pk_wallet(id),
@@ -58,12 +59,28 @@ create table wallet (
 create index ind_wallet_is_dao on wallet(is_dao);
 
 create table miner (
-    id            bigint       not null auto_increment,
-    fid           varchar(100) not null,
-    create_at     bigint       not null,
+    id                bigint        not null auto_increment,
+    fid               varchar(100)  not null,
+    status            varchar(100)  not null default 'Normal',
+    deal_cnt          int           not null default 0,
+    deal_active_cnt   int           not null default 0,
+    deal_failed_cnt   int           not null default 0,
+    deal_slashed_cnt  int           not null default 0,
+    success_rate      double        not null default 0,
+    avg_active_second bigint        not null default 0,
+    price             varchar(100),
+    score             double        not null default 0,
+    note              text,
+    retrieval_check_cnt      int    not null default 0,
+    retrieval_success_rate   double not null default 0,
+    avg_retrieval_latency_ms bigint not null default 0,
+    create_at         bigint        not null,
+    update_at         bigint        not null default 0,
     primary key pk_miner(id)
 );
 
+create index ind_miner_status on miner(status);
+
 create table source_file (
     id            bigint        not null auto_increment,
     payload_cid   varchar(100)  not null,
@@ -72,6 +89,11 @@ create table source_file (
     file_size     bigint        not null,
     dataset       varchar(100),
     pin_status    varchar(100)  not null,
+    local_deleted_at bigint,                #--local copy under dir_deal deleted by GcLocalStorage
+    mime_type     varchar(200),             #--sniffed by the scan hooks
+    scan_status   varchar(100),             #--Passed,PassedWithError, null if not scanned
+    scan_verdicts text,                     #--verdicts of the scan hooks in json
+    scanned_at    bigint,
     create_at     bigint        not null,
     update_at     bigint        not null,
     primary key pk_source_file(id),
@@ -89,7 +111,17 @@ create table source_file_upload (
     status         varchar(100)  not null,
     duration       int           not null,  #--unit:day
     pin_status     varchar(100)  not null,
+    unpin_at       bigint,                  #--when the unpin scheduled is due, undoable till then
     is_free        boolean       not null,
+    encryption_scheme varchar(100),         #--null if not encrypted, aes-256-gcm-64k
+    key_wrap_scheme   varchar(100),         #--x25519-xsalsa20-poly1305 to the wallet, kms
+    wrapped_key       text,                 #--the data key wrapped
+    kms_key_id        varchar(200),
+    plain_file_size   bigint,               #--size before encrypted
+    content_sha256    varchar(100),         #--of the content uploaded, before encrypted
+    blocked_at        bigint,               #--content removed by the admin, not stored
+    lease_owner    varchar(200),            #--instance handling it, see job_lease
+    lease_expire_at bigint,
     create_at      bigint        not null,
     update_at      bigint        not null,
     primary key pk_source_file_upload(id),
@@ -98,6 +130,8 @@ create table source_file_upload (
     constraint fk_source_file_upload_wallet_id foreign key (wallet_id) references wallet(id)
 );
 
+create index ind_source_file_upload_pin_status_unpin_at on source_file_upload(pin_status,unpin_at);
+
 
 create table source_file_mint (
     id                    bigint        not null auto_increment,
@@ -123,6 +157,9 @@ create table car_file (
     max_price          varchar(100)  not null,
     status             varchar(100)  not null,
     is_free            boolean       not null,
+    local_deleted_at   bigint,                  #--local copy under dir_deal deleted by GcLocalStorage
+    lease_owner        varchar(200),
+    lease_expire_at    bigint,
     create_at          bigint        not null,
     update_at          bigint        not null,
     primary key pk_car_file(id)
@@ -153,6 +190,9 @@ create table offline_deal (
     unlock_tx_hash   varchar(100),
     unlock_at        bigint,
     note             text,
+    next_scan_at     bigint,
+    scan_interval    bigint        not null default 0,  #--unit:second, doubled while the status is not changed
+    end_epoch        bigint,                            #--from the market state, once the deal is active
     create_at        bigint        not null,
     update_at        bigint        not null,
     primary key pk_offline_deal(id),
@@ -162,6 +202,8 @@ create table offline_deal (
     constraint fk_offline_deal_sender_wallet_id foreign key (sender_wallet_id) references wallet(id)
 );
 
+create index ind_offline_deal_next_scan_at on offline_deal(next_scan_at);
+
 create table offline_deal_log (
     id               bigint        not null auto_increment,
     offline_deal_id  bigint        not null,
@@ -256,6 +298,381 @@ create table dao_signature_source_file_upload (
     constraint fk_dao_signature_source_file_upload_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id)
 );
 
+create table replica_repair (
+    id                 bigint        not null auto_increment,
+    car_file_id        bigint        not null,
+    active_replica_cnt int           not null,
+    target_replica_cnt int           not null,
+    task_uuid          varchar(100)  not null,
+    status             varchar(100)  not null,
+    note               text,
+    create_at          bigint        not null,
+    update_at          bigint        not null,
+    primary key pk_replica_repair(id),
+    constraint fk_replica_repair_car_file_id foreign key (car_file_id) references car_file(id)
+);
+
+create table renewal (
+    id                    bigint        not null auto_increment,
+    uuid                  varchar(100)  not null,
+    source_file_upload_id bigint        not null,
+    car_file_id           bigint        not null,
+    car_file_id_renewed   bigint,
+    end_epoch             bigint        not null,
+    duration              int           not null,  #--unit:day
+    pay_amount            varchar(100)  not null,
+    pay_tx_hash           varchar(100),
+    status                varchar(100)  not null,
+    note                  text,
+    attempt_cnt           int           not null default 0,
+    next_attempt_at       bigint,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_renewal(id),
+    constraint un_renewal unique(source_file_upload_id,car_file_id),
+    constraint un_renewal_pay_tx_hash unique(pay_tx_hash),
+    constraint fk_renewal_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id),
+    constraint fk_renewal_car_file_id foreign key (car_file_id) references car_file(id),
+    constraint fk_renewal_car_file_id_renewed foreign key (car_file_id_renewed) references car_file(id)
+);
+
+create table job_lease (
+    id         bigint        not null auto_increment,
+    name       varchar(100)  not null,
+    owner      varchar(200)  not null,
+    expire_at  bigint        not null,
+    create_at  bigint        not null,
+    update_at  bigint        not null,
+    primary key pk_job_lease(id),
+    constraint un_job_lease_name unique(name)
+);
+
+create table event_outbox (
+    id          bigint        not null auto_increment,
+    event_type  varchar(100)  not null,               #--UploadPaid,CarCreated,DealSent,DealActive
+    entity_id   bigint        not null,               #--source_file_upload/car_file/offline_deal id
+    status      varchar(100)  not null,               #--Pending,Dispatched,Failed
+    attempt_cnt int           not null default 0,
+    note        text,
+    create_at   bigint        not null,
+    dispatch_at bigint,
+    primary key pk_event_outbox(id),
+    index ind_event_outbox_status(status,id)
+);
+
+delimiter //
+create trigger tr_source_file_upload_paid after update on source_file_upload for each row
+begin
+    if new.status='Paid' and old.status<>'Paid' then
+        insert into event_outbox(event_type,entity_id,status,attempt_cnt,create_at) values('UploadPaid',new.id,'Pending',0,unix_timestamp());
+    end if;
+end//
+create trigger tr_source_file_upload_free after insert on source_file_upload for each row
+begin
+    if new.status='Free' then
+        insert into event_outbox(event_type,entity_id,status,attempt_cnt,create_at) values('UploadPaid',new.id,'Pending',0,unix_timestamp());
+    end if;
+end//
+delimiter ;
+
+create table car_creation_job (
+    id                     bigint        not null auto_increment,
+    is_free                boolean       not null,
+    max_price              varchar(100)  not null,
+    src_dir                varchar(1000) not null,
+    car_dir                varchar(1000) not null,
+    step                   varchar(100)  not null,  #--Created,Copied,CarCreated,Uploaded,TaskCreated,Saved
+    status                 varchar(100)  not null,  #--Running,Succeeded,RollingBack,RolledBack
+    payload_cid            varchar(200),
+    car_file_url           varchar(1000),
+    task_uuid              varchar(200),
+    car_file_name          varchar(200),
+    car_file_path          varchar(1000),
+    car_file_size          bigint,
+    piece_cid              varchar(200),
+    car_file_id            bigint,
+    attempt_cnt            int           not null default 0,
+    note                   text,
+    lease_owner            varchar(200),
+    lease_expire_at        bigint,
+    create_at              bigint        not null,
+    update_at              bigint        not null,
+    primary key pk_car_creation_job(id),
+    index ind_car_creation_job_status(status)
+);
+
+create table car_creation_job_upload (
+    id                    bigint        not null auto_increment,
+    car_creation_job_id   bigint        not null,
+    source_file_upload_id bigint        not null,  #--set after source files copied
+    create_at             bigint        not null,
+    primary key pk_car_creation_job_upload(id),
+    constraint un_car_creation_job_upload unique(car_creation_job_id,source_file_upload_id),
+    constraint fk_car_creation_job_upload_car_creation_job_id foreign key (car_creation_job_id) references car_creation_job(id),
+    index ind_car_creation_job_upload_source_file_upload_id(source_file_upload_id)
+);
+
+create table wallet_access_key (
+    id           bigint        not null auto_increment,
+    wallet_id    bigint        not null,
+    access_key   varchar(100)  not null,
+    secret       varchar(100)  not null,  #--kept as it is, sigv4 signatures are verified with it
+    status       varchar(100)  not null,  #--Active,Revoked
+    last_used_at bigint,
+    create_at    bigint        not null,
+    update_at    bigint        not null,
+    primary key pk_wallet_access_key(id),
+    constraint un_wallet_access_key_access_key unique(access_key),
+    constraint fk_wallet_access_key_wallet_id foreign key (wallet_id) references wallet(id)
+);
+
+create table pin_request (
+    id                    bigint        not null auto_increment,
+    request_id            varchar(100)  not null,
+    wallet_id             bigint        not null,
+    cid                   varchar(200)  not null,
+    name                  varchar(255)  character set utf8mb4 collate utf8mb4_bin,  #--case sensitive, matched by lower() when case insensitive
+    origins               text,                               #--json array of multiaddrs
+    meta                  json,
+    status                varchar(100)  not null,             #--queued,pinning,pinned,failed
+    info                  text,
+    source_file_upload_id bigint,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_pin_request(id),
+    constraint un_pin_request_request_id unique(request_id),
+    constraint fk_pin_request_wallet_id foreign key (wallet_id) references wallet(id),
+    constraint fk_pin_request_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id),
+    index ind_pin_request_wallet_create_at(wallet_id,create_at),
+    index ind_pin_request_status(status,id)
+);
+
+create table bucket (
+    id         bigint        not null auto_increment,
+    wallet_id  bigint        not null,
+    name       varchar(63)   not null,
+    create_at  bigint        not null,
+    update_at  bigint        not null,
+    primary key pk_bucket(id),
+    constraint un_bucket_name unique(name),
+    constraint fk_bucket_wallet_id foreign key (wallet_id) references wallet(id),
+    index ind_bucket_wallet_id(wallet_id)
+);
+
+create table bucket_object (
+    id                    bigint          not null auto_increment,
+    bucket_id             bigint          not null,
+    object_key            varbinary(1024) not null,           #--compared and sorted as bytes like s3
+    source_file_upload_id bigint          not null,
+    content_type          varchar(255)    not null,
+    etag                  varchar(100)    not null,
+    size                  bigint          not null,
+    create_at             bigint          not null,
+    update_at             bigint          not null,
+    primary key pk_bucket_object(id),
+    constraint un_bucket_object_key unique(bucket_id,object_key),
+    constraint fk_bucket_object_bucket_id foreign key (bucket_id) references bucket(id),
+    constraint fk_bucket_object_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id)
+);
+
+create table multipart_upload (
+    id           bigint          not null auto_increment,
+    upload_id    varchar(100)    not null,
+    bucket_id    bigint          not null,
+    object_key   varbinary(1024) not null,
+    content_type varchar(255)    not null,
+    create_at    bigint          not null,
+    update_at    bigint          not null,
+    primary key pk_multipart_upload(id),
+    constraint un_multipart_upload_upload_id unique(upload_id),
+    constraint fk_multipart_upload_bucket_id foreign key (bucket_id) references bucket(id)
+);
+
+create table multipart_upload_part (
+    id                  bigint       not null auto_increment,
+    multipart_upload_id bigint       not null,
+    part_number         int          not null,
+    etag                varchar(100) not null,
+    size                bigint       not null,
+    create_at           bigint       not null,
+    update_at           bigint       not null,
+    primary key pk_multipart_upload_part(id),
+    constraint un_multipart_upload_part_number unique(multipart_upload_id,part_number),
+    constraint fk_multipart_upload_part_multipart_upload_id foreign key (multipart_upload_id) references multipart_upload(id)
+);
+
+create table pin_drift (
+    id             bigint        not null auto_increment,
+    source_file_id bigint        not null,
+    payload_cid    varchar(200)  not null,
+    kind           varchar(100)  not null,             #--Missing,Unexpected
+    status         varchar(100)  not null,             #--Repaired,Failed
+    message        text,
+    detect_cnt     int           not null,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_pin_drift(id),
+    constraint un_pin_drift_source_file_kind unique(source_file_id,kind),
+    constraint fk_pin_drift_source_file_id foreign key (source_file_id) references source_file(id),
+    index ind_pin_drift_update_at(update_at)
+);
+
+create table retrieval_check (
+    id              bigint        not null auto_increment,
+    offline_deal_id bigint        not null,
+    miner_id        bigint        not null,
+    source_file_id  bigint        not null,
+    payload_cid     varchar(200)  not null,
+    mode            varchar(100)  not null,             #--Full,Range
+    range_offset    bigint        not null,
+    range_length    bigint        not null,
+    status          varchar(100)  not null,             #--Succeeded,Failed
+    latency_ms      bigint        not null,
+    message         text,
+    create_at       bigint        not null,
+    primary key pk_retrieval_check(id),
+    constraint fk_retrieval_check_offline_deal_id foreign key (offline_deal_id) references offline_deal(id),
+    constraint fk_retrieval_check_miner_id foreign key (miner_id) references miner(id),
+    index ind_retrieval_check_offline_deal_create_at(offline_deal_id,create_at),
+    index ind_retrieval_check_miner_create_at(miner_id,create_at)
+);
+
+create table denylist (
+    id             bigint        not null auto_increment,
+    kind           varchar(100)  not null,             #--Cid,DoubleHash,Sha256
+    value          varchar(200)  not null,
+    source         varchar(500)  not null,             #--admin, or the url of the list imported
+    reason         text,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_denylist(id),
+    constraint un_denylist_kind_value unique(kind,value),
+    index ind_denylist_source_update_at(source(200),update_at)
+);
+
+create table abuse_report (
+    id                    bigint        not null auto_increment,
+    payload_cid           varchar(200)  not null,
+    source_file_upload_id bigint,
+    reason                text          not null,
+    reporter_contact      varchar(200),
+    status                varchar(100)  not null,      #--Open,Removed,Dismissed
+    review_note           text,
+    reviewed_at           bigint,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_abuse_report(id),
+    index ind_abuse_report_status(status)
+);
+
+create table audit_log (
+    id             bigint        not null auto_increment,
+    actor          varchar(100)  not null,             #--admin,system,reporter
+    actor_ip       varchar(100),
+    action         varchar(100)  not null,
+    target_type    varchar(100)  not null,
+    target_id      varchar(200)  not null,
+    detail         text,
+    create_at      bigint        not null,
+    primary key pk_audit_log(id),
+    index ind_audit_log_target(target_type,target_id)
+);
+
+
+create table plan (
+    id                  bigint        not null auto_increment,
+    name                varchar(100)  not null,
+    monthly_free_bytes  bigint        not null,
+    max_file_size       bigint        not null default 0,  #--0 for no limit
+    max_files           int           not null default 0,  #--uploads per calendar month, 0 for no limit
+    requests_per_minute int           not null default 0,  #--0 for no limit
+    uploads_per_minute  int           not null default 0,  #--0 for no limit
+    create_at           bigint        not null,
+    update_at           bigint        not null,
+    primary key pk_plan(id),
+    constraint un_plan_name unique(name)
+);
+
+insert into plan(name,monthly_free_bytes,max_file_size,max_files,requests_per_minute,uploads_per_minute,create_at,update_at) values('free',10737418240,0,0,600,60,unix_timestamp(),unix_timestamp());
+insert into plan(name,monthly_free_bytes,max_file_size,max_files,requests_per_minute,uploads_per_minute,create_at,update_at) values('pro',107374182400,0,0,3000,300,unix_timestamp(),unix_timestamp());
+insert into plan(name,monthly_free_bytes,max_file_size,max_files,requests_per_minute,uploads_per_minute,create_at,update_at) values('enterprise',1099511627776,0,0,0,0,unix_timestamp(),unix_timestamp());
+
+create table plan_assignment (
+    id             bigint        not null auto_increment,
+    subject_type   varchar(100)  not null,             #--wallet,organization
+    subject_id     bigint        not null,
+    plan_id        bigint        not null,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_plan_assignment(id),
+    constraint un_plan_assignment_subject unique(subject_type,subject_id),
+    constraint fk_plan_assignment_plan_id foreign key (plan_id) references plan(id)
+);
+
+create table usage_counter (
+    id             bigint        not null auto_increment,
+    subject_type   varchar(100)  not null,             #--wallet,organization
+    subject_id     bigint        not null,
+    period_start   bigint        not null,             #--start of the calendar month in utc
+    uploaded_cnt   int           not null default 0,
+    uploaded_bytes bigint        not null default 0,
+    free_bytes     bigint        not null default 0,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_usage_counter(id),
+    constraint un_usage_counter_subject_period unique(subject_type,subject_id,period_start)
+);
+
+
+create table organization (
+    id             bigint        not null auto_increment,
+    name           varchar(200)  not null,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_organization(id)
+);
+
+create table organization_member (
+    id              bigint        not null auto_increment,
+    organization_id bigint        not null,
+    wallet_id       bigint        not null,
+    role            varchar(100)  not null,            #--owner,admin,uploader,viewer
+    create_at       bigint        not null,
+    update_at       bigint        not null,
+    primary key pk_organization_member(id),
+    constraint un_organization_member unique(organization_id,wallet_id),
+    constraint fk_organization_member_organization_id foreign key (organization_id) references organization(id),
+    constraint fk_organization_member_wallet_id foreign key (wallet_id) references wallet(id),
+    index ind_organization_member_wallet_id(wallet_id)
+);
+
+alter table source_file_upload add organization_id bigint;
+create index ind_source_file_upload_organization_create_at on source_file_upload(organization_id,create_at);
+
+create table source_file_upload_tag (
+    id                    bigint        not null auto_increment,
+    source_file_upload_id bigint        not null,
+    tag_key               varchar(128)  not null,
+    tag_value             varchar(256)  not null,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_source_file_upload_tag(id),
+    constraint un_source_file_upload_tag unique(source_file_upload_id,tag_key),
+    constraint fk_source_file_upload_tag_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id),
+    index ind_source_file_upload_tag_key_value(tag_key,tag_value)
+);
+
+create index ind_source_file_upload_wallet_create_at on source_file_upload(wallet_id,create_at);
+create index ind_source_file_upload_wallet_file_name on source_file_upload(wallet_id,file_name);
+create index ind_transaction_wallet_pay_at on transaction(wallet_id_pay,pay_at);
+
+create fulltext index ft_source_file_upload_file_name on source_file_upload(file_name) with parser ngram;
+create fulltext index ft_source_file_upload_tag on source_file_upload_tag(tag_key,tag_value) with parser ngram;
+create index ind_transaction_pay_tx_hash on transaction(pay_tx_hash);
+create index ind_transaction_refund_tx_hash on transaction(refund_tx_hash);
+create index ind_source_file_mint_nft_tx_hash on source_file_mint(nft_tx_hash);
+create index ind_offline_deal_unlock_tx_hash on offline_deal(unlock_tx_hash);
+
 
 
 #--2022.09.06
@@ -326,3 +743,440 @@ SET SQL_SAFE_UPDATES = 1;
 
 update network set name='polygon.mumbai' where name='polygon';
 */
+
+#--2026.10.19
+/*
+create table replica_repair (
+    id                 bigint        not null auto_increment,
+    car_file_id        bigint        not null,
+    active_replica_cnt int           not null,
+    target_replica_cnt int           not null,
+    task_uuid          varchar(100)  not null,
+    status             varchar(100)  not null,
+    note               text,
+    create_at          bigint        not null,
+    update_at          bigint        not null,
+    primary key pk_replica_repair(id),
+    constraint fk_replica_repair_car_file_id foreign key (car_file_id) references car_file(id)
+);
+
+create table renewal (
+    id                    bigint        not null auto_increment,
+    uuid                  varchar(100)  not null,
+    source_file_upload_id bigint        not null,
+    car_file_id           bigint        not null,
+    car_file_id_renewed   bigint,
+    end_epoch             bigint        not null,
+    duration              int           not null,  #--unit:day
+    pay_amount            varchar(100)  not null,
+    pay_tx_hash           varchar(100),
+    status                varchar(100)  not null,
+    note                  text,
+    attempt_cnt           int           not null default 0,
+    next_attempt_at       bigint,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_renewal(id),
+    constraint un_renewal unique(source_file_upload_id,car_file_id),
+    constraint un_renewal_pay_tx_hash unique(pay_tx_hash),
+    constraint fk_renewal_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id),
+    constraint fk_renewal_car_file_id foreign key (car_file_id) references car_file(id),
+    constraint fk_renewal_car_file_id_renewed foreign key (car_file_id_renewed) references car_file(id)
+);
+
+alter table miner add status            varchar(100)  not null default 'Normal';
+alter table miner add deal_cnt          int           not null default 0;
+alter table miner add deal_active_cnt   int           not null default 0;
+alter table miner add deal_failed_cnt   int           not null default 0;
+alter table miner add deal_slashed_cnt  int           not null default 0;
+alter table miner add success_rate      double        not null default 0;
+alter table miner add avg_active_second bigint        not null default 0;
+alter table miner add price             varchar(100);
+alter table miner add score             double        not null default 0;
+alter table miner add note              text;
+alter table miner add update_at         bigint        not null default 0;
+create index ind_miner_status on miner(status);
+
+alter table offline_deal add next_scan_at     bigint;
+alter table offline_deal add scan_interval    bigint        not null default 0;
+create index ind_offline_deal_next_scan_at on offline_deal(next_scan_at);
+
+create table job_lease (
+    id         bigint        not null auto_increment,
+    name       varchar(100)  not null,
+    owner      varchar(200)  not null,
+    expire_at  bigint        not null,
+    create_at  bigint        not null,
+    update_at  bigint        not null,
+    primary key pk_job_lease(id),
+    constraint un_job_lease_name unique(name)
+);
+
+alter table source_file_upload add lease_owner    varchar(200);
+alter table source_file_upload add lease_expire_at bigint;
+alter table car_file add lease_owner        varchar(200);
+alter table car_file add lease_expire_at    bigint;
+
+create table event_outbox (
+    id          bigint        not null auto_increment,
+    event_type  varchar(100)  not null,               #--UploadPaid,CarCreated,DealSent,DealActive
+    entity_id   bigint        not null,               #--source_file_upload/car_file/offline_deal id
+    status      varchar(100)  not null,               #--Pending,Dispatched,Failed
+    attempt_cnt int           not null default 0,
+    note        text,
+    create_at   bigint        not null,
+    dispatch_at bigint,
+    primary key pk_event_outbox(id),
+    index ind_event_outbox_status(status,id)
+);
+
+delimiter //
+create trigger tr_source_file_upload_paid after update on source_file_upload for each row
+begin
+    if new.status='Paid' and old.status<>'Paid' then
+        insert into event_outbox(event_type,entity_id,status,attempt_cnt,create_at) values('UploadPaid',new.id,'Pending',0,unix_timestamp());
+    end if;
+end//
+create trigger tr_source_file_upload_free after insert on source_file_upload for each row
+begin
+    if new.status='Free' then
+        insert into event_outbox(event_type,entity_id,status,attempt_cnt,create_at) values('UploadPaid',new.id,'Pending',0,unix_timestamp());
+    end if;
+end//
+delimiter ;
+
+create table car_creation_job (
+    id                     bigint        not null auto_increment,
+    is_free                boolean       not null,
+    max_price              varchar(100)  not null,
+    src_dir                varchar(1000) not null,
+    car_dir                varchar(1000) not null,
+    step                   varchar(100)  not null,  #--Created,Copied,CarCreated,Uploaded,TaskCreated,Saved
+    status                 varchar(100)  not null,  #--Running,Succeeded,RollingBack,RolledBack
+    payload_cid            varchar(200),
+    car_file_url           varchar(1000),
+    task_uuid              varchar(200),
+    car_file_name          varchar(200),
+    car_file_path          varchar(1000),
+    car_file_size          bigint,
+    piece_cid              varchar(200),
+    car_file_id            bigint,
+    attempt_cnt            int           not null default 0,
+    note                   text,
+    lease_owner            varchar(200),
+    lease_expire_at        bigint,
+    create_at              bigint        not null,
+    update_at              bigint        not null,
+    primary key pk_car_creation_job(id),
+    index ind_car_creation_job_status(status)
+);
+
+create table car_creation_job_upload (
+    id                    bigint        not null auto_increment,
+    car_creation_job_id   bigint        not null,
+    source_file_upload_id bigint        not null,  #--set after source files copied
+    create_at             bigint        not null,
+    primary key pk_car_creation_job_upload(id),
+    constraint un_car_creation_job_upload unique(car_creation_job_id,source_file_upload_id),
+    constraint fk_car_creation_job_upload_car_creation_job_id foreign key (car_creation_job_id) references car_creation_job(id),
+    index ind_car_creation_job_upload_source_file_upload_id(source_file_upload_id)
+);
+
+alter table source_file add local_deleted_at bigint;
+alter table car_file add local_deleted_at bigint;
+
+create table wallet_access_key (
+    id           bigint        not null auto_increment,
+    wallet_id    bigint        not null,
+    access_key   varchar(100)  not null,
+    secret       varchar(100)  not null,  #--kept as it is, sigv4 signatures are verified with it
+    status       varchar(100)  not null,  #--Active,Revoked
+    last_used_at bigint,
+    create_at    bigint        not null,
+    update_at    bigint        not null,
+    primary key pk_wallet_access_key(id),
+    constraint un_wallet_access_key_access_key unique(access_key),
+    constraint fk_wallet_access_key_wallet_id foreign key (wallet_id) references wallet(id)
+);
+
+create table pin_request (
+    id                    bigint        not null auto_increment,
+    request_id            varchar(100)  not null,
+    wallet_id             bigint        not null,
+    cid                   varchar(200)  not null,
+    name                  varchar(255)  character set utf8mb4 collate utf8mb4_bin,  #--case sensitive, matched by lower() when case insensitive
+    origins               text,                               #--json array of multiaddrs
+    meta                  json,
+    status                varchar(100)  not null,             #--queued,pinning,pinned,failed
+    info                  text,
+    source_file_upload_id bigint,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_pin_request(id),
+    constraint un_pin_request_request_id unique(request_id),
+    constraint fk_pin_request_wallet_id foreign key (wallet_id) references wallet(id),
+    constraint fk_pin_request_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id),
+    index ind_pin_request_wallet_create_at(wallet_id,create_at),
+    index ind_pin_request_status(status,id)
+);
+
+create table bucket (
+    id         bigint        not null auto_increment,
+    wallet_id  bigint        not null,
+    name       varchar(63)   not null,
+    create_at  bigint        not null,
+    update_at  bigint        not null,
+    primary key pk_bucket(id),
+    constraint un_bucket_name unique(name),
+    constraint fk_bucket_wallet_id foreign key (wallet_id) references wallet(id),
+    index ind_bucket_wallet_id(wallet_id)
+);
+
+create table bucket_object (
+    id                    bigint          not null auto_increment,
+    bucket_id             bigint          not null,
+    object_key            varbinary(1024) not null,           #--compared and sorted as bytes like s3
+    source_file_upload_id bigint          not null,
+    content_type          varchar(255)    not null,
+    etag                  varchar(100)    not null,
+    size                  bigint          not null,
+    create_at             bigint          not null,
+    update_at             bigint          not null,
+    primary key pk_bucket_object(id),
+    constraint un_bucket_object_key unique(bucket_id,object_key),
+    constraint fk_bucket_object_bucket_id foreign key (bucket_id) references bucket(id),
+    constraint fk_bucket_object_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id)
+);
+
+create table multipart_upload (
+    id           bigint          not null auto_increment,
+    upload_id    varchar(100)    not null,
+    bucket_id    bigint          not null,
+    object_key   varbinary(1024) not null,
+    content_type varchar(255)    not null,
+    create_at    bigint          not null,
+    update_at    bigint          not null,
+    primary key pk_multipart_upload(id),
+    constraint un_multipart_upload_upload_id unique(upload_id),
+    constraint fk_multipart_upload_bucket_id foreign key (bucket_id) references bucket(id)
+);
+
+create table multipart_upload_part (
+    id                  bigint       not null auto_increment,
+    multipart_upload_id bigint       not null,
+    part_number         int          not null,
+    etag                varchar(100) not null,
+    size                bigint       not null,
+    create_at           bigint       not null,
+    update_at           bigint       not null,
+    primary key pk_multipart_upload_part(id),
+    constraint un_multipart_upload_part_number unique(multipart_upload_id,part_number),
+    constraint fk_multipart_upload_part_multipart_upload_id foreign key (multipart_upload_id) references multipart_upload(id)
+);
+
+create table pin_drift (
+    id             bigint        not null auto_increment,
+    source_file_id bigint        not null,
+    payload_cid    varchar(200)  not null,
+    kind           varchar(100)  not null,             #--Missing,Unexpected
+    status         varchar(100)  not null,             #--Repaired,Failed
+    message        text,
+    detect_cnt     int           not null,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_pin_drift(id),
+    constraint un_pin_drift_source_file_kind unique(source_file_id,kind),
+    constraint fk_pin_drift_source_file_id foreign key (source_file_id) references source_file(id),
+    index ind_pin_drift_update_at(update_at)
+);
+
+alter table source_file_upload add unpin_at       bigint;
+create index ind_source_file_upload_pin_status_unpin_at on source_file_upload(pin_status,unpin_at);
+
+create table retrieval_check (
+    id              bigint        not null auto_increment,
+    offline_deal_id bigint        not null,
+    miner_id        bigint        not null,
+    source_file_id  bigint        not null,
+    payload_cid     varchar(200)  not null,
+    mode            varchar(100)  not null,             #--Full,Range
+    range_offset    bigint        not null,
+    range_length    bigint        not null,
+    status          varchar(100)  not null,             #--Succeeded,Failed
+    latency_ms      bigint        not null,
+    message         text,
+    create_at       bigint        not null,
+    primary key pk_retrieval_check(id),
+    constraint fk_retrieval_check_offline_deal_id foreign key (offline_deal_id) references offline_deal(id),
+    constraint fk_retrieval_check_miner_id foreign key (miner_id) references miner(id),
+    index ind_retrieval_check_offline_deal_create_at(offline_deal_id,create_at),
+    index ind_retrieval_check_miner_create_at(miner_id,create_at)
+);
+
+alter table miner add retrieval_check_cnt      int    not null default 0;
+alter table miner add retrieval_success_rate   double not null default 0;
+alter table miner add avg_retrieval_latency_ms bigint not null default 0;
+
+alter table source_file_upload add encryption_scheme varchar(100);
+alter table source_file_upload add key_wrap_scheme   varchar(100);
+alter table source_file_upload add wrapped_key       text;
+alter table source_file_upload add kms_key_id        varchar(200);
+alter table source_file_upload add plain_file_size   bigint;
+
+create table denylist (
+    id             bigint        not null auto_increment,
+    kind           varchar(100)  not null,             #--Cid,DoubleHash,Sha256
+    value          varchar(200)  not null,
+    source         varchar(500)  not null,             #--admin, or the url of the list imported
+    reason         text,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_denylist(id),
+    constraint un_denylist_kind_value unique(kind,value),
+    index ind_denylist_source_update_at(source(200),update_at)
+);
+
+create table abuse_report (
+    id                    bigint        not null auto_increment,
+    payload_cid           varchar(200)  not null,
+    source_file_upload_id bigint,
+    reason                text          not null,
+    reporter_contact      varchar(200),
+    status                varchar(100)  not null,      #--Open,Removed,Dismissed
+    review_note           text,
+    reviewed_at           bigint,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_abuse_report(id),
+    index ind_abuse_report_status(status)
+);
+
+create table audit_log (
+    id             bigint        not null auto_increment,
+    actor          varchar(100)  not null,             #--admin,system,reporter
+    actor_ip       varchar(100),
+    action         varchar(100)  not null,
+    target_type    varchar(100)  not null,
+    target_id      varchar(200)  not null,
+    detail         text,
+    create_at      bigint        not null,
+    primary key pk_audit_log(id),
+    index ind_audit_log_target(target_type,target_id)
+);
+
+alter table wallet add is_blocked boolean not null default false;
+alter table source_file_upload add content_sha256    varchar(100);
+alter table source_file_upload add blocked_at        bigint;
+
+alter table source_file add mime_type     varchar(200);
+alter table source_file add scan_status   varchar(100);
+alter table source_file add scan_verdicts text;
+alter table source_file add scanned_at    bigint;
+
+
+create table plan (
+    id                  bigint        not null auto_increment,
+    name                varchar(100)  not null,
+    monthly_free_bytes  bigint        not null,
+    max_file_size       bigint        not null default 0,  #--0 for no limit
+    max_files           int           not null default 0,  #--uploads per calendar month, 0 for no limit
+    requests_per_minute int           not null default 0,  #--0 for no limit
+    uploads_per_minute  int           not null default 0,  #--0 for no limit
+    create_at           bigint        not null,
+    update_at           bigint        not null,
+    primary key pk_plan(id),
+    constraint un_plan_name unique(name)
+);
+
+insert into plan(name,monthly_free_bytes,max_file_size,max_files,requests_per_minute,uploads_per_minute,create_at,update_at) values('free',10737418240,0,0,600,60,unix_timestamp(),unix_timestamp());
+insert into plan(name,monthly_free_bytes,max_file_size,max_files,requests_per_minute,uploads_per_minute,create_at,update_at) values('pro',107374182400,0,0,3000,300,unix_timestamp(),unix_timestamp());
+insert into plan(name,monthly_free_bytes,max_file_size,max_files,requests_per_minute,uploads_per_minute,create_at,update_at) values('enterprise',1099511627776,0,0,0,0,unix_timestamp(),unix_timestamp());
+
+create table plan_assignment (
+    id             bigint        not null auto_increment,
+    subject_type   varchar(100)  not null,             #--wallet,organization
+    subject_id     bigint        not null,
+    plan_id        bigint        not null,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_plan_assignment(id),
+    constraint un_plan_assignment_subject unique(subject_type,subject_id),
+    constraint fk_plan_assignment_plan_id foreign key (plan_id) references plan(id)
+);
+
+create table usage_counter (
+    id             bigint        not null auto_increment,
+    subject_type   varchar(100)  not null,             #--wallet,organization
+    subject_id     bigint        not null,
+    period_start   bigint        not null,             #--start of the calendar month in utc
+    uploaded_cnt   int           not null default 0,
+    uploaded_bytes bigint        not null default 0,
+    free_bytes     bigint        not null default 0,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_usage_counter(id),
+    constraint un_usage_counter_subject_period unique(subject_type,subject_id,period_start)
+);
+
+#--the usage of the current month is counted from the uploads made so far
+set time_zone='+00:00';
+insert into usage_counter(subject_type,subject_id,period_start,uploaded_cnt,uploaded_bytes,free_bytes,create_at,update_at)
+select 'wallet',a.wallet_id,unix_timestamp(date_format(now(),'%Y-%m-01')),count(*),sum(b.file_size),sum(case when a.is_free then b.file_size else 0 end),unix_timestamp(),unix_timestamp()
+from source_file_upload a, source_file b
+where a.source_file_id=b.id and a.create_at>=unix_timestamp(date_format(now(),'%Y-%m-01'))
+group by a.wallet_id;
+
+
+create table organization (
+    id             bigint        not null auto_increment,
+    name           varchar(200)  not null,
+    create_at      bigint        not null,
+    update_at      bigint        not null,
+    primary key pk_organization(id)
+);
+
+create table organization_member (
+    id              bigint        not null auto_increment,
+    organization_id bigint        not null,
+    wallet_id       bigint        not null,
+    role            varchar(100)  not null,            #--owner,admin,uploader,viewer
+    create_at       bigint        not null,
+    update_at       bigint        not null,
+    primary key pk_organization_member(id),
+    constraint un_organization_member unique(organization_id,wallet_id),
+    constraint fk_organization_member_organization_id foreign key (organization_id) references organization(id),
+    constraint fk_organization_member_wallet_id foreign key (wallet_id) references wallet(id),
+    index ind_organization_member_wallet_id(wallet_id)
+);
+
+alter table source_file_upload add organization_id bigint;
+create index ind_source_file_upload_organization_id on source_file_upload(organization_id);
+
+create table source_file_upload_tag (
+    id                    bigint        not null auto_increment,
+    source_file_upload_id bigint        not null,
+    tag_key               varchar(128)  not null,
+    tag_value             varchar(256)  not null,
+    create_at             bigint        not null,
+    update_at             bigint        not null,
+    primary key pk_source_file_upload_tag(id),
+    constraint un_source_file_upload_tag unique(source_file_upload_id,tag_key),
+    constraint fk_source_file_upload_tag_source_file_upload_id foreign key (source_file_upload_id) references source_file_upload(id),
+    index ind_source_file_upload_tag_key_value(tag_key,tag_value)
+);
+
+drop index ind_source_file_upload_organization_id on source_file_upload;
+create index ind_source_file_upload_organization_create_at on source_file_upload(organization_id,create_at);
+create index ind_source_file_upload_wallet_create_at on source_file_upload(wallet_id,create_at);
+create index ind_source_file_upload_wallet_file_name on source_file_upload(wallet_id,file_name);
+create index ind_transaction_wallet_pay_at on transaction(wallet_id_pay,pay_at);
+
+create fulltext index ft_source_file_upload_file_name on source_file_upload(file_name) with parser ngram;
+create fulltext index ft_source_file_upload_tag on source_file_upload_tag(tag_key,tag_value) with parser ngram;
+create index ind_transaction_pay_tx_hash on transaction(pay_tx_hash);
+create index ind_transaction_refund_tx_hash on transaction(refund_tx_hash);
+create index ind_source_file_mint_nft_tx_hash on source_file_mint(nft_tx_hash);
+create index ind_offline_deal_unlock_tx_hash on offline_deal(unlock_tx_hash);
+
+alter table offline_deal add end_epoch        bigint;
+*/
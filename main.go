@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/config"
 	"multi-chain-storage/database"
 	"multi-chain-storage/routers"
 	"multi-chain-storage/service/scheduler"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/filswan/go-swan-lib/logs"
@@ -26,12 +30,55 @@ func main() {
 	db := database.Init()
 	defer database.CloseDB(db)
 
-	scheduler.InitScheduler()
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.InitScheduler(ctx)
 
-	createGinServer()
+	servers := []*http.Server{createGinServer()}
+	if config.GetConfig().S3Gateway.Port > 0 {
+		servers = append(servers, createS3GatewayServer())
+	}
+
+	for _, server := range servers {
+		go func(server *http.Server) {
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				logs.GetLogger().Fatal(err)
+			}
+		}(server)
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signalChan
+	logs.GetLogger().Info("signal:", sig, " received, shutting down")
+
+	shutdown(servers, cancel)
 }
 
-func createGinServer() {
+// shutdown stops accepting requests and new job runs, then waits for the requests and jobs running to end
+func shutdown(servers []*http.Server, cancelScheduler context.CancelFunc) {
+	timeout := constants.SHUTDOWN_TIMEOUT_SECOND * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cancelScheduler()
+
+	for _, server := range servers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+
+	if !scheduler.WaitJobs(timeout) {
+		logs.GetLogger().Error("jobs not ended in ", timeout)
+		return
+	}
+
+	logs.GetLogger().Info("shut down gracefully")
+}
+
+func createGinServer() *http.Server {
 	if config.GetConfig().Release {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -51,10 +98,30 @@ func createGinServer() {
 	routers.HostManager(v1.Group("common"))
 	routers.BillingManager(v1.Group("billing"))
 	routers.Storage(v1.Group("storage"))
+	routers.Bucket(v1.Group("bucket"))
+	routers.Organization(v1.Group("organization"))
 	routers.Dao(v1.Group("dao"))
+	routers.Admin(v1.Group("admin"))
+	routers.Pinning(v1.Group("pinning"))
 
-	err := r.Run(":" + strconv.Itoa(config.GetConfig().Port))
-	if err != nil {
-		logs.GetLogger().Fatal(err)
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(config.GetConfig().Port),
+		Handler: r,
 	}
+
+	return server
+}
+
+// createS3GatewayServer creates the server of the s3 compatible api, on its own port since s3 clients address buckets from the root path
+func createS3GatewayServer() *http.Server {
+	r := gin.New()
+	r.Use(gin.Logger(), gin.Recovery())
+	routers.S3Gateway(r)
+
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(config.GetConfig().S3Gateway.Port),
+		Handler: r,
+	}
+
+	return server
 }
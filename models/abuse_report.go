@@ -0,0 +1,85 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// AbuseReport is content reported to be abusive, Open till reviewed by the admin
+type AbuseReport struct {
+	ID                 int64   `json:"id"`
+	PayloadCid         string  `json:"payload_cid"`
+	SourceFileUploadId *int64  `json:"source_file_upload_id"`
+	Reason             string  `json:"reason"`
+	ReporterContact    *string `json:"reporter_contact"`
+	Status             string  `json:"status"`
+	ReviewNote         *string `json:"review_note"`
+	ReviewedAt         *int64  `json:"reviewed_at"`
+	CreateAt           int64   `json:"create_at"`
+	UpdateAt           int64   `json:"update_at"`
+}
+
+func CreateAbuseReport(abuseReport *AbuseReport) error {
+	err := database.GetDB().Create(abuseReport).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func GetAbuseReportById(id int64) (*AbuseReport, error) {
+	var abuseReports []*AbuseReport
+	err := database.GetDB().Where("id=?", id).Find(&abuseReports).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(abuseReports) > 0 {
+		return abuseReports[0], nil
+	}
+
+	return nil, nil
+}
+
+// GetAbuseReports returns the reports of the status if given, earliest first, so the reports waiting longest are
+// reviewed first
+func GetAbuseReports(status *string, limit, offset int) ([]*AbuseReport, error) {
+	db := database.GetDB()
+	if status != nil {
+		db = db.Where("status=?", *status)
+	}
+
+	var abuseReports []*AbuseReport
+	err := db.Order("id").Limit(limit).Offset(offset).Find(&abuseReports).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return abuseReports, nil
+}
+
+// UpdateAbuseReportReviewed closes the report if it is still Open, it returns false if reviewed already
+func UpdateAbuseReportReviewed(id int64, status string, reviewNote *string) (bool, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["review_note"] = reviewNote
+	fields2BeUpdated["reviewed_at"] = currentUtcSecond
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	result := database.GetDB().Model(AbuseReport{}).Where("id=? and status=?", id, constants.ABUSE_REPORT_STATUS_OPEN).Update(fields2BeUpdated)
+	err := result.Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return result.RowsAffected > 0, nil
+}
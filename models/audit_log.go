@@ -0,0 +1,61 @@
+package models
+
+import (
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// AuditLog records an action of the content policy, by the admin or the system, never updated or deleted
+type AuditLog struct {
+	ID         int64   `json:"id"`
+	Actor      string  `json:"actor"`
+	ActorIp    *string `json:"actor_ip"`
+	Action     string  `json:"action"`
+	TargetType string  `json:"target_type"`
+	TargetId   string  `json:"target_id"`
+	Detail     *string `json:"detail"`
+	CreateAt   int64   `json:"create_at"`
+}
+
+func CreateAuditLog(actor string, actorIp *string, action, targetType, targetId string, detail *string) error {
+	auditLog := &AuditLog{
+		Actor:      actor,
+		ActorIp:    actorIp,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Detail:     detail,
+		CreateAt:   libutils.GetCurrentUtcSecond(),
+	}
+
+	err := database.GetDB().Create(auditLog).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetAuditLogs returns the logs of the target if given, latest first
+func GetAuditLogs(targetType, targetId *string, limit, offset int) ([]*AuditLog, error) {
+	db := database.GetDB()
+	if targetType != nil {
+		db = db.Where("target_type=?", *targetType)
+	}
+
+	if targetId != nil {
+		db = db.Where("target_id=?", *targetId)
+	}
+
+	var auditLogs []*AuditLog
+	err := db.Order("id desc").Limit(limit).Offset(offset).Find(&auditLogs).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return auditLogs, nil
+}
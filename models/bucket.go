@@ -0,0 +1,71 @@
+package models
+
+import (
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// Bucket is a bucket of the s3 gateway, the name is unique among all wallets
+type Bucket struct {
+	ID       int64  `json:"id"`
+	WalletId int64  `json:"wallet_id"`
+	Name     string `json:"name"`
+	CreateAt int64  `json:"create_at"`
+	UpdateAt int64  `json:"update_at"`
+}
+
+func CreateBucket(walletId int64, name string) (*Bucket, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	bucket := Bucket{
+		WalletId: walletId,
+		Name:     name,
+		CreateAt: currentUtcSecond,
+		UpdateAt: currentUtcSecond,
+	}
+
+	err := database.SaveOne(&bucket)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &bucket, nil
+}
+
+func GetBucketByName(name string) (*Bucket, error) {
+	var buckets []*Bucket
+	err := database.GetDB().Where("name=?", name).Find(&buckets).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(buckets) > 0 {
+		return buckets[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetBucketsByWalletId(walletId int64) ([]*Bucket, error) {
+	var buckets []*Bucket
+	err := database.GetDB().Where("wallet_id=?", walletId).Order("name").Find(&buckets).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+func DeleteBucket(id int64) error {
+	err := database.GetDB().Where("id=?", id).Delete(Bucket{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// BucketObject maps the key in the bucket to the source file upload keeping its content,
+// the key is compared and sorted as bytes like s3
+type BucketObject struct {
+	ID                 int64  `json:"id"`
+	BucketId           int64  `json:"bucket_id"`
+	ObjectKey          string `json:"object_key"`
+	SourceFileUploadId int64  `json:"source_file_upload_id"`
+	ContentType        string `json:"content_type"`
+	Etag               string `json:"etag"`
+	Size               int64  `json:"size"`
+	CreateAt           int64  `json:"create_at"`
+	UpdateAt           int64  `json:"update_at"`
+}
+
+func GetBucketObject(bucketId int64, objectKey string) (*BucketObject, error) {
+	var bucketObjects []*BucketObject
+	err := database.GetDB().Where("bucket_id=? and object_key=?", bucketId, objectKey).Find(&bucketObjects).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(bucketObjects) > 0 {
+		return bucketObjects[0], nil
+	}
+
+	return nil, nil
+}
+
+// GetBucketObjects returns the objects with keys starting with the prefix and after startAfter, in the order of keys
+func GetBucketObjects(bucketId int64, prefix, startAfter string, limit int) ([]*BucketObject, error) {
+	db := database.GetDB().Where("bucket_id=? and object_key>?", bucketId, startAfter)
+	if prefix != "" {
+		db = db.Where("object_key like ?", utils.EscapeLike(prefix)+"%")
+	}
+
+	var bucketObjects []*BucketObject
+	err := db.Order("object_key").Limit(limit).Find(&bucketObjects).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return bucketObjects, nil
+}
+
+// SaveBucketObject creates the object or replaces the object with the same key,
+// it returns the source file upload replaced if any
+func SaveBucketObject(bucketObject *BucketObject) (*int64, error) {
+	db := database.GetDBTransaction()
+
+	var bucketObjects []*BucketObject
+	err := db.Set("gorm:query_option", "FOR UPDATE").Where("bucket_id=? and object_key=?", bucketObject.BucketId, bucketObject.ObjectKey).Find(&bucketObjects).Error
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	bucketObject.UpdateAt = currentUtcSecond
+
+	var sourceFileUploadIdReplaced *int64
+	if len(bucketObjects) > 0 {
+		bucketObject.ID = bucketObjects[0].ID
+		bucketObject.CreateAt = bucketObjects[0].CreateAt
+		if bucketObjects[0].SourceFileUploadId != bucketObject.SourceFileUploadId {
+			sourceFileUploadIdReplaced = &bucketObjects[0].SourceFileUploadId
+		}
+	} else {
+		bucketObject.CreateAt = currentUtcSecond
+	}
+
+	err = database.SaveOneInTransaction(db, bucketObject)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFileUploadIdReplaced, nil
+}
+
+func DeleteBucketObject(id int64) error {
+	err := database.GetDB().Where("id=?", id).Delete(BucketObject{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateBucketObject creates the object, it fails if the key is taken in the bucket
+func CreateBucketObject(bucketObject *BucketObject) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	bucketObject.CreateAt = currentUtcSecond
+	bucketObject.UpdateAt = currentUtcSecond
+
+	err := database.SaveOne(bucketObject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// MoveBucketObject moves the object to the key in the bucket, it fails if the key is taken in the bucket
+func MoveBucketObject(id, bucketId int64, objectKey string) error {
+	sql := "update bucket_object set bucket_id=?,object_key=?,update_at=? where id=?"
+	err := database.GetDB().Exec(sql, bucketId, objectKey, libutils.GetCurrentUtcSecond(), id).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// MoveBucketObjectsByPrefix moves the objects with keys starting with the prefix to the bucket, the prefix of their keys
+// replaced by the new prefix, all or none moved. It returns the number of the objects moved
+func MoveBucketObjectsByPrefix(bucketId int64, prefix string, newBucketId int64, newPrefix string) (int64, error) {
+	sql := "update bucket_object set bucket_id=?,object_key=concat(?,substring(object_key,?)),update_at=?\n" +
+		"where bucket_id=? and object_key like ?"
+	params := []interface{}{}
+	params = append(params, newBucketId, newPrefix, len(prefix)+1, libutils.GetCurrentUtcSecond())
+	params = append(params, bucketId, utils.EscapeLike(prefix)+"%")
+
+	result := database.GetDB().Exec(sql, params...)
+	if result.Error != nil {
+		logs.GetLogger().Error(result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/jinzhu/gorm"
+	"github.com/shopspring/decimal"
+)
+
+type CarCreationJob struct {
+	ID            int64           `json:"id"`
+	IsFree        bool            `json:"is_free"`
+	MaxPrice      decimal.Decimal `json:"max_price"`
+	SrcDir        string          `json:"src_dir"`
+	CarDir        string          `json:"car_dir"`
+	Step          string          `json:"step"`
+	Status        string          `json:"status"`
+	PayloadCid    *string         `json:"payload_cid"`
+	CarFileUrl    *string         `json:"car_file_url"`
+	TaskUuid      *string         `json:"task_uuid"`
+	CarFileName   *string         `json:"car_file_name"`
+	CarFilePath   *string         `json:"car_file_path"`
+	CarFileSize   *int64          `json:"car_file_size"`
+	PieceCid      *string         `json:"piece_cid"`
+	CarFileId     *int64          `json:"car_file_id"`
+	AttemptCnt    int             `json:"attempt_cnt"`
+	Note          *string         `json:"note"`
+	LeaseOwner    *string         `json:"lease_owner"`
+	LeaseExpireAt *int64          `json:"lease_expire_at"`
+	CreateAt      int64           `json:"create_at"`
+	UpdateAt      int64           `json:"update_at"`
+}
+
+// CarCreationJobUpload is a source file upload copied to be created to the car file by the job
+type CarCreationJobUpload struct {
+	ID                 int64 `json:"id"`
+	CarCreationJobId   int64 `json:"car_creation_job_id"`
+	SourceFileUploadId int64 `json:"source_file_upload_id"`
+	CreateAt           int64 `json:"create_at"`
+}
+
+func CreateCarCreationJob(isFree bool, maxPrice decimal.Decimal, srcDir, carDir, owner string, leaseSecond int64) (*CarCreationJob, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	leaseExpireAt := currentUtcSecond + leaseSecond
+	job := CarCreationJob{
+		IsFree:        isFree,
+		MaxPrice:      maxPrice,
+		SrcDir:        srcDir,
+		CarDir:        carDir,
+		Step:          constants.CAR_CREATION_STEP_CREATED,
+		Status:        constants.CAR_CREATION_JOB_STATUS_RUNNING,
+		LeaseOwner:    &owner,
+		LeaseExpireAt: &leaseExpireAt,
+		CreateAt:      currentUtcSecond,
+		UpdateAt:      currentUtcSecond,
+	}
+
+	err := database.SaveOne(&job)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func GetCarCreationJobsByStatus(status string) ([]*CarCreationJob, error) {
+	var jobs []*CarCreationJob
+	err := database.GetDB().Where("status=?", status).Order("id").Find(&jobs).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// GetCarCreationJobByCarFilePath returns the latest job succeeded creating the car file and uploading it to the hot
+// storage, nil if not found
+func GetCarCreationJobByCarFilePath(carFilePath string) (*CarCreationJob, error) {
+	var jobs []*CarCreationJob
+	err := database.GetDB().Where("car_file_path=? and status=? and car_file_url is not null", carFilePath, constants.CAR_CREATION_JOB_STATUS_SUCCEEDED).
+		Order("id desc").Limit(1).Find(&jobs).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	return jobs[0], nil
+}
+
+// GetCarCreationJobs2BeResumed returns the running jobs whose lease has expired, their instance crashed or stopped
+func GetCarCreationJobs2BeResumed(currentUtcSecond int64) ([]*CarCreationJob, error) {
+	var jobs []*CarCreationJob
+	err := database.GetDB().Where("status=? and (lease_expire_at is null or lease_expire_at<?)", constants.CAR_CREATION_JOB_STATUS_RUNNING, currentUtcSecond).
+		Order("id").Find(&jobs).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// IsCarCreationDirInUse checks whether the directory is a work directory of a job not finished yet
+func IsCarCreationDirInUse(dir string) (bool, error) {
+	var cnt int
+	err := database.GetDB().Model(CarCreationJob{}).Where("status<>? and status<>? and (src_dir=? or car_dir=?)",
+		constants.CAR_CREATION_JOB_STATUS_SUCCEEDED, constants.CAR_CREATION_JOB_STATUS_ROLLED_BACK, dir, dir).Count(&cnt).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return cnt > 0, nil
+}
+
+// UpdateCarCreationJobStep records the progress of the job after each step, with the outputs of the step
+func UpdateCarCreationJobStep(id int64, step string, fields map[string]interface{}) error {
+	fields2BeUpdated := make(map[string]interface{})
+	for field, value := range fields {
+		fields2BeUpdated[field] = value
+	}
+	fields2BeUpdated["step"] = step
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	err := database.GetDB().Model(CarCreationJob{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateCarCreationJobCopied records the source file uploads copied by the job, with the max price of the car, in one
+// transaction with the step, the uploads of a running job are not listed to be created to car files again. The uploads
+// are locked and must still be leased by the owner, or ErrLeaseLost is returned, since another instance copying them
+// after their leases expired would create them to another car
+func UpdateCarCreationJobCopied(id int64, sourceFileUploadIds []int64, maxPrice decimal.Decimal, owner string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	db := database.GetDBTransaction()
+
+	var sourceFileUploads []*SourceFileUpload
+	err := db.Set("gorm:query_option", "FOR UPDATE").Where("id in (?) and lease_owner=?", sourceFileUploadIds, owner).Find(&sourceFileUploads).Error
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(sourceFileUploads) != len(sourceFileUploadIds) {
+		db.Rollback()
+		err := fmt.Errorf("%w, %d of the %d source file uploads of car creation job:%d", ErrLeaseLost, len(sourceFileUploadIds)-len(sourceFileUploads), len(sourceFileUploadIds), id)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, sourceFileUploadId := range sourceFileUploadIds {
+		carCreationJobUpload := CarCreationJobUpload{
+			CarCreationJobId:   id,
+			SourceFileUploadId: sourceFileUploadId,
+			CreateAt:           currentUtcSecond,
+		}
+
+		err := database.SaveOneInTransaction(db, &carCreationJobUpload)
+		if err != nil {
+			db.Rollback()
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["step"] = constants.CAR_CREATION_STEP_COPIED
+	fields2BeUpdated["max_price"] = maxPrice
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err = db.Model(CarCreationJob{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetCarCreationJobUploadIds returns the ids of the source file uploads copied by the job
+func GetCarCreationJobUploadIds(carCreationJobId int64) ([]int64, error) {
+	var sourceFileUploadIds []int64
+	err := database.GetDB().Model(CarCreationJobUpload{}).Where("car_creation_job_id=?", carCreationJobId).Order("id").Pluck("source_file_upload_id", &sourceFileUploadIds).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFileUploadIds, nil
+}
+
+// UpdateCarCreationJobSucceededInTransaction marks the job succeeded in the same transaction as the car file is saved
+func UpdateCarCreationJobSucceededInTransaction(db *gorm.DB, id, carFileId int64) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["step"] = constants.CAR_CREATION_STEP_SAVED
+	fields2BeUpdated["status"] = constants.CAR_CREATION_JOB_STATUS_SUCCEEDED
+	fields2BeUpdated["car_file_id"] = carFileId
+	fields2BeUpdated["lease_owner"] = nil
+	fields2BeUpdated["lease_expire_at"] = nil
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	err := db.Model(CarCreationJob{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateCarCreationJobStatus(id int64, status string, attemptCnt int, note string) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["attempt_cnt"] = attemptCnt
+	fields2BeUpdated["note"] = note
+	if status != constants.CAR_CREATION_JOB_STATUS_RUNNING {
+		fields2BeUpdated["lease_owner"] = nil
+		fields2BeUpdated["lease_expire_at"] = nil
+	}
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	err := database.GetDB().Model(CarCreationJob{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func ClaimCarCreationJobs(ids []int64, owner string, leaseSecond int64) ([]int64, error) {
+	return claimRows("car_creation_job", ids, constants.CAR_CREATION_JOB_STATUS_RUNNING, owner, leaseSecond)
+}
+
+func RenewCarCreationJobs(ids []int64, owner string, leaseSecond int64) ([]int64, error) {
+	return renewRows("car_creation_job", ids, owner, leaseSecond)
+}
+
+// IsCarFileDirInUse checks whether a car file saved is under the directory
+func IsCarFileDirInUse(dir string) (bool, error) {
+	var cnt int
+	err := database.GetDB().Model(CarFile{}).Where("car_file_path like ?", dir+"/%").Count(&cnt).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return cnt > 0, nil
+}
+
+func ReleaseCarCreationJobs(ids []int64, owner string) error {
+	return releaseRows("car_creation_job", ids, owner)
+}
+
+// DeleteCarCreationJob deletes the job which has not made anything to keep
+func DeleteCarCreationJob(id int64) error {
+	err := database.GetDB().Where("car_creation_job_id=?", id).Delete(CarCreationJobUpload{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = database.GetDB().Where("id=?", id).Delete(CarCreationJob{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
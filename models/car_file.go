@@ -1,6 +1,7 @@
 package models
 
 import (
+	"multi-chain-storage/common/constants"
 	"multi-chain-storage/database"
 
 	libutils "github.com/filswan/go-swan-lib/utils"
@@ -10,19 +11,20 @@ import (
 )
 
 type CarFile struct {
-	ID          int64           `json:"id"`
-	CarFileName string          `json:"car_file_name"`
-	PayloadCid  string          `json:"payload_cid"`
-	PieceCid    string          `json:"piece_cid"`
-	CarFileSize int64           `json:"car_file_size"`
-	CarFilePath string          `json:"car_file_path"`
-	Duration    int             `json:"duration"`
-	TaskUuid    string          `json:"task_uuid"`
-	MaxPrice    decimal.Decimal `json:"max_price"`
-	Status      string          `json:"status"`
-	IsFree      bool            `json:"is_free"`
-	CreateAt    int64           `json:"create_at"`
-	UpdateAt    int64           `json:"update_at"`
+	ID             int64           `json:"id"`
+	CarFileName    string          `json:"car_file_name"`
+	PayloadCid     string          `json:"payload_cid"`
+	PieceCid       string          `json:"piece_cid"`
+	CarFileSize    int64           `json:"car_file_size"`
+	CarFilePath    string          `json:"car_file_path"`
+	Duration       int             `json:"duration"`
+	TaskUuid       string          `json:"task_uuid"`
+	MaxPrice       decimal.Decimal `json:"max_price"`
+	Status         string          `json:"status"`
+	IsFree         bool            `json:"is_free"`
+	LocalDeletedAt *int64          `json:"local_deleted_at"`
+	CreateAt       int64           `json:"create_at"`
+	UpdateAt       int64           `json:"update_at"`
 }
 
 func GetCarFileById(id int64) (*CarFile, error) {
@@ -117,3 +119,87 @@ func UpdateCarFileStatus(id int64, status string) error {
 
 	return nil
 }
+
+func UpdateCarFileTaskUuid(id int64, taskUuid, status string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["task_uuid"] = taskUuid
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(CarFile{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+type CarFileLocal struct {
+	CarFilePath   string `json:"car_file_path"`
+	CarFileSize   int64  `json:"car_file_size"`
+	CreateAt      int64  `json:"create_at"`
+	ActiveDealCnt int    `json:"active_deal_cnt"`
+}
+
+// GetCarFilesLocal2BeDeleted returns the car files kept locally whose deals active reach activeDealCntMin, oldest first,
+// the car files sharing the same path, such as the ones renewed, must all reach it, and none of them is being renewed
+// or repaired
+func GetCarFilesLocal2BeDeleted(activeDealCntMin int) ([]*CarFileLocal, error) {
+	sql := "select a.car_file_path,max(a.car_file_size) car_file_size,min(a.create_at) create_at,min(ifnull(b.active_deal_cnt,0)) active_deal_cnt\n" +
+		"from car_file a left join (\n" +
+		"    select car_file_id,count(*) active_deal_cnt from offline_deal where status in (?,?) group by car_file_id\n" +
+		") b on a.id=b.car_file_id\n" +
+		"where a.local_deleted_at is null\n" +
+		"and not exists (select 1 from car_file c,renewal d where c.car_file_path=a.car_file_path and d.car_file_id=c.id and d.status in (?,?,?))\n" +
+		"and not exists (select 1 from car_file c,replica_repair d where c.car_file_path=a.car_file_path and d.car_file_id=c.id and d.status=?)\n" +
+		"group by a.car_file_path\n" +
+		"having min(ifnull(b.active_deal_cnt,0))>=?\n" +
+		"order by min(a.create_at)"
+
+	params := []interface{}{}
+	params = append(params, constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS)
+	params = append(params, constants.RENEWAL_STATUS_QUOTED, constants.RENEWAL_STATUS_PAID, constants.RENEWAL_STATUS_TASK_CREATED)
+	params = append(params, constants.REPLICA_REPAIR_STATUS_TASK_CREATED)
+	params = append(params, activeDealCntMin)
+
+	var carFiles []*CarFileLocal
+	err := database.GetDB().Raw(sql, params...).Scan(&carFiles).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return carFiles, nil
+}
+
+// UpdateCarFilesLocalRestored marks the car files at the path kept locally again, after restored from the hot storage
+func UpdateCarFilesLocalRestored(carFilePath string) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["local_deleted_at"] = nil
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	err := database.GetDB().Model(CarFile{}).Where("car_file_path=?", carFilePath).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateCarFilesLocalDeleted(carFilePath string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["local_deleted_at"] = currentUtcSecond
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(CarFile{}).Where("car_file_path=?", carFilePath).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
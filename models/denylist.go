@@ -0,0 +1,131 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// Denylist is content not to be stored, by its cid or its content hash, added by the admin or imported from a list
+type Denylist struct {
+	ID       int64   `json:"id"`
+	Kind     string  `json:"kind"`
+	Value    string  `json:"value"`
+	Source   string  `json:"source"`
+	Reason   *string `json:"reason"`
+	CreateAt int64   `json:"create_at"`
+	UpdateAt int64   `json:"update_at"`
+}
+
+// SaveDenylist adds the entry, or updates its source and reason if it exists, an entry added by the admin stays so even
+// if it is in a list imported, so it is not removed when the list no longer has it
+func SaveDenylist(kind, value, source string, reason *string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert into denylist(kind,value,source,reason,create_at,update_at) values(?,?,?,?,?,?)\n" +
+		"on duplicate key update reason=if(source=?,ifnull(values(reason),reason),values(reason)),source=if(source=?,source,values(source)),update_at=values(update_at)"
+	params := []interface{}{}
+	params = append(params, kind, value, source, reason, currentUtcSecond, currentUtcSecond)
+	params = append(params, constants.DENYLIST_SOURCE_ADMIN, constants.DENYLIST_SOURCE_ADMIN)
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetDenylistMatched returns an entry matching the cid, the double hash of the cid or the content hash, the empty ones
+// are not matched, nil if none
+func GetDenylistMatched(cid, doubleHash, contentSha256 string) (*Denylist, error) {
+	conditions := []string{}
+	params := []interface{}{}
+	for kind, value := range map[string]string{
+		constants.DENYLIST_KIND_CID:         cid,
+		constants.DENYLIST_KIND_DOUBLE_HASH: doubleHash,
+		constants.DENYLIST_KIND_SHA256:      contentSha256,
+	} {
+		if value != "" {
+			conditions = append(conditions, "(kind=? and value=?)")
+			params = append(params, kind, value)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	var denylists []*Denylist
+	err := database.GetDB().Where(strings.Join(conditions, " or "), params...).Limit(1).Find(&denylists).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(denylists) > 0 {
+		return denylists[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetDenylistById(id int64) (*Denylist, error) {
+	var denylists []*Denylist
+	err := database.GetDB().Where("id=?", id).Find(&denylists).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(denylists) > 0 {
+		return denylists[0], nil
+	}
+
+	return nil, nil
+}
+
+// GetDenylists returns the entries of the kind and the source if given, latest updated first
+func GetDenylists(kind, source *string, limit, offset int) ([]*Denylist, error) {
+	db := database.GetDB()
+	if kind != nil {
+		db = db.Where("kind=?", *kind)
+	}
+
+	if source != nil {
+		db = db.Where("source=?", *source)
+	}
+
+	var denylists []*Denylist
+	err := db.Order("update_at desc,id desc").Limit(limit).Offset(offset).Find(&denylists).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return denylists, nil
+}
+
+func DeleteDenylistById(id int64) error {
+	err := database.GetDB().Where("id=?", id).Delete(Denylist{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteDenylistsNotUpdatedSince removes the entries of the source no longer in the list imported since updateAt
+func DeleteDenylistsNotUpdatedSince(source string, updateAt int64) (int64, error) {
+	result := database.GetDB().Where("source=? and update_at<?", source, updateAt).Delete(Denylist{})
+	err := result.Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return result.RowsAffected, nil
+}
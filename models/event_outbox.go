@@ -0,0 +1,81 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/jinzhu/gorm"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+type EventOutbox struct {
+	ID         int64   `json:"id"`
+	EventType  string  `json:"event_type"`
+	EntityId   int64   `json:"entity_id"`
+	Status     string  `json:"status"`
+	AttemptCnt int     `json:"attempt_cnt"`
+	Note       *string `json:"note"`
+	CreateAt   int64   `json:"create_at"`
+	DispatchAt *int64  `json:"dispatch_at"`
+}
+
+func CreateEvent(eventType string, entityId int64) error {
+	return CreateEventInTransaction(database.GetDB(), eventType, entityId)
+}
+
+// CreateEventInTransaction records the event in the same transaction as the state change it is about
+func CreateEventInTransaction(db *gorm.DB, eventType string, entityId int64) error {
+	event := EventOutbox{
+		EventType: eventType,
+		EntityId:  entityId,
+		Status:    constants.EVENT_STATUS_PENDING,
+		CreateAt:  libutils.GetCurrentUtcSecond(),
+	}
+
+	err := db.Create(&event).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func GetEventsPending(limit int) ([]*EventOutbox, error) {
+	var events []*EventOutbox
+	err := database.GetDB().Where("status=?", constants.EVENT_STATUS_PENDING).Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func UpdateEventStatus(id int64, status string, attemptCnt int, note string) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["attempt_cnt"] = attemptCnt
+	fields2BeUpdated["note"] = note
+	fields2BeUpdated["dispatch_at"] = libutils.GetCurrentUtcSecond()
+
+	err := database.GetDB().Model(EventOutbox{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func DeleteEventsDispatched(dispatchAtMax int64) error {
+	err := database.GetDB().Where("status=? and dispatch_at<?", constants.EVENT_STATUS_DISPATCHED, dispatchAtMax).Delete(EventOutbox{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"multi-chain-storage/database"
+
+	libutils "github.com/filswan/go-swan-lib/utils"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// ErrLeaseLost is returned when the rows leased by an instance have been claimed by another one, after their leases expired
+var ErrLeaseLost = errors.New("lease lost to another instance")
+
+type JobLease struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Owner    string `json:"owner"`
+	ExpireAt int64  `json:"expire_at"`
+	CreateAt int64  `json:"create_at"`
+	UpdateAt int64  `json:"update_at"`
+}
+
+// AcquireJobLease takes the lease of the job when it is free, expired or already held by the owner,
+// it returns whether the owner holds the lease afterwards
+func AcquireJobLease(name, owner string, leaseSecond int64) (bool, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert ignore into job_lease(name,owner,expire_at,create_at,update_at) values(?,?,0,?,?)"
+	err := database.GetDB().Exec(sql, name, owner, currentUtcSecond, currentUtcSecond).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	sql = "update job_lease set owner=?,expire_at=?,update_at=? where name=? and (owner=? or expire_at<?)"
+	params := []interface{}{}
+	params = append(params, owner, currentUtcSecond+leaseSecond, currentUtcSecond)
+	params = append(params, name, owner, currentUtcSecond)
+	err = database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	var jobLeases []*JobLease
+	err = database.GetDB().Where("name=?", name).Find(&jobLeases).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	if len(jobLeases) == 0 {
+		return false, nil
+	}
+
+	return jobLeases[0].Owner == owner && jobLeases[0].ExpireAt >= currentUtcSecond, nil
+}
+
+func ReleaseJobLease(name, owner string) error {
+	sql := "update job_lease set expire_at=0,update_at=? where name=? and owner=?"
+	err := database.GetDB().Exec(sql, libutils.GetCurrentUtcSecond(), name, owner).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// claimRows leases the rows of the table still in the status, which are not leased by others or whose lease has expired,
+// it returns the ids of the rows leased by the owner afterwards. The rows handled by others since they were listed have
+// left the status, so they are not claimed again after their leases are released
+func claimRows(table string, ids []int64, status, owner string, leaseSecond int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql, params := getClaimRowsSql(table, ids, status, owner, currentUtcSecond, leaseSecond)
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var idsClaimed []int64
+	err = database.GetDB().Table(table).Where("id in (?) and status=? and lease_owner=?", ids, status, owner).Pluck("id", &idsClaimed).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return idsClaimed, nil
+}
+
+// getClaimRowsSql returns the update leasing the rows of the ids till leaseSecond after currentUtcSecond, for those still in
+// the status and not leased by others, or whose lease has expired
+func getClaimRowsSql(table string, ids []int64, status, owner string, currentUtcSecond, leaseSecond int64) (string, []interface{}) {
+	sql := "update " + table + " set lease_owner=?,lease_expire_at=?\n" +
+		"where id in (?) and status=? and (lease_owner is null or lease_owner=? or lease_expire_at<?)"
+	params := []interface{}{}
+	params = append(params, owner, currentUtcSecond+leaseSecond)
+	params = append(params, ids, status, owner, currentUtcSecond)
+	return sql, params
+}
+
+// renewRows extends the leases of the rows still leased by the owner, whatever their status is now, it returns the ids
+// of them. The rows not returned have been claimed by others after their leases expired
+func renewRows(table string, ids []int64, owner string, leaseSecond int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	sql := "update " + table + " set lease_expire_at=? where id in (?) and lease_owner=?"
+	err := database.GetDB().Exec(sql, libutils.GetCurrentUtcSecond()+leaseSecond, ids, owner).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var idsRenewed []int64
+	err = database.GetDB().Table(table).Where("id in (?) and lease_owner=?", ids, owner).Pluck("id", &idsRenewed).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return idsRenewed, nil
+}
+
+func releaseRows(table string, ids []int64, owner string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	sql := "update " + table + " set lease_owner=null,lease_expire_at=null where id in (?) and lease_owner=?"
+	err := database.GetDB().Exec(sql, ids, owner).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func ClaimSourceFileUploads(ids []int64, status, owner string, leaseSecond int64) ([]int64, error) {
+	return claimRows("source_file_upload", ids, status, owner, leaseSecond)
+}
+
+func RenewSourceFileUploads(ids []int64, owner string, leaseSecond int64) ([]int64, error) {
+	return renewRows("source_file_upload", ids, owner, leaseSecond)
+}
+
+func ReleaseSourceFileUploads(ids []int64, owner string) error {
+	return releaseRows("source_file_upload", ids, owner)
+}
+
+func ClaimCarFiles(ids []int64, status, owner string, leaseSecond int64) ([]int64, error) {
+	return claimRows("car_file", ids, status, owner, leaseSecond)
+}
+
+func RenewCarFiles(ids []int64, owner string, leaseSecond int64) ([]int64, error) {
+	return renewRows("car_file", ids, owner, leaseSecond)
+}
+
+func ReleaseCarFiles(ids []int64, owner string) error {
+	return releaseRows("car_file", ids, owner)
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// bindTestSql replaces the placeholders of the sql by the params in order, as gorm binds them, it fails if their
+// counts differ
+func bindTestSql(t *testing.T, sql string, params []interface{}) string {
+	placeholderCnt := strings.Count(sql, "?")
+	if placeholderCnt != len(params) {
+		t.Fatalf("%d placeholders, %d params", placeholderCnt, len(params))
+	}
+
+	for _, param := range params {
+		value := ""
+		switch param := param.(type) {
+		case string:
+			value = "'" + param + "'"
+		case []int64:
+			values := []string{}
+			for _, id := range param {
+				values = append(values, fmt.Sprint(id))
+			}
+			value = strings.Join(values, ",")
+		default:
+			value = fmt.Sprint(param)
+		}
+		sql = strings.Replace(sql, "?", value, 1)
+	}
+
+	return sql
+}
+
+func TestGetClaimRowsSql(t *testing.T) {
+	tests := []struct {
+		name             string
+		table            string
+		ids              []int64
+		status           string
+		owner            string
+		currentUtcSecond int64
+		leaseSecond      int64
+		wantSql          string
+	}{
+		{
+			name:             "car files",
+			table:            "car_file",
+			ids:              []int64{1, 2, 3},
+			status:           "TaskCreated",
+			owner:            "host-a",
+			currentUtcSecond: 1000,
+			leaseSecond:      60,
+			wantSql: "update car_file set lease_owner='host-a',lease_expire_at=1060\n" +
+				"where id in (1,2,3) and status='TaskCreated' and (lease_owner is null or lease_owner='host-a' or lease_expire_at<1000)",
+		},
+		{
+			name:             "source file uploads",
+			table:            "source_file_upload",
+			ids:              []int64{7},
+			status:           "Paid",
+			owner:            "host-b",
+			currentUtcSecond: 2000,
+			leaseSecond:      300,
+			wantSql: "update source_file_upload set lease_owner='host-b',lease_expire_at=2300\n" +
+				"where id in (7) and status='Paid' and (lease_owner is null or lease_owner='host-b' or lease_expire_at<2000)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sql, params := getClaimRowsSql(test.table, test.ids, test.status, test.owner, test.currentUtcSecond, test.leaseSecond)
+			sqlBound := bindTestSql(t, sql, params)
+			if sqlBound != test.wantSql {
+				t.Errorf("sql:\n%s\nwant:\n%s", sqlBound, test.wantSql)
+			}
+		})
+	}
+}
+
+func TestClaimRowsNone(t *testing.T) {
+	// no rows to claim, the database is not called
+	idsClaimed, err := claimRows("car_file", nil, "TaskCreated", "host-a", 60)
+	if err != nil || idsClaimed != nil {
+		t.Errorf("ids claimed:%v, error:%v", idsClaimed, err)
+	}
+}
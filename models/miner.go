@@ -1,17 +1,35 @@
 package models
 
 import (
+	"multi-chain-storage/common/constants"
 	"multi-chain-storage/database"
 
 	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/shopspring/decimal"
 
 	"github.com/filswan/go-swan-lib/logs"
 )
 
 type Miner struct {
-	ID       int64  `json:"id"`
-	Fid      string `json:"fid"`
-	CreateAt int64  `json:"create_at"`
+	ID              int64            `json:"id"`
+	Fid             string           `json:"fid"`
+	Status          string           `json:"status"`
+	DealCnt         int              `json:"deal_cnt"`
+	DealActiveCnt   int              `json:"deal_active_cnt"`
+	DealFailedCnt   int              `json:"deal_failed_cnt"`
+	DealSlashedCnt  int              `json:"deal_slashed_cnt"`
+	SuccessRate     float64          `json:"success_rate"`
+	AvgActiveSecond int64            `json:"avg_active_second"`
+	Price           *decimal.Decimal `json:"price"` // FIL/GiB/epoch of its latest active deal
+	Score           float64          `json:"score"`
+	Note            *string          `json:"note"`
+
+	RetrievalCheckCnt     int     `json:"retrieval_check_cnt"`
+	RetrievalSuccessRate  float64 `json:"retrieval_success_rate"`
+	AvgRetrievalLatencyMs int64   `json:"avg_retrieval_latency_ms"`
+
+	CreateAt int64 `json:"create_at"`
+	UpdateAt int64 `json:"update_at"`
 }
 
 func GeMinerByFid(fid string) (*Miner, error) {
@@ -36,9 +54,12 @@ func GeMinerByFid(fid string) (*Miner, error) {
 }
 
 func SaveMiner(fid string) (*Miner, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
 	miner := Miner{
 		Fid:      fid,
-		CreateAt: libutils.GetCurrentUtcSecond(),
+		Status:   constants.MINER_STATUS_NORMAL,
+		CreateAt: currentUtcSecond,
+		UpdateAt: currentUtcSecond,
 	}
 
 	minerResult := database.GetDB().Create(&miner)
@@ -52,3 +73,117 @@ func SaveMiner(fid string) (*Miner, error) {
 
 	return minerCreated, nil
 }
+
+func GetMiners(status string) ([]*Miner, error) {
+	db := database.GetDB()
+	if status != "" {
+		db = db.Where("status=?", status)
+	}
+
+	var miners []*Miner
+	err := db.Order("score desc,id").Find(&miners).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return miners, nil
+}
+
+type MinerStat struct {
+	MinerId         int64  `json:"miner_id"`
+	DealCnt         int    `json:"deal_cnt"`
+	DealActiveCnt   int    `json:"deal_active_cnt"`
+	DealFailedCnt   int    `json:"deal_failed_cnt"`
+	DealSlashedCnt  int    `json:"deal_slashed_cnt"`
+	AvgActiveSecond int64  `json:"avg_active_second"`
+	LatestDealId    *int64 `json:"latest_deal_id"`
+
+	RetrievalCheckCnt     int   `json:"retrieval_check_cnt"`
+	RetrievalSucceededCnt int   `json:"retrieval_succeeded_cnt"`
+	AvgRetrievalLatencyMs int64 `json:"avg_retrieval_latency_ms"`
+}
+
+// GetMinerStats summarizes the offline deal history of each miner, the time to active is from the deal sent
+// till the first StorageDealActive log of the deal, the retrieval checks are counted in the latest stat window, with the
+// latency averaged over the succeeded ones. The deals sent to the miners while blocklisted are not counted
+func GetMinerStats() ([]*MinerStat, error) {
+	sql := "select a.miner_id,count(*) deal_cnt,\n" +
+		"sum(case when a.status in (?,?) then 1 else 0 end) deal_active_cnt,\n" +
+		"sum(case when a.status=? then 1 else 0 end) deal_failed_cnt,\n" +
+		"sum(case when a.on_chain_status=? then 1 else 0 end) deal_slashed_cnt,\n" +
+		"ifnull(cast(avg(b.active_at-a.create_at) as signed),0) avg_active_second,\n" +
+		"max(case when a.status in (?,?) then a.deal_id end) latest_deal_id,\n" +
+		"ifnull(max(c.retrieval_check_cnt),0) retrieval_check_cnt,\n" +
+		"ifnull(max(c.retrieval_succeeded_cnt),0) retrieval_succeeded_cnt,\n" +
+		"ifnull(max(c.avg_retrieval_latency_ms),0) avg_retrieval_latency_ms\n" +
+		"from offline_deal a\n" +
+		"left join (select offline_deal_id,min(create_at) active_at from offline_deal_log where on_chain_status=? group by offline_deal_id) b on a.id=b.offline_deal_id\n" +
+		"left join (select miner_id,count(*) retrieval_check_cnt,sum(case when status=? then 1 else 0 end) retrieval_succeeded_cnt,\n" +
+		"  cast(avg(case when status=? then latency_ms end) as signed) avg_retrieval_latency_ms\n" +
+		"  from retrieval_check where create_at>=? group by miner_id) c on a.miner_id=c.miner_id\n" +
+		"where a.status<>?\n" +
+		"group by a.miner_id"
+
+	params := []interface{}{}
+	params = append(params, constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS)
+	params = append(params, constants.OFFLINE_DEAL_STATUS_FAILED)
+	params = append(params, constants.ON_CHAIN_DEAL_STATUS_SLASHED)
+	params = append(params, constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS)
+	params = append(params, constants.ON_CHAIN_DEAL_STATUS_ACTIVE)
+	params = append(params, constants.RETRIEVAL_CHECK_STATUS_SUCCEEDED, constants.RETRIEVAL_CHECK_STATUS_SUCCEEDED)
+	params = append(params, libutils.GetCurrentUtcSecond()-constants.RETRIEVAL_CHECK_STAT_WINDOW_SECOND)
+	params = append(params, constants.OFFLINE_DEAL_STATUS_MINER_BLOCKLISTED)
+
+	var minerStats []*MinerStat
+	err := database.GetDB().Raw(sql, params...).Scan(&minerStats).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return minerStats, nil
+}
+
+func UpdateMinerReputation(minerStat *MinerStat, successRate, retrievalSuccessRate float64, price *decimal.Decimal, score float64) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["deal_cnt"] = minerStat.DealCnt
+	fields2BeUpdated["deal_active_cnt"] = minerStat.DealActiveCnt
+	fields2BeUpdated["deal_failed_cnt"] = minerStat.DealFailedCnt
+	fields2BeUpdated["deal_slashed_cnt"] = minerStat.DealSlashedCnt
+	fields2BeUpdated["success_rate"] = successRate
+	fields2BeUpdated["avg_active_second"] = minerStat.AvgActiveSecond
+	fields2BeUpdated["retrieval_check_cnt"] = minerStat.RetrievalCheckCnt
+	fields2BeUpdated["retrieval_success_rate"] = retrievalSuccessRate
+	fields2BeUpdated["avg_retrieval_latency_ms"] = minerStat.AvgRetrievalLatencyMs
+	fields2BeUpdated["score"] = score
+	fields2BeUpdated["update_at"] = currentUtcSecond
+	if price != nil {
+		fields2BeUpdated["price"] = *price
+	}
+
+	err := database.GetDB().Model(Miner{}).Where("id=?", minerStat.MinerId).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateMinerStatus(id int64, status, note string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["note"] = note
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(Miner{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// MultipartUpload is a multipart upload of the s3 gateway in progress, its parts are kept locally till completed
+type MultipartUpload struct {
+	ID          int64  `json:"id"`
+	UploadId    string `json:"upload_id"`
+	BucketId    int64  `json:"bucket_id"`
+	ObjectKey   string `json:"object_key"`
+	ContentType string `json:"content_type"`
+	CreateAt    int64  `json:"create_at"`
+	UpdateAt    int64  `json:"update_at"`
+}
+
+type MultipartUploadPart struct {
+	ID                int64  `json:"id"`
+	MultipartUploadId int64  `json:"multipart_upload_id"`
+	PartNumber        int    `json:"part_number"`
+	Etag              string `json:"etag"`
+	Size              int64  `json:"size"`
+	CreateAt          int64  `json:"create_at"`
+	UpdateAt          int64  `json:"update_at"`
+}
+
+func CreateMultipartUpload(multipartUpload *MultipartUpload) (*MultipartUpload, error) {
+	err := database.SaveOne(multipartUpload)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return multipartUpload, nil
+}
+
+func GetMultipartUploadByUploadId(uploadId string) (*MultipartUpload, error) {
+	var multipartUploads []*MultipartUpload
+	err := database.GetDB().Where("upload_id=?", uploadId).Find(&multipartUploads).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(multipartUploads) > 0 {
+		return multipartUploads[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetMultipartUploadCntByBucketId(bucketId int64) (int64, error) {
+	var cnt int64
+	err := database.GetDB().Model(MultipartUpload{}).Where("bucket_id=?", bucketId).Count(&cnt).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return cnt, nil
+}
+
+// SaveMultipartUploadPart records the part, or replaces the part uploaded before with the same number
+func SaveMultipartUploadPart(multipartUploadId int64, partNumber int, etag string, size int64) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert into multipart_upload_part(multipart_upload_id,part_number,etag,size,create_at,update_at) values(?,?,?,?,?,?)\n" +
+		"on duplicate key update etag=values(etag),size=values(size),update_at=values(update_at)"
+	params := []interface{}{}
+	params = append(params, multipartUploadId, partNumber, etag, size, currentUtcSecond, currentUtcSecond)
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func GetMultipartUploadParts(multipartUploadId int64) ([]*MultipartUploadPart, error) {
+	var parts []*MultipartUploadPart
+	err := database.GetDB().Where("multipart_upload_id=?", multipartUploadId).Order("part_number").Find(&parts).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+func DeleteMultipartUpload(id int64) error {
+	db := database.GetDBTransaction()
+	err := db.Where("multipart_upload_id=?", id).Delete(MultipartUploadPart{}).Error
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = db.Where("id=?", id).Delete(MultipartUpload{}).Error
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -24,6 +24,9 @@ type OfflineDeal struct {
 	UnlockTxHash   *string `json:"unlock_tx_hash"`
 	UnlockAt       *int64  `json:"unlock_at"`
 	Note           *string `json:"note"`
+	NextScanAt     *int64  `json:"next_scan_at"`
+	ScanInterval   int64   `json:"scan_interval"`
+	EndEpoch       *int64  `json:"end_epoch"`
 	CreateAt       int64   `json:"create_at"`
 	UpdateAt       int64   `json:"update_at"`
 }
@@ -33,9 +36,11 @@ type OfflineDealOut struct {
 	MinerFid string `json:"miner_fid"`
 }
 
-func GetOfflineDeals2BeScanned() ([]*OfflineDeal, error) {
+func GetOfflineDeals2BeScanned(currentUtcSecond int64, limit int) ([]*OfflineDeal, error) {
 	var offlineDeals []*OfflineDeal
-	err := database.GetDB().Where("status not in (?,?,?)", constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS, constants.OFFLINE_DEAL_STATUS_FAILED).Find(&offlineDeals).Error
+	err := database.GetDB().Where("status not in (?,?,?,?) and (next_scan_at is null or next_scan_at<=?)",
+		constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS, constants.OFFLINE_DEAL_STATUS_FAILED, constants.OFFLINE_DEAL_STATUS_MINER_BLOCKLISTED, currentUtcSecond).
+		Order("next_scan_at").Limit(limit).Find(&offlineDeals).Error
 
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -45,9 +50,13 @@ func GetOfflineDeals2BeScanned() ([]*OfflineDeal, error) {
 	return offlineDeals, nil
 }
 
-func GetOfflineDeals2BeScannedAfterActive() ([]*OfflineDeal, error) {
+// GetOfflineDeals2BeScannedAfterActive excludes the deals slashed or expired, their status is final
+func GetOfflineDeals2BeScannedAfterActive(currentUtcSecond int64, limit int) ([]*OfflineDeal, error) {
 	var offlineDeals []*OfflineDeal
-	err := database.GetDB().Where("status in (?,?) and on_chain_status!=?", constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS, constants.ON_CHAIN_DEAL_STATUS_ACTIVE).Find(&offlineDeals).Error
+	err := database.GetDB().Where("status in (?,?) and on_chain_status not in (?,?,?) and (next_scan_at is null or next_scan_at<=?)",
+		constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS,
+		constants.ON_CHAIN_DEAL_STATUS_ACTIVE, constants.ON_CHAIN_DEAL_STATUS_SLASHED, constants.ON_CHAIN_DEAL_STATUS_EXPIRED, currentUtcSecond).
+		Order("next_scan_at").Limit(limit).Find(&offlineDeals).Error
 
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -176,6 +185,29 @@ func GetOfflineDealsBySourceFileUploadId(sourceFileUploadId int64) ([]*OfflineDe
 	return offlineDeals, nil
 }
 
+type SourceFileDeal struct {
+	DealId   int64  `json:"deal_id"`
+	PieceCid string `json:"piece_cid"`
+	MinerFid string `json:"miner_fid"`
+}
+
+// GetSourceFileActiveDeals returns the active deals of the car files containing the source file
+func GetSourceFileActiveDeals(sourceFileId int64) ([]*SourceFileDeal, error) {
+	sql := "select distinct d.deal_id,c.piece_cid,e.fid miner_fid\n" +
+		"from source_file_upload a,car_file_source b,car_file c,offline_deal d,miner e\n" +
+		"where a.source_file_id=? and a.id=b.source_file_upload_id and b.car_file_id=c.id\n" +
+		"  and c.id=d.car_file_id and d.miner_id=e.id and d.on_chain_status=?"
+
+	var sourceFileDeals []*SourceFileDeal
+	err := database.GetDB().Raw(sql, sourceFileId, constants.ON_CHAIN_DEAL_STATUS_ACTIVE).Scan(&sourceFileDeals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFileDeals, nil
+}
+
 func GetOfflineDealsByCarFileId(carFileId int64) ([]*OfflineDeal, error) {
 	var offlineDeals []*OfflineDeal
 	err := database.GetDB().Where("car_file_id=?", carFileId).Find(&offlineDeals).Error
@@ -214,6 +246,35 @@ func GetOfflineDealOutsBySourceFileUploadId(sourceFileUploadId int64) ([]*Offlin
 	return offlineDeals, nil
 }
 
+type offlineDealOutOfSourceFileUpload struct {
+	OfflineDealOut
+	SourceFileUploadId int64 `json:"source_file_upload_id"`
+}
+
+// GetOfflineDealOutsBySourceFileUploadIds returns the deals of the car files of each source file upload, in one query
+func GetOfflineDealOutsBySourceFileUploadIds(sourceFileUploadIds []int64) (map[int64][]*OfflineDealOut, error) {
+	offlineDealOuts := map[int64][]*OfflineDealOut{}
+	if len(sourceFileUploadIds) == 0 {
+		return offlineDealOuts, nil
+	}
+
+	var offlineDeals []*offlineDealOutOfSourceFileUpload
+	sql := "select b.*,c.fid miner_fid,a.source_file_upload_id from car_file_source a,offline_deal b,miner c\n" +
+		"where a.source_file_upload_id in (?) and a.car_file_id=b.car_file_id and b.miner_id=c.id\n"
+	err := database.GetDB().Raw(sql, sourceFileUploadIds).Scan(&offlineDeals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	for _, offlineDeal := range offlineDeals {
+		offlineDealOut := offlineDeal.OfflineDealOut
+		offlineDealOuts[offlineDeal.SourceFileUploadId] = append(offlineDealOuts[offlineDeal.SourceFileUploadId], &offlineDealOut)
+	}
+
+	return offlineDealOuts, nil
+}
+
 func GetOfflineDealByDealId(dealId int64) (*OfflineDeal, error) {
 	if dealId <= 0 {
 		err := fmt.Errorf("deal id must be greater than 0")
@@ -282,3 +343,105 @@ func UpdateOfflineDealOnChainStatus(id int64, onChainStatus string) error {
 
 	return nil
 }
+
+func UpdateOfflineDealEndEpoch(id int64, endEpoch int64) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["end_epoch"] = endEpoch
+
+	err := database.GetDB().Model(OfflineDeal{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateOfflineDealNextScan(id int64, nextScanAt, scanInterval int64) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["next_scan_at"] = nextScanAt
+	fields2BeUpdated["scan_interval"] = scanInterval
+
+	err := database.GetDB().Model(OfflineDeal{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func GetOfflineDealsActive() ([]*OfflineDeal, error) {
+	var offlineDeals []*OfflineDeal
+	err := database.GetDB().Where("status in (?,?) and deal_id is not null and (on_chain_status is null or on_chain_status not in (?,?))",
+		constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS,
+		constants.ON_CHAIN_DEAL_STATUS_SLASHED, constants.ON_CHAIN_DEAL_STATUS_EXPIRED).Find(&offlineDeals).Error
+
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return offlineDeals, nil
+}
+
+type CarFileReplica struct {
+	CarFileId        int64 `json:"car_file_id"`
+	ActiveReplicaCnt int   `json:"active_replica_cnt"`
+	PendingDealCnt   int   `json:"pending_deal_cnt"`
+	LostReplicaCnt   int   `json:"lost_replica_cnt"`
+}
+
+func getCarFileReplicas(carFileId *int64) ([]*CarFileReplica, error) {
+	sql := "select a.id car_file_id,\n" +
+		"sum(case when b.status in (?,?) and (b.on_chain_status is null or b.on_chain_status not in (?,?)) then 1 else 0 end) active_replica_cnt,\n" +
+		"sum(case when b.status=? then 1 else 0 end) pending_deal_cnt,\n" +
+		"sum(case when b.on_chain_status in (?,?) then 1 else 0 end) lost_replica_cnt\n" +
+		"from car_file a, offline_deal b\n" +
+		"where a.id=b.car_file_id and a.status in (?,?)"
+
+	params := []interface{}{}
+	params = append(params, constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS)
+	params = append(params, constants.ON_CHAIN_DEAL_STATUS_SLASHED, constants.ON_CHAIN_DEAL_STATUS_EXPIRED)
+	params = append(params, constants.OFFLINE_DEAL_STATUS_CREATED)
+	params = append(params, constants.ON_CHAIN_DEAL_STATUS_SLASHED, constants.ON_CHAIN_DEAL_STATUS_EXPIRED)
+	params = append(params, constants.CAR_FILE_STATUS_DEAL_SENT, constants.CAR_FILE_STATUS_COMPLETED)
+
+	if carFileId != nil {
+		sql = sql + " and a.id=?"
+		params = append(params, *carFileId)
+	}
+
+	sql = sql + "\ngroup by a.id"
+
+	var carFileReplicas []*CarFileReplica
+	err := database.GetDB().Raw(sql, params...).Scan(&carFileReplicas).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return carFileReplicas, nil
+}
+
+func GetCarFileReplicas() ([]*CarFileReplica, error) {
+	return getCarFileReplicas(nil)
+}
+
+func GetCarFileReplicaByCarFileId(carFileId int64) (*CarFileReplica, error) {
+	carFileReplicas, err := getCarFileReplicas(&carFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(carFileReplicas) > 0 {
+		return carFileReplicas[0], nil
+	}
+
+	carFileReplica := &CarFileReplica{
+		CarFileId: carFileId,
+	}
+
+	return carFileReplica, nil
+}
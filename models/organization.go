@@ -0,0 +1,166 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// Organization owns the uploads of its member wallets made for it, sharing their plan and billing
+type Organization struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	CreateAt int64  `json:"create_at"`
+	UpdateAt int64  `json:"update_at"`
+}
+
+type OrganizationMember struct {
+	ID             int64  `json:"id"`
+	OrganizationId int64  `json:"organization_id"`
+	WalletId       int64  `json:"wallet_id"`
+	Role           string `json:"role"`
+	CreateAt       int64  `json:"create_at"`
+	UpdateAt       int64  `json:"update_at"`
+}
+
+// OrganizationOut is an organization with the role of the wallet in it
+type OrganizationOut struct {
+	Organization
+	Role string `json:"role"`
+}
+
+type OrganizationMemberOut struct {
+	OrganizationMember
+	WalletAddress string `json:"wallet_address"`
+}
+
+// CreateOrganization creates the organization with the wallet as its owner
+func CreateOrganization(name string, walletId int64) (*Organization, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	organization := &Organization{
+		Name:     name,
+		CreateAt: currentUtcSecond,
+		UpdateAt: currentUtcSecond,
+	}
+
+	db := database.GetDBTransaction()
+	err := database.SaveOneInTransaction(db, organization)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	organizationMember := &OrganizationMember{
+		OrganizationId: organization.ID,
+		WalletId:       walletId,
+		Role:           constants.ORGANIZATION_ROLE_OWNER,
+		CreateAt:       currentUtcSecond,
+		UpdateAt:       currentUtcSecond,
+	}
+
+	err = database.SaveOneInTransaction(db, organizationMember)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+func GetOrganizationById(id int64) (*Organization, error) {
+	var organizations []*Organization
+	err := database.GetDB().Where("id=?", id).Find(&organizations).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(organizations) > 0 {
+		return organizations[0], nil
+	}
+
+	return nil, nil
+}
+
+// GetOrganizationsByWalletId returns the organizations the wallet is a member of, with its role
+func GetOrganizationsByWalletId(walletId int64) ([]*OrganizationOut, error) {
+	sql := "select a.*,b.role from organization a, organization_member b\n" +
+		"where b.wallet_id=? and b.organization_id=a.id\n" +
+		"order by a.id"
+
+	var organizations []*OrganizationOut
+	err := database.GetDB().Raw(sql, walletId).Scan(&organizations).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return organizations, nil
+}
+
+// GetOrganizationMember returns the membership of the wallet in the organization, nil if not a member
+func GetOrganizationMember(organizationId, walletId int64) (*OrganizationMember, error) {
+	var organizationMembers []*OrganizationMember
+	err := database.GetDB().Where("organization_id=? and wallet_id=?", organizationId, walletId).Find(&organizationMembers).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(organizationMembers) > 0 {
+		return organizationMembers[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetOrganizationMembers(organizationId int64) ([]*OrganizationMemberOut, error) {
+	sql := "select a.*,b.address wallet_address from organization_member a, wallet b\n" +
+		"where a.organization_id=? and a.wallet_id=b.id\n" +
+		"order by a.id"
+
+	var organizationMembers []*OrganizationMemberOut
+	err := database.GetDB().Raw(sql, organizationId).Scan(&organizationMembers).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return organizationMembers, nil
+}
+
+// SaveOrganizationMember adds the wallet to the organization, or changes its role if a member already
+func SaveOrganizationMember(organizationId, walletId int64, role string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert into organization_member(organization_id,wallet_id,role,create_at,update_at) values(?,?,?,?,?)\n" +
+		"on duplicate key update role=values(role),update_at=values(update_at)"
+	params := []interface{}{}
+	params = append(params, organizationId, walletId, role, currentUtcSecond, currentUtcSecond)
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func DeleteOrganizationMember(organizationId, walletId int64) error {
+	err := database.GetDB().Where("organization_id=? and wallet_id=?", organizationId, walletId).Delete(OrganizationMember{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
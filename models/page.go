@@ -0,0 +1,150 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"multi-chain-storage/database"
+	"regexp"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// ErrInvalidCursor is wrapped by the errors of a cursor not returned by the listing, for errors.Is
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var numericCursorValueRegexp = regexp.MustCompile(`^-?[0-9]{1,47}(\.[0-9]{1,18})?$`)
+
+// Page is a page of a listing, the rows after the cursor if given, otherwise the rows of the page number from 1
+type Page struct {
+	Limit      int
+	PageNumber int
+	Cursor     string // next_cursor of the previous page
+}
+
+// sortColumn is the sql of a column a listing can be sorted by, not null, the numeric ones compared as decimals
+type sortColumn struct {
+	sql       string
+	isNumeric bool
+}
+
+// pageCursor is the last row of a page, by its value sorted by and its id breaking the ties
+type pageCursor struct {
+	Value string `json:"v"`
+	Id    int64  `json:"id"`
+}
+
+func encodePageCursor(value string, id int64) string {
+	cursorJson, _ := json.Marshal(pageCursor{Value: value, Id: id})
+	return base64.RawURLEncoding.EncodeToString(cursorJson)
+}
+
+func decodePageCursor(cursor string, column sortColumn) (*pageCursor, error) {
+	cursorJson, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		err := fmt.Errorf("%w, not base64", ErrInvalidCursor)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var pageCursor pageCursor
+	err = json.Unmarshal(cursorJson, &pageCursor)
+	if err != nil || (column.isNumeric && !numericCursorValueRegexp.MatchString(pageCursor.Value)) {
+		err := fmt.Errorf("%w, not of the sort order", ErrInvalidCursor)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &pageCursor, nil
+}
+
+// getSortColumn returns the column of the name, the default one if not found
+func getSortColumn(sortColumns map[string]sortColumn, name *string, nameDefault string) sortColumn {
+	if name != nil {
+		if column, ok := sortColumns[*name]; ok {
+			return column
+		}
+	}
+
+	return sortColumns[nameDefault]
+}
+
+// getWhereSql returns the condition of the rows after the cursor in the order of the column and then the id, empty if
+// no cursor
+func (p *Page) getWhereSql(column sortColumn, idSql string, isAscend bool) (string, []interface{}, error) {
+	params := []interface{}{}
+	if p == nil || p.Cursor == "" {
+		return "", params, nil
+	}
+
+	pageCursor, err := decodePageCursor(p.Cursor, column)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", nil, err
+	}
+
+	operator := "<"
+	if isAscend {
+		operator = ">"
+	}
+
+	valueSql := "?"
+	if column.isNumeric {
+		valueSql = "cast(? as decimal(65,18))"
+	}
+
+	sql := " and (" + column.sql + operator + valueSql + " or (" + column.sql + "=" + valueSql + " and " + idSql + operator + "?))"
+	params = append(params, pageCursor.Value, pageCursor.Value, pageCursor.Id)
+	return sql, params, nil
+}
+
+// getOrderLimitSql returns the order by the column and then the id, and the limit of the page, one row more than the
+// page to tell if there are more
+func (p *Page) getOrderLimitSql(column sortColumn, idSql string, isAscend bool) (string, []interface{}) {
+	direction := " desc"
+	if isAscend {
+		direction = " asc"
+	}
+
+	sql := "\norder by " + column.sql + direction + "," + idSql + direction
+	params := []interface{}{}
+	if p == nil {
+		return sql, params
+	}
+
+	sql = sql + " limit ?"
+	params = append(params, p.Limit+1)
+	if p.Cursor == "" && p.PageNumber > 1 {
+		sql = sql + " offset ?"
+		params = append(params, (p.PageNumber-1)*p.Limit)
+	}
+
+	return sql, params
+}
+
+// hasMore returns whether the rows got by getOrderLimitSql are more than the page
+func (p *Page) hasMore(rowCnt int) bool {
+	return p != nil && rowCnt > p.Limit
+}
+
+type rowCount struct {
+	RowCnt int `json:"row_cnt"`
+}
+
+// getRowCount returns the count of the rows of the from and where sql
+func getRowCount(fromSql string, params []interface{}) (int, error) {
+	var rowCount rowCount
+	err := database.GetDB().Raw("select count(*) row_cnt "+fromSql, params...).Scan(&rowCount).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return rowCount.RowCnt, nil
+}
+
+// getSortValueSql returns the column selected as sort_value, for the cursors
+func (c sortColumn) getSortValueSql() string {
+	return "cast(" + c.sql + " as char) sort_value"
+}
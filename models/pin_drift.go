@@ -0,0 +1,54 @@
+package models
+
+import (
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// PinDrift is a difference between the pins on the hot storage and the pin status in the database found by ReconcilePin,
+// the same drift found again updates the row
+type PinDrift struct {
+	ID           int64   `json:"id"`
+	SourceFileId int64   `json:"source_file_id"`
+	PayloadCid   string  `json:"payload_cid"`
+	Kind         string  `json:"kind"`
+	Status       string  `json:"status"`
+	Message      *string `json:"message"`
+	DetectCnt    int     `json:"detect_cnt"`
+	CreateAt     int64   `json:"create_at"`
+	UpdateAt     int64   `json:"update_at"`
+}
+
+func SavePinDrift(sourceFileId int64, payloadCid, kind, status string, message *string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert into pin_drift(source_file_id,payload_cid,kind,status,message,detect_cnt,create_at,update_at) values(?,?,?,?,?,1,?,?)\n" +
+		"on duplicate key update status=values(status),message=values(message),detect_cnt=detect_cnt+1,update_at=values(update_at)"
+	params := []interface{}{}
+	params = append(params, sourceFileId, payloadCid, kind, status, message, currentUtcSecond, currentUtcSecond)
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetPinDrifts returns the drifts of the status if given, latest found first
+func GetPinDrifts(status *string, limit, offset int) ([]*PinDrift, error) {
+	db := database.GetDB()
+	if status != nil {
+		db = db.Where("status=?", *status)
+	}
+
+	var pinDrifts []*PinDrift
+	err := db.Order("update_at desc").Limit(limit).Offset(offset).Find(&pinDrifts).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return pinDrifts, nil
+}
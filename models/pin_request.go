@@ -0,0 +1,149 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+	"strconv"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// PinRequest is a pin of the ipfs pinning service api, it is mapped to a source file upload once the content is pinned
+type PinRequest struct {
+	ID                 int64   `json:"id"`
+	RequestId          string  `json:"request_id"`
+	WalletId           int64   `json:"wallet_id"`
+	Cid                string  `json:"cid"`
+	Name               *string `json:"name"`
+	Origins            *string `json:"origins"` // json array of multiaddrs
+	Meta               *string `json:"meta"`    // json object of string values
+	Status             string  `json:"status"`
+	Info               *string `json:"info"`
+	SourceFileUploadId *int64  `json:"source_file_upload_id"`
+	CreateAt           int64   `json:"create_at"`
+	UpdateAt           int64   `json:"update_at"`
+}
+
+func CreatePinRequest(pinRequest *PinRequest) (*PinRequest, error) {
+	err := database.SaveOne(pinRequest)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return pinRequest, nil
+}
+
+func GetPinRequestByRequestId(requestId string) (*PinRequest, error) {
+	var pinRequests []*PinRequest
+	err := database.GetDB().Where("request_id=?", requestId).Find(&pinRequests).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(pinRequests) > 0 {
+		return pinRequests[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetPinRequestsByStatus(status string, limit int) ([]*PinRequest, error) {
+	var pinRequests []*PinRequest
+	err := database.GetDB().Where("status=?", status).Order("id").Limit(limit).Find(&pinRequests).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return pinRequests, nil
+}
+
+// GetPinRequests returns the pin requests of the wallet from the latest, the name is matched by the like pattern
+// when it is set, case sensitive unless nameIgnoreCase, and each meta entry should be found in the json meta
+func GetPinRequests(walletId int64, cids []string, nameLike *string, nameIgnoreCase bool, statuses []string, createAtBefore, createAtAfter *int64, meta map[string]string, limit int) ([]*PinRequest, int64, error) {
+	db := database.GetDB().Model(PinRequest{}).Where("wallet_id=?", walletId)
+	if len(cids) > 0 {
+		db = db.Where("cid in (?)", cids)
+	}
+	if nameLike != nil {
+		if nameIgnoreCase {
+			db = db.Where("lower(name) like lower(?)", *nameLike)
+		} else {
+			db = db.Where("name like ?", *nameLike)
+		}
+	}
+	if len(statuses) > 0 {
+		db = db.Where("status in (?)", statuses)
+	}
+	if createAtBefore != nil {
+		db = db.Where("create_at<?", *createAtBefore)
+	}
+	if createAtAfter != nil {
+		db = db.Where("create_at>?", *createAtAfter)
+	}
+	for key, value := range meta {
+		db = db.Where("json_unquote(json_extract(meta,?))=?", "$."+strconv.Quote(key), value)
+	}
+
+	var totalRecordCount int64
+	err := db.Count(&totalRecordCount).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, 0, err
+	}
+
+	var pinRequests []*PinRequest
+	err = db.Order("create_at desc, id desc").Limit(limit).Find(&pinRequests).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, 0, err
+	}
+
+	return pinRequests, totalRecordCount, nil
+}
+
+func UpdatePinRequestStatus(id int64, status string, info *string, sourceFileUploadId *int64) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["info"] = info
+	if sourceFileUploadId != nil {
+		fields2BeUpdated["source_file_upload_id"] = *sourceFileUploadId
+	}
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	err := database.GetDB().Model(PinRequest{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// ResetPinRequestsPinning sets the requests left in pinning by a stopped run back to queued
+func ResetPinRequestsPinning() error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = constants.PIN_REQUEST_STATUS_QUEUED
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	err := database.GetDB().Model(PinRequest{}).Where("status=?", constants.PIN_REQUEST_STATUS_PINNING).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func DeletePinRequest(id int64) error {
+	err := database.GetDB().Where("id=?", id).Delete(PinRequest{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
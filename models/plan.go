@@ -0,0 +1,125 @@
+package models
+
+import (
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// Plan is the monthly free bytes and the limits of the wallets assigned to it, a limit of 0 means no limit
+type Plan struct {
+	ID                int64  `json:"id"`
+	Name              string `json:"name"`
+	MonthlyFreeBytes  int64  `json:"monthly_free_bytes"`
+	MaxFileSize       int64  `json:"max_file_size"`
+	MaxFiles          int    `json:"max_files"` // uploads per calendar month
+	RequestsPerMinute int    `json:"requests_per_minute"`
+	UploadsPerMinute  int    `json:"uploads_per_minute"`
+	CreateAt          int64  `json:"create_at"`
+	UpdateAt          int64  `json:"update_at"`
+}
+
+// PlanAssignment assigns the plan to the subject, such as a wallet
+type PlanAssignment struct {
+	ID          int64  `json:"id"`
+	SubjectType string `json:"subject_type"`
+	SubjectId   int64  `json:"subject_id"`
+	PlanId      int64  `json:"plan_id"`
+	CreateAt    int64  `json:"create_at"`
+	UpdateAt    int64  `json:"update_at"`
+}
+
+func GetPlanById(id int64) (*Plan, error) {
+	var plans []*Plan
+	err := database.GetDB().Where("id=?", id).Find(&plans).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(plans) > 0 {
+		return plans[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetPlanByName(name string) (*Plan, error) {
+	var plans []*Plan
+	err := database.GetDB().Where("name=?", name).Find(&plans).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(plans) > 0 {
+		return plans[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetPlans() ([]*Plan, error) {
+	var plans []*Plan
+	err := database.GetDB().Order("id").Find(&plans).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// SavePlan adds the plan, or updates the plan of the same name
+func SavePlan(plan *Plan) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert into plan(name,monthly_free_bytes,max_file_size,max_files,requests_per_minute,uploads_per_minute,create_at,update_at)\n" +
+		"values(?,?,?,?,?,?,?,?)\n" +
+		"on duplicate key update monthly_free_bytes=values(monthly_free_bytes),max_file_size=values(max_file_size),max_files=values(max_files),\n" +
+		"requests_per_minute=values(requests_per_minute),uploads_per_minute=values(uploads_per_minute),update_at=values(update_at)"
+	params := []interface{}{}
+	params = append(params, plan.Name, plan.MonthlyFreeBytes, plan.MaxFileSize, plan.MaxFiles, plan.RequestsPerMinute, plan.UploadsPerMinute)
+	params = append(params, currentUtcSecond, currentUtcSecond)
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetAssignedPlan returns the plan assigned to the subject, nil if none
+func GetAssignedPlan(subjectType string, subjectId int64) (*Plan, error) {
+	sql := "select b.* from plan_assignment a, plan b where a.subject_type=? and a.subject_id=? and a.plan_id=b.id"
+
+	var plans []*Plan
+	err := database.GetDB().Raw(sql, subjectType, subjectId).Scan(&plans).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(plans) > 0 {
+		return plans[0], nil
+	}
+
+	return nil, nil
+}
+
+// SavePlanAssignment assigns the plan to the subject, replacing the plan assigned before
+func SavePlanAssignment(subjectType string, subjectId, planId int64) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert into plan_assignment(subject_type,subject_id,plan_id,create_at,update_at) values(?,?,?,?,?)\n" +
+		"on duplicate key update plan_id=values(plan_id),update_at=values(update_at)"
+	params := []interface{}{}
+	params = append(params, subjectType, subjectId, planId, currentUtcSecond, currentUtcSecond)
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
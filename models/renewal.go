@@ -0,0 +1,245 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	libutils "github.com/filswan/go-swan-lib/utils"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+type Renewal struct {
+	ID                 int64   `json:"id"`
+	Uuid               string  `json:"uuid"`
+	SourceFileUploadId int64   `json:"source_file_upload_id"`
+	CarFileId          int64   `json:"car_file_id"`
+	CarFileIdRenewed   *int64  `json:"car_file_id_renewed"`
+	EndEpoch           int64   `json:"end_epoch"`
+	Duration           int     `json:"duration"`
+	PayAmount          string  `json:"pay_amount"`
+	PayTxHash          *string `json:"pay_tx_hash"`
+	Status             string  `json:"status"`
+	Note               *string `json:"note"`
+	AttemptCnt         int     `json:"attempt_cnt"`
+	NextAttemptAt      *int64  `json:"next_attempt_at"`
+	CreateAt           int64   `json:"create_at"`
+	UpdateAt           int64   `json:"update_at"`
+}
+
+type SourceFileUpload2Renew struct {
+	SourceFileUploadId int64 `json:"source_file_upload_id"`
+	CarFileId          int64 `json:"car_file_id"`
+	EndEpoch           int64 `json:"end_epoch"`
+	FileSize           int64 `json:"file_size"`
+}
+
+// GetSourceFileUploads2Renew returns the source file uploads whose active deals end before endEpochMax and not quoted yet
+func GetSourceFileUploads2Renew(endEpochMax int64) ([]*SourceFileUpload2Renew, error) {
+	sql := "select a.source_file_upload_id,b.id car_file_id,max(c.start_epoch)+b.duration*? end_epoch,e.file_size\n" +
+		"from car_file_source a\n" +
+		"join car_file b on a.car_file_id=b.id\n" +
+		"join offline_deal c on b.id=c.car_file_id and c.status in (?,?) and (c.on_chain_status is null or c.on_chain_status not in (?,?))\n" +
+		"join source_file_upload d on a.source_file_upload_id=d.id\n" +
+		"join source_file e on d.source_file_id=e.id\n" +
+		"where not exists (select 1 from renewal f where f.source_file_upload_id=a.source_file_upload_id and f.car_file_id=b.id)\n" +
+		"group by a.source_file_upload_id,b.id,b.duration,e.file_size\n" +
+		"having end_epoch<=?"
+
+	params := []interface{}{}
+	params = append(params, constants.EPOCH_PER_DAY)
+	params = append(params, constants.OFFLINE_DEAL_STATUS_ACTIVE, constants.OFFLINE_DEAL_STATUS_SUCCESS)
+	params = append(params, constants.ON_CHAIN_DEAL_STATUS_SLASHED, constants.ON_CHAIN_DEAL_STATUS_EXPIRED)
+	params = append(params, endEpochMax)
+
+	var sourceFileUploads2Renew []*SourceFileUpload2Renew
+	err := database.GetDB().Raw(sql, params...).Scan(&sourceFileUploads2Renew).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFileUploads2Renew, nil
+}
+
+func GetRenewalById(id int64) (*Renewal, error) {
+	var renewals []*Renewal
+	err := database.GetDB().Where("id=?", id).Find(&renewals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(renewals) > 0 {
+		return renewals[0], nil
+	}
+
+	return nil, nil
+}
+
+// GetRenewalByCarFileIdRenewed returns the renewal the car file is created for, nil for the car files of uploads
+func GetRenewalByCarFileIdRenewed(carFileIdRenewed int64) (*Renewal, error) {
+	var renewals []*Renewal
+	err := database.GetDB().Where("car_file_id_renewed=?", carFileIdRenewed).Find(&renewals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(renewals) > 0 {
+		return renewals[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetRenewalsByStatus(status string) ([]*Renewal, error) {
+	var renewals []*Renewal
+	err := database.GetDB().Where("status=?", status).Find(&renewals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return renewals, nil
+}
+
+// GetRenewals2Renew returns the paid renewals not attempted before or whose next attempt is due
+func GetRenewals2Renew(currentUtcSecond int64) ([]*Renewal, error) {
+	var renewals []*Renewal
+	err := database.GetDB().Where("status=? and (next_attempt_at is null or next_attempt_at<=?)", constants.RENEWAL_STATUS_PAID, currentUtcSecond).Find(&renewals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return renewals, nil
+}
+
+// IsPayTxHashUsed returns whether the tx hash is recorded as the payment of a renewal or a source file upload
+func IsPayTxHashUsed(payTxHash string) (bool, error) {
+	fromSql := "from (\n" +
+		"select id from renewal where pay_tx_hash=?\n" +
+		"union all\n" +
+		"select id from transaction where pay_tx_hash=?\n" +
+		") a"
+
+	rowCount, err := getRowCount(fromSql, []interface{}{payTxHash, payTxHash})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return rowCount > 0, nil
+}
+
+type RenewalOut struct {
+	Renewal
+	FileName   string `json:"file_name"`
+	PayloadCid string `json:"payload_cid"`
+	WCid       string `json:"w_cid"`
+}
+
+func GetRenewalsByWalletId(walletId int64, status *string) ([]*RenewalOut, error) {
+	sql := "select a.*,b.file_name,c.payload_cid,concat(a.uuid,c.payload_cid) w_cid from renewal a\n" +
+		"join source_file_upload b on a.source_file_upload_id=b.id\n" +
+		"join source_file c on b.source_file_id=c.id\n" +
+		"where b.wallet_id=?"
+
+	params := []interface{}{}
+	params = append(params, walletId)
+
+	if !libutils.IsStrEmpty(status) {
+		sql = sql + " and a.status=?"
+		params = append(params, *status)
+	}
+
+	sql = sql + "\norder by a.end_epoch"
+
+	var renewals []*RenewalOut
+	err := database.GetDB().Raw(sql, params...).Scan(&renewals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return renewals, nil
+}
+
+func CreateRenewal(renewal *Renewal) error {
+	err := database.SaveOne(renewal)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateRenewalPaid(id int64, payTxHash string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = constants.RENEWAL_STATUS_PAID
+	fields2BeUpdated["pay_tx_hash"] = payTxHash
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(Renewal{}).Where("id=? and status=?", id, constants.RENEWAL_STATUS_QUOTED).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateRenewalStatus(id int64, status, note string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["note"] = note
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(Renewal{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateRenewalAttempt records the failed attempt of the renewal, it is renewed again after nextAttemptAt
+func UpdateRenewalAttempt(id int64, attemptCnt int, nextAttemptAt int64, note string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["attempt_cnt"] = attemptCnt
+	fields2BeUpdated["next_attempt_at"] = nextAttemptAt
+	fields2BeUpdated["note"] = note
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(Renewal{}).Where("id=? and status=?", id, constants.RENEWAL_STATUS_PAID).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func ExpireRenewals(currentEpoch int64) error {
+	sql := "update renewal set status=?,update_at=? where status=? and end_epoch<?"
+
+	params := []interface{}{}
+	params = append(params, constants.RENEWAL_STATUS_EXPIRED)
+	params = append(params, libutils.GetCurrentUtcSecond())
+	params = append(params, constants.RENEWAL_STATUS_QUOTED)
+	params = append(params, currentEpoch)
+
+	err := database.GetDB().Exec(sql, params...).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	libutils "github.com/filswan/go-swan-lib/utils"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+type ReplicaRepair struct {
+	ID               int64   `json:"id"`
+	CarFileId        int64   `json:"car_file_id"`
+	ActiveReplicaCnt int     `json:"active_replica_cnt"`
+	TargetReplicaCnt int     `json:"target_replica_cnt"`
+	TaskUuid         string  `json:"task_uuid"`
+	Status           string  `json:"status"`
+	Note             *string `json:"note"`
+	CreateAt         int64   `json:"create_at"`
+	UpdateAt         int64   `json:"update_at"`
+}
+
+func GetReplicaRepairsByCarFileId(carFileId int64) ([]*ReplicaRepair, error) {
+	var replicaRepairs []*ReplicaRepair
+	err := database.GetDB().Where("car_file_id=?", carFileId).Order("id").Find(&replicaRepairs).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return replicaRepairs, nil
+}
+
+func GetReplicaRepairsByStatus(status string) ([]*ReplicaRepair, error) {
+	var replicaRepairs []*ReplicaRepair
+	err := database.GetDB().Where("status=?", status).Find(&replicaRepairs).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return replicaRepairs, nil
+}
+
+func CreateReplicaRepair(carFileId int64, activeReplicaCnt, targetReplicaCnt int, taskUuid string) (*ReplicaRepair, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	replicaRepair := ReplicaRepair{
+		CarFileId:        carFileId,
+		ActiveReplicaCnt: activeReplicaCnt,
+		TargetReplicaCnt: targetReplicaCnt,
+		TaskUuid:         taskUuid,
+		Status:           constants.REPLICA_REPAIR_STATUS_TASK_CREATED,
+		CreateAt:         currentUtcSecond,
+		UpdateAt:         currentUtcSecond,
+	}
+
+	err := database.SaveOne(&replicaRepair)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &replicaRepair, nil
+}
+
+func UpdateReplicaRepairStatus(id int64, status, note string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["note"] = note
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(ReplicaRepair{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
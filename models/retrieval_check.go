@@ -0,0 +1,90 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// RetrievalCheck is a retrieval of a source file from an active deal by CheckRetrieval, the whole file or a range of it
+type RetrievalCheck struct {
+	ID            int64   `json:"id"`
+	OfflineDealId int64   `json:"offline_deal_id"`
+	MinerId       int64   `json:"miner_id"`
+	SourceFileId  int64   `json:"source_file_id"`
+	PayloadCid    string  `json:"payload_cid"`
+	Mode          string  `json:"mode"`
+	RangeOffset   int64   `json:"range_offset"`
+	RangeLength   int64   `json:"range_length"`
+	Status        string  `json:"status"`
+	LatencyMs     int64   `json:"latency_ms"`
+	Message       *string `json:"message"`
+	CreateAt      int64   `json:"create_at"`
+}
+
+// RetrievalCheckDeal is an active deal to be checked, with a source file in its car
+type RetrievalCheckDeal struct {
+	OfflineDealId int64  `json:"offline_deal_id"`
+	DealId        int64  `json:"deal_id"`
+	MinerId       int64  `json:"miner_id"`
+	MinerFid      string `json:"miner_fid"`
+	PieceCid      string `json:"piece_cid"`
+	SourceFileId  int64  `json:"source_file_id"`
+	PayloadCid    string `json:"payload_cid"`
+	FileSize      int64  `json:"file_size"`
+}
+
+func CreateRetrievalCheck(retrievalCheck *RetrievalCheck) error {
+	err := database.GetDB().Create(retrievalCheck).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetRetrievalCheckDeals samples the active deals, the ones never checked or checked least recently first, randomly
+// among the same, each with a random source file of its car
+func GetRetrievalCheckDeals(limit int) ([]*RetrievalCheckDeal, error) {
+	sql := "select a.id offline_deal_id,a.deal_id,a.miner_id,b.fid miner_fid,c.piece_cid,\n" +
+		"  (select f.id from car_file_source d,source_file_upload e,source_file f\n" +
+		"   where d.car_file_id=a.car_file_id and d.source_file_upload_id=e.id and e.source_file_id=f.id order by rand() limit 1) source_file_id\n" +
+		"from offline_deal a\n" +
+		"join miner b on a.miner_id=b.id\n" +
+		"join car_file c on a.car_file_id=c.id\n" +
+		"left join (select offline_deal_id,max(create_at) check_at from retrieval_check group by offline_deal_id) g on a.id=g.offline_deal_id\n" +
+		"where a.on_chain_status=? and a.deal_id is not null\n" +
+		"order by ifnull(g.check_at,0),rand()\n" +
+		"limit ?"
+	sql = "select h.*,i.payload_cid,i.file_size from (" + sql + ") h join source_file i on h.source_file_id=i.id"
+
+	params := []interface{}{}
+	params = append(params, constants.ON_CHAIN_DEAL_STATUS_ACTIVE)
+	params = append(params, limit)
+
+	var retrievalCheckDeals []*RetrievalCheckDeal
+	err := database.GetDB().Raw(sql, params...).Scan(&retrievalCheckDeals).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return retrievalCheckDeals, nil
+}
+
+// GetRetrievalChecksByDealId returns the latest checks of the deal
+func GetRetrievalChecksByDealId(dealId int64, limit int) ([]*RetrievalCheck, error) {
+	sql := "select a.* from retrieval_check a,offline_deal b where b.deal_id=? and a.offline_deal_id=b.id\n" +
+		"order by a.create_at desc,a.id desc limit ?"
+
+	var retrievalChecks []*RetrievalCheck
+	err := database.GetDB().Raw(sql, dealId, limit).Scan(&retrievalChecks).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return retrievalChecks, nil
+}
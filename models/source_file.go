@@ -7,19 +7,27 @@ import (
 
 	"github.com/filswan/go-swan-lib/logs"
 	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/jinzhu/gorm"
 	"github.com/shopspring/decimal"
 )
 
 type SourceFile struct {
-	ID          int64  `json:"id"`
-	PayloadCid  string `json:"payload_cid"`
-	ResourceUri string `json:"resource_uri"`
-	IpfsUrl     string `json:"ipfs_url"`
-	FileSize    int64  `json:"file_size"`
-	Dataset     string `json:"dataset"`
-	PinStatus   string `json:"pin_status"`
-	CreateAt    int64  `json:"create_at"`
-	UpdateAt    int64  `json:"update_at"`
+	ID             int64  `json:"id"`
+	PayloadCid     string `json:"payload_cid"`
+	ResourceUri    string `json:"resource_uri"`
+	IpfsUrl        string `json:"ipfs_url"`
+	FileSize       int64  `json:"file_size"`
+	Dataset        string `json:"dataset"`
+	PinStatus      string `json:"pin_status"`
+	LocalDeletedAt *int64 `json:"local_deleted_at"`
+
+	MimeType     *string `json:"mime_type"`     // sniffed by the scan hooks
+	ScanStatus   *string `json:"scan_status"`   // nil if not scanned, such as content pinned by cid
+	ScanVerdicts *string `json:"scan_verdicts"` // verdicts of the scan hooks in json
+	ScannedAt    *int64  `json:"scanned_at"`
+
+	CreateAt int64 `json:"create_at"`
+	UpdateAt int64 `json:"update_at"`
 }
 
 type SourceFileExt struct {
@@ -89,6 +97,68 @@ func UpdateSourceFilePinStatus(sourceFileId int64, pinStatus string) error {
 	return nil
 }
 
+// UpdateSourceFilePinStatusFrom changes the pin status of the source file only if it is still pinStatusFrom, it returns
+// whether the source file is updated
+func UpdateSourceFilePinStatusFrom(sourceFileId int64, pinStatusFrom, pinStatus string) (bool, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["pin_status"] = pinStatus
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	result := database.GetDB().Model(SourceFile{}).Where("id=? and pin_status=?", sourceFileId, pinStatusFrom).Update(fields2BeUpdated)
+	if result.Error != nil {
+		logs.GetLogger().Error(result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// GetSourceFilesByPinStatus returns the source files of the pin status after the id, not updated since updateAtBefore,
+// in the order of id
+func GetSourceFilesByPinStatus(pinStatus string, idAfter, updateAtBefore int64, limit int) ([]*SourceFile, error) {
+	var sourceFiles []*SourceFile
+	err := database.GetDB().Where("pin_status=? and id>? and update_at<?", pinStatus, idAfter, updateAtBefore).Order("id").Limit(limit).Find(&sourceFiles).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFiles, nil
+}
+
+// GetSourceFileByPayloadCidForUpdate locks the source file of the payload cid in the transaction, the pin status of
+// the source file and its uploads are changed with it locked, so the content is not unpinned while being saved again
+func GetSourceFileByPayloadCidForUpdate(db *gorm.DB, payloadCid string) (*SourceFile, error) {
+	var sourceFiles []*SourceFile
+	err := db.Set("gorm:query_option", "FOR UPDATE").Where("payload_cid=?", payloadCid).Find(&sourceFiles).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(sourceFiles) > 0 {
+		return sourceFiles[0], nil
+	}
+
+	return nil, nil
+}
+
+func GetSourceFileByIdForUpdate(db *gorm.DB, id int64) (*SourceFile, error) {
+	var sourceFiles []*SourceFile
+	err := db.Set("gorm:query_option", "FOR UPDATE").Where("id=?", id).Find(&sourceFiles).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(sourceFiles) > 0 {
+		return sourceFiles[0], nil
+	}
+
+	return nil, nil
+}
+
 func UpdateSourceFile2Unpinned(sourceFileId int64) error {
 	sql := "update source_file set pin_status=?,update_at=? where id=?\n" +
 		"and not exists (select 1 from source_file_upload b where source_file_id=? and pin_status=?)\n"
@@ -108,3 +178,51 @@ func UpdateSourceFile2Unpinned(sourceFileId int64) error {
 
 	return nil
 }
+
+type SourceFileLocal struct {
+	ID          int64  `json:"id"`
+	ResourceUri string `json:"resource_uri"`
+	FileSize    int64  `json:"file_size"`
+	CreateAt    int64  `json:"create_at"`
+}
+
+// GetSourceFilesLocal2BeDeleted returns the source files kept locally under the dir, which are pinned on ipfs
+// and all of whose uploads have been created to car files, oldest first
+func GetSourceFilesLocal2BeDeleted(dir string) ([]*SourceFileLocal, error) {
+	sql := "select a.id,a.resource_uri,a.file_size,a.create_at from source_file a\n" +
+		"where a.pin_status=? and a.local_deleted_at is null and a.resource_uri like ?\n" +
+		"and exists (select 1 from source_file_upload b where b.source_file_id=a.id and b.file_type=?)\n" +
+		"and not exists (\n" +
+		"    select 1 from source_file_upload b where b.source_file_id=a.id and b.file_type=?\n" +
+		"    and not exists (select 1 from car_file_source c where c.source_file_upload_id=b.id)\n" +
+		")\n" +
+		"order by a.create_at"
+
+	params := []interface{}{}
+	params = append(params, constants.IPFS_File_PINNED_STATUS, dir+"/%")
+	params = append(params, constants.SOURCE_FILE_TYPE_NORMAL, constants.SOURCE_FILE_TYPE_NORMAL)
+
+	var sourceFiles []*SourceFileLocal
+	err := database.GetDB().Raw(sql, params...).Scan(&sourceFiles).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFiles, nil
+}
+
+func UpdateSourceFileLocalDeleted(id int64) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["local_deleted_at"] = currentUtcSecond
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(SourceFile{}).Where("id=?", id).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -5,11 +5,11 @@ import (
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/common/utils"
 	"multi-chain-storage/database"
-	"sort"
 	"strings"
 
 	"github.com/filswan/go-swan-lib/logs"
 	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/jinzhu/gorm"
 	"github.com/shopspring/decimal"
 )
 
@@ -23,9 +23,22 @@ type SourceFileUpload struct {
 	Status       string `json:"status"`
 	Duration     int    `json:"duration"`
 	PinStatus    string `json:"pin_status"`
+	UnpinAt      *int64 `json:"unpin_at"`
 	IsFree       bool   `json:"is_free"`
-	CreateAt     int64  `json:"create_at"`
-	UpdateAt     int64  `json:"update_at"`
+
+	EncryptionScheme *string `json:"encryption_scheme"`
+	KeyWrapScheme    *string `json:"key_wrap_scheme"`
+	WrappedKey       *string `json:"wrapped_key"`
+	KmsKeyId         *string `json:"kms_key_id"`
+	PlainFileSize    *int64  `json:"plain_file_size"`
+
+	ContentSha256 *string `json:"content_sha256"` // sha256 in hex of the content uploaded, before encrypted
+	BlockedAt     *int64  `json:"blocked_at"`     // when the content was removed by the admin, not stored since then
+
+	OrganizationId *int64 `json:"organization_id"` // the organization owning the upload, nil if owned by the wallet
+
+	CreateAt int64 `json:"create_at"`
+	UpdateAt int64 `json:"update_at"`
 }
 
 type SourceFileUploadOut struct {
@@ -129,6 +142,8 @@ func GetSourceFileUploadsByFileTypeStatus(fileType int, status string) ([]*Sourc
 
 type SourceFileUploadNeed2Car struct {
 	SourceFileUploadId int64           `json:"source_file_upload_id"`
+	PayloadCid         string          `json:"payload_cid"`
+	ContentSha256      *string         `json:"content_sha256"`
 	ResourceUri        string          `json:"resource_uri"`
 	IpfsUrl            string          `json:"ipfs_url"`
 	FileSize           int64           `json:"file_size"`
@@ -138,10 +153,12 @@ type SourceFileUploadNeed2Car struct {
 
 func GetSourceFileUploadsNeed2Car() ([]*SourceFileUploadNeed2Car, error) {
 	var sourceFileUploadsNeed2Car []*SourceFileUploadNeed2Car
-	sql := `select a.id source_file_upload_id,b.resource_uri,b.ipfs_url,b.file_size,a.create_at,c.pay_amount
+	sql := `select a.id source_file_upload_id,b.payload_cid,a.content_sha256,b.resource_uri,b.ipfs_url,b.file_size,a.create_at,c.pay_amount
 		from source_file_upload a, source_file b, transaction c
-		where a.file_type=? and a.status=? and a.source_file_id=b.id and a.id=c.source_file_upload_id`
-	err := database.GetDB().Raw(sql, constants.SOURCE_FILE_TYPE_NORMAL, constants.SOURCE_FILE_UPLOAD_STATUS_PAID).Scan(&sourceFileUploadsNeed2Car).Error
+		where a.file_type=? and a.status=? and a.source_file_id=b.id and a.id=c.source_file_upload_id and a.blocked_at is null
+		and not exists (select 1 from car_creation_job_upload d, car_creation_job f where d.source_file_upload_id=a.id and d.car_creation_job_id=f.id and f.status=?)
+		and not exists (select 1 from wallet e where e.id=a.wallet_id and e.is_blocked=true)`
+	err := database.GetDB().Raw(sql, constants.SOURCE_FILE_TYPE_NORMAL, constants.SOURCE_FILE_UPLOAD_STATUS_PAID, constants.CAR_CREATION_JOB_STATUS_RUNNING).Scan(&sourceFileUploadsNeed2Car).Error
 
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -153,10 +170,12 @@ func GetSourceFileUploadsNeed2Car() ([]*SourceFileUploadNeed2Car, error) {
 
 func GetFreeSourceFileUploadsNeed2Car() ([]*SourceFileUploadNeed2Car, error) {
 	var sourceFileUploadsNeed2Car []*SourceFileUploadNeed2Car
-	sql := "select a.id source_file_upload_id,b.resource_uri,b.ipfs_url,b.file_size,a.create_at\n" +
+	sql := "select a.id source_file_upload_id,b.payload_cid,a.content_sha256,b.resource_uri,b.ipfs_url,b.file_size,a.create_at\n" +
 		"from source_file_upload a, source_file b\n" +
-		"where a.file_type=? and a.status=? and a.is_free=true and a.source_file_id=b.id"
-	err := database.GetDB().Raw(sql, constants.SOURCE_FILE_TYPE_NORMAL, constants.SOURCE_FILE_UPLOAD_STATUS_FREE).Scan(&sourceFileUploadsNeed2Car).Error
+		"where a.file_type=? and a.status=? and a.is_free=true and a.source_file_id=b.id and a.blocked_at is null\n" +
+		"and not exists (select 1 from car_creation_job_upload d, car_creation_job f where d.source_file_upload_id=a.id and d.car_creation_job_id=f.id and f.status=?)\n" +
+		"and not exists (select 1 from wallet e where e.id=a.wallet_id and e.is_blocked=true)"
+	err := database.GetDB().Raw(sql, constants.SOURCE_FILE_TYPE_NORMAL, constants.SOURCE_FILE_UPLOAD_STATUS_FREE, constants.CAR_CREATION_JOB_STATUS_RUNNING).Scan(&sourceFileUploadsNeed2Car).Error
 
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -174,53 +193,91 @@ type SourceFileUploadResult struct {
 	Duration           int               `json:"duration"`
 	IpfsUrl            string            `json:"ipfs_url"`
 	PinStatus          string            `json:"pin_status"`
+	UnpinAt            *int64            `json:"unpin_at"`
 	PayAmount          string            `json:"pay_amount"`
 	Status             string            `json:"status"`
 	IsFree             bool              `json:"is_free"`
+	IsEncrypted        bool              `json:"is_encrypted"`
 	IsMinted           bool              `json:"is_minted"`
 	TokenId            *string           `json:"token_id"`
 	MintAddress        *string           `json:"mint_address"`
 	NftTxHash          *string           `json:"nft_tx_hash"`
 	RefundedBySelf     bool              `json:"refunded_by_self"`
 	OfflineDeals       []*OfflineDealOut `json:"offline_deal"`
+	Tags               map[string]string `json:"tags"`
+	SortValue          string            `json:"-"` // of the column sorted by, for the cursor
 }
-type SourceFileUploadResultByFileName []*SourceFileUploadResult
 
-func (a SourceFileUploadResultByFileName) Len() int           { return len(a) }
-func (a SourceFileUploadResultByFileName) Less(i, j int) bool { return a[i].FileName < a[j].FileName }
-func (a SourceFileUploadResultByFileName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+// SourceFileUploadFilter narrows the uploads to those with keys in the bucket, and those tagged with the key, and with
+// the value if given, each ignored if nil
+type SourceFileUploadFilter struct {
+	BucketId *int64
+	TagKey   *string
+	TagValue *string
+}
 
-type SourceFileUploadResultByFileSize []*SourceFileUploadResult
+// getSql returns the conditions of the filter on the source file uploads aliased, and their params
+func (f *SourceFileUploadFilter) getSql(alias string) (string, []interface{}) {
+	sql := ""
+	params := []interface{}{}
+	if f == nil {
+		return sql, params
+	}
 
-func (a SourceFileUploadResultByFileSize) Len() int           { return len(a) }
-func (a SourceFileUploadResultByFileSize) Less(i, j int) bool { return a[i].FileSize < a[j].FileSize }
-func (a SourceFileUploadResultByFileSize) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+	if f.BucketId != nil {
+		sql = sql + " and exists (select 1 from bucket_object x where x.source_file_upload_id=" + alias + ".id and x.bucket_id=?)"
+		params = append(params, *f.BucketId)
+	}
 
-type SourceFileUploadResultByUploadAt []*SourceFileUploadResult
+	if f.TagKey != nil {
+		sql = sql + " and exists (select 1 from source_file_upload_tag y where y.source_file_upload_id=" + alias + ".id and y.tag_key=?"
+		params = append(params, *f.TagKey)
+		if f.TagValue != nil {
+			sql = sql + " and y.tag_value=?"
+			params = append(params, *f.TagValue)
+		}
+		sql = sql + ")"
+	}
 
-func (a SourceFileUploadResultByUploadAt) Len() int           { return len(a) }
-func (a SourceFileUploadResultByUploadAt) Less(i, j int) bool { return a[i].UploadAt < a[j].UploadAt }
-func (a SourceFileUploadResultByUploadAt) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+	return sql, params
+}
 
-func GetSourceFileUploads(walletId int64, status, fileName, orderBy, isMinted *string, isAscend bool, limit, offset *int, uploadAtStart, uploadAtEnd *int64) ([]*SourceFileUploadResult, *int, error) {
-	sql := "select\n" +
-		"a.id source_file_upload_id,a.file_name,b.file_size,a.create_at upload_at,a.duration,\n" +
-		"case when a.pin_status=? then b.ipfs_url else '' end ipfs_url,a.pin_status,f.pay_amount,a.status,a.is_free,\n" +
-		"e.id is not null is_minted,e.token_id,e.mint_address,e.nft_tx_hash,\n" +
-		"case when wallet_id_pay=refund_by_wallet_id then true else false end refunded_by_self\n" +
-		"from source_file_upload a\n" +
-		"left join source_file b on a.source_file_id=b.id\n" +
-		"left outer join source_file_mint e on a.id=e.source_file_upload_id\n" +
-		"left outer join transaction f on a.id=f.source_file_upload_id\n" +
-		"where a.wallet_id=? and a.file_type=0"
+var sourceFileUploadSortColumns = map[string]sortColumn{
+	"file_name": {sql: "a.file_name"},
+	"file_size": {sql: "ifnull(a.plain_file_size,b.file_size)", isNumeric: true},
+	"upload_at": {sql: "a.create_at", isNumeric: true},
+}
 
-	if fileName != nil {
-		sql = sql + " and a.file_name like '%" + *fileName + "%'\n"
+// sourceFileUploadResultSql is the columns of SourceFileUploadResult selected from sourceFileUploadResultFromSql, with
+// the pinned statuses as the params
+const sourceFileUploadResultSql = "a.id source_file_upload_id,a.file_name,ifnull(a.plain_file_size,b.file_size) file_size,a.create_at upload_at,a.duration,\n" +
+	"case when a.pin_status in (?,?) then b.ipfs_url else '' end ipfs_url,a.pin_status,a.unpin_at,f.pay_amount,a.status,a.is_free,\n" +
+	"a.encryption_scheme is not null is_encrypted,\n" +
+	"e.id is not null is_minted,e.token_id,e.mint_address,e.nft_tx_hash,\n" +
+	"case when wallet_id_pay=refund_by_wallet_id then true else false end refunded_by_self"
+
+// sourceFileUploadResultFromSql is the tables joined to the source file uploads a for SourceFileUploadResult
+const sourceFileUploadResultFromSql = "left join source_file b on a.source_file_id=b.id\n" +
+	"left outer join source_file_mint e on a.id=e.source_file_upload_id\n" +
+	"left outer join transaction f on a.id=f.source_file_upload_id\n"
+
+// getSourceFileUploadResultWhereSql returns the conditions on the normal uploads a of sourceFileUploadResultFromSql,
+// owned by the organization if given, otherwise by the wallet, narrowed by the filter and the others given, and their
+// params
+func getSourceFileUploadResultWhereSql(walletId int64, organizationId *int64, filter *SourceFileUploadFilter, status, pinStatus, isMinted *string, uploadAtStart, uploadAtEnd *int64) (string, []interface{}) {
+	sql := "where a.file_type=0"
+	params := []interface{}{}
+	if organizationId != nil {
+		sql = sql + " and a.organization_id=?"
+		params = append(params, *organizationId)
+	} else {
+		sql = sql + " and a.wallet_id=? and a.organization_id is null"
+		params = append(params, walletId)
 	}
 
-	params := []interface{}{}
-	params = append(params, constants.IPFS_File_PINNED_STATUS)
-	params = append(params, walletId)
+	filterSql, filterParams := filter.getSql("a")
+	sql = sql + filterSql
+	params = append(params, filterParams...)
 
 	if uploadAtStart != nil {
 		sql = sql + " and a.create_at>=?"
@@ -238,17 +295,22 @@ func GetSourceFileUploads(walletId int64, status, fileName, orderBy, isMinted *s
 			constants.SOURCE_FILE_UPLOAD_STATUS_REFUNDABLE,
 			constants.SOURCE_FILE_UPLOAD_STATUS_COMPLETED:
 			sql = sql + " and a.status=?"
-			params = append(params, status)
+			params = append(params, strings.Trim(*status, " "))
 		case constants.SOURCE_FILE_UPLOAD_STATUS_PROCESSING:
 			sql = sql + " and a.status not in (?,?,?)"
 			params = append(params, constants.SOURCE_FILE_UPLOAD_STATUS_PENDING)
 			params = append(params, constants.SOURCE_FILE_UPLOAD_STATUS_REFUNDABLE)
 			params = append(params, constants.SOURCE_FILE_UPLOAD_STATUS_COMPLETED)
 		default:
-			logs.GetLogger().Info("input status:", status, ", get records with all kinds of statuses")
+			logs.GetLogger().Info("input status:", *status, ", get records with all kinds of statuses")
 		}
 	}
 
+	if !libutils.IsStrEmpty(pinStatus) {
+		sql = sql + " and a.pin_status=?"
+		params = append(params, strings.Trim(*pinStatus, " "))
+	}
+
 	if isMinted != nil {
 		if strings.EqualFold(*isMinted, "y") {
 			sql = sql + " and e.id is not null"
@@ -257,64 +319,64 @@ func GetSourceFileUploads(walletId int64, status, fileName, orderBy, isMinted *s
 		}
 	}
 
-	var sourceFileUploadResult []*SourceFileUploadResult
+	return sql, params
+}
+
+// GetSourceFileUploads returns the page of the uploads owned by the organization if given, otherwise those owned by the
+// wallet, narrowed by the filter if given, with the file names containing fileName, sorted by orderBy, upload_at by
+// default, all of them if no page. It returns the count of all the uploads listed as well, and the cursor of the next
+// page, nil if no more
+func GetSourceFileUploads(walletId int64, organizationId *int64, filter *SourceFileUploadFilter, status, fileName, orderBy, isMinted *string, isAscend bool, page *Page, uploadAtStart, uploadAtEnd *int64) ([]*SourceFileUploadResult, *int, *string, error) {
+	column := getSortColumn(sourceFileUploadSortColumns, orderBy, "upload_at")
+
+	whereSql, params := getSourceFileUploadResultWhereSql(walletId, organizationId, filter, status, nil, isMinted, uploadAtStart, uploadAtEnd)
+	fromSql := "from source_file_upload a\n" + sourceFileUploadResultFromSql + whereSql
+
+	if !libutils.IsStrEmpty(fileName) {
+		fromSql = fromSql + " and a.file_name like ?"
+		params = append(params, "%"+utils.EscapeLike(*fileName)+"%")
+	}
 
-	err := database.GetDB().Raw(sql, params...).Scan(&sourceFileUploadResult).Error
+	totalRecordCount, err := getRowCount(fromSql, params)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	if orderBy == nil {
-		orderByDefault := "upload_at"
-		orderBy = &orderByDefault
+	pageSql, pageParams, err := page.getWhereSql(column, "a.id", isAscend)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
 	}
 
-	switch strings.Trim(*orderBy, " ") {
-	case "file_name":
-		if isAscend {
-			sort.Sort(SourceFileUploadResultByFileName(sourceFileUploadResult))
-		} else {
-			sort.Sort(sort.Reverse(SourceFileUploadResultByFileName(sourceFileUploadResult)))
-		}
-	case "file_size":
-		if isAscend {
-			sort.Sort(SourceFileUploadResultByFileSize(sourceFileUploadResult))
-		} else {
-			sort.Sort(sort.Reverse(SourceFileUploadResultByFileSize(sourceFileUploadResult)))
-		}
-	case "upload_at":
-		if isAscend {
-			sort.Sort(SourceFileUploadResultByUploadAt(sourceFileUploadResult))
-		} else {
-			sort.Sort(sort.Reverse(SourceFileUploadResultByUploadAt(sourceFileUploadResult)))
-		}
-	default:
-		if isAscend {
-			sort.Sort(SourceFileUploadResultByUploadAt(sourceFileUploadResult))
-		} else {
-			sort.Sort(sort.Reverse(SourceFileUploadResultByUploadAt(sourceFileUploadResult)))
-		}
-	}
+	orderLimitSql, orderLimitParams := page.getOrderLimitSql(column, "a.id", isAscend)
 
-	totalRecordCount := len(sourceFileUploadResult)
+	sql := "select\n" + sourceFileUploadResultSql + ",\n" +
+		column.getSortValueSql() + "\n" +
+		fromSql + pageSql + orderLimitSql
 
-	if limit == nil || offset == nil {
-		return sourceFileUploadResult, &totalRecordCount, nil
-	}
+	sqlParams := []interface{}{}
+	sqlParams = append(sqlParams, constants.IPFS_File_PINNED_STATUS, constants.IPFS_File_UNPINNING_STATUS)
+	sqlParams = append(sqlParams, params...)
+	sqlParams = append(sqlParams, pageParams...)
+	sqlParams = append(sqlParams, orderLimitParams...)
 
-	start := (*offset - 1) * *limit
-	end := start + *limit
-	if start >= totalRecordCount {
-		return nil, &totalRecordCount, nil
+	var sourceFileUploadResults []*SourceFileUploadResult
+	err = database.GetDB().Raw(sql, sqlParams...).Scan(&sourceFileUploadResults).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
 	}
 
-	if end >= totalRecordCount {
-		end = totalRecordCount
+	var nextCursor *string
+	if page.hasMore(len(sourceFileUploadResults)) {
+		sourceFileUploadResults = sourceFileUploadResults[:page.Limit]
+		lastResult := sourceFileUploadResults[page.Limit-1]
+		cursor := encodePageCursor(lastResult.SortValue, lastResult.SourceFileUploadId)
+		nextCursor = &cursor
 	}
 
-	result := sourceFileUploadResult[start:end]
-	return result, &totalRecordCount, nil
+	return sourceFileUploadResults, &totalRecordCount, nextCursor, nil
 }
 
 func UpdateSourceFileUploadStatus(id int64, status string) error {
@@ -386,27 +448,121 @@ func UpdateSourceFileUploadPinStatus(sourceFileUploadId int64, pinStatus string)
 	return nil
 }
 
-type FreeSizeUsage struct {
-	FreeSize int64 `json:"free_size"`
+// ScheduleSourceFileUploadUnpin marks the pinned upload to be unpinned at unpinAt, it returns false if the upload is not pinned
+func ScheduleSourceFileUploadUnpin(sourceFileUploadId, unpinAt int64) (bool, error) {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["pin_status"] = constants.IPFS_File_UNPINNING_STATUS
+	fields2BeUpdated["unpin_at"] = unpinAt
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	result := database.GetDB().Model(SourceFileUpload{}).Where("id=? and pin_status=?", sourceFileUploadId, constants.IPFS_File_PINNED_STATUS).Update(fields2BeUpdated)
+	if result.Error != nil {
+		logs.GetLogger().Error(result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// UndoSourceFileUploadUnpin marks the upload scheduled to unpin pinned again, it returns false if the upload is not
+// being unpinned, such as it has been unpinned already
+func UndoSourceFileUploadUnpin(sourceFileUploadId int64) (bool, error) {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["pin_status"] = constants.IPFS_File_PINNED_STATUS
+	fields2BeUpdated["unpin_at"] = nil
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	result := database.GetDB().Model(SourceFileUpload{}).Where("id=? and pin_status=?", sourceFileUploadId, constants.IPFS_File_UNPINNING_STATUS).Update(fields2BeUpdated)
+	if result.Error != nil {
+		logs.GetLogger().Error(result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// GetSourceFileUploadsUnpinDue returns the uploads being unpinned whose unpin_at is due, after the id, in the order of id
+func GetSourceFileUploadsUnpinDue(unpinAtBefore, idAfter int64, limit int) ([]*SourceFileUpload, error) {
+	var sourceFileUploads []*SourceFileUpload
+	err := database.GetDB().Where("pin_status=? and unpin_at<=? and id>?", constants.IPFS_File_UNPINNING_STATUS, unpinAtBefore, idAfter).Order("id").Limit(limit).Find(&sourceFileUploads).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFileUploads, nil
 }
 
-func GetSourceFileUploadFreeUsage(walletId int64) (*int64, error) {
-	var freeSizeUsages []*FreeSizeUsage
-	sql := "select sum(b.file_size) free_size from source_file_upload a\n" +
-		"left join source_file b on a.source_file_id=b.id\n" +
-		"where a.wallet_id=? and a.create_at>=? and is_free=true"
+// UpdateSourceFileUploadUnpinnedInTransaction marks the upload being unpinned unpinned, with its source file locked,
+// it returns false if the upload is not being unpinned, such as the unpin has been undone
+func UpdateSourceFileUploadUnpinnedInTransaction(db *gorm.DB, sourceFileUploadId int64) (bool, error) {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["pin_status"] = constants.IPFS_File_UNPINNED_STATUS
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	result := db.Model(SourceFileUpload{}).Where("id=? and pin_status=?", sourceFileUploadId, constants.IPFS_File_UNPINNING_STATUS).Update(fields2BeUpdated)
+	if result.Error != nil {
+		logs.GetLogger().Error(result.Error)
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// GetSourceFileUploadPinnedCntInTransaction counts the uploads of the source file still pinned, including those being unpinned
+func GetSourceFileUploadPinnedCntInTransaction(db *gorm.DB, sourceFileId int64) (int, error) {
+	var cnt int
+	err := db.Model(SourceFileUpload{}).Where("source_file_id=? and pin_status in (?)", sourceFileId, []string{constants.IPFS_File_PINNED_STATUS, constants.IPFS_File_UNPINNING_STATUS}).Count(&cnt).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return cnt, nil
+}
+
+// UpdateSourceFileUploadsBlockedInTransaction unpins all the uploads of the source file and marks them blocked, so they
+// are no longer stored
+func UpdateSourceFileUploadsBlockedInTransaction(db *gorm.DB, sourceFileId int64) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["pin_status"] = constants.IPFS_File_UNPINNED_STATUS
+	fields2BeUpdated["unpin_at"] = nil
+	fields2BeUpdated["blocked_at"] = currentUtcSecond
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := db.Model(SourceFileUpload{}).Where("source_file_id=?", sourceFileId).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
 
-	monthStart := utils.GetMonthStart()
-	err := database.GetDB().Raw(sql, walletId, monthStart).Scan(&freeSizeUsages).Error
+	return nil
+}
+
+// GetSourceFileUploadWalletIds returns the wallets having uploaded the source file
+func GetSourceFileUploadWalletIds(sourceFileId int64) ([]int64, error) {
+	var walletIds []int64
+	err := database.GetDB().Model(SourceFileUpload{}).Where("source_file_id=?", sourceFileId).Pluck("distinct wallet_id", &walletIds).Error
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	if len(freeSizeUsages) > 0 {
-		return &freeSizeUsages[0].FreeSize, nil
+	return walletIds, nil
+}
+
+func UpdateSourceFileUploadsPinStatusBySourceFileId(sourceFileId int64, pinStatus string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["pin_status"] = pinStatus
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(SourceFileUpload{}).Where("source_file_id=?", sourceFileId).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
 	}
 
-	freeSizeUsage := int64(0)
-	return &freeSizeUsage, nil
+	return nil
 }
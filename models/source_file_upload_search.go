@@ -0,0 +1,116 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// SourceFileUploadSearchResult is an upload found by a search, with the tx hash of its payment and its relevance
+type SourceFileUploadSearchResult struct {
+	SourceFileUploadResult
+	PayTxHash *string `json:"pay_tx_hash"`
+	Score     float64 `json:"score"`
+}
+
+var sourceFileUploadSearchSortColumn = sortColumn{sql: "s.score", isNumeric: true}
+
+// getSourceFileUploadSearchScoreSql returns the scores of the uploads matching the query, the full-text scores of the
+// words of their file names and tags, plus SEARCH_SCORE_EXACT_MATCH for each payload cid, wcid, tx hash or deal id
+// equal to it
+func getSourceFileUploadSearchScoreSql(query string) (string, []interface{}) {
+	exactMatchScore := strconv.Itoa(constants.SEARCH_SCORE_EXACT_MATCH)
+	sqls := []string{
+		"select id source_file_upload_id,match(file_name) against(? in natural language mode) score from source_file_upload\n" +
+			"where match(file_name) against(? in natural language mode)",
+		"select source_file_upload_id,match(tag_key,tag_value) against(? in natural language mode) score from source_file_upload_tag\n" +
+			"where match(tag_key,tag_value) against(? in natural language mode)",
+		"select a.id source_file_upload_id," + exactMatchScore + " score from source_file_upload a,source_file b\n" +
+			"where a.source_file_id=b.id and b.payload_cid=?",
+		"select source_file_upload_id," + exactMatchScore + " score from transaction where pay_tx_hash=?",
+		"select source_file_upload_id," + exactMatchScore + " score from transaction where refund_tx_hash=?",
+		"select source_file_upload_id," + exactMatchScore + " score from source_file_mint where nft_tx_hash=?",
+		"select a.source_file_upload_id," + exactMatchScore + " score from car_file_source a,offline_deal b\n" +
+			"where a.car_file_id=b.car_file_id and b.unlock_tx_hash=?",
+	}
+
+	params := []interface{}{}
+	params = append(params, query, query, query, query, query, query, query, query, query)
+
+	if len(query) > constants.SOURCE_FILE_UPLOAD_UUID_LEN {
+		sqls = append(sqls, "select a.id source_file_upload_id,"+exactMatchScore+" score from source_file_upload a,source_file b\n"+
+			"where a.source_file_id=b.id and b.payload_cid=? and a.uuid=?")
+		params = append(params, query[constants.SOURCE_FILE_UPLOAD_UUID_LEN:], query[:constants.SOURCE_FILE_UPLOAD_UUID_LEN])
+	}
+
+	dealId, err := strconv.ParseInt(query, 10, 64)
+	if err == nil && dealId > 0 {
+		sqls = append(sqls, "select a.source_file_upload_id,"+exactMatchScore+" score from car_file_source a,offline_deal b\n"+
+			"where a.car_file_id=b.car_file_id and b.deal_id=?")
+		params = append(params, dealId)
+	}
+
+	sql := "select source_file_upload_id,cast(sum(score) as decimal(65,6)) score from (\n" +
+		strings.Join(sqls, "\nunion all\n") + "\n" +
+		") m group by source_file_upload_id"
+
+	return sql, params
+}
+
+// SearchSourceFileUploads returns the page of the uploads matching the query, owned by the organization if given,
+// otherwise by the wallet, narrowed by the filter and the others given, the most relevant first. It returns the count
+// of all the uploads found as well, and the cursor of the next page, nil if no more
+func SearchSourceFileUploads(walletId int64, organizationId *int64, filter *SourceFileUploadFilter, query string, status, pinStatus, isMinted *string, page *Page, uploadAtStart, uploadAtEnd *int64) ([]*SourceFileUploadSearchResult, *int, *string, error) {
+	column := sourceFileUploadSearchSortColumn
+
+	scoreSql, params := getSourceFileUploadSearchScoreSql(query)
+	whereSql, whereParams := getSourceFileUploadResultWhereSql(walletId, organizationId, filter, status, pinStatus, isMinted, uploadAtStart, uploadAtEnd)
+	fromSql := "from (" + scoreSql + ") s\n" +
+		"join source_file_upload a on s.source_file_upload_id=a.id\n" +
+		sourceFileUploadResultFromSql + whereSql
+	params = append(params, whereParams...)
+
+	totalRecordCount, err := getRowCount(fromSql, params)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
+	}
+
+	pageSql, pageParams, err := page.getWhereSql(column, "a.id", false)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
+	}
+
+	orderLimitSql, orderLimitParams := page.getOrderLimitSql(column, "a.id", false)
+
+	sql := "select\n" + sourceFileUploadResultSql + ",\n" +
+		"f.pay_tx_hash,s.score," + column.getSortValueSql() + "\n" +
+		fromSql + pageSql + orderLimitSql
+
+	sqlParams := []interface{}{}
+	sqlParams = append(sqlParams, constants.IPFS_File_PINNED_STATUS, constants.IPFS_File_UNPINNING_STATUS)
+	sqlParams = append(sqlParams, params...)
+	sqlParams = append(sqlParams, pageParams...)
+	sqlParams = append(sqlParams, orderLimitParams...)
+
+	var searchResults []*SourceFileUploadSearchResult
+	err = database.GetDB().Raw(sql, sqlParams...).Scan(&searchResults).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
+	}
+
+	var nextCursor *string
+	if page.hasMore(len(searchResults)) {
+		searchResults = searchResults[:page.Limit]
+		lastResult := searchResults[page.Limit-1]
+		cursor := encodePageCursor(lastResult.SortValue, lastResult.SourceFileUploadId)
+		nextCursor = &cursor
+	}
+
+	return searchResults, &totalRecordCount, nextCursor, nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"strings"
+	"testing"
+)
+
+func TestGetSourceFileUploadSearchScoreSql(t *testing.T) {
+	uuid := "0a1b2c3d-0000-4000-8000-000000000000"
+	tests := []struct {
+		name        string
+		query       string
+		paramCnt    int
+		uuidMatch   bool
+		dealIdMatch bool
+	}{
+		{name: "words", query: "holiday photos", paramCnt: 9},
+		{name: "payload cid", query: "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi", paramCnt: 11, uuidMatch: true},
+		{name: "wcid", query: uuid + "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi", paramCnt: 11, uuidMatch: true},
+		{name: "deal id", query: "123456", paramCnt: 10, dealIdMatch: true},
+		{name: "zero not a deal id", query: "0", paramCnt: 9},
+		{name: "negative not a deal id", query: "-1", paramCnt: 9},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sql, params := getSourceFileUploadSearchScoreSql(test.query)
+			bindTestSql(t, sql, params)
+
+			if len(params) != test.paramCnt {
+				t.Errorf("params:%d, want:%d", len(params), test.paramCnt)
+			}
+
+			if strings.Contains(sql, "a.uuid=?") != test.uuidMatch {
+				t.Errorf("wcid matched:%t, want:%t", !test.uuidMatch, test.uuidMatch)
+			}
+
+			if strings.Contains(sql, "b.deal_id=?") != test.dealIdMatch {
+				t.Errorf("deal id matched:%t, want:%t", !test.dealIdMatch, test.dealIdMatch)
+			}
+
+			if test.uuidMatch {
+				payloadCid, uuid := params[9], params[10]
+				if payloadCid != test.query[constants.SOURCE_FILE_UPLOAD_UUID_LEN:] || uuid != test.query[:constants.SOURCE_FILE_UPLOAD_UUID_LEN] {
+					t.Errorf("wcid split to payload cid:%v, uuid:%v", payloadCid, uuid)
+				}
+			}
+		})
+	}
+}
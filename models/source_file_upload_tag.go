@@ -0,0 +1,94 @@
+package models
+
+import (
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// SourceFileUploadTag is a key-value tag of the source file upload, the key is unique in the upload
+type SourceFileUploadTag struct {
+	ID                 int64  `json:"id"`
+	SourceFileUploadId int64  `json:"source_file_upload_id"`
+	TagKey             string `json:"tag_key"`
+	TagValue           string `json:"tag_value"`
+	CreateAt           int64  `json:"create_at"`
+	UpdateAt           int64  `json:"update_at"`
+}
+
+// GetSourceFileUploadTags returns the tags of the source file upload by key
+func GetSourceFileUploadTags(sourceFileUploadId int64) (map[string]string, error) {
+	var sourceFileUploadTags []*SourceFileUploadTag
+	err := database.GetDB().Where("source_file_upload_id=?", sourceFileUploadId).Order("tag_key").Find(&sourceFileUploadTags).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	tags := map[string]string{}
+	for _, sourceFileUploadTag := range sourceFileUploadTags {
+		tags[sourceFileUploadTag.TagKey] = sourceFileUploadTag.TagValue
+	}
+
+	return tags, nil
+}
+
+// GetSourceFileUploadTagsBySourceFileUploadIds returns the tags by key of each source file upload, in one query
+func GetSourceFileUploadTagsBySourceFileUploadIds(sourceFileUploadIds []int64) (map[int64]map[string]string, error) {
+	tags := map[int64]map[string]string{}
+	if len(sourceFileUploadIds) == 0 {
+		return tags, nil
+	}
+
+	var sourceFileUploadTags []*SourceFileUploadTag
+	err := database.GetDB().Where("source_file_upload_id in (?)", sourceFileUploadIds).Find(&sourceFileUploadTags).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	for _, sourceFileUploadTag := range sourceFileUploadTags {
+		if tags[sourceFileUploadTag.SourceFileUploadId] == nil {
+			tags[sourceFileUploadTag.SourceFileUploadId] = map[string]string{}
+		}
+		tags[sourceFileUploadTag.SourceFileUploadId][sourceFileUploadTag.TagKey] = sourceFileUploadTag.TagValue
+	}
+
+	return tags, nil
+}
+
+// SaveSourceFileUploadTags adds the tags to the source file upload, the values of the keys tagged already are replaced
+func SaveSourceFileUploadTags(sourceFileUploadId int64, tags map[string]string) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert into source_file_upload_tag(source_file_upload_id,tag_key,tag_value,create_at,update_at) values(?,?,?,?,?)\n" +
+		"on duplicate key update tag_value=values(tag_value),update_at=values(update_at)"
+
+	db := database.GetDBTransaction()
+	for tagKey, tagValue := range tags {
+		err := db.Exec(sql, sourceFileUploadId, tagKey, tagValue, currentUtcSecond, currentUtcSecond).Error
+		if err != nil {
+			db.Rollback()
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	err := db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func DeleteSourceFileUploadTags(sourceFileUploadId int64, tagKeys []string) error {
+	err := database.GetDB().Where("source_file_upload_id=? and tag_key in (?)", sourceFileUploadId, tagKeys).Delete(SourceFileUploadTag{}).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -1,8 +1,8 @@
 package models
 
 import (
+	"multi-chain-storage/common/utils"
 	"multi-chain-storage/database"
-	"sort"
 	"strings"
 
 	libutils "github.com/filswan/go-swan-lib/utils"
@@ -59,132 +59,92 @@ type Billing struct {
 	Deadline     int64  `json:"deadline"`
 	NetworkName  string `json:"network_name"`
 	TokenName    string `json:"token_name"`
+	SortValue    string `json:"-"` // of the column sorted by, for the cursor
 }
 
-type BillingByPayAt []*Billing
-
-func (a BillingByPayAt) Len() int           { return len(a) }
-func (a BillingByPayAt) Less(i, j int) bool { return a[i].PayAt < a[j].PayAt }
-func (a BillingByPayAt) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-
-type BillingByPayAmount []*Billing
-
-func (a BillingByPayAmount) Len() int           { return len(a) }
-func (a BillingByPayAmount) Less(i, j int) bool { return a[i].PayAmount < a[j].PayAmount }
-func (a BillingByPayAmount) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-
-type BillingByUnlockAmount []*Billing
-
-func (a BillingByUnlockAmount) Len() int           { return len(a) }
-func (a BillingByUnlockAmount) Less(i, j int) bool { return a[i].UnlockAmount < a[j].UnlockAmount }
-func (a BillingByUnlockAmount) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-
-type BillingByFileName []*Billing
-
-func (a BillingByFileName) Len() int           { return len(a) }
-func (a BillingByFileName) Less(i, j int) bool { return a[i].FileName < a[j].FileName }
-func (a BillingByFileName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-
-type BillingByUnlockAt []*Billing
-
-func (a BillingByUnlockAt) Len() int           { return len(a) }
-func (a BillingByUnlockAt) Less(i, j int) bool { return a[i].UnlockAt < a[j].UnlockAt }
-func (a BillingByUnlockAt) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-
-type BillingByDeadline []*Billing
+var billingSortColumns = map[string]sortColumn{
+	"pay_amount":    {sql: "cast(a.pay_amount as decimal(65,18))", isNumeric: true},
+	"unlock_amount": {sql: "cast(ifnull(a.unlock_amount,'0') as decimal(65,18))", isNumeric: true},
+	"file_name":     {sql: "ifnull(b.file_name,'')"},
+	"pay_at":        {sql: "a.pay_at", isNumeric: true},
+	"unlock_at":     {sql: "ifnull(a.last_unlock_at,0)", isNumeric: true},
+	"deadline":      {sql: "a.deadline", isNumeric: true},
+}
 
-func (a BillingByDeadline) Len() int           { return len(a) }
-func (a BillingByDeadline) Less(i, j int) bool { return a[i].Deadline < a[j].Deadline }
-func (a BillingByDeadline) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+// GetTransactions returns the page of the payments for the uploads owned by the organization if given, by any wallet,
+// otherwise the payments by the wallet, narrowed by the filter on their uploads if given, sorted by orderBy, pay_at by
+// default. It returns the count of all the payments listed as well, and the cursor of the next page, nil if no more
+func GetTransactions(walletId int64, organizationId *int64, filter *SourceFileUploadFilter, txHash, fileName, orderBy string, isAscend bool, page *Page) ([]*Billing, *int, *string, error) {
+	orderBy = strings.Trim(orderBy, " ")
+	column := getSortColumn(billingSortColumns, &orderBy, "pay_at")
 
-func GetTransactions(walletId int64, txHash, fileName, orderBy string, isAscend bool, limit, offset int) ([]*Billing, *int, error) {
-	sql := "select\n" +
-		"a.id pay_id,a.pay_tx_hash,a.pay_amount,a.unlock_amount,b.file_name,d.payload_cid,\n" +
-		"a.pay_at,a.last_unlock_at unlock_at,a.deadline,e.name network_name,f.name token_name\n" +
-		"from transaction a\n" +
+	fromSql := "from transaction a\n" +
 		"left join source_file_upload b on a.source_file_upload_id=b.id\n" +
 		"left outer join car_file_source c on c.source_file_upload_id=a.source_file_upload_id\n" +
 		"left outer join car_file d on c.car_file_id=d.id\n" +
 		"left join network e on a.network_id=e.id\n" +
-		"left join token f on a.token_id=f.id\n" +
-		"where a.wallet_id_pay=?"
+		"left join token f on a.token_id=f.id\n"
 
 	params := []interface{}{}
-	params = append(params, walletId)
+	if organizationId != nil {
+		fromSql = fromSql + "where b.organization_id=?"
+		params = append(params, *organizationId)
+	} else {
+		fromSql = fromSql + "where a.wallet_id_pay=?"
+		params = append(params, walletId)
+	}
+
+	filterSql, filterParams := filter.getSql("b")
+	fromSql = fromSql + filterSql
+	params = append(params, filterParams...)
 
 	if !libutils.IsStrEmpty(&txHash) {
-		sql = sql + " and a.pay_tx_hash =?"
+		fromSql = fromSql + " and a.pay_tx_hash =?"
 		params = append(params, txHash)
 	}
 
 	if !libutils.IsStrEmpty(&fileName) {
-		sql = sql + " and b.file_name like '%" + fileName + "%' "
+		fromSql = fromSql + " and b.file_name like ?"
+		params = append(params, "%"+utils.EscapeLike(fileName)+"%")
 	}
 
-	var billings []*Billing
-	err := database.GetDB().Raw(sql, params...).Scan(&billings).Error
+	totalRecordCount, err := getRowCount(fromSql, params)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil, nil, err
-
+		return nil, nil, nil, err
 	}
 
-	switch strings.Trim(orderBy, " ") {
-	case "pay_amount":
-		if isAscend {
-			sort.Sort(BillingByPayAmount(billings))
-		} else {
-			sort.Sort(sort.Reverse(BillingByPayAmount(billings)))
-		}
-	case "unlock_amount":
-		if isAscend {
-			sort.Sort(BillingByUnlockAmount(billings))
-		} else {
-			sort.Sort(sort.Reverse(BillingByUnlockAmount(billings)))
-		}
-	case "file_name":
-		if isAscend {
-			sort.Sort(BillingByFileName(billings))
-		} else {
-			sort.Sort(sort.Reverse(BillingByFileName(billings)))
-		}
-	case "pay_at":
-		if isAscend {
-			sort.Sort(BillingByPayAt(billings))
-		} else {
-			sort.Sort(sort.Reverse(BillingByPayAt(billings)))
-		}
-	case "unlock_at":
-		if isAscend {
-			sort.Sort(BillingByUnlockAt(billings))
-		} else {
-			sort.Sort(sort.Reverse(BillingByUnlockAt(billings)))
-		}
-	case "deadline":
-		if isAscend {
-			sort.Sort(BillingByDeadline(billings))
-		} else {
-			sort.Sort(sort.Reverse(BillingByDeadline(billings)))
-		}
-	default:
-		if isAscend {
-			sort.Sort(BillingByPayAt(billings))
-		} else {
-			sort.Sort(sort.Reverse(BillingByPayAt(billings)))
-		}
+	pageSql, pageParams, err := page.getWhereSql(column, "a.id", isAscend)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
 	}
 
-	totalRecordCount := len(billings)
-	start := (offset - 1) * limit
-	end := start + limit
-	if start >= totalRecordCount {
-		return nil, &totalRecordCount, nil
+	orderLimitSql, orderLimitParams := page.getOrderLimitSql(column, "a.id", isAscend)
+
+	sql := "select\n" +
+		"a.id pay_id,a.pay_tx_hash,a.pay_amount,a.unlock_amount,b.file_name,d.payload_cid,\n" +
+		"a.pay_at,a.last_unlock_at unlock_at,a.deadline,e.name network_name,f.name token_name,\n" +
+		column.getSortValueSql() + "\n" +
+		fromSql + pageSql + orderLimitSql
+
+	params = append(params, pageParams...)
+	params = append(params, orderLimitParams...)
+
+	var billings []*Billing
+	err = database.GetDB().Raw(sql, params...).Scan(&billings).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
 	}
 
-	if end >= totalRecordCount {
-		end = totalRecordCount
+	var nextCursor *string
+	if page.hasMore(len(billings)) {
+		billings = billings[:page.Limit]
+		lastBilling := billings[page.Limit-1]
+		cursor := encodePageCursor(lastBilling.SortValue, lastBilling.PayId)
+		nextCursor = &cursor
 	}
 
-	result := billings[start:end]
-	return result, &totalRecordCount, nil
+	return billings, &totalRecordCount, nextCursor, nil
 }
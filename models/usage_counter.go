@@ -0,0 +1,81 @@
+package models
+
+import (
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/jinzhu/gorm"
+)
+
+// UsageCounter is the usage of the subject in the calendar month from period_start, added to by each upload
+type UsageCounter struct {
+	ID            int64  `json:"id"`
+	SubjectType   string `json:"subject_type"`
+	SubjectId     int64  `json:"subject_id"`
+	PeriodStart   int64  `json:"period_start"`
+	UploadedCnt   int    `json:"uploaded_cnt"`
+	UploadedBytes int64  `json:"uploaded_bytes"`
+	FreeBytes     int64  `json:"free_bytes"` // of the uploads free
+	CreateAt      int64  `json:"create_at"`
+	UpdateAt      int64  `json:"update_at"`
+}
+
+// GetUsageCounter returns the usage of the subject in the period, nil if nothing uploaded
+func GetUsageCounter(subjectType string, subjectId, periodStart int64) (*UsageCounter, error) {
+	var usageCounters []*UsageCounter
+	err := database.GetDB().Where("subject_type=? and subject_id=? and period_start=?", subjectType, subjectId, periodStart).Find(&usageCounters).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(usageCounters) > 0 {
+		return usageCounters[0], nil
+	}
+
+	return nil, nil
+}
+
+// GetUsageCounterForUpdateInTransaction locks the usage of the subject in the period, created first if not exists,
+// so the uploads of the subject are counted one by one
+func GetUsageCounterForUpdateInTransaction(db *gorm.DB, subjectType string, subjectId, periodStart int64) (*UsageCounter, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sql := "insert ignore into usage_counter(subject_type,subject_id,period_start,uploaded_cnt,uploaded_bytes,free_bytes,create_at,update_at)\n" +
+		"values(?,?,?,0,0,0,?,?)"
+	err := db.Exec(sql, subjectType, subjectId, periodStart, currentUtcSecond, currentUtcSecond).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var usageCounters []*UsageCounter
+	err = db.Set("gorm:query_option", "FOR UPDATE").Where("subject_type=? and subject_id=? and period_start=?", subjectType, subjectId, periodStart).Find(&usageCounters).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(usageCounters) > 0 {
+		return usageCounters[0], nil
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+// AddUsageCounterInTransaction adds an upload of the bytes to the usage, to the free bytes as well if free
+func AddUsageCounterInTransaction(db *gorm.DB, id, uploadedBytes int64, isFree bool) error {
+	freeBytes := int64(0)
+	if isFree {
+		freeBytes = uploadedBytes
+	}
+
+	sql := "update usage_counter set uploaded_cnt=uploaded_cnt+1,uploaded_bytes=uploaded_bytes+?,free_bytes=free_bytes+?,update_at=? where id=?"
+	err := db.Exec(sql, uploadedBytes, freeBytes, libutils.GetCurrentUtcSecond(), id).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
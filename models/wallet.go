@@ -9,13 +9,14 @@ import (
 )
 
 type Wallet struct {
-	ID       int64   `json:"id"`
-	Type     int     `json:"type"`
-	Address  string  `json:"address"`
-	IsDao    *bool   `json:"is_dao"`
-	Nonce    *string `json:"nonce"`
-	CreateAt int64   `json:"create_at"`
-	UpdateAt int64   `json:"update_at"`
+	ID        int64   `json:"id"`
+	Type      int     `json:"type"`
+	Address   string  `json:"address"`
+	IsDao     *bool   `json:"is_dao"`
+	Nonce     *string `json:"nonce"`
+	IsBlocked bool    `json:"is_blocked"` // blocked by the admin, no more uploads, its uploads not stored
+	CreateAt  int64   `json:"create_at"`
+	UpdateAt  int64   `json:"update_at"`
 }
 
 func GetWalletByAddress(address string, walletType int) (*Wallet, error) {
@@ -74,3 +75,18 @@ func SetWalletAsDao(walletId int64) error {
 
 	return nil
 }
+
+func UpdateWalletBlocked(walletId int64, isBlocked bool) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["is_blocked"] = isBlocked
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err := database.GetDB().Model(Wallet{}).Where("id=?", walletId).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+type WalletAccessKey struct {
+	ID         int64  `json:"id"`
+	WalletId   int64  `json:"wallet_id"`
+	AccessKey  string `json:"access_key"`
+	Secret     string `json:"-"`
+	Status     string `json:"status"`
+	LastUsedAt *int64 `json:"last_used_at"`
+	CreateAt   int64  `json:"create_at"`
+	UpdateAt   int64  `json:"update_at"`
+}
+
+func CreateWalletAccessKey(walletId int64, accessKey, secret string) (*WalletAccessKey, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	walletAccessKey := WalletAccessKey{
+		WalletId:  walletId,
+		AccessKey: accessKey,
+		Secret:    secret,
+		Status:    constants.WALLET_ACCESS_KEY_STATUS_ACTIVE,
+		CreateAt:  currentUtcSecond,
+		UpdateAt:  currentUtcSecond,
+	}
+
+	err := database.SaveOne(&walletAccessKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &walletAccessKey, nil
+}
+
+func GetWalletAccessKeyByAccessKey(accessKey string) (*WalletAccessKey, error) {
+	var walletAccessKeys []*WalletAccessKey
+	err := database.GetDB().Where("access_key=?", accessKey).Find(&walletAccessKeys).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(walletAccessKeys) > 0 {
+		return walletAccessKeys[0], nil
+	}
+
+	return nil, nil
+}
+
+func UpdateWalletAccessKeyStatus(accessKey, status string) error {
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["status"] = status
+	fields2BeUpdated["update_at"] = libutils.GetCurrentUtcSecond()
+
+	err := database.GetDB().Model(WalletAccessKey{}).Where("access_key=?", accessKey).Update(fields2BeUpdated).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateWalletAccessKeyLastUsed(id int64) error {
+	err := database.GetDB().Model(WalletAccessKey{}).Where("id=?", id).Update("last_used_at", libutils.GetCurrentUtcSecond()).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func GetWalletById(id int64) (*Wallet, error) {
+	var wallets []*Wallet
+	err := database.GetDB().Where("id=?", id).Find(&wallets).Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(wallets) > 0 {
+		return wallets[0], nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,636 @@
+package routers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"multi-chain-storage/common"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/errorinfo"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+)
+
+func Admin(router *gin.RouterGroup) {
+	router.Use(adminAuth())
+	router.GET("/miners", GetMiners)
+	router.GET("/miners/rank", RankMiners)
+	router.POST("/miner/allowlist", AllowlistMiner)
+	router.POST("/miner/blocklist", BlocklistMiner)
+	router.POST("/miner/reset", ResetMiner)
+	router.GET("/scan_deal/stats", GetScanDealStats)
+	router.GET("/gc/stats", GetGcStat)
+	router.GET("/gc/report", GetGcReport)
+	router.GET("/pin/drifts", GetPinDrifts)
+	router.GET("/jobs", GetJobs)
+	router.POST("/job/:job_name/pause", PauseJob)
+	router.POST("/job/:job_name/resume", ResumeJob)
+	router.POST("/job/:job_name/trigger", TriggerJob)
+	router.POST("/access_key", CreateAccessKey)
+	router.POST("/access_key/revoke", RevokeAccessKey)
+	router.GET("/abuse_reports", GetAbuseReports)
+	router.POST("/abuse_report/:id/review", ReviewAbuseReport)
+	router.GET("/denylist", GetDenylists)
+	router.POST("/denylist", AddDenylist)
+	router.POST("/denylist/remove", RemoveDenylist)
+	router.POST("/denylist/import", ImportDenylist)
+	router.POST("/wallet/block", BlockWallet)
+	router.POST("/wallet/unblock", UnblockWallet)
+	router.GET("/audit_logs", GetAuditLogs)
+	router.GET("/plans", GetPlans)
+	router.POST("/plan", SavePlan)
+	router.POST("/plan/assign", AssignPlan)
+}
+
+// adminAuth requires the admin_token in config as the bearer token, admin apis are disabled when it is not set
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminToken := config.GetConfig().AdminToken
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			err := fmt.Errorf("admin token is invalid")
+			logs.GetLogger().Error(err, ", ip:", c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, common.CreateErrorResponse(errorinfo.ERROR_UNAUTHORIZED, err.Error()))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func GetMiners(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	status := strings.Trim(URL.Get("status"), " ")
+
+	miners, err := service.GetMiners(status)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"miner": miners,
+	}))
+}
+
+func RankMiners(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	minerFidsStr := strings.Trim(URL.Get("miner_fids"), " ")
+	if minerFidsStr == "" {
+		err := fmt.Errorf("miner_fids is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	var minerFids []string
+	for _, minerFid := range strings.Split(minerFidsStr, ",") {
+		minerFid = strings.Trim(minerFid, " ")
+		if minerFid != "" {
+			minerFids = append(minerFids, minerFid)
+		}
+	}
+
+	miners, err := service.RankMiners(minerFids)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"miner": miners,
+	}))
+}
+
+type minerStatusParam struct {
+	MinerFid string `json:"miner_fid"`
+	Note     string `json:"note"`
+}
+
+func AllowlistMiner(c *gin.Context) {
+	updateMinerStatus(c, constants.MINER_STATUS_ALLOWLISTED)
+}
+
+func BlocklistMiner(c *gin.Context) {
+	updateMinerStatus(c, constants.MINER_STATUS_BLOCKLISTED)
+}
+
+func ResetMiner(c *gin.Context) {
+	updateMinerStatus(c, constants.MINER_STATUS_NORMAL)
+}
+
+func updateMinerStatus(c *gin.Context, status string) {
+	var model minerStatusParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	minerFid := strings.Trim(model.MinerFid, " ")
+	if minerFid == "" {
+		err := fmt.Errorf("miner_fid is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	err = service.UpdateMinerStatus(minerFid, status, model.Note)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+func GetScanDealStats(c *gin.Context) {
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"scan_deal_stat": service.GetScanDealStats(),
+	}))
+}
+
+func GetGcStat(c *gin.Context) {
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"gc_stat": service.GetGcStat(),
+	}))
+}
+
+func GetGcReport(c *gin.Context) {
+	gcReport, err := service.GetGcReport()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"gc_report": gcReport,
+	}))
+}
+
+func GetPinDrifts(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	var status *string
+	statusStr := strings.Trim(URL.Get("status"), " ")
+	if statusStr != "" {
+		status = &statusStr
+	}
+
+	pageNumber := 1
+	pageNumberTemp, err := strconv.Atoi(strings.Trim(URL.Get("page_number"), " "))
+	if err == nil && pageNumberTemp > 0 {
+		pageNumber = pageNumberTemp
+	}
+
+	pageSize := constants.PAGE_SIZE_DEFAULT_VALUE
+	pageSizeTemp, err := strconv.Atoi(strings.Trim(URL.Get("page_size"), " "))
+	if err == nil && pageSizeTemp > 0 {
+		pageSize = pageSizeTemp
+	}
+
+	pinDrifts, err := service.GetPinDrifts(status, pageSize, (pageNumber-1)*pageSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"pin_drift": pinDrifts,
+	}))
+}
+
+func GetJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"job": service.GetJobStatuses(),
+	}))
+}
+
+func PauseJob(c *gin.Context) {
+	operateJob(c, service.PauseJob)
+}
+
+func ResumeJob(c *gin.Context) {
+	operateJob(c, service.ResumeJob)
+}
+
+func TriggerJob(c *gin.Context) {
+	operateJob(c, service.TriggerJob)
+}
+
+func operateJob(c *gin.Context, operation func(string) error) {
+	jobName := strings.Trim(c.Params.ByName("job_name"), " ")
+	if jobName == "" {
+		err := fmt.Errorf("job_name is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	err := operation(jobName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+type accessKeyParam struct {
+	WalletAddress string `json:"wallet_address"`
+	AccessKey     string `json:"access_key"`
+}
+
+func CreateAccessKey(c *gin.Context) {
+	var model accessKeyParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	walletAddress := strings.Trim(model.WalletAddress, " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	accessKey, err := service.CreateAccessKey(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"access_key": accessKey,
+	}))
+}
+
+func RevokeAccessKey(c *gin.Context) {
+	var model accessKeyParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	accessKey := strings.Trim(model.AccessKey, " ")
+	if accessKey == "" {
+		err := fmt.Errorf("access_key is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	err = service.RevokeAccessKey(accessKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+// getPageLimitOffset returns the limit and the offset of page_number and page_size in the query
+func getPageLimitOffset(URL url.Values) (int, int) {
+	pageNumber := 1
+	pageNumberTemp, err := strconv.Atoi(strings.Trim(URL.Get("page_number"), " "))
+	if err == nil && pageNumberTemp > 0 {
+		pageNumber = pageNumberTemp
+	}
+
+	pageSize := constants.PAGE_SIZE_DEFAULT_VALUE
+	pageSizeTemp, err := strconv.Atoi(strings.Trim(URL.Get("page_size"), " "))
+	if err == nil && pageSizeTemp > 0 {
+		pageSize = pageSizeTemp
+	}
+
+	return pageSize, (pageNumber - 1) * pageSize
+}
+
+// getQueryOptional returns the param in the query, nil if it is empty
+func getQueryOptional(URL url.Values, key string) *string {
+	value := strings.Trim(URL.Get(key), " ")
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func GetAbuseReports(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	limit, offset := getPageLimitOffset(URL)
+
+	abuseReports, err := service.GetAbuseReports(getQueryOptional(URL, "status"), limit, offset)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"abuse_report": abuseReports,
+	}))
+}
+
+type abuseReportReviewParam struct {
+	Action      string  `json:"action"` // remove or dismiss
+	BlockWallet bool    `json:"block_wallet"`
+	Note        *string `json:"note"`
+}
+
+// ReviewAbuseReport removes the content reported, optionally blocking the wallets having uploaded it, or dismisses
+// the report
+func ReviewAbuseReport(c *gin.Context) {
+	id, err := strconv.ParseInt(strings.Trim(c.Params.ByName("id"), " "), 10, 64)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, "id should be a number"))
+		return
+	}
+
+	var model abuseReportReviewParam
+	err = c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	action := strings.Trim(model.Action, " ")
+	if action != constants.ABUSE_REPORT_ACTION_REMOVE && action != constants.ABUSE_REPORT_ACTION_DISMISS {
+		err := fmt.Errorf("action should be %s or %s", constants.ABUSE_REPORT_ACTION_REMOVE, constants.ABUSE_REPORT_ACTION_DISMISS)
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	abuseReport, err := service.ReviewAbuseReport(id, action, model.BlockWallet, model.Note, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrAbuseReportNotFound) {
+			c.JSON(http.StatusNotFound, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		if errors.Is(err, service.ErrAbuseReportReviewed) {
+			c.JSON(http.StatusConflict, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"abuse_report": abuseReport,
+	}))
+}
+
+func GetDenylists(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	limit, offset := getPageLimitOffset(URL)
+
+	denylists, err := service.GetDenylists(getQueryOptional(URL, "kind"), getQueryOptional(URL, "source"), limit, offset)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"denylist": denylists,
+	}))
+}
+
+type denylistParam struct {
+	Id     int64   `json:"id"`
+	Kind   string  `json:"kind"`
+	Value  string  `json:"value"`
+	Reason *string `json:"reason"`
+	Url    string  `json:"url"`
+}
+
+func AddDenylist(c *gin.Context) {
+	var model denylistParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	err = service.AddDenylist(strings.Trim(model.Kind, " "), model.Value, model.Reason, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+func RemoveDenylist(c *gin.Context) {
+	var model denylistParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	if model.Id <= 0 {
+		err := fmt.Errorf("id is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	err = service.RemoveDenylist(model.Id, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrDenylistNotFound) {
+			c.JSON(http.StatusNotFound, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+// ImportDenylist imports the list in the compact denylist format at the url, the entries imported from the url before
+// but no longer in the list are removed
+func ImportDenylist(c *gin.Context) {
+	var model denylistParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	denylistUrl := strings.Trim(model.Url, " ")
+	if denylistUrl == "" {
+		err := fmt.Errorf("url is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	savedCnt, removedCnt, err := service.ImportDenylist(c.Request.Context(), denylistUrl, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"saved_cnt":   savedCnt,
+		"removed_cnt": removedCnt,
+	}))
+}
+
+type walletBlockParam struct {
+	WalletAddress string  `json:"wallet_address"`
+	Note          *string `json:"note"`
+}
+
+func BlockWallet(c *gin.Context) {
+	updateWalletBlocked(c, true)
+}
+
+func UnblockWallet(c *gin.Context) {
+	updateWalletBlocked(c, false)
+}
+
+func updateWalletBlocked(c *gin.Context, isBlocked bool) {
+	var model walletBlockParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	walletAddress := strings.Trim(model.WalletAddress, " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	err = service.BlockWallet(walletAddress, isBlocked, model.Note, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+func GetAuditLogs(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	limit, offset := getPageLimitOffset(URL)
+
+	auditLogs, err := service.GetAuditLogs(getQueryOptional(URL, "target_type"), getQueryOptional(URL, "target_id"), limit, offset)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"audit_log": auditLogs,
+	}))
+}
+
+func GetPlans(c *gin.Context) {
+	plans, err := service.GetPlans()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"plan": plans,
+	}))
+}
+
+func SavePlan(c *gin.Context) {
+	var model models.Plan
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	err = service.SavePlan(&model, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+type planAssignParam struct {
+	WalletAddress  string `json:"wallet_address"`
+	OrganizationId *int64 `json:"organization_id"`
+	PlanName       string `json:"plan_name"`
+}
+
+func AssignPlan(c *gin.Context) {
+	var model planAssignParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	if (strings.Trim(model.WalletAddress, " ") == "" && model.OrganizationId == nil) || strings.Trim(model.PlanName, " ") == "" {
+		err := fmt.Errorf("wallet_address or organization_id, and plan_name are required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	err = service.AssignPlan(model.WalletAddress, model.OrganizationId, model.PlanName, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrPlanNotFound) || errors.Is(err, service.ErrOrganizationNotFound) {
+			c.JSON(http.StatusNotFound, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
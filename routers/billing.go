@@ -1,11 +1,13 @@
 package routers
 
 import (
+	"errors"
 	"fmt"
 	common "multi-chain-storage/common"
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/common/errorinfo"
 	"multi-chain-storage/common/utils"
+	"multi-chain-storage/models"
 	"multi-chain-storage/service"
 	"net/http"
 	"strconv"
@@ -67,9 +69,33 @@ func GetUserBillingHistory(c *gin.Context) {
 
 	fileName := URL.Get("file_name")
 
-	billings, totalRecordCount, err := service.GetTransactions(walletAddress, txHash, fileName, orderBy, isAscend, limit, offset)
+	organizationId, err := getOrganizationId(URL.Get("organization_id"))
 	if err != nil {
 		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if !authenticateOrganizationWallet(c, walletAddress, organizationId) {
+		return
+	}
+
+	page := &models.Page{Limit: limit, PageNumber: offset, Cursor: strings.Trim(URL.Get("cursor"), " ")}
+	billings, totalRecordCount, nextCursor, err := service.GetTransactions(walletAddress, organizationId, getUploadFilter(URL), txHash, fileName, orderBy, isAscend, page)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, models.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		if errors.Is(err, service.ErrOrganizationNotFound) || errors.Is(err, service.ErrOrganizationForbidden) {
+			organizationError(c, err)
+			return
+		}
+		if isBucketError(err) {
+			bucketError(c, err, http.StatusInternalServerError)
+			return
+		}
 		c.AbortWithStatusJSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
 		return
 	}
@@ -77,6 +103,7 @@ func GetUserBillingHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
 		"billing":            billings,
 		"total_record_count": *totalRecordCount,
+		"next_cursor":        nextCursor,
 	}))
 }
 
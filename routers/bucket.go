@@ -0,0 +1,231 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common"
+	"multi-chain-storage/common/errorinfo"
+	"multi-chain-storage/service"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+)
+
+func Bucket(router *gin.RouterGroup) {
+	router.GET("", GetBuckets)
+	router.POST("", CreateBucket)
+	router.GET("/objects", GetBucketObjects)
+	router.POST("/object", PutBucketObject)
+	router.POST("/object/move", MoveBucketObject)
+}
+
+// isBucketError returns whether the error is of the buckets and their keys
+func isBucketError(err error) bool {
+	return errors.Is(err, service.ErrNoSuchBucket) || errors.Is(err, service.ErrNoSuchKey) || errors.Is(err, service.ErrS3AccessDenied) ||
+		errors.Is(err, service.ErrBucketAlreadyExists) || errors.Is(err, service.ErrBucketAlreadyOwnedByYou) ||
+		errors.Is(err, service.ErrBucketObjectExists) || errors.Is(err, service.ErrInvalidBucketName) ||
+		errors.Is(err, service.ErrBucketOrganizationUpload)
+}
+
+// bucketError responds 404 if the bucket, the key or the upload is not found, 403 if not allowed, 409 if the bucket or
+// the key is taken, otherwise the error with the status given
+func bucketError(c *gin.Context, err error, httpStatus int) {
+	errorCode := errorinfo.ERROR_PARAM_INVALID_VALUE
+	switch {
+	case errors.Is(err, service.ErrNoSuchBucket) || errors.Is(err, service.ErrNoSuchKey) || errors.Is(err, service.ErrSourceFileUploadNotFound):
+		httpStatus = http.StatusNotFound
+	case errors.Is(err, service.ErrS3AccessDenied) || errors.Is(err, service.ErrWalletBlocked) || errors.Is(err, service.ErrSourceFileUploadForbidden):
+		httpStatus = http.StatusForbidden
+	case errors.Is(err, service.ErrBucketAlreadyExists) || errors.Is(err, service.ErrBucketAlreadyOwnedByYou) || errors.Is(err, service.ErrBucketObjectExists):
+		httpStatus = http.StatusConflict
+	case errors.Is(err, service.ErrInvalidBucketName) || errors.Is(err, service.ErrBucketOrganizationUpload):
+		httpStatus = http.StatusBadRequest
+	case httpStatus == http.StatusInternalServerError:
+		errorCode = errorinfo.ERROR_INTERNAL
+	}
+
+	c.JSON(httpStatus, common.CreateErrorResponse(errorCode, err.Error()))
+}
+
+// getUploadFilter returns the filter of the uploads by bucket_name, tag_key and tag_value in the query, tag_value is
+// ignored if not in the query, an empty one filters by the tags with empty values
+func getUploadFilter(URL url.Values) *service.UploadFilter {
+	uploadFilter := &service.UploadFilter{
+		BucketName: strings.Trim(URL.Get("bucket_name"), " "),
+		TagKey:     strings.Trim(URL.Get("tag_key"), " "),
+	}
+
+	if _, ok := URL["tag_value"]; ok {
+		tagValue := URL.Get("tag_value")
+		uploadFilter.TagValue = &tagValue
+	}
+
+	return uploadFilter
+}
+
+type bucketParam struct {
+	WalletAddress      string `json:"wallet_address"`
+	BucketName         string `json:"bucket_name"`
+	ObjectKey          string `json:"object_key"`
+	SourceFileUploadId int64  `json:"source_file_upload_id"`
+	NewBucketName      string `json:"new_bucket_name"`
+	NewObjectKey       string `json:"new_object_key"`
+}
+
+// bindBucketParam parses the body, the wallet address and the bucket name are required
+func bindBucketParam(c *gin.Context) (*bucketParam, bool) {
+	var model bucketParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return nil, false
+	}
+
+	model.WalletAddress = strings.Trim(model.WalletAddress, " ")
+	if model.WalletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return nil, false
+	}
+
+	model.BucketName = strings.Trim(model.BucketName, " ")
+	if model.BucketName == "" {
+		err := fmt.Errorf("bucket_name is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return nil, false
+	}
+
+	model.NewBucketName = strings.Trim(model.NewBucketName, " ")
+	return &model, true
+}
+
+func GetBuckets(c *gin.Context) {
+	walletAddress := strings.Trim(c.Request.URL.Query().Get("wallet_address"), " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	buckets, err := service.GetWalletBuckets(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"bucket": buckets,
+	}))
+}
+
+func CreateBucket(c *gin.Context) {
+	model, ok := bindBucketParam(c)
+	if !ok {
+		return
+	}
+
+	err := service.CreateWalletBucket(model.WalletAddress, model.BucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		bucketError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+// GetBucketObjects lists the keys in the bucket with the prefix, the keys with the delimiter after the prefix rolled up
+// to common_prefixes, the folders when the delimiter is /. The list continues with start_after of next_marker
+func GetBucketObjects(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	walletAddress := strings.Trim(URL.Get("wallet_address"), " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	bucketName := strings.Trim(URL.Get("bucket_name"), " ")
+	if bucketName == "" {
+		err := fmt.Errorf("bucket_name is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	maxKeys := 0
+	maxKeysStr := strings.Trim(URL.Get("max_keys"), " ")
+	if maxKeysStr != "" {
+		maxKeysTemp, err := strconv.Atoi(maxKeysStr)
+		if err != nil {
+			err := fmt.Errorf("max_keys must be a valid number")
+			logs.GetLogger().Error(err)
+			c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_WRONG_TYPE, err.Error()))
+			return
+		}
+		maxKeys = maxKeysTemp
+	}
+
+	objectList, err := service.ListWalletObjects(walletAddress, bucketName, URL.Get("prefix"), URL.Get("delimiter"), URL.Get("start_after"), maxKeys)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		bucketError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(objectList))
+}
+
+// PutBucketObject puts an upload of the wallet at the key in its bucket, the key must not be taken
+func PutBucketObject(c *gin.Context) {
+	model, ok := bindBucketParam(c)
+	if !ok {
+		return
+	}
+
+	if model.SourceFileUploadId <= 0 {
+		err := fmt.Errorf("source_file_upload_id must be greater than 0")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	bucketObject, err := service.PutWalletObject(model.WalletAddress, model.BucketName, model.ObjectKey, model.SourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		bucketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(bucketObject))
+}
+
+// MoveBucketObject moves or renames the key, or the folder if the key ends with /, to the new key in the new bucket,
+// the same bucket if new_bucket_name is empty
+func MoveBucketObject(c *gin.Context) {
+	model, ok := bindBucketParam(c)
+	if !ok {
+		return
+	}
+
+	movedCnt, err := service.MoveWalletObject(model.WalletAddress, model.BucketName, model.ObjectKey, model.NewBucketName, model.NewObjectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		bucketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"moved_cnt": movedCnt,
+	}))
+}
@@ -0,0 +1,261 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common"
+	"multi-chain-storage/common/errorinfo"
+	"multi-chain-storage/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+)
+
+func Organization(router *gin.RouterGroup) {
+	router.POST("", CreateOrganization)
+	router.GET("", GetOrganizations)
+	router.GET("/:organization_id/members", GetOrganizationMembers)
+	router.POST("/:organization_id/member", SaveOrganizationMember)
+	router.POST("/:organization_id/member/remove", RemoveOrganizationMember)
+}
+
+// getOrganizationId parses the organization id given, nil if it is empty
+func getOrganizationId(organizationIdStr string) (*int64, error) {
+	organizationIdStr = strings.Trim(organizationIdStr, " ")
+	if organizationIdStr == "" {
+		return nil, nil
+	}
+
+	organizationId, err := strconv.ParseInt(organizationIdStr, 10, 64)
+	if err != nil {
+		err := fmt.Errorf("organization_id must be a valid number")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &organizationId, nil
+}
+
+// authenticateWallet responds 401 and returns false unless the bearer token is an access key of the wallet, the roles
+// of the wallet in the organizations are granted only to the requests authenticated so
+func authenticateWallet(c *gin.Context, walletAddress string) bool {
+	err := service.AuthenticateWallet(walletAddress, strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrWalletUnauthorized) {
+			c.JSON(http.StatusUnauthorized, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return false
+	}
+
+	return true
+}
+
+// authenticateOrganizationWallet is authenticateWallet for the requests on the organization given, the others are not
+// checked
+func authenticateOrganizationWallet(c *gin.Context, walletAddress string, organizationId *int64) bool {
+	if organizationId == nil {
+		return true
+	}
+
+	return authenticateWallet(c, walletAddress)
+}
+
+// authenticateSourceFileUploadWallet is authenticateWallet for the requests on an upload owned by an organization
+func authenticateSourceFileUploadWallet(c *gin.Context, walletAddress string, sourceFileUploadId int64) bool {
+	organizationId, err := service.GetSourceFileUploadOrganizationId(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return false
+	}
+
+	return authenticateOrganizationWallet(c, walletAddress, organizationId)
+}
+
+// organizationError responds 404 if the organization is not found, 403 if the wallet is not allowed in it, otherwise
+// the error as internal
+func organizationError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrOrganizationNotFound) {
+		c.JSON(http.StatusNotFound, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if errors.Is(err, service.ErrOrganizationForbidden) || errors.Is(err, service.ErrWalletBlocked) {
+		c.JSON(http.StatusForbidden, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+}
+
+type organizationParam struct {
+	WalletAddress       string `json:"wallet_address"`
+	Name                string `json:"name"`
+	MemberWalletAddress string `json:"member_wallet_address"`
+	Role                string `json:"role"`
+}
+
+// bindOrganizationParam parses the body, and the organization id in the path if required, the request must be
+// authenticated as the wallet
+func bindOrganizationParam(c *gin.Context, isOrganizationIdRequired bool) (*organizationParam, int64, bool) {
+	var model organizationParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return nil, 0, false
+	}
+
+	model.WalletAddress = strings.Trim(model.WalletAddress, " ")
+	if model.WalletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return nil, 0, false
+	}
+
+	if !authenticateWallet(c, model.WalletAddress) {
+		return nil, 0, false
+	}
+
+	if !isOrganizationIdRequired {
+		return &model, 0, true
+	}
+
+	organizationId, err := getOrganizationId(c.Params.ByName("organization_id"))
+	if err != nil || organizationId == nil {
+		err := fmt.Errorf("organization_id must be a valid number")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return nil, 0, false
+	}
+
+	if strings.Trim(model.MemberWalletAddress, " ") == "" {
+		err := fmt.Errorf("member_wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return nil, 0, false
+	}
+
+	return &model, *organizationId, true
+}
+
+func CreateOrganization(c *gin.Context) {
+	model, _, ok := bindOrganizationParam(c, false)
+	if !ok {
+		return
+	}
+
+	organization, err := service.CreateOrganization(model.WalletAddress, model.Name)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrWalletBlocked) {
+			organizationError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(organization))
+}
+
+func GetOrganizations(c *gin.Context) {
+	walletAddress := strings.Trim(c.Request.URL.Query().Get("wallet_address"), " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	if !authenticateWallet(c, walletAddress) {
+		return
+	}
+
+	organizations, err := service.GetOrganizations(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"organization": organizations,
+	}))
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	walletAddress := strings.Trim(c.Request.URL.Query().Get("wallet_address"), " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	organizationId, err := getOrganizationId(c.Params.ByName("organization_id"))
+	if err != nil || organizationId == nil {
+		err := fmt.Errorf("organization_id must be a valid number")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if !authenticateWallet(c, walletAddress) {
+		return
+	}
+
+	organizationMembers, err := service.GetOrganizationMembers(walletAddress, *organizationId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		organizationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"organization_member": organizationMembers,
+	}))
+}
+
+func SaveOrganizationMember(c *gin.Context) {
+	model, organizationId, ok := bindOrganizationParam(c, true)
+	if !ok {
+		return
+	}
+
+	err := service.SaveOrganizationMember(model.WalletAddress, organizationId, model.MemberWalletAddress, model.Role)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrOrganizationNotFound) || errors.Is(err, service.ErrOrganizationForbidden) || errors.Is(err, service.ErrWalletBlocked) {
+			organizationError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	model, organizationId, ok := bindOrganizationParam(c, true)
+	if !ok {
+		return
+	}
+
+	err := service.RemoveOrganizationMember(model.WalletAddress, organizationId, model.MemberWalletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		organizationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
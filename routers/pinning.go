@@ -0,0 +1,276 @@
+package routers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service"
+	"multi-chain-storage/service/denylist"
+	"multi-chain-storage/service/plan"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+)
+
+// Pinning serves the ipfs pinning service api, https://ipfs.github.io/pinning-services-api-spec/
+func Pinning(router *gin.RouterGroup) {
+	router.Use(pinningAuth())
+	router.GET("/pins", GetPins)
+	router.POST("/pins", CreatePin)
+	router.GET("/pins/:requestid", GetPin)
+	router.POST("/pins/:requestid", ReplacePin)
+	router.DELETE("/pins/:requestid", DeletePin)
+}
+
+const PINNING_CONTEXT_KEY_WALLET = "wallet"
+
+// pinningError responds the error in the format of the pinning service api
+func pinningError(c *gin.Context, httpStatus int, reason string, err error) {
+	logs.GetLogger().Error(err)
+	c.AbortWithStatusJSON(httpStatus, gin.H{
+		"error": gin.H{
+			"reason":  reason,
+			"details": err.Error(),
+		},
+	})
+}
+
+// pinningAuth requires the token access_key:secret of a wallet as the bearer token
+func pinningAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		wallet, err := service.AuthenticateAccessKey(token)
+		if err != nil {
+			pinningError(c, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err)
+			return
+		}
+
+		if wallet == nil {
+			err := fmt.Errorf("access token is invalid, ip:%s", c.ClientIP())
+			pinningError(c, http.StatusUnauthorized, "UNAUTHORIZED", err)
+			return
+		}
+
+		err = plan.AllowRequest(wallet.ID)
+		if err != nil {
+			if errors.Is(err, plan.ErrRateLimited) {
+				pinningError(c, http.StatusTooManyRequests, "RATE_LIMITED", err)
+				return
+			}
+			pinningError(c, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err)
+			return
+		}
+
+		c.Set(PINNING_CONTEXT_KEY_WALLET, wallet)
+		c.Next()
+	}
+}
+
+func getPinningWallet(c *gin.Context) *models.Wallet {
+	return c.MustGet(PINNING_CONTEXT_KEY_WALLET).(*models.Wallet)
+}
+
+func GetPins(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	pinFilter := service.PinFilter{
+		Statuses: []string{constants.PIN_REQUEST_STATUS_PINNED},
+		Limit:    constants.PIN_LIST_LIMIT_DEFAULT,
+	}
+
+	cidsStr := strings.Trim(URL.Get("cid"), " ")
+	if cidsStr != "" {
+		pinFilter.Cids = strings.Split(cidsStr, ",")
+	}
+
+	name := URL.Get("name")
+	if name != "" {
+		nameLike := utils.EscapeLike(name)
+		match := strings.Trim(URL.Get("match"), " ")
+		switch match {
+		case "", "exact":
+		case "iexact":
+			pinFilter.NameIgnoreCase = true
+		case "partial":
+			nameLike = "%" + nameLike + "%"
+		case "ipartial":
+			nameLike = "%" + nameLike + "%"
+			pinFilter.NameIgnoreCase = true
+		default:
+			err := fmt.Errorf("match:%s should be exact, iexact, partial or ipartial", match)
+			pinningError(c, http.StatusBadRequest, "BAD_REQUEST", err)
+			return
+		}
+		pinFilter.NameLike = &nameLike
+	}
+
+	statusesStr := strings.Trim(URL.Get("status"), " ")
+	if statusesStr != "" {
+		pinFilter.Statuses = nil
+		for _, status := range strings.Split(statusesStr, ",") {
+			switch status {
+			case constants.PIN_REQUEST_STATUS_QUEUED, constants.PIN_REQUEST_STATUS_PINNING, constants.PIN_REQUEST_STATUS_PINNED, constants.PIN_REQUEST_STATUS_FAILED:
+				pinFilter.Statuses = append(pinFilter.Statuses, status)
+			default:
+				err := fmt.Errorf("status:%s should be queued, pinning, pinned or failed", status)
+				pinningError(c, http.StatusBadRequest, "BAD_REQUEST", err)
+				return
+			}
+		}
+	}
+
+	var ok bool
+	pinFilter.Before, ok = getPinTimeParam(c, "before")
+	if !ok {
+		return
+	}
+
+	pinFilter.After, ok = getPinTimeParam(c, "after")
+	if !ok {
+		return
+	}
+
+	limitStr := strings.Trim(URL.Get("limit"), " ")
+	if limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > constants.PIN_LIST_LIMIT_MAX {
+			err := fmt.Errorf("limit should be an integer in [1,%d]", constants.PIN_LIST_LIMIT_MAX)
+			pinningError(c, http.StatusBadRequest, "BAD_REQUEST", err)
+			return
+		}
+		pinFilter.Limit = limit
+	}
+
+	metaStr := strings.Trim(URL.Get("meta"), " ")
+	if metaStr != "" {
+		err := json.Unmarshal([]byte(metaStr), &pinFilter.Meta)
+		if err != nil {
+			pinningError(c, http.StatusBadRequest, "BAD_REQUEST", fmt.Errorf("meta should be a json object of strings, %w", err))
+			return
+		}
+	}
+
+	pinResults, err := service.GetPins(getPinningWallet(c), &pinFilter)
+	if err != nil {
+		pinningError(c, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pinResults)
+}
+
+// getPinTimeParam parses the time param in RFC3339 to unix second
+func getPinTimeParam(c *gin.Context, param string) (*int64, bool) {
+	timeStr := strings.Trim(c.Query(param), " ")
+	if timeStr == "" {
+		return nil, true
+	}
+
+	timeParsed, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		pinningError(c, http.StatusBadRequest, "BAD_REQUEST", fmt.Errorf("%s should be in RFC3339, %w", param, err))
+		return nil, false
+	}
+
+	unixSecond := timeParsed.Unix()
+	return &unixSecond, true
+}
+
+func bindPin(c *gin.Context) (*service.Pin, bool) {
+	var pin service.Pin
+	err := c.ShouldBindJSON(&pin)
+	if err != nil {
+		pinningError(c, http.StatusBadRequest, "BAD_REQUEST", err)
+		return nil, false
+	}
+
+	pin.Cid = strings.Trim(pin.Cid, " ")
+	if pin.Cid == "" {
+		pinningError(c, http.StatusBadRequest, "BAD_REQUEST", fmt.Errorf("cid is required"))
+		return nil, false
+	}
+
+	return &pin, true
+}
+
+func CreatePin(c *gin.Context) {
+	pin, ok := bindPin(c)
+	if !ok {
+		return
+	}
+
+	pinStatus, err := service.CreatePin(getPinningWallet(c), pin)
+	if err != nil {
+		pinningServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, pinStatus)
+}
+
+// pinningServiceError responds the error of the pinning service, 404 if the pin is not found, 403 if the content is
+// denied or the plan limit is exceeded, 429 if rate limited
+func pinningServiceError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrPinNotFound) {
+		pinningError(c, http.StatusNotFound, "NOT_FOUND", err)
+		return
+	}
+
+	if errors.Is(err, denylist.ErrContentDenied) {
+		pinningError(c, http.StatusForbidden, "CONTENT_DENIED", err)
+		return
+	}
+
+	if errors.Is(err, plan.ErrPlanLimitExceeded) {
+		pinningError(c, http.StatusForbidden, "PLAN_LIMIT_EXCEEDED", err)
+		return
+	}
+
+	if errors.Is(err, plan.ErrRateLimited) {
+		pinningError(c, http.StatusTooManyRequests, "RATE_LIMITED", err)
+		return
+	}
+
+	pinningError(c, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err)
+}
+
+func GetPin(c *gin.Context) {
+	pinStatus, err := service.GetPin(getPinningWallet(c), c.Params.ByName("requestid"))
+	if err != nil {
+		pinningServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pinStatus)
+}
+
+func ReplacePin(c *gin.Context) {
+	pin, ok := bindPin(c)
+	if !ok {
+		return
+	}
+
+	pinStatus, err := service.ReplacePin(getPinningWallet(c), c.Params.ByName("requestid"), pin)
+	if err != nil {
+		pinningServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, pinStatus)
+}
+
+func DeletePin(c *gin.Context) {
+	err := service.DeletePin(getPinningWallet(c), c.Params.ByName("requestid"))
+	if err != nil {
+		pinningServiceError(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,81 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common"
+	"multi-chain-storage/common/errorinfo"
+	"multi-chain-storage/service"
+	"net/http"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+)
+
+func GetRenewals(c *gin.Context) {
+	logs.GetLogger().Info("ip:", c.ClientIP(), ",port:", c.Request.URL.Port())
+	URL := c.Request.URL.Query()
+	walletAddress := strings.Trim(URL.Get("wallet_address"), " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	status := strings.Trim(URL.Get("status"), " ")
+
+	renewals, err := service.GetRenewals(walletAddress, &status)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"renewal": renewals,
+	}))
+}
+
+type renewalPayment struct {
+	RenewalId int64  `json:"renewal_id"`
+	TxHash    string `json:"tx_hash"`
+}
+
+func PayRenewal(c *gin.Context) {
+	var model renewalPayment
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	if model.RenewalId <= 0 {
+		err := fmt.Errorf("renewal_id must be greater than 0")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if strings.Trim(model.TxHash, " ") == "" {
+		err := fmt.Errorf("tx_hash is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	err = service.PayRenewal(model.RenewalId, strings.Trim(model.TxHash, " "))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrRenewalPaymentInvalid) {
+			c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
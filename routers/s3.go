@@ -0,0 +1,675 @@
+package routers
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service"
+	"multi-chain-storage/service/denylist"
+	"multi-chain-storage/service/plan"
+	"multi-chain-storage/service/scan"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// S3Gateway serves the s3 compatible api on the engine, the buckets are addressed by path like /bucket/key,
+// since the operations are told by the query parameters rather than the paths, all requests are dispatched by handleS3
+func S3Gateway(engine *gin.Engine) {
+	engine.Use(s3Auth())
+	engine.Any("/*path", handleS3)
+}
+
+const (
+	S3_CONTEXT_KEY_WALLET     = "wallet"
+	S3_CONTEXT_KEY_REQUEST_ID = "request_id"
+	S3_XML_NAMESPACE          = "http://s3.amazonaws.com/doc/2006-03-01/"
+	S3_TIME_FORMAT            = "2006-01-02T15:04:05.000Z"
+)
+
+var (
+	errS3InvalidArgument    = errors.New("invalid argument")
+	errS3MalformedXML       = errors.New("the xml you provided was not well-formed or did not validate against our published schema")
+	errS3BadDigest          = errors.New("the content-md5 you specified did not match what we received")
+	errS3MethodNotAllowed   = errors.New("the specified method is not allowed against this resource")
+	s3SubresourcesSupported = map[string]bool{
+		"location":           true,
+		"uploads":            true,
+		"uploadId":           true,
+		"partNumber":         true,
+		"list-type":          true,
+		"continuation-token": true,
+		"start-after":        true,
+		"fetch-owner":        true,
+		"marker":             true,
+		"max-keys":           true,
+		"prefix":             true,
+		"delimiter":          true,
+		"encoding-type":      true,
+	}
+	s3Errors = []struct {
+		err        error
+		code       string
+		httpStatus int
+	}{
+		{service.ErrNoSuchBucket, "NoSuchBucket", http.StatusNotFound},
+		{service.ErrBucketAlreadyExists, "BucketAlreadyExists", http.StatusConflict},
+		{service.ErrBucketAlreadyOwnedByYou, "BucketAlreadyOwnedByYou", http.StatusConflict},
+		{service.ErrBucketNotEmpty, "BucketNotEmpty", http.StatusConflict},
+		{service.ErrInvalidBucketName, "InvalidBucketName", http.StatusBadRequest},
+		{service.ErrNoSuchKey, "NoSuchKey", http.StatusNotFound},
+		{service.ErrNoSuchUpload, "NoSuchUpload", http.StatusNotFound},
+		{service.ErrInvalidPart, "InvalidPart", http.StatusBadRequest},
+		{service.ErrInvalidPartOrder, "InvalidPartOrder", http.StatusBadRequest},
+		{service.ErrEntityTooSmall, "EntityTooSmall", http.StatusBadRequest},
+		{service.ErrS3AccessDenied, "AccessDenied", http.StatusForbidden},
+		{denylist.ErrContentDenied, "AccessDenied", http.StatusForbidden},
+		{scan.ErrUploadRejected, "AccessDenied", http.StatusForbidden},
+		{plan.ErrPlanLimitExceeded, "AccessDenied", http.StatusForbidden},
+		{plan.ErrRateLimited, "SlowDown", http.StatusServiceUnavailable},
+		{errS3MissingSecurityHeader, "MissingSecurityHeader", http.StatusBadRequest},
+		{errS3AuthorizationMalformed, "AuthorizationHeaderMalformed", http.StatusBadRequest},
+		{errS3InvalidAccessKeyId, "InvalidAccessKeyId", http.StatusForbidden},
+		{errS3SignatureDoesNotMatch, "SignatureDoesNotMatch", http.StatusForbidden},
+		{errS3RequestTimeTooSkewed, "RequestTimeTooSkewed", http.StatusForbidden},
+		{errS3ExpiredPresignedRequest, "AccessDenied", http.StatusForbidden},
+		{errS3ContentSha256Mismatch, "XAmzContentSHA256Mismatch", http.StatusBadRequest},
+		{errS3IncompleteBody, "IncompleteBody", http.StatusBadRequest},
+		{errS3NotImplemented, "NotImplemented", http.StatusNotImplemented},
+		{errS3InvalidArgument, "InvalidArgument", http.StatusBadRequest},
+		{errS3MalformedXML, "MalformedXML", http.StatusBadRequest},
+		{errS3BadDigest, "BadDigest", http.StatusBadRequest},
+		{errS3MethodNotAllowed, "MethodNotAllowed", http.StatusMethodNotAllowed},
+	}
+)
+
+type s3ErrorResult struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestId string   `xml:"RequestId"`
+}
+
+type s3Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type s3Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name    `xml:"ListAllMyBucketsResult"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Owner   s3Owner     `xml:"Owner"`
+	Buckets []*s3Bucket `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Region  string   `xml:",chardata"`
+}
+
+type s3Content struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listBucketResult is the result of both ListObjects and ListObjectsV2, the fields of the other version omitted
+type listBucketResult struct {
+	XMLName               xml.Name          `xml:"ListBucketResult"`
+	Xmlns                 string            `xml:"xmlns,attr"`
+	Name                  string            `xml:"Name"`
+	Prefix                string            `xml:"Prefix"`
+	Marker                *string           `xml:"Marker"`
+	NextMarker            string            `xml:"NextMarker,omitempty"`
+	StartAfter            string            `xml:"StartAfter,omitempty"`
+	ContinuationToken     string            `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string            `xml:"NextContinuationToken,omitempty"`
+	KeyCount              *int              `xml:"KeyCount"`
+	MaxKeys               int               `xml:"MaxKeys"`
+	Delimiter             string            `xml:"Delimiter,omitempty"`
+	EncodingType          string            `xml:"EncodingType,omitempty"`
+	IsTruncated           bool              `xml:"IsTruncated"`
+	Contents              []*s3Content      `xml:"Contents"`
+	CommonPrefixes        []*s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func s3XmlResponse(c *gin.Context, httpStatus int, result interface{}) {
+	output, err := xml.Marshal(result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(httpStatus, "application/xml", append([]byte(xml.Header), output...))
+}
+
+// s3ErrorResponse responds the error in the format of s3, the errors not known are internal errors
+func s3ErrorResponse(c *gin.Context, err error) {
+	logs.GetLogger().Error(err)
+
+	code := "InternalError"
+	httpStatus := http.StatusInternalServerError
+	message := "we encountered an internal error, please try again"
+	for _, s3Error := range s3Errors {
+		if errors.Is(err, s3Error.err) {
+			code = s3Error.code
+			httpStatus = s3Error.httpStatus
+			message = err.Error()
+			break
+		}
+	}
+
+	c.Abort()
+	if c.Request.Method == http.MethodHead {
+		c.Status(httpStatus)
+		return
+	}
+
+	s3XmlResponse(c, httpStatus, &s3ErrorResult{
+		Code:      code,
+		Message:   message,
+		Resource:  c.Request.URL.Path,
+		RequestId: c.GetString(S3_CONTEXT_KEY_REQUEST_ID),
+	})
+}
+
+// s3Auth requires the requests signed by signature version 4 with the access key of a wallet
+func s3Auth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := uuid.NewString()
+		c.Set(S3_CONTEXT_KEY_REQUEST_ID, requestId)
+		c.Header("x-amz-request-id", requestId)
+
+		wallet, err := authenticateSigV4(c.Request)
+		if err != nil {
+			s3ErrorResponse(c, fmt.Errorf("%w, ip:%s", err, c.ClientIP()))
+			return
+		}
+
+		err = plan.AllowRequest(wallet.ID)
+		if err != nil {
+			s3ErrorResponse(c, err)
+			return
+		}
+
+		c.Set(S3_CONTEXT_KEY_WALLET, wallet)
+		c.Next()
+	}
+}
+
+func getS3Wallet(c *gin.Context) *models.Wallet {
+	return c.MustGet(S3_CONTEXT_KEY_WALLET).(*models.Wallet)
+}
+
+// handleS3 dispatches the request by the method, the path /bucket/key, and the subresource in the query
+func handleS3(c *gin.Context) {
+	query := c.Request.URL.Query()
+	for key := range query {
+		if !s3SubresourcesSupported[key] && !strings.HasPrefix(key, "X-Amz-") && !strings.HasPrefix(key, "response-") {
+			s3ErrorResponse(c, fmt.Errorf("%w, subresource:%s", errS3NotImplemented, key))
+			return
+		}
+	}
+
+	bucketName, objectKey := parseS3Path(c.Request.URL.Path)
+	_, hasUploads := query["uploads"]
+	_, hasUploadId := query["uploadId"]
+	_, hasLocation := query["location"]
+	method := c.Request.Method
+
+	switch {
+	case bucketName == "" && method == http.MethodGet:
+		ListS3Buckets(c)
+	case bucketName == "":
+		s3ErrorResponse(c, errS3MethodNotAllowed)
+	case objectKey == "" && method == http.MethodPut:
+		CreateS3Bucket(c, bucketName)
+	case objectKey == "" && method == http.MethodDelete:
+		DeleteS3Bucket(c, bucketName)
+	case objectKey == "" && method == http.MethodHead:
+		HeadS3Bucket(c, bucketName)
+	case objectKey == "" && method == http.MethodGet && hasLocation:
+		GetS3BucketLocation(c, bucketName)
+	case objectKey == "" && method == http.MethodGet && hasUploads:
+		s3ErrorResponse(c, fmt.Errorf("%w, listing multipart uploads", errS3NotImplemented))
+	case objectKey == "" && method == http.MethodGet:
+		ListS3Objects(c, bucketName)
+	case objectKey == "":
+		s3ErrorResponse(c, errS3MethodNotAllowed)
+	case method == http.MethodPut && c.GetHeader("X-Amz-Copy-Source") != "":
+		s3ErrorResponse(c, fmt.Errorf("%w, copying objects", errS3NotImplemented))
+	case method == http.MethodPut && hasUploadId:
+		UploadS3Part(c, bucketName, objectKey)
+	case method == http.MethodPut:
+		PutS3Object(c, bucketName, objectKey)
+	case method == http.MethodGet && hasUploadId:
+		s3ErrorResponse(c, fmt.Errorf("%w, listing parts", errS3NotImplemented))
+	case method == http.MethodGet:
+		GetS3Object(c, bucketName, objectKey)
+	case method == http.MethodHead:
+		HeadS3Object(c, bucketName, objectKey)
+	case method == http.MethodDelete && hasUploadId:
+		AbortS3MultipartUpload(c, bucketName, objectKey)
+	case method == http.MethodDelete:
+		DeleteS3Object(c, bucketName, objectKey)
+	case method == http.MethodPost && hasUploads:
+		CreateS3MultipartUpload(c, bucketName, objectKey)
+	case method == http.MethodPost && hasUploadId:
+		CompleteS3MultipartUpload(c, bucketName, objectKey)
+	default:
+		s3ErrorResponse(c, errS3MethodNotAllowed)
+	}
+}
+
+// parseS3Path splits the path /bucket/key, the key may contain any slashes
+func parseS3Path(path string) (string, string) {
+	bucketKey := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(bucketKey) < 2 {
+		return bucketKey[0], ""
+	}
+
+	return bucketKey[0], bucketKey[1]
+}
+
+func formatS3Time(utcSecond int64) string {
+	return time.Unix(utcSecond, 0).UTC().Format(S3_TIME_FORMAT)
+}
+
+func ListS3Buckets(c *gin.Context) {
+	wallet := getS3Wallet(c)
+	buckets, err := service.ListBuckets(wallet)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	result := &listAllMyBucketsResult{
+		Xmlns: S3_XML_NAMESPACE,
+		Owner: s3Owner{
+			ID:          wallet.Address,
+			DisplayName: wallet.Address,
+		},
+	}
+
+	for _, bucket := range buckets {
+		result.Buckets = append(result.Buckets, &s3Bucket{
+			Name:         bucket.Name,
+			CreationDate: formatS3Time(bucket.CreateAt),
+		})
+	}
+
+	s3XmlResponse(c, http.StatusOK, result)
+}
+
+func CreateS3Bucket(c *gin.Context, bucketName string) {
+	err := service.CreateBucket(getS3Wallet(c), bucketName)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Location", "/"+bucketName)
+	c.Status(http.StatusOK)
+}
+
+func DeleteS3Bucket(c *gin.Context, bucketName string) {
+	err := service.DeleteBucket(getS3Wallet(c), bucketName)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func HeadS3Bucket(c *gin.Context, bucketName string) {
+	_, err := service.GetBucket(getS3Wallet(c), bucketName)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	c.Header("x-amz-bucket-region", config.GetConfig().S3Gateway.Region)
+	c.Status(http.StatusOK)
+}
+
+func GetS3BucketLocation(c *gin.Context, bucketName string) {
+	_, err := service.GetBucket(getS3Wallet(c), bucketName)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	result := &locationConstraint{
+		Xmlns: S3_XML_NAMESPACE,
+	}
+
+	// us-east-1 is responded as empty like s3
+	if config.GetConfig().S3Gateway.Region != constants.S3_REGION_DEFAULT {
+		result.Region = config.GetConfig().S3Gateway.Region
+	}
+
+	s3XmlResponse(c, http.StatusOK, result)
+}
+
+// ListS3Objects serves both ListObjectsV2 with list-type=2 and ListObjects, the continuation token of v2 is
+// the base64 of the marker
+func ListS3Objects(c *gin.Context, bucketName string) {
+	query := c.Request.URL.Query()
+	isV2 := query.Get("list-type") == "2"
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		s3ErrorResponse(c, fmt.Errorf("%w, encoding-type:%s", errS3InvalidArgument, encodingType))
+		return
+	}
+
+	maxKeys := constants.S3_LIST_MAX_KEYS_DEFAULT
+	maxKeysStr := query.Get("max-keys")
+	if maxKeysStr != "" {
+		var err error
+		maxKeys, err = strconv.Atoi(maxKeysStr)
+		if err != nil || maxKeys < 0 {
+			s3ErrorResponse(c, fmt.Errorf("%w, max-keys:%s", errS3InvalidArgument, maxKeysStr))
+			return
+		}
+		if maxKeys > constants.S3_LIST_MAX_KEYS_DEFAULT {
+			maxKeys = constants.S3_LIST_MAX_KEYS_DEFAULT
+		}
+	}
+
+	result := &listBucketResult{
+		Xmlns:        S3_XML_NAMESPACE,
+		Name:         bucketName,
+		MaxKeys:      maxKeys,
+		EncodingType: encodingType,
+	}
+
+	marker := query.Get("marker")
+	if isV2 {
+		marker = query.Get("start-after")
+		result.StartAfter = encodeS3Key(marker, encodingType)
+		continuationToken := query.Get("continuation-token")
+		if continuationToken != "" {
+			markerBytes, err := base64.URLEncoding.DecodeString(continuationToken)
+			if err != nil {
+				s3ErrorResponse(c, fmt.Errorf("%w, continuation-token:%s", errS3InvalidArgument, continuationToken))
+				return
+			}
+			marker = string(markerBytes)
+			result.ContinuationToken = continuationToken
+		}
+	} else {
+		encodedMarker := encodeS3Key(marker, encodingType)
+		result.Marker = &encodedMarker
+	}
+
+	objectList, err := service.ListObjects(getS3Wallet(c), bucketName, prefix, delimiter, marker, maxKeys)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	result.Prefix = encodeS3Key(prefix, encodingType)
+	result.Delimiter = encodeS3Key(delimiter, encodingType)
+	result.IsTruncated = objectList.IsTruncated
+	for _, bucketObject := range objectList.Objects {
+		result.Contents = append(result.Contents, &s3Content{
+			Key:          encodeS3Key(bucketObject.ObjectKey, encodingType),
+			LastModified: formatS3Time(bucketObject.UpdateAt),
+			ETag:         `"` + bucketObject.Etag + `"`,
+			Size:         bucketObject.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+
+	for _, commonPrefix := range objectList.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, &s3CommonPrefix{
+			Prefix: encodeS3Key(commonPrefix, encodingType),
+		})
+	}
+
+	if isV2 {
+		keyCount := len(result.Contents) + len(result.CommonPrefixes)
+		result.KeyCount = &keyCount
+		if objectList.IsTruncated {
+			result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(objectList.NextMarker))
+		}
+	} else if objectList.IsTruncated {
+		result.NextMarker = encodeS3Key(objectList.NextMarker, encodingType)
+	}
+
+	s3XmlResponse(c, http.StatusOK, result)
+}
+
+// encodeS3Key encodes the key for encoding-type=url, as the clients decode it
+func encodeS3Key(key, encodingType string) string {
+	if encodingType != "url" {
+		return key
+	}
+
+	return url.QueryEscape(key)
+}
+
+// getS3Content returns the body, checked against the header Content-MD5 if given
+func getS3Content(c *gin.Context) (io.Reader, error) {
+	contentMd5Str := c.GetHeader("Content-MD5")
+	if contentMd5Str == "" {
+		return c.Request.Body, nil
+	}
+
+	contentMd5, err := base64.StdEncoding.DecodeString(contentMd5Str)
+	if err != nil || len(contentMd5) != md5.Size {
+		return nil, fmt.Errorf("%w, content-md5:%s", errS3InvalidArgument, contentMd5Str)
+	}
+
+	content := &digestCheckReader{
+		body:        c.Request.Body,
+		hash:        md5.New(),
+		expected:    contentMd5,
+		errMismatch: errS3BadDigest,
+	}
+
+	return content, nil
+}
+
+func getS3ContentType(c *gin.Context) string {
+	contentType := c.GetHeader("Content-Type")
+	if contentType == "" {
+		contentType = constants.S3_CONTENT_TYPE_DEFAULT
+	}
+
+	return contentType
+}
+
+func PutS3Object(c *gin.Context, bucketName, objectKey string) {
+	content, err := getS3Content(c)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	bucketObject, err := service.PutObject(getS3Wallet(c), bucketName, objectKey, getS3ContentType(c), content)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", `"`+bucketObject.Etag+`"`)
+	c.Status(http.StatusOK)
+}
+
+// setS3ObjectHeaders sets the headers of the object, the status of its source file upload and deals as user metadata
+func setS3ObjectHeaders(c *gin.Context, s3Object *service.S3Object) {
+	c.Header("ETag", `"`+s3Object.Etag+`"`)
+	c.Header("Last-Modified", time.Unix(s3Object.UpdateAt, 0).UTC().Format(http.TimeFormat))
+	for key, value := range s3Object.Metadata {
+		c.Header("x-amz-meta-"+key, value)
+	}
+}
+
+func HeadS3Object(c *gin.Context, bucketName, objectKey string) {
+	s3Object, err := service.HeadObject(getS3Wallet(c), bucketName, objectKey)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	setS3ObjectHeaders(c, s3Object)
+	c.Header("Content-Type", s3Object.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(s3Object.Size, 10))
+	c.Status(http.StatusOK)
+}
+
+func GetS3Object(c *gin.Context, bucketName, objectKey string) {
+	s3Object, content, err := service.GetObject(getS3Wallet(c), bucketName, objectKey)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+	defer content.Close()
+
+	setS3ObjectHeaders(c, s3Object)
+	c.DataFromReader(http.StatusOK, s3Object.Size, s3Object.ContentType, content, nil)
+}
+
+func DeleteS3Object(c *gin.Context, bucketName, objectKey string) {
+	err := service.DeleteObject(getS3Wallet(c), bucketName, objectKey)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func CreateS3MultipartUpload(c *gin.Context, bucketName, objectKey string) {
+	uploadId, err := service.CreateMultipartUpload(getS3Wallet(c), bucketName, objectKey, getS3ContentType(c))
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	s3XmlResponse(c, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    S3_XML_NAMESPACE,
+		Bucket:   bucketName,
+		Key:      objectKey,
+		UploadId: uploadId,
+	})
+}
+
+func UploadS3Part(c *gin.Context, bucketName, objectKey string) {
+	partNumberStr := c.Query("partNumber")
+	partNumber, err := strconv.Atoi(partNumberStr)
+	if err != nil || partNumber < 1 || partNumber > constants.S3_MULTIPART_PART_NUMBER_MAX {
+		s3ErrorResponse(c, fmt.Errorf("%w, partNumber:%s", errS3InvalidArgument, partNumberStr))
+		return
+	}
+
+	content, err := getS3Content(c)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	etag, err := service.UploadPart(getS3Wallet(c), bucketName, objectKey, c.Query("uploadId"), partNumber, content)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	c.Header("ETag", `"`+etag+`"`)
+	c.Status(http.StatusOK)
+}
+
+func CompleteS3MultipartUpload(c *gin.Context, bucketName, objectKey string) {
+	var request completeMultipartUpload
+	err := xml.NewDecoder(c.Request.Body).Decode(&request)
+	if err != nil {
+		s3ErrorResponse(c, fmt.Errorf("%w, %s", errS3MalformedXML, err.Error()))
+		return
+	}
+
+	var completedParts []*service.CompletedPart
+	for _, part := range request.Parts {
+		completedParts = append(completedParts, &service.CompletedPart{
+			PartNumber: part.PartNumber,
+			Etag:       part.ETag,
+		})
+	}
+
+	bucketObject, err := service.CompleteMultipartUpload(getS3Wallet(c), bucketName, objectKey, c.Query("uploadId"), completedParts)
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	s3XmlResponse(c, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    S3_XML_NAMESPACE,
+		Location: "/" + bucketName + "/" + objectKey,
+		Bucket:   bucketName,
+		Key:      objectKey,
+		ETag:     `"` + bucketObject.Etag + `"`,
+	})
+}
+
+func AbortS3MultipartUpload(c *gin.Context, bucketName, objectKey string) {
+	err := service.AbortMultipartUpload(getS3Wallet(c), bucketName, objectKey, c.Query("uploadId"))
+	if err != nil {
+		s3ErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,451 @@
+package routers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// the signature version 4 of aws, https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+const (
+	SIGV4_ALGORITHM                  = "AWS4-HMAC-SHA256"
+	SIGV4_CHUNK_ALGORITHM            = "AWS4-HMAC-SHA256-PAYLOAD"
+	SIGV4_TIME_FORMAT                = "20060102T150405Z"
+	SIGV4_DATE_FORMAT                = "20060102"
+	SIGV4_UNSIGNED_PAYLOAD           = "UNSIGNED-PAYLOAD"
+	SIGV4_STREAMING_PAYLOAD          = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	SIGV4_STREAMING_UNSIGNED_TRAILER = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+var (
+	errS3MissingSecurityHeader    = errors.New("your request is missing a required header")
+	errS3AuthorizationMalformed   = errors.New("the authorization header or query parameters are malformed")
+	errS3InvalidAccessKeyId       = errors.New("the access key id you provided does not exist in our records")
+	errS3SignatureDoesNotMatch    = errors.New("the request signature we calculated does not match the signature you provided")
+	errS3RequestTimeTooSkewed     = errors.New("the difference between the request time and the server's time is too large")
+	errS3ExpiredPresignedRequest  = errors.New("request has expired")
+	errS3ContentSha256Mismatch    = errors.New("the provided x-amz-content-sha256 header does not match what was computed")
+	errS3IncompleteBody           = errors.New("you did not provide the number of bytes specified by the content-length http header")
+	errS3NotImplemented           = errors.New("a header or query you provided implies functionality that is not implemented")
+	sigV4CredentialRegexp         = regexp.MustCompile(`^([^/]+)/(\d{8})/([^/]+)/s3/aws4_request$`)
+	sigV4AuthorizationFieldRegexp = regexp.MustCompile(`(Credential|SignedHeaders|Signature)=([^,\s]+)`)
+	sigV4SpacesRegexp             = regexp.MustCompile(`\s+`)
+)
+
+type sigV4Auth struct {
+	accessKey     string
+	date          string
+	region        string
+	signedHeaders []string
+	signature     string
+	requestTime   time.Time
+	expireSecond  int64 // for presigned urls only
+	payloadHash   string
+	presigned     bool
+}
+
+func (auth *sigV4Auth) getScope() string {
+	return auth.date + "/" + auth.region + "/s3/aws4_request"
+}
+
+func parseSigV4Credential(auth *sigV4Auth, credential string) error {
+	matches := sigV4CredentialRegexp.FindStringSubmatch(credential)
+	if matches == nil {
+		return fmt.Errorf("%w, credential:%s", errS3AuthorizationMalformed, credential)
+	}
+
+	auth.accessKey = matches[1]
+	auth.date = matches[2]
+	auth.region = matches[3]
+	return nil
+}
+
+// parseSigV4Header parses Authorization: AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=...
+func parseSigV4Header(request *http.Request) (*sigV4Auth, error) {
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, SIGV4_ALGORITHM+" ") {
+		return nil, fmt.Errorf("%w, only %s supported", errS3AuthorizationMalformed, SIGV4_ALGORITHM)
+	}
+
+	fields := map[string]string{}
+	for _, match := range sigV4AuthorizationFieldRegexp.FindAllStringSubmatch(authorization, -1) {
+		fields[match[1]] = match[2]
+	}
+
+	auth := &sigV4Auth{
+		signedHeaders: strings.Split(fields["SignedHeaders"], ";"),
+		signature:     fields["Signature"],
+		payloadHash:   request.Header.Get("X-Amz-Content-Sha256"),
+	}
+
+	err := parseSigV4Credential(auth, fields["Credential"])
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.signature == "" || fields["SignedHeaders"] == "" {
+		return nil, fmt.Errorf("%w, signed headers or signature missing", errS3AuthorizationMalformed)
+	}
+
+	if auth.payloadHash == "" {
+		return nil, fmt.Errorf("%w, x-amz-content-sha256 missing", errS3MissingSecurityHeader)
+	}
+
+	amzDate := request.Header.Get("X-Amz-Date")
+	if amzDate != "" {
+		auth.requestTime, err = time.Parse(SIGV4_TIME_FORMAT, amzDate)
+	} else {
+		auth.requestTime, err = http.ParseTime(request.Header.Get("Date"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w, x-amz-date or date missing or invalid", errS3MissingSecurityHeader)
+	}
+
+	return auth, nil
+}
+
+// parseSigV4Query parses the query parameters X-Amz-* of a presigned url
+func parseSigV4Query(request *http.Request) (*sigV4Auth, error) {
+	query := request.URL.Query()
+	if query.Get("X-Amz-Algorithm") != SIGV4_ALGORITHM {
+		return nil, fmt.Errorf("%w, only %s supported", errS3AuthorizationMalformed, SIGV4_ALGORITHM)
+	}
+
+	auth := &sigV4Auth{
+		signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     query.Get("X-Amz-Signature"),
+		payloadHash:   SIGV4_UNSIGNED_PAYLOAD,
+		presigned:     true,
+	}
+
+	err := parseSigV4Credential(auth, query.Get("X-Amz-Credential"))
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.signature == "" {
+		return nil, fmt.Errorf("%w, signature missing", errS3AuthorizationMalformed)
+	}
+
+	auth.requestTime, err = time.Parse(SIGV4_TIME_FORMAT, query.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, fmt.Errorf("%w, x-amz-date invalid", errS3AuthorizationMalformed)
+	}
+
+	auth.expireSecond, err = strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || auth.expireSecond < 0 || auth.expireSecond > constants.S3_PRESIGNED_URL_EXPIRE_SECOND_MAX {
+		return nil, fmt.Errorf("%w, x-amz-expires invalid", errS3AuthorizationMalformed)
+	}
+
+	return auth, nil
+}
+
+// awsUriEncode encodes all the bytes except the unreserved characters, and the slashes if not encodeSlash
+func awsUriEncode(value string, encodeSlash bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+
+	return builder.String()
+}
+
+func getCanonicalHeaderValue(request *http.Request, header string) string {
+	var values []string
+	switch header {
+	case "host":
+		values = []string{request.Host}
+	case "content-length":
+		// moved out of the header by net/http
+		values = []string{strconv.FormatInt(request.ContentLength, 10)}
+	case "transfer-encoding":
+		values = append(values, request.TransferEncoding...)
+	default:
+		values = append(values, request.Header.Values(header)...)
+	}
+
+	for i := range values {
+		values[i] = sigV4SpacesRegexp.ReplaceAllString(strings.TrimSpace(values[i]), " ")
+	}
+
+	return strings.Join(values, ",")
+}
+
+func getCanonicalRequest(request *http.Request, auth *sigV4Auth) string {
+	canonicalUri := awsUriEncode(request.URL.Path, false)
+	if canonicalUri == "" {
+		canonicalUri = "/"
+	}
+
+	var queryParams []string
+	for key, values := range request.URL.Query() {
+		if auth.presigned && key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			queryParams = append(queryParams, awsUriEncode(key, true)+"="+awsUriEncode(value, true))
+		}
+	}
+	sort.Strings(queryParams)
+
+	var canonicalHeaders strings.Builder
+	for _, header := range auth.signedHeaders {
+		canonicalHeaders.WriteString(header + ":" + getCanonicalHeaderValue(request, header) + "\n")
+	}
+
+	return request.Method + "\n" +
+		canonicalUri + "\n" +
+		strings.Join(queryParams, "&") + "\n" +
+		canonicalHeaders.String() + "\n" +
+		strings.Join(auth.signedHeaders, ";") + "\n" +
+		auth.payloadHash
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func getSigningKey(secret, date, region string) []byte {
+	key := hmacSha256([]byte("AWS4"+secret), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	return hmacSha256(key, "aws4_request")
+}
+
+// authenticateSigV4 verifies the signature of the request with the secret of the access key, and replaces the body
+// with a reader verifying the payload, which fails at the end if the payload does not match the signed
+func authenticateSigV4(request *http.Request) (*models.Wallet, error) {
+	var auth *sigV4Auth
+	var err error
+	if request.Header.Get("Authorization") != "" {
+		auth, err = parseSigV4Header(request)
+	} else if request.URL.Query().Get("X-Amz-Algorithm") != "" {
+		auth, err = parseSigV4Query(request)
+	} else {
+		return nil, fmt.Errorf("%w, anonymous requests not allowed", service.ErrS3AccessDenied)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if auth.presigned {
+		if now.Before(auth.requestTime.Add(-constants.S3_REQUEST_TIME_SKEW_SECOND_MAX*time.Second)) ||
+			now.After(auth.requestTime.Add(time.Duration(auth.expireSecond)*time.Second)) {
+			return nil, errS3ExpiredPresignedRequest
+		}
+	} else if now.Sub(auth.requestTime) > constants.S3_REQUEST_TIME_SKEW_SECOND_MAX*time.Second ||
+		auth.requestTime.Sub(now) > constants.S3_REQUEST_TIME_SKEW_SECOND_MAX*time.Second {
+		return nil, errS3RequestTimeTooSkewed
+	}
+
+	if auth.requestTime.UTC().Format(SIGV4_DATE_FORMAT) != auth.date {
+		return nil, fmt.Errorf("%w, date of the credential not matching the request time", errS3AuthorizationMalformed)
+	}
+
+	wallet, secret, err := service.GetAccessKeyWallet(auth.accessKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if wallet == nil {
+		return nil, fmt.Errorf("%w, access key:%s", errS3InvalidAccessKeyId, auth.accessKey)
+	}
+
+	err = verifySigV4(request, auth, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// verifySigV4 verifies the signature of the request parsed to auth with the secret, and replaces the body with a reader
+// verifying the payload
+func verifySigV4(request *http.Request, auth *sigV4Auth, secret string) error {
+	signingKey := getSigningKey(secret, auth.date, auth.region)
+	amzDate := auth.requestTime.UTC().Format(SIGV4_TIME_FORMAT)
+	canonicalRequest := getCanonicalRequest(request, auth)
+	stringToSign := SIGV4_ALGORITHM + "\n" + amzDate + "\n" + auth.getScope() + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+	if !hmac.Equal([]byte(signature), []byte(auth.signature)) {
+		return errS3SignatureDoesNotMatch
+	}
+
+	switch auth.payloadHash {
+	case SIGV4_UNSIGNED_PAYLOAD:
+	case SIGV4_STREAMING_PAYLOAD, SIGV4_STREAMING_UNSIGNED_TRAILER:
+		request.Body = &awsChunkedReader{
+			body:          request.Body,
+			reader:        bufio.NewReader(request.Body),
+			signed:        auth.payloadHash == SIGV4_STREAMING_PAYLOAD,
+			signingKey:    signingKey,
+			amzDate:       amzDate,
+			scope:         auth.getScope(),
+			prevSignature: auth.signature,
+		}
+	default:
+		payloadHash, err := hex.DecodeString(auth.payloadHash)
+		if err != nil || len(payloadHash) != sha256.Size {
+			return fmt.Errorf("%w, x-amz-content-sha256:%s", errS3NotImplemented, auth.payloadHash)
+		}
+
+		request.Body = &digestCheckReader{
+			body:        request.Body,
+			hash:        sha256.New(),
+			expected:    payloadHash,
+			errMismatch: errS3ContentSha256Mismatch,
+		}
+	}
+
+	return nil
+}
+
+// digestCheckReader returns the mismatch error instead of io.EOF if the content read does not match the digest expected
+type digestCheckReader struct {
+	body        io.ReadCloser
+	hash        hash.Hash
+	expected    []byte
+	errMismatch error
+}
+
+func (r *digestCheckReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(r.hash.Sum(nil), r.expected) {
+		return n, r.errMismatch
+	}
+
+	return n, err
+}
+
+func (r *digestCheckReader) Close() error {
+	return r.body.Close()
+}
+
+// awsChunkedReader decodes the aws-chunked content, each chunk is hex(size);chunk-signature=signature\r\n data \r\n,
+// the signature chains the signature of the chunk before, the last chunk has size 0 and may be followed by trailers,
+// a chunk is returned only after its signature verified
+type awsChunkedReader struct {
+	body          io.ReadCloser
+	reader        *bufio.Reader
+	signed        bool
+	signingKey    []byte
+	amzDate       string
+	scope         string
+	prevSignature string
+	chunk         []byte
+	err           error
+}
+
+func (r *awsChunkedReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readChunk()
+	}
+
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *awsChunkedReader) Close() error {
+	return r.body.Close()
+}
+
+func (r *awsChunkedReader) readLine() (string, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("%w, %s", errS3IncompleteBody, err.Error())
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (r *awsChunkedReader) readChunk() error {
+	header, err := r.readLine()
+	if err != nil {
+		return err
+	}
+
+	sizeStr := header
+	signature := ""
+	if index := strings.Index(header, ";"); index >= 0 {
+		sizeStr = header[:index]
+		signature = strings.TrimPrefix(header[index+1:], "chunk-signature=")
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 16, 64)
+	if err != nil || size < 0 || size > constants.S3_AWS_CHUNK_SIZE_MAX {
+		return fmt.Errorf("%w, chunk header:%s", errS3IncompleteBody, header)
+	}
+
+	chunk := make([]byte, size)
+	_, err = io.ReadFull(r.reader, chunk)
+	if err != nil {
+		return fmt.Errorf("%w, %s", errS3IncompleteBody, err.Error())
+	}
+
+	if r.signed {
+		stringToSign := SIGV4_CHUNK_ALGORITHM + "\n" + r.amzDate + "\n" + r.scope + "\n" + r.prevSignature + "\n" +
+			sha256Hex(nil) + "\n" + sha256Hex(chunk)
+		expected := hex.EncodeToString(hmacSha256(r.signingKey, stringToSign))
+		if !hmac.Equal([]byte(expected), []byte(signature)) {
+			return errS3SignatureDoesNotMatch
+		}
+		r.prevSignature = signature
+	}
+
+	if size == 0 {
+		// the trailers, such as the checksums, are not verified
+		for {
+			line, err := r.readLine()
+			if err != nil || line == "" {
+				return io.EOF
+			}
+		}
+	}
+
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return fmt.Errorf("%w, chunk not ended with crlf", errS3IncompleteBody)
+	}
+
+	r.chunk = chunk
+	return nil
+}
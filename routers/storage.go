@@ -1,17 +1,26 @@
 package routers
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"multi-chain-storage/common"
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/common/errorinfo"
 	"multi-chain-storage/common/utils"
 	"multi-chain-storage/models"
 	"multi-chain-storage/service"
+	"multi-chain-storage/service/denylist"
+	"multi-chain-storage/service/encryption"
+	"multi-chain-storage/service/plan"
+	"multi-chain-storage/service/scan"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/gin-gonic/gin"
@@ -21,11 +30,20 @@ func Storage(router *gin.RouterGroup) {
 	router.POST("/ipfs/upload", UploadFile)
 	router.GET("/tasks/deals", GetDeals)
 	router.GET("/tasks/deals/download", DownloadDeals)
+	router.GET("/search", SearchSourceFileUploads)
 	router.GET("/source_file_upload/:source_file_upload_id", GetSourceFileUpload)
+	router.GET("/source_file_upload/:source_file_upload_id/tags", GetSourceFileUploadTags)
+	router.POST("/source_file_upload/:source_file_upload_id/tags", SaveSourceFileUploadTags)
+	router.POST("/source_file_upload/:source_file_upload_id/tags/remove", RemoveSourceFileUploadTags)
 	router.GET("/deal/detail/:deal_id", GetDealFromFlink)
 	router.GET("/deal/log/:offline_deal_id", GetDealLogs)
 	router.POST("/mint/info", RecordMintInfo)
 	router.POST("/unpin_source_file/:source_file_upload_id", UnpinSourceFile)
+	router.POST("/undo_unpin_source_file/:source_file_upload_id", UndoUnpinSourceFile)
+	router.GET("/retrieve/:source_file_upload_id", RetrieveSourceFile)
+	router.GET("/renewals", GetRenewals)
+	router.POST("/renewal/pay", PayRenewal)
+	router.POST("/abuse_report", CreateAbuseReport)
 }
 
 func UploadFile(c *gin.Context) {
@@ -80,8 +98,79 @@ func UploadFile(c *gin.Context) {
 		fileType = 0
 	}
 
-	uploadResult, err := service.SaveFile(c, file, duration, fileType, walletAddress)
+	organizationId, err := getOrganizationId(c.PostForm("organization_id"))
 	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if !authenticateOrganizationWallet(c, walletAddress, organizationId) {
+		return
+	}
+
+	encryptionType := strings.Trim(c.PostForm("encryption"), " ")
+	walletPublicKey := strings.Trim(c.PostForm("encryption_public_key"), " ")
+	if encryptionType != "" && encryptionType != constants.ENCRYPTION_TYPE_WALLET && encryptionType != constants.ENCRYPTION_TYPE_KMS {
+		err := fmt.Errorf("encryption must be %s or %s", constants.ENCRYPTION_TYPE_WALLET, constants.ENCRYPTION_TYPE_KMS)
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if encryptionType == constants.ENCRYPTION_TYPE_WALLET && walletPublicKey == "" {
+		err := fmt.Errorf("encryption_public_key is required for encryption %s", constants.ENCRYPTION_TYPE_WALLET)
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	var tags map[string]string
+	tagsStr := strings.Trim(c.PostForm("tags"), " ")
+	if tagsStr != "" {
+		err := json.Unmarshal([]byte(tagsStr), &tags)
+		if err != nil {
+			err := fmt.Errorf("tags must be a json object of strings")
+			logs.GetLogger().Error(err)
+			c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+	}
+
+	bucketName := strings.Trim(c.PostForm("bucket_name"), " ")
+	objectKey := c.PostForm("object_key")
+
+	uploadResult, err := service.SaveFile(c, file, duration, fileType, walletAddress, organizationId, encryptionType, walletPublicKey, bucketName, objectKey, tags)
+	if err != nil {
+		if errors.Is(err, service.ErrOrganizationNotFound) || errors.Is(err, service.ErrOrganizationForbidden) {
+			organizationError(c, err)
+			return
+		}
+		if isBucketError(err) {
+			bucketError(c, err, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrWalletBlocked) || errors.Is(err, denylist.ErrContentDenied) {
+			c.JSON(http.StatusForbidden, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		if errors.Is(err, plan.ErrPlanLimitExceeded) {
+			c.JSON(http.StatusForbidden, common.CreateErrorResponse(errorinfo.ERROR_PLAN_LIMIT_EXCEEDED, err.Error()))
+			return
+		}
+		if errors.Is(err, plan.ErrRateLimited) {
+			c.JSON(http.StatusTooManyRequests, common.CreateErrorResponse(errorinfo.ERROR_RATE_LIMITED, err.Error()))
+			return
+		}
+		var rejectedErr *scan.RejectedError
+		if errors.As(err, &rejectedErr) {
+			httpStatus := http.StatusBadRequest
+			if rejectedErr.Verdict.ErrorCode == errorinfo.ERROR_UPLOAD_SCAN_FAILED {
+				httpStatus = http.StatusServiceUnavailable
+			}
+			c.JSON(httpStatus, common.CreateErrorResponse(rejectedErr.Verdict.ErrorCode, rejectedErr.Verdict.Reason))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
 		return
 	}
@@ -130,9 +219,33 @@ func GetDeals(c *gin.Context) {
 
 	isAscend := strings.EqualFold(strings.Trim(URL.Get("is_ascend"), " "), "y")
 
-	sourceFileUploads, totalRecordCount, freeUsage, err := service.GetSourceFileUploads(walletAddress, &status, &fileName, &orderBy, &is_minted, isAscend, &limit, &offset, nil, nil)
+	organizationId, err := getOrganizationId(URL.Get("organization_id"))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if !authenticateOrganizationWallet(c, walletAddress, organizationId) {
+		return
+	}
+
+	page := &models.Page{Limit: limit, PageNumber: offset, Cursor: strings.Trim(URL.Get("cursor"), " ")}
+	sourceFileUploads, totalRecordCount, nextCursor, usage, err := service.GetSourceFileUploads(walletAddress, organizationId, getUploadFilter(URL), &status, &fileName, &orderBy, &is_minted, isAscend, page, nil, nil)
 	if err != nil {
 		logs.GetLogger().Error(err)
+		if errors.Is(err, models.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		if errors.Is(err, service.ErrOrganizationNotFound) || errors.Is(err, service.ErrOrganizationForbidden) {
+			organizationError(c, err)
+			return
+		}
+		if isBucketError(err) {
+			bucketError(c, err, http.StatusInternalServerError)
+			return
+		}
 		c.AbortWithStatusJSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
 		return
 	}
@@ -140,8 +253,114 @@ func GetDeals(c *gin.Context) {
 	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
 		"source_file_upload":   sourceFileUploads,
 		"total_record_count":   *totalRecordCount,
-		"free_usage":           *freeUsage,
-		"free_quota_per_month": constants.FREE_SIZE_PER_WALLET_MONTH,
+		"next_cursor":          nextCursor,
+		"free_usage":           usage.FreeBytes,
+		"free_quota_per_month": usage.Plan.MonthlyFreeBytes,
+		"usage":                usage,
+	}))
+}
+
+// getUploadAt returns the time in the query by the name, nil if not given
+func getUploadAt(URL url.Values, name string) (*int64, error) {
+	uploadAtStr := strings.Trim(URL.Get(name), " ")
+	if uploadAtStr == "" {
+		return nil, nil
+	}
+
+	uploadAt, err := strconv.ParseInt(uploadAtStr, 10, 64)
+	if err != nil || uploadAt < 0 {
+		err := fmt.Errorf("%s must be a valid number >= 0", name)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &uploadAt, nil
+}
+
+// SearchSourceFileUploads searches the uploads by the words of their file names and tags, and by their payload cids,
+// wcids, tx hashes and deal ids, the most relevant first, narrowed by the filters of GetDeals, pin_status and the
+// upload time range
+func SearchSourceFileUploads(c *gin.Context) {
+	URL := c.Request.URL.Query()
+	walletAddress := strings.Trim(URL.Get("wallet_address"), " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	query := strings.Trim(URL.Get("q"), " ")
+	if query == "" || utf8.RuneCountInString(query) > constants.SEARCH_QUERY_LEN_MAX {
+		err := fmt.Errorf("q must be 1 to %d characters", constants.SEARCH_QUERY_LEN_MAX)
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	pageNumber, err := strconv.Atoi(strings.Trim(URL.Get("page_number"), " "))
+	if err != nil || pageNumber <= 0 {
+		pageNumber = 1
+	}
+
+	pageSize, err := strconv.Atoi(strings.Trim(URL.Get("page_size"), " "))
+	if err != nil || pageSize <= 0 {
+		pageSize = constants.PAGE_SIZE_DEFAULT_VALUE
+	}
+
+	uploadAtStart, err := getUploadAt(URL, "upload_at_start")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	uploadAtEnd, err := getUploadAt(URL, "upload_at_end")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	organizationId, err := getOrganizationId(URL.Get("organization_id"))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if !authenticateOrganizationWallet(c, walletAddress, organizationId) {
+		return
+	}
+
+	status := strings.Trim(URL.Get("status"), " ")
+	pinStatus := strings.Trim(URL.Get("pin_status"), " ")
+	isMinted := strings.Trim(URL.Get("is_minted"), " ")
+	page := &models.Page{Limit: pageSize, PageNumber: pageNumber, Cursor: strings.Trim(URL.Get("cursor"), " ")}
+
+	sourceFileUploads, totalRecordCount, nextCursor, err := service.SearchSourceFileUploads(walletAddress, organizationId, getUploadFilter(URL), query, &status, &pinStatus, &isMinted, page, uploadAtStart, uploadAtEnd)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, models.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		if errors.Is(err, service.ErrOrganizationNotFound) || errors.Is(err, service.ErrOrganizationForbidden) {
+			organizationError(c, err)
+			return
+		}
+		if isBucketError(err) {
+			bucketError(c, err, http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"source_file_upload": sourceFileUploads,
+		"total_record_count": *totalRecordCount,
+		"next_cursor":        nextCursor,
 	}))
 }
 
@@ -209,9 +428,28 @@ func DownloadDeals(c *gin.Context) {
 		return
 	}
 
-	sourceFileUploads, err := service.DownloadSourceFileUploads(location, walletAddress, &uploadAtStart, &uploadAtEnd)
+	organizationId, err := getOrganizationId(URL.Get("organization_id"))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	if !authenticateOrganizationWallet(c, walletAddress, organizationId) {
+		return
+	}
+
+	sourceFileUploads, err := service.DownloadSourceFileUploads(location, walletAddress, organizationId, getUploadFilter(URL), &uploadAtStart, &uploadAtEnd)
 	if err != nil {
 		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrOrganizationNotFound) || errors.Is(err, service.ErrOrganizationForbidden) {
+			organizationError(c, err)
+			return
+		}
+		if isBucketError(err) {
+			bucketError(c, err, http.StatusInternalServerError)
+			return
+		}
 		c.AbortWithStatusJSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
 		return
 	}
@@ -315,10 +553,26 @@ func GetDealFromFlink(c *gin.Context) {
 		return
 	}
 
+	replicaHealth, err := service.GetReplicaHealth(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	retrievalChecks, err := service.GetDealRetrievalChecks(dealId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
 	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
 		"source_file_upload_deal": sourceFileUploadDeal,
 		"dao_threshold":           systemParam.DaoThreshold,
 		"dao_signature":           daoSignatures,
+		"replica_health":          replicaHealth,
+		"retrieval_check":         retrievalChecks,
 	}))
 }
 
@@ -447,3 +701,386 @@ func UnpinSourceFile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
 }
+
+func UndoUnpinSourceFile(c *gin.Context) {
+	logs.GetLogger().Info("ip:", c.ClientIP(), ",port:", c.Request.URL.Port())
+	sourceFileUploadIdStr := strings.Trim(c.Params.ByName("source_file_upload_id"), " ")
+	if sourceFileUploadIdStr == "" {
+		err := fmt.Errorf("source_file_upload_id is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	sourceFileUploadId, err := strconv.ParseInt(sourceFileUploadIdStr, 10, 64)
+	if err != nil {
+		err := fmt.Errorf("source_file_upload_id must be a valid number")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_WRONG_TYPE, err.Error()))
+		return
+	}
+
+	if sourceFileUploadId <= 0 {
+		err := fmt.Errorf("source_file_upload_id must be greater than 0")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	err = service.UndoUnpinSourceFile(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err.Error())
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+// RetrieveSourceFile downloads the file of the upload, a single range of the Range header is supported,
+// X-Retrieved-From tells where the content is read from
+func RetrieveSourceFile(c *gin.Context) {
+	logs.GetLogger().Info("ip:", c.ClientIP(), ",port:", c.Request.URL.Port())
+	sourceFileUploadIdStr := strings.Trim(c.Params.ByName("source_file_upload_id"), " ")
+	if sourceFileUploadIdStr == "" {
+		err := fmt.Errorf("source_file_upload_id is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	sourceFileUploadId, err := strconv.ParseInt(sourceFileUploadIdStr, 10, 64)
+	if err != nil {
+		err := fmt.Errorf("source_file_upload_id must be a valid number")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_WRONG_TYPE, err.Error()))
+		return
+	}
+
+	sourceFileContent, err := service.GetSourceFileContent(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrSourceFileUploadNotFound) {
+			c.JSON(http.StatusNotFound, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	// the retrievals are counted against the plan of the wallet of the upload, since the route needs no authentication
+	err = plan.AllowRequest(sourceFileContent.WalletId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, plan.ErrRateLimited) {
+			c.JSON(http.StatusTooManyRequests, common.CreateErrorResponse(errorinfo.ERROR_RATE_LIMITED, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	if sourceFileContent.IsEncrypted {
+		if !unlockSourceFileContent(c, sourceFileContent) {
+			return
+		}
+	}
+
+	offset, length, isPartial, err := parseByteRange(c.GetHeader("Range"), sourceFileContent.FileSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", sourceFileContent.FileSize))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return
+	}
+
+	content, retrievedFrom, err := service.RetrieveSourceFile(c.Request.Context(), sourceFileContent, offset, length)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, encryption.ErrNotAuthentic) {
+			c.JSON(http.StatusForbidden, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+	defer content.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(sourceFileContent.FileName))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	headers := map[string]string{
+		"Accept-Ranges":       "bytes",
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": sourceFileContent.FileName}),
+		"X-Retrieved-From":    retrievedFrom,
+	}
+
+	status := http.StatusOK
+	if isPartial {
+		status = http.StatusPartialContent
+		headers["Content-Range"] = fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, sourceFileContent.FileSize)
+	}
+
+	logs.GetLogger().Info("source file upload:", sourceFileUploadId, " retrieved from ", retrievedFrom, ", offset:", offset, ", length:", length)
+	c.DataFromReader(status, length, contentType, content, headers)
+}
+
+// unlockSourceFileContent requires the access token of the wallet owning the encrypted content as the bearer token, and
+// X-Data-Key, the data key unwrapped by the wallet, unless the data key is wrapped by the kms
+func unlockSourceFileContent(c *gin.Context, sourceFileContent *service.SourceFileContent) bool {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	wallet, err := service.AuthenticateAccessKey(token)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return false
+	}
+
+	if wallet == nil {
+		err := fmt.Errorf("access token of the wallet is required for encrypted content, ip:%s", c.ClientIP())
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusUnauthorized, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return false
+	}
+
+	err = service.UnlockSourceFileContent(sourceFileContent, wallet, strings.Trim(c.GetHeader("X-Data-Key"), " "))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrSourceFileUploadForbidden) {
+			c.JSON(http.StatusForbidden, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return false
+		}
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return false
+	}
+
+	return true
+}
+
+// parseByteRange returns the offset and length of the range in the header, the whole content if no range or the
+// header is not a single byte range, it fails if the range is not satisfiable
+func parseByteRange(rangeHeader string, size int64) (int64, int64, bool, error) {
+	spec := strings.TrimSpace(rangeHeader)
+	if !strings.HasPrefix(spec, "bytes=") || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+
+	bounds := strings.SplitN(strings.TrimPrefix(spec, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return 0, size, false, nil
+	}
+
+	startStr := strings.TrimSpace(bounds[0])
+	endStr := strings.TrimSpace(bounds[1])
+	if startStr == "" {
+		suffixLength, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffixLength < 0 {
+			return 0, size, false, nil
+		}
+
+		if suffixLength == 0 || size == 0 {
+			err := fmt.Errorf("range:%s not satisfiable for size:%d", rangeHeader, size)
+			return 0, 0, false, err
+		}
+
+		if suffixLength > size {
+			suffixLength = size
+		}
+
+		return size - suffixLength, suffixLength, true, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, nil
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, size, false, nil
+		}
+
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		err := fmt.Errorf("range:%s not satisfiable for size:%d", rangeHeader, size)
+		return 0, 0, false, err
+	}
+
+	return start, end - start + 1, true, nil
+}
+
+type abuseReportParam struct {
+	PayloadCid         string  `json:"payload_cid"`
+	SourceFileUploadId *int64  `json:"source_file_upload_id"`
+	Reason             string  `json:"reason"`
+	ReporterContact    *string `json:"reporter_contact"`
+}
+
+// CreateAbuseReport reports the content of the payload cid or the source file upload, to be reviewed by the admin
+func CreateAbuseReport(c *gin.Context) {
+	var model abuseReportParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return
+	}
+
+	payloadCid := strings.Trim(model.PayloadCid, " ")
+	if payloadCid == "" && model.SourceFileUploadId == nil {
+		err := fmt.Errorf("payload_cid or source_file_upload_id is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	reason := strings.Trim(model.Reason, " ")
+	if reason == "" {
+		err := fmt.Errorf("reason is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	abuseReport, err := service.CreateAbuseReport(payloadCid, model.SourceFileUploadId, reason, model.ReporterContact, c.ClientIP())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if errors.Is(err, service.ErrSourceFileUploadNotFound) {
+			c.JSON(http.StatusNotFound, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, common.CreateErrorResponse(errorinfo.ERROR_INTERNAL, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"abuse_report_id": abuseReport.ID,
+		"status":          abuseReport.Status,
+	}))
+}
+
+// getSourceFileUploadIdParam parses source_file_upload_id in the path, false if invalid and responded already
+func getSourceFileUploadIdParam(c *gin.Context) (int64, bool) {
+	sourceFileUploadId, err := strconv.ParseInt(strings.Trim(c.Params.ByName("source_file_upload_id"), " "), 10, 64)
+	if err != nil || sourceFileUploadId <= 0 {
+		err := fmt.Errorf("source_file_upload_id must be a number greater than 0")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_INVALID_VALUE, err.Error()))
+		return 0, false
+	}
+
+	return sourceFileUploadId, true
+}
+
+func GetSourceFileUploadTags(c *gin.Context) {
+	sourceFileUploadId, ok := getSourceFileUploadIdParam(c)
+	if !ok {
+		return
+	}
+
+	walletAddress := strings.Trim(c.Request.URL.Query().Get("wallet_address"), " ")
+	if walletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return
+	}
+
+	if !authenticateSourceFileUploadWallet(c, walletAddress, sourceFileUploadId) {
+		return
+	}
+
+	tags, err := service.GetSourceFileUploadTags(walletAddress, sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		bucketError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(gin.H{
+		"tags": tags,
+	}))
+}
+
+type sourceFileUploadTagsParam struct {
+	WalletAddress string            `json:"wallet_address"`
+	Tags          map[string]string `json:"tags"`
+	TagKeys       []string          `json:"tag_keys"`
+}
+
+// bindSourceFileUploadTagsParam parses the body, the request must be authenticated as the wallet if the upload is owned
+// by an organization
+func bindSourceFileUploadTagsParam(c *gin.Context, sourceFileUploadId int64) (*sourceFileUploadTagsParam, bool) {
+	var model sourceFileUploadTagsParam
+	err := c.BindJSON(&model)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_PARSE_TO_STRUCT, err.Error()))
+		return nil, false
+	}
+
+	model.WalletAddress = strings.Trim(model.WalletAddress, " ")
+	if model.WalletAddress == "" {
+		err := fmt.Errorf("wallet_address is required")
+		logs.GetLogger().Error(err)
+		c.JSON(http.StatusBadRequest, common.CreateErrorResponse(errorinfo.ERROR_PARAM_NULL, err.Error()))
+		return nil, false
+	}
+
+	if !authenticateSourceFileUploadWallet(c, model.WalletAddress, sourceFileUploadId) {
+		return nil, false
+	}
+
+	return &model, true
+}
+
+// SaveSourceFileUploadTags adds the tags to the upload, replacing the values of the keys tagged already
+func SaveSourceFileUploadTags(c *gin.Context) {
+	sourceFileUploadId, ok := getSourceFileUploadIdParam(c)
+	if !ok {
+		return
+	}
+
+	model, ok := bindSourceFileUploadTagsParam(c, sourceFileUploadId)
+	if !ok {
+		return
+	}
+
+	err := service.SaveSourceFileUploadTags(model.WalletAddress, sourceFileUploadId, model.Tags)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		bucketError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
+
+func RemoveSourceFileUploadTags(c *gin.Context) {
+	sourceFileUploadId, ok := getSourceFileUploadIdParam(c)
+	if !ok {
+		return
+	}
+
+	model, ok := bindSourceFileUploadTagsParam(c, sourceFileUploadId)
+	if !ok {
+		return
+	}
+
+	err := service.RemoveSourceFileUploadTags(model.WalletAddress, sourceFileUploadId, model.TagKeys)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		bucketError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, common.CreateSuccessResponse(nil))
+}
@@ -0,0 +1,50 @@
+package routers
+
+import "testing"
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		rangeHeader string
+		size        int64
+		offset      int64
+		length      int64
+		partial     bool
+		failed      bool
+	}{
+		{name: "no range", rangeHeader: "", size: 100, offset: 0, length: 100},
+		{name: "first bytes", rangeHeader: "bytes=0-9", size: 100, offset: 0, length: 10, partial: true},
+		{name: "middle bytes", rangeHeader: "bytes=10-19", size: 100, offset: 10, length: 10, partial: true},
+		{name: "till the end", rangeHeader: "bytes=90-", size: 100, offset: 90, length: 10, partial: true},
+		{name: "end beyond size", rangeHeader: "bytes=90-200", size: 100, offset: 90, length: 10, partial: true},
+		{name: "last byte", rangeHeader: "bytes=99-99", size: 100, offset: 99, length: 1, partial: true},
+		{name: "suffix", rangeHeader: "bytes=-10", size: 100, offset: 90, length: 10, partial: true},
+		{name: "suffix beyond size", rangeHeader: "bytes=-200", size: 100, offset: 0, length: 100, partial: true},
+		{name: "spaces", rangeHeader: " bytes= 10 - 19 ", size: 100, offset: 10, length: 10, partial: true},
+		{name: "start beyond size", rangeHeader: "bytes=100-", size: 100, failed: true},
+		{name: "suffix empty", rangeHeader: "bytes=-0", size: 100, failed: true},
+		{name: "suffix of empty content", rangeHeader: "bytes=-10", size: 0, failed: true},
+		{name: "multiple ranges ignored", rangeHeader: "bytes=0-9,20-29", size: 100, offset: 0, length: 100},
+		{name: "other unit ignored", rangeHeader: "items=0-9", size: 100, offset: 0, length: 100},
+		{name: "end before start ignored", rangeHeader: "bytes=20-10", size: 100, offset: 0, length: 100},
+		{name: "not a number ignored", rangeHeader: "bytes=a-9", size: 100, offset: 0, length: 100},
+		{name: "no dash ignored", rangeHeader: "bytes=10", size: 100, offset: 0, length: 100},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			offset, length, partial, err := parseByteRange(test.rangeHeader, test.size)
+			if (err != nil) != test.failed {
+				t.Fatalf("error:%v, failure expected:%t", err, test.failed)
+			}
+
+			if test.failed {
+				return
+			}
+
+			if offset != test.offset || length != test.length || partial != test.partial {
+				t.Errorf("offset:%d, length:%d, partial:%t, want offset:%d, length:%d, partial:%t", offset, length, partial, test.offset, test.length, test.partial)
+			}
+		})
+	}
+}
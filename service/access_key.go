@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// ErrWalletUnauthorized is wrapped by the errors of the requests not authenticated as the wallet they act for, for errors.Is
+var ErrWalletUnauthorized = errors.New("access token of the wallet required")
+
+type AccessKey struct {
+	AccessKey string `json:"access_key"`
+	Secret    string `json:"secret"`
+	Token     string `json:"token"` // sent as the bearer token, access_key:secret
+}
+
+func generateRandomHex(byteCnt int) (string, error) {
+	bytes := make([]byte, byteCnt)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
+
+// CreateAccessKey creates an access key for the wallet, the secret is returned only here
+func CreateAccessKey(walletAddress string) (*AccessKey, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	accessKey, err := generateRandomHex(16)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	secret, err := generateRandomHex(32)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	_, err = models.CreateWalletAccessKey(wallet.ID, accessKey, secret)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	result := &AccessKey{
+		AccessKey: accessKey,
+		Secret:    secret,
+		Token:     accessKey + ":" + secret,
+	}
+
+	return result, nil
+}
+
+func RevokeAccessKey(accessKey string) error {
+	walletAccessKey, err := models.GetWalletAccessKeyByAccessKey(accessKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if walletAccessKey == nil {
+		err := fmt.Errorf("access key:%s not exists", accessKey)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.UpdateWalletAccessKeyStatus(accessKey, constants.WALLET_ACCESS_KEY_STATUS_REVOKED)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetAccessKeyWallet returns the wallet and the secret of the access key, or nil if the key is not active or the wallet
+// is blocked
+func GetAccessKeyWallet(accessKey string) (*models.Wallet, string, error) {
+	walletAccessKey, err := models.GetWalletAccessKeyByAccessKey(accessKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	if walletAccessKey == nil || walletAccessKey.Status != constants.WALLET_ACCESS_KEY_STATUS_ACTIVE {
+		return nil, "", nil
+	}
+
+	wallet, err := models.GetWalletById(walletAccessKey.WalletId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	if wallet == nil || wallet.IsBlocked {
+		return nil, "", nil
+	}
+
+	err = models.UpdateWalletAccessKeyLastUsed(walletAccessKey.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+
+	return wallet, walletAccessKey.Secret, nil
+}
+
+// AuthenticateAccessKey returns the wallet of the token access_key:secret, or nil if the token is not valid
+func AuthenticateAccessKey(token string) (*models.Wallet, error) {
+	accessKeySecret := strings.SplitN(token, ":", 2)
+	if len(accessKeySecret) != 2 {
+		return nil, nil
+	}
+
+	wallet, secret, err := GetAccessKeyWallet(accessKeySecret[0])
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if wallet == nil || subtle.ConstantTimeCompare([]byte(secret), []byte(accessKeySecret[1])) != 1 {
+		return nil, nil
+	}
+
+	return wallet, nil
+}
+
+// AuthenticateWallet returns ErrWalletUnauthorized unless the token is an access key of the wallet, the roles of the
+// wallet in the organizations are granted only to the requests authenticated so
+func AuthenticateWallet(walletAddress, token string) error {
+	wallet, err := AuthenticateAccessKey(token)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if wallet == nil || !strings.EqualFold(wallet.Address, strings.Trim(walletAddress, " ")) {
+		err := fmt.Errorf("%w, wallet:%s", ErrWalletUnauthorized, walletAddress)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
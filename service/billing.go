@@ -8,20 +8,31 @@ import (
 	"github.com/filswan/go-swan-lib/logs"
 )
 
-func GetTransactions(walletAddress, txHash, fileName, orderBy string, isAscend bool, limit, offset int) ([]*models.Billing, *int, error) {
+// GetTransactions returns the page of the payments by the wallet, or the payments for the uploads of the organization
+// if given, which requires the wallet to be its member, narrowed by the filter on their uploads if given, with the count
+// of all the payments listed and the cursor of the next page
+func GetTransactions(walletAddress string, organizationId *int64, uploadFilter *UploadFilter, txHash, fileName, orderBy string, isAscend bool, page *models.Page) ([]*models.Billing, *int, *string, error) {
 	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	billings, totalRecordCount, err := models.GetTransactions(wallet.ID, txHash, fileName, orderBy, isAscend, limit, offset)
+	if organizationId != nil {
+		_, err := checkOrganizationRole(wallet, *organizationId, constants.ORGANIZATION_ROLE_VIEWER)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, nil, nil, err
+		}
+	}
+
+	filter, err := getSourceFileUploadFilter(wallet, uploadFilter)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	return billings, totalRecordCount, nil
+	return models.GetTransactions(wallet.ID, organizationId, filter, txHash, fileName, orderBy, isAscend, page)
 }
 
 type SourceFileUploadInfoWcid struct {
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+var ErrBucketObjectExists = errors.New("the key exists in the bucket already")
+var ErrBucketOrganizationUpload = errors.New("uploads owned by an organization cannot be put in a bucket")
+
+// UploadFilter narrows the uploads listed to those with keys in the bucket of the wallet, and those tagged with the
+// key, and with the value if given, each ignored if empty
+type UploadFilter struct {
+	BucketName string
+	TagKey     string
+	TagValue   *string
+}
+
+// getSourceFileUploadFilter resolves the filter of the wallet, nil if nothing to filter by
+func getSourceFileUploadFilter(wallet *models.Wallet, uploadFilter *UploadFilter) (*models.SourceFileUploadFilter, error) {
+	if uploadFilter == nil || (uploadFilter.BucketName == "" && uploadFilter.TagKey == "") {
+		return nil, nil
+	}
+
+	filter := &models.SourceFileUploadFilter{}
+	if uploadFilter.BucketName != "" {
+		bucket, err := GetBucket(wallet, uploadFilter.BucketName)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		filter.BucketId = &bucket.ID
+	}
+
+	if uploadFilter.TagKey != "" {
+		filter.TagKey = &uploadFilter.TagKey
+		filter.TagValue = uploadFilter.TagValue
+	}
+
+	return filter, nil
+}
+
+// checkSourceFileUploadRole returns ErrSourceFileUploadForbidden unless the upload is owned by the wallet, or by an
+// organization the wallet has the role or a more privileged one in
+func checkSourceFileUploadRole(wallet *models.Wallet, sourceFileUpload *models.SourceFileUpload, role string) error {
+	if sourceFileUpload.OrganizationId != nil {
+		_, err := checkOrganizationRole(wallet, *sourceFileUpload.OrganizationId, role)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return fmt.Errorf("%w, id:%d", ErrSourceFileUploadForbidden, sourceFileUpload.Id)
+		}
+	} else if sourceFileUpload.WalletId != wallet.ID {
+		err := fmt.Errorf("%w, id:%d", ErrSourceFileUploadForbidden, sourceFileUpload.Id)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// getSourceFileUploadByRole returns the upload, checked to be owned by the wallet or by an organization the wallet has
+// the role in
+func getSourceFileUploadByRole(wallet *models.Wallet, sourceFileUploadId int64, role string) (*models.SourceFileUpload, error) {
+	sourceFileUpload, err := models.GetSourceFileUploadById(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if sourceFileUpload == nil {
+		err := fmt.Errorf("%w, id:%d", ErrSourceFileUploadNotFound, sourceFileUploadId)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = checkSourceFileUploadRole(wallet, sourceFileUpload, role)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFileUpload, nil
+}
+
+// getWalletNotBlocked returns the wallet, ErrWalletBlocked if it is blocked
+func getWalletNotBlocked(walletAddress string) (*models.Wallet, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if wallet.IsBlocked {
+		err := fmt.Errorf("%w, wallet:%s", ErrWalletBlocked, walletAddress)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+func GetWalletBuckets(walletAddress string) ([]*models.Bucket, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ListBuckets(wallet)
+}
+
+// CreateWalletBucket creates the bucket of the wallet, shared with the s3 gateway
+func CreateWalletBucket(walletAddress, bucketName string) error {
+	wallet, err := getWalletNotBlocked(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = CreateBucket(wallet, bucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("bucket:", bucketName, " created by wallet:", walletAddress)
+	return nil
+}
+
+// ListWalletObjects lists the objects in the bucket of the wallet like ListObjects, a delimiter of / lists the keys as
+// paths of folders
+func ListWalletObjects(walletAddress, bucketName, prefix, delimiter, startAfter string, maxKeys int) (*ObjectList, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if maxKeys <= 0 || maxKeys > constants.S3_LIST_MAX_KEYS_DEFAULT {
+		maxKeys = constants.S3_LIST_MAX_KEYS_DEFAULT
+	}
+
+	return ListObjects(wallet, bucketName, prefix, delimiter, startAfter, maxKeys)
+}
+
+// checkObjectKey returns an error if the key is not a valid s3 key
+func checkObjectKey(objectKey string) error {
+	if objectKey == "" || len(objectKey) > constants.S3_OBJECT_KEY_LEN_MAX || !utf8.ValidString(objectKey) {
+		err := fmt.Errorf("object key must be utf-8 of 1 to %d bytes", constants.S3_OBJECT_KEY_LEN_MAX)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// putBucketObject maps the key in the bucket to the source file upload, ErrBucketObjectExists if the key is taken,
+// keys are not replaced from the web as the upload replaced would be left without a key
+func putBucketObject(bucket *models.Bucket, objectKey string, sourceFileUpload *models.SourceFileUpload) (*models.BucketObject, error) {
+	if sourceFileUpload.OrganizationId != nil {
+		err := fmt.Errorf("%w, id:%d", ErrBucketOrganizationUpload, sourceFileUpload.Id)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	bucketObject, err := models.GetBucketObject(bucket.ID, objectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if bucketObject != nil {
+		err := fmt.Errorf("%w, bucket:%s, key:%s", ErrBucketObjectExists, bucket.Name, objectKey)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	sourceFile, err := models.GetSourceFileById(sourceFileUpload.SourceFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	contentType := constants.S3_CONTENT_TYPE_DEFAULT
+	if sourceFile.MimeType != nil && *sourceFile.MimeType != "" && sourceFileUpload.EncryptionScheme == nil {
+		contentType = *sourceFile.MimeType
+	}
+
+	// the md5 of the content is not known for the uploads from the web, the etag is opaque to s3 clients anyway
+	etag := sourceFile.PayloadCid
+	if sourceFileUpload.ContentSha256 != nil {
+		etag = *sourceFileUpload.ContentSha256
+	}
+
+	bucketObject = &models.BucketObject{
+		BucketId:           bucket.ID,
+		ObjectKey:          objectKey,
+		SourceFileUploadId: sourceFileUpload.Id,
+		ContentType:        contentType,
+		Etag:               etag,
+		Size:               sourceFile.FileSize,
+	}
+
+	err = models.CreateBucketObject(bucketObject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return bucketObject, nil
+}
+
+// PutWalletObject puts the upload of the wallet at the key in its bucket, the same upload can be put at several keys
+func PutWalletObject(walletAddress, bucketName, objectKey string, sourceFileUploadId int64) (*models.BucketObject, error) {
+	err := checkObjectKey(objectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	wallet, err := getWalletNotBlocked(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	sourceFileUpload, err := getSourceFileUploadByRole(wallet, sourceFileUploadId, constants.ORGANIZATION_ROLE_UPLOADER)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return putBucketObject(bucket, objectKey, sourceFileUpload)
+}
+
+// MoveWalletObject moves or renames the key in the bucket of the wallet to the new key in the new bucket of the
+// wallet, the same bucket if not given. A key ending with / is a folder, all the keys under it are moved under the new
+// key, which must be a folder with no keys under it. It returns the number of the objects moved
+func MoveWalletObject(walletAddress, bucketName, objectKey, newBucketName, newObjectKey string) (int64, error) {
+	err := checkObjectKey(objectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	err = checkObjectKey(newObjectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	isFolder := strings.HasSuffix(objectKey, constants.BUCKET_FOLDER_DELIMITER)
+	if isFolder != strings.HasSuffix(newObjectKey, constants.BUCKET_FOLDER_DELIMITER) {
+		err := fmt.Errorf("a folder ending with %s can only be moved to a folder", constants.BUCKET_FOLDER_DELIMITER)
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	wallet, err := getWalletNotBlocked(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	newBucket := bucket
+	if newBucketName != "" && newBucketName != bucketName {
+		newBucket, err = GetBucket(wallet, newBucketName)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+	}
+
+	if newBucket.ID == bucket.ID && newObjectKey == objectKey {
+		return 0, nil
+	}
+
+	if !isFolder {
+		bucketObject, err := getBucketObject(wallet, bucketName, objectKey)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+
+		bucketObjectExisting, err := models.GetBucketObject(newBucket.ID, newObjectKey)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+
+		if bucketObjectExisting != nil {
+			err := fmt.Errorf("%w, bucket:%s, key:%s", ErrBucketObjectExists, newBucket.Name, newObjectKey)
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+
+		err = models.MoveBucketObject(bucketObject.ID, newBucket.ID, newObjectKey)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+
+		logs.GetLogger().Info("key:", objectKey, " in bucket:", bucketName, " moved to key:", newObjectKey, " in bucket:", newBucket.Name)
+		return 1, nil
+	}
+
+	// the new folder must be empty, so no key moved collides with a key there
+	bucketObjectsExisting, err := models.GetBucketObjects(newBucket.ID, newObjectKey, "", 1)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	if len(bucketObjectsExisting) > 0 {
+		err := fmt.Errorf("%w, bucket:%s, folder:%s is not empty", ErrBucketObjectExists, newBucket.Name, newObjectKey)
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	movedCnt, err := models.MoveBucketObjectsByPrefix(bucket.ID, objectKey, newBucket.ID, newObjectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	if movedCnt == 0 {
+		err := fmt.Errorf("%w, bucket:%s, folder:%s", ErrNoSuchKey, bucketName, objectKey)
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	logs.GetLogger().Info(movedCnt, " keys under folder:", objectKey, " in bucket:", bucketName, " moved to folder:", newObjectKey, " in bucket:", newBucket.Name)
+	return movedCnt, nil
+}
@@ -3,6 +3,8 @@ package service
 import (
 	"multi-chain-storage/common"
 	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/scheduler"
 	"runtime"
 	"time"
 )
@@ -18,3 +20,35 @@ func GetHostInfo() *common.HostInfo {
 
 	return &hostInfo
 }
+
+func GetScanDealStats() []*scheduler.ScanDealStat {
+	return scheduler.GetScanDealStats()
+}
+
+func GetGcStat() *scheduler.GcStat {
+	return scheduler.GetGcStat()
+}
+
+func GetGcReport() (*scheduler.GcReport, error) {
+	return scheduler.GetGcReport()
+}
+
+func GetPinDrifts(status *string, limit, offset int) ([]*models.PinDrift, error) {
+	return models.GetPinDrifts(status, limit, offset)
+}
+
+func GetJobStatuses() []*scheduler.JobStatus {
+	return scheduler.GetJobStatuses()
+}
+
+func PauseJob(name string) error {
+	return scheduler.PauseJob(name)
+}
+
+func ResumeJob(name string) error {
+	return scheduler.ResumeJob(name)
+}
+
+func TriggerJob(name string) error {
+	return scheduler.TriggerJob(name)
+}
@@ -0,0 +1,436 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/denylist"
+	"multi-chain-storage/service/hotstorage"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+var ErrWalletBlocked = errors.New("wallet is blocked")
+var ErrAbuseReportNotFound = errors.New("abuse report not found")
+var ErrAbuseReportReviewed = errors.New("abuse report has been reviewed")
+var ErrDenylistNotFound = errors.New("denylist entry not found")
+
+// checkContentAllowed fails if the content of the wallet is in the denylist by its cid or its hash, the source file is
+// removed then, and the denial is recorded to the audit log
+func checkContentAllowed(wallet *models.Wallet, srcFilepath, cid, contentSha256 string) error {
+	err := denylist.CheckContent(cid, contentSha256)
+	if err == nil {
+		return nil
+	}
+
+	os.Remove(srcFilepath)
+
+	if errors.Is(err, denylist.ErrContentDenied) {
+		detail := err.Error()
+		createAuditLog(constants.AUDIT_LOG_ACTOR_SYSTEM, "", constants.AUDIT_LOG_ACTION_CONTENT_DENIED, constants.AUDIT_LOG_TARGET_TYPE_WALLET, wallet.Address, &detail)
+	}
+
+	return err
+}
+
+// unpinDeniedContent unpins the content put before it is found denied by its cid, unless it is pinned for other uploads
+// before, which is removed by the admin if needed
+func unpinDeniedContent(hotStorage hotstorage.HotStorage, cid string) {
+	sourceFile, err := models.GetSourceFileByPayloadCid(cid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return
+	}
+
+	if sourceFile != nil && sourceFile.PinStatus == constants.IPFS_File_PINNED_STATUS {
+		return
+	}
+
+	err = hotStorage.Unpin(context.Background(), cid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+// createAuditLog records the action, a failure is only logged, so it does not fail the action done already
+func createAuditLog(actor, actorIp, action, targetType, targetId string, detail *string) {
+	var actorIpPtr *string
+	if actorIp != "" {
+		actorIpPtr = &actorIp
+	}
+
+	err := models.CreateAuditLog(actor, actorIpPtr, action, targetType, targetId, detail)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+// CreateAbuseReport reports the content of the cid, or of the source file upload if given, to be reviewed by the admin
+func CreateAbuseReport(payloadCid string, sourceFileUploadId *int64, reason string, reporterContact *string, reporterIp string) (*models.AbuseReport, error) {
+	if sourceFileUploadId != nil {
+		sourceFileUpload, err := models.GetSourceFileUploadById(*sourceFileUploadId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if sourceFileUpload == nil {
+			err := fmt.Errorf("%w, id:%d", ErrSourceFileUploadNotFound, *sourceFileUploadId)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		sourceFile, err := models.GetSourceFileById(sourceFileUpload.SourceFileId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if sourceFile == nil {
+			err := fmt.Errorf("source file:%d of upload:%d not exists", sourceFileUpload.SourceFileId, sourceFileUpload.Id)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		payloadCid = sourceFile.PayloadCid
+	}
+
+	if payloadCid == "" {
+		err := errors.New("payload_cid or source_file_upload_id is required")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	abuseReport := &models.AbuseReport{
+		PayloadCid:         payloadCid,
+		SourceFileUploadId: sourceFileUploadId,
+		Reason:             reason,
+		ReporterContact:    reporterContact,
+		Status:             constants.ABUSE_REPORT_STATUS_OPEN,
+		CreateAt:           currentUtcSecond,
+		UpdateAt:           currentUtcSecond,
+	}
+
+	err := models.CreateAbuseReport(abuseReport)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	detail := "payload_cid:" + payloadCid
+	createAuditLog(constants.AUDIT_LOG_ACTOR_REPORTER, reporterIp, constants.AUDIT_LOG_ACTION_ABUSE_REPORT_CREATE, constants.AUDIT_LOG_TARGET_TYPE_ABUSE_REPORT, strconv.FormatInt(abuseReport.ID, 10), &detail)
+
+	return abuseReport, nil
+}
+
+func GetAbuseReports(status *string, limit, offset int) ([]*models.AbuseReport, error) {
+	return models.GetAbuseReports(status, limit, offset)
+}
+
+// ReviewAbuseReport closes the open report, by removing the content reported and optionally blocking the wallets having
+// uploaded it, or by dismissing the report
+func ReviewAbuseReport(id int64, action string, blockWallet bool, note *string, adminIp string) (*models.AbuseReport, error) {
+	abuseReport, err := models.GetAbuseReportById(id)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if abuseReport == nil {
+		err := fmt.Errorf("%w, id:%d", ErrAbuseReportNotFound, id)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if abuseReport.Status != constants.ABUSE_REPORT_STATUS_OPEN {
+		err := fmt.Errorf("%w, id:%d, status:%s", ErrAbuseReportReviewed, id, abuseReport.Status)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var status string
+	switch action {
+	case constants.ABUSE_REPORT_ACTION_REMOVE:
+		reason := "abuse report:" + strconv.FormatInt(id, 10)
+		err := RemoveContent(abuseReport.PayloadCid, blockWallet, &reason, adminIp)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		status = constants.ABUSE_REPORT_STATUS_REMOVED
+	case constants.ABUSE_REPORT_ACTION_DISMISS:
+		status = constants.ABUSE_REPORT_STATUS_DISMISSED
+	default:
+		err := fmt.Errorf("invalid action:%s, should be %s or %s", action, constants.ABUSE_REPORT_ACTION_REMOVE, constants.ABUSE_REPORT_ACTION_DISMISS)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	reviewed, err := models.UpdateAbuseReportReviewed(id, status, note)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if !reviewed {
+		err := fmt.Errorf("%w, id:%d", ErrAbuseReportReviewed, id)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	detail := "status:" + status
+	if note != nil {
+		detail = detail + ", note:" + *note
+	}
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_ABUSE_REPORT_REVIEW, constants.AUDIT_LOG_TARGET_TYPE_ABUSE_REPORT, strconv.FormatInt(id, 10), &detail)
+
+	return models.GetAbuseReportById(id)
+}
+
+// RemoveContent adds the cid to the denylist, so it is not uploaded or imported again, then unpins it, removes its local
+// copy and blocks its uploads, so they are not stored in new deals, the deals made already are not affected.
+// With blockWallet, the wallets having uploaded it are blocked as well
+func RemoveContent(payloadCid string, blockWallet bool, reason *string, adminIp string) error {
+	err := models.SaveDenylist(constants.DENYLIST_KIND_CID, denylist.NormalizeCid(payloadCid), constants.DENYLIST_SOURCE_ADMIN, reason)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	detail := "kind:" + constants.DENYLIST_KIND_CID
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_DENYLIST_ADD, constants.AUDIT_LOG_TARGET_TYPE_PAYLOAD_CID, payloadCid, &detail)
+
+	sourceFile, err := models.GetSourceFileByPayloadCid(payloadCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if sourceFile == nil && denylist.NormalizeCid(payloadCid) != payloadCid {
+		sourceFile, err = models.GetSourceFileByPayloadCid(denylist.NormalizeCid(payloadCid))
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	if sourceFile == nil {
+		logs.GetLogger().Info("no source file of payload cid:", payloadCid, " to remove")
+		return nil
+	}
+
+	localFilepath, err := removeSourceFileContent(sourceFile.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if localFilepath != "" {
+		err = os.Remove(localFilepath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+
+	detail = "payload_cid:" + sourceFile.PayloadCid
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_CONTENT_REMOVE, constants.AUDIT_LOG_TARGET_TYPE_SOURCE_FILE, strconv.FormatInt(sourceFile.ID, 10), &detail)
+
+	if !blockWallet {
+		return nil
+	}
+
+	walletIds, err := models.GetSourceFileUploadWalletIds(sourceFile.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, walletId := range walletIds {
+		wallet, err := models.GetWalletById(walletId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		if wallet == nil {
+			continue
+		}
+
+		err = setWalletBlocked(wallet, true, reason, adminIp)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeSourceFileContent blocks the uploads of the source file, unpins it and marks its local copy deleted, the source
+// file is locked meanwhile so it is not pinned again by a concurrent upload. It returns the local copy to be removed
+func removeSourceFileContent(sourceFileId int64) (string, error) {
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	db := database.GetDBTransaction()
+	sourceFile, err := models.GetSourceFileByIdForUpdate(db, sourceFileId)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	if sourceFile == nil {
+		db.Rollback()
+		err := fmt.Errorf("source file:%d not exists", sourceFileId)
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	err = models.UpdateSourceFileUploadsBlockedInTransaction(db, sourceFile.ID)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	if sourceFile.PinStatus == constants.IPFS_File_PINNED_STATUS {
+		err = hotStorage.Unpin(context.Background(), sourceFile.PayloadCid)
+		if err != nil {
+			db.Rollback()
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+	}
+
+	localFilepath := ""
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	if sourceFile.LocalDeletedAt == nil {
+		localFilepath = sourceFile.ResourceUri
+		sourceFile.LocalDeletedAt = &currentUtcSecond
+	}
+
+	sourceFile.PinStatus = constants.IPFS_File_UNPINNED_STATUS
+	sourceFile.UpdateAt = currentUtcSecond
+	err = database.SaveOneInTransaction(db, sourceFile)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return localFilepath, nil
+}
+
+func GetDenylists(kind, source *string, limit, offset int) ([]*models.Denylist, error) {
+	return models.GetDenylists(kind, source, limit, offset)
+}
+
+// AddDenylist adds the cid or the hash to the denylist by the admin, the content already stored is not affected,
+// which is removed by RemoveContent
+func AddDenylist(kind, value string, reason *string, adminIp string) error {
+	denylistEntry, err := denylist.NewDenylistEntry(kind, value)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.SaveDenylist(denylistEntry.Kind, denylistEntry.Value, constants.DENYLIST_SOURCE_ADMIN, reason)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	detail := "kind:" + denylistEntry.Kind + ", value:" + denylistEntry.Value
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_DENYLIST_ADD, constants.AUDIT_LOG_TARGET_TYPE_DENYLIST, denylistEntry.Value, &detail)
+
+	return nil
+}
+
+func RemoveDenylist(id int64, adminIp string) error {
+	denylistEntry, err := models.GetDenylistById(id)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if denylistEntry == nil {
+		err := fmt.Errorf("%w, id:%d", ErrDenylistNotFound, id)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.DeleteDenylistById(id)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	detail := "kind:" + denylistEntry.Kind + ", source:" + denylistEntry.Source
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_DENYLIST_REMOVE, constants.AUDIT_LOG_TARGET_TYPE_DENYLIST, denylistEntry.Value, &detail)
+
+	return nil
+}
+
+// ImportDenylist imports the list in the compact denylist format at the url, see denylist.ImportDenylist
+func ImportDenylist(ctx context.Context, url string, adminIp string) (int, int64, error) {
+	savedCnt, removedCnt, err := denylist.ImportDenylist(ctx, url)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, 0, err
+	}
+
+	detail := fmt.Sprintf("saved:%d, removed:%d", savedCnt, removedCnt)
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_DENYLIST_IMPORT, constants.AUDIT_LOG_TARGET_TYPE_DENYLIST, url, &detail)
+
+	return savedCnt, removedCnt, nil
+}
+
+// BlockWallet blocks or unblocks the wallet, a blocked wallet can neither upload nor use its access keys, and its
+// uploads are not stored in new deals
+func BlockWallet(walletAddress string, isBlocked bool, note *string, adminIp string) error {
+	wallet, err := models.GetWalletByAddress(strings.Trim(walletAddress, " "), constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return setWalletBlocked(wallet, isBlocked, note, adminIp)
+}
+
+func setWalletBlocked(wallet *models.Wallet, isBlocked bool, note *string, adminIp string) error {
+	err := models.UpdateWalletBlocked(wallet.ID, isBlocked)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	action := constants.AUDIT_LOG_ACTION_WALLET_BLOCK
+	if !isBlocked {
+		action = constants.AUDIT_LOG_ACTION_WALLET_UNBLOCK
+	}
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, action, constants.AUDIT_LOG_TARGET_TYPE_WALLET, wallet.Address, note)
+
+	return nil
+}
+
+func GetAuditLogs(targetType, targetId *string, limit, offset int) ([]*models.AuditLog, error) {
+	return models.GetAuditLogs(targetType, targetId, limit, offset)
+}
@@ -57,10 +57,10 @@ func GetDeals2Sign(signerWalletAddress string) ([]*models.Deal2Sign, error) {
 					logs.GetLogger().Error(err)
 					return nil, err
 				}
-				wCids := []string{}
-				for _, sourceFileUpload := range sourceFileUploads {
-					wCid := sourceFileUpload.Uuid + sourceFileUpload.PayloadCid
-					wCids = append(wCids, wCid)
+				wCids, err := getWCids(deal2Sign.CarFileId, sourceFileUploads)
+				if err != nil {
+					logs.GetLogger().Error(err)
+					return nil, err
 				}
 
 				deal2SignBatchInfo := &models.Deal2SignBatchInfo{
@@ -96,10 +96,10 @@ func GetDeals2SignHash(signerWalletAddress string) ([]*models.Deal2Sign, error)
 			return nil, err
 		}
 
-		wCids := []string{}
-		for _, sourceFileUpload := range sourceFileUploads {
-			wCid := sourceFileUpload.Uuid + sourceFileUpload.PayloadCid
-			wCids = append(wCids, wCid)
+		wCids, err := getWCids(deal2Sign.CarFileId, sourceFileUploads)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
 		}
 
 		deal2SignBatchInfo := &models.Deal2SignBatchInfo{
@@ -113,6 +113,27 @@ func GetDeals2SignHash(signerWalletAddress string) ([]*models.Deal2Sign, error)
 	return deals2Sign, nil
 }
 
+// getWCids returns the w_cids the payments for the deals of the car file are locked for, which are of the source file
+// uploads, or of the renewal when the car file is created for one, so that its payment is unlocked instead of the upload's
+func getWCids(carFileId int64, sourceFileUploads []*models.SourceFileUploadOut) ([]string, error) {
+	renewal, err := models.GetRenewalByCarFileIdRenewed(carFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	wCids := []string{}
+	for _, sourceFileUpload := range sourceFileUploads {
+		wCid := sourceFileUpload.Uuid + sourceFileUpload.PayloadCid
+		if renewal != nil {
+			wCid = renewal.Uuid + sourceFileUpload.PayloadCid
+		}
+		wCids = append(wCids, wCid)
+	}
+
+	return wCids, nil
+}
+
 func RegisterDao(daoWalletAddress string) error {
 	daoWallet, err := models.GetWalletByAddress(daoWalletAddress, constants.WALLET_TYPE_META_MASK)
 	if err != nil {
@@ -0,0 +1,643 @@
+package dealclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"multi-chain-storage/common/cidutil"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+)
+
+var BOOST_ERROR_DEAL_NOT_FOUND = []string{"not found", "no rows in result set"}
+
+// the checkpoints a boost deal goes through, in order
+var boostCheckpoints = []string{"Accepted", "Transferred", "Published", "PublishConfirmed", "AddedPiece", "IndexedAndAnnounced", "Complete"}
+
+// BoostDealClient proposes deals with http transfer through the boost json-rpc of the miners, in deal_client.boost_api_urls,
+// the proposals are signed by filecoin_wallet on the lotus node, each deal is identified by its uuid,
+// the car files are downloaded by the miners from deal_client.car_download_url_prefix
+type BoostDealClient struct {
+	lotusApiUrl      string
+	lotusAccessToken string
+	apiUrls          map[string]string
+	accessTokens     map[string]string
+}
+
+func NewBoostDealClient() *BoostDealClient {
+	return &BoostDealClient{
+		lotusApiUrl:      config.GetConfig().Lotus.ClientApiUrl,
+		lotusAccessToken: config.GetConfig().Lotus.ClientAccessToken,
+		apiUrls:          config.GetConfig().DealClient.BoostApiUrls,
+		accessTokens:     config.GetConfig().DealClient.BoostAccessTokens,
+	}
+}
+
+type jsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type boostSignature struct {
+	Type int
+	Data []byte
+}
+
+type boostDealProposal struct {
+	PieceCID             lotusCid
+	PieceSize            int64
+	VerifiedDeal         bool
+	Client               string
+	Provider             string
+	Label                string
+	StartEpoch           int64
+	EndEpoch             int64
+	StoragePricePerEpoch string
+	ProviderCollateral   string
+	ClientCollateral     string
+}
+
+type boostClientDealProposal struct {
+	Proposal        boostDealProposal
+	ClientSignature boostSignature
+}
+
+type boostTransfer struct {
+	Type     string
+	ClientID string
+	Params   []byte
+	Size     int64
+}
+
+type boostHttpRequest struct {
+	URL     string
+	Headers map[string]string
+}
+
+type boostDealParams struct {
+	DealUUID           string
+	IsOffline          bool
+	ClientDealProposal boostClientDealProposal
+	DealDataRoot       lotusCid
+	Transfer           boostTransfer
+	RemoveUnsealedCopy bool
+	SkipIPNIAnnounce   bool
+}
+
+type boostDealRejectionInfo struct {
+	Result *struct {
+		Accepted bool
+		Reason   string
+	} `json:"result"`
+	Error *jsonRpcError `json:"error"`
+}
+
+type boostDealState struct {
+	Result *struct {
+		DealUuid    string
+		ChainDealID int64
+		Checkpoint  int
+		Err         string
+	} `json:"result"`
+	Error *jsonRpcError `json:"error"`
+}
+
+func (c *BoostDealClient) SendDeals(ctx context.Context, carFile *models.CarFile, minerFids []string) ([]*Deal, error) {
+	if len(minerFids) == 0 {
+		err := fmt.Errorf("no miner given for car file:%d", carFile.ID)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carFileUrl, err := getCarFileUrl(carFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	proposal, err := getDealProposal(ctx, carFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	clientId, err := c.lookupId(ctx, config.GetConfig().FilecoinWallet)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	providerCollateral, err := c.getProviderCollateral(ctx, proposal.PieceSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	transferParams, err := json.Marshal(boostHttpRequest{URL: *carFileUrl})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var deals []*Deal
+	for _, minerFid := range minerFids {
+		if ctx.Err() != nil {
+			break
+		}
+
+		dealProposal := boostDealProposal{
+			PieceCID:             lotusCid{Cid: carFile.PieceCid},
+			PieceSize:            proposal.PieceSize,
+			VerifiedDeal:         config.GetConfig().SwanTask.VerifiedDeal,
+			Client:               *clientId,
+			Provider:             minerFid,
+			Label:                carFile.PayloadCid,
+			StartEpoch:           proposal.StartEpoch,
+			EndEpoch:             proposal.StartEpoch + proposal.Duration,
+			StoragePricePerEpoch: proposal.PricePerEpoch,
+			ProviderCollateral:   *providerCollateral,
+			ClientCollateral:     "0",
+		}
+
+		dealParams := boostDealParams{
+			DealUUID:     uuid.NewString(),
+			DealDataRoot: lotusCid{Cid: carFile.PayloadCid},
+			Transfer: boostTransfer{
+				Type:   "http",
+				Params: transferParams,
+				Size:   carFile.CarFileSize,
+			},
+			RemoveUnsealedCopy: !config.GetConfig().SwanTask.FastRetrieval,
+		}
+
+		err := c.proposeDeal(dealParams, dealProposal)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		logs.GetLogger().Info("deal:", dealParams.DealUUID, " sent to miner:", minerFid, " for car file:", carFile.ID)
+		deals = append(deals, &Deal{
+			DealCid:    dealParams.DealUUID,
+			MinerFid:   minerFid,
+			StartEpoch: int(proposal.StartEpoch),
+		})
+	}
+
+	if len(deals) == 0 {
+		err := fmt.Errorf("no deal sent for car file:%d", carFile.ID)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return deals, nil
+}
+
+// proposeDeal signs the proposal and hands the deal to the boost node of its provider
+func (c *BoostDealClient) proposeDeal(dealParams boostDealParams, dealProposal boostDealProposal) error {
+	apiUrl, ok := c.apiUrls[dealProposal.Provider]
+	if !ok {
+		err := fmt.Errorf("no boost api url of miner:%s in deal_client.boost_api_urls", dealProposal.Provider)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	proposalBytes, err := encodeDealProposal(dealProposal)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	// not cancelled with the caller, the deal may be made by boost without its uuid recorded
+	signature, err := c.sign(context.Background(), config.GetConfig().FilecoinWallet, proposalBytes)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	dealParams.ClientDealProposal = boostClientDealProposal{
+		Proposal:        dealProposal,
+		ClientSignature: *signature,
+	}
+
+	jsonRpcParams := utils.LotusJsonRpcParams{
+		JsonRpc: utils.LOTUS_JSON_RPC_VERSION,
+		Method:  "Boost.BoostDummyDeal",
+		Params:  []interface{}{dealParams},
+		Id:      utils.LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := utils.HttpPostJsonRpc(context.Background(), apiUrl, c.accessTokens[dealProposal.Provider], jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	var rejectionInfo boostDealRejectionInfo
+	err = json.Unmarshal(response, &rejectionInfo)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if rejectionInfo.Error != nil {
+		err := fmt.Errorf("propose deal:%s to miner:%s failed, code:%d,message:%s", dealParams.DealUUID, dealProposal.Provider, rejectionInfo.Error.Code, rejectionInfo.Error.Message)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if rejectionInfo.Result == nil || !rejectionInfo.Result.Accepted {
+		reason := ""
+		if rejectionInfo.Result != nil {
+			reason = rejectionInfo.Result.Reason
+		}
+		err := fmt.Errorf("deal:%s rejected by miner:%s, %s", dealParams.DealUUID, dealProposal.Provider, reason)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetDealInfo asks the boost nodes in deal_client.boost_api_urls for the deal, since the deal uuid does not tell its miner,
+// the deal is not found when none of them knows it. Once the deal is on chain, its status is the one in the market state
+func (c *BoostDealClient) GetDealInfo(ctx context.Context, dealCid string) (*DealInfo, error) {
+	var lastErr error
+	for minerFid, apiUrl := range c.apiUrls {
+		jsonRpcParams := utils.LotusJsonRpcParams{
+			JsonRpc: utils.LOTUS_JSON_RPC_VERSION,
+			Method:  "Boost.BoostDeal",
+			Params:  []interface{}{dealCid},
+			Id:      utils.LOTUS_JSON_RPC_ID,
+		}
+
+		response, err := utils.HttpPostJsonRpc(ctx, apiUrl, c.accessTokens[minerFid], jsonRpcParams)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			lastErr = err
+			continue
+		}
+
+		var dealState boostDealState
+		err = json.Unmarshal(response, &dealState)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			lastErr = err
+			continue
+		}
+
+		if dealState.Error != nil {
+			if isBoostDealNotFound(dealState.Error.Message) {
+				continue
+			}
+
+			lastErr = fmt.Errorf("get deal:%s from miner:%s failed, code:%d,message:%s", dealCid, minerFid, dealState.Error.Code, dealState.Error.Message)
+			logs.GetLogger().Error(lastErr)
+			continue
+		}
+
+		if dealState.Result == nil {
+			continue
+		}
+
+		return c.getDealInfo(ctx, dealState.Result.ChainDealID, dealState.Result.Checkpoint, dealState.Result.Err)
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	return nil, fmt.Errorf("%w, deal uuid:%s", ErrDealNotFound, dealCid)
+}
+
+func (c *BoostDealClient) getDealInfo(ctx context.Context, chainDealId int64, checkpoint int, dealErr string) (*DealInfo, error) {
+	dealInfo := &DealInfo{
+		DealId:  chainDealId,
+		Status:  strconv.Itoa(checkpoint),
+		Message: dealErr,
+	}
+
+	if checkpoint >= 0 && checkpoint < len(boostCheckpoints) {
+		dealInfo.Status = boostCheckpoints[checkpoint]
+	}
+
+	if dealErr != "" {
+		dealInfo.Status = constants.ON_CHAIN_DEAL_STATUS_ERROR
+		return dealInfo, nil
+	}
+
+	if chainDealId == 0 {
+		return dealInfo, nil
+	}
+
+	marketDealState, err := utils.GetDealState(ctx, chainDealId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if marketDealState.Error != nil || marketDealState.Result == nil {
+		return dealInfo, nil
+	}
+
+	switch {
+	case marketDealState.Result.State.SlashEpoch > -1:
+		dealInfo.Status = constants.ON_CHAIN_DEAL_STATUS_SLASHED
+	case marketDealState.Result.State.SectorStartEpoch > -1:
+		dealInfo.Status = constants.ON_CHAIN_DEAL_STATUS_ACTIVE
+	}
+
+	return dealInfo, nil
+}
+
+func isBoostDealNotFound(message string) bool {
+	for _, notFound := range BOOST_ERROR_DEAL_NOT_FOUND {
+		if strings.Contains(message, notFound) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupId returns the id address of the wallet, the deal proposals are made by it, so that only id addresses are encoded
+func (c *BoostDealClient) lookupId(ctx context.Context, wallet string) (*string, error) {
+	jsonRpcParams := utils.LotusJsonRpcParams{
+		JsonRpc: utils.LOTUS_JSON_RPC_VERSION,
+		Method:  "Filecoin.StateLookupID",
+		Params:  []interface{}{wallet, nil},
+		Id:      utils.LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := utils.HttpPostJsonRpc(ctx, c.lotusApiUrl, c.lotusAccessToken, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var result struct {
+		Result string        `json:"result"`
+		Error  *jsonRpcError `json:"error"`
+	}
+	err = json.Unmarshal(response, &result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if result.Error != nil || result.Result == "" {
+		err := fmt.Errorf("look up id of wallet:%s failed, %+v", wallet, result.Error)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &result.Result, nil
+}
+
+// getProviderCollateral returns the provider collateral of the deals, 6/5 of the min of the market, as boost does,
+// so that the deals are not rejected when the min rises before they are published
+func (c *BoostDealClient) getProviderCollateral(ctx context.Context, pieceSize int64) (*string, error) {
+	jsonRpcParams := utils.LotusJsonRpcParams{
+		JsonRpc: utils.LOTUS_JSON_RPC_VERSION,
+		Method:  "Filecoin.StateDealProviderCollateralBounds",
+		Params:  []interface{}{pieceSize, config.GetConfig().SwanTask.VerifiedDeal, nil},
+		Id:      utils.LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := utils.HttpPostJsonRpc(ctx, c.lotusApiUrl, c.lotusAccessToken, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var result struct {
+		Result *struct {
+			Min string
+			Max string
+		} `json:"result"`
+		Error *jsonRpcError `json:"error"`
+	}
+	err = json.Unmarshal(response, &result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if result.Error != nil || result.Result == nil {
+		err := fmt.Errorf("get provider collateral bounds of piece size:%d failed, %+v", pieceSize, result.Error)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	collateralMin, ok := new(big.Int).SetString(result.Result.Min, 10)
+	if !ok {
+		err := fmt.Errorf("invalid min provider collateral:%s", result.Result.Min)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	collateral := collateralMin.Mul(collateralMin, big.NewInt(6))
+	collateral = collateral.Div(collateral, big.NewInt(5))
+	collateralStr := collateral.String()
+	return &collateralStr, nil
+}
+
+func (c *BoostDealClient) sign(ctx context.Context, wallet string, message []byte) (*boostSignature, error) {
+	jsonRpcParams := utils.LotusJsonRpcParams{
+		JsonRpc: utils.LOTUS_JSON_RPC_VERSION,
+		Method:  "Filecoin.WalletSign",
+		Params:  []interface{}{wallet, message},
+		Id:      utils.LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := utils.HttpPostJsonRpc(ctx, c.lotusApiUrl, c.lotusAccessToken, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var result struct {
+		Result *boostSignature `json:"result"`
+		Error  *jsonRpcError   `json:"error"`
+	}
+	err = json.Unmarshal(response, &result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if result.Error != nil || result.Result == nil {
+		err := fmt.Errorf("sign with wallet:%s failed, %+v", wallet, result.Error)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return result.Result, nil
+}
+
+// getCarFileUrl maps the car file under swan_task.dir_deal to the url the miners download it from
+func getCarFileUrl(carFile *models.CarFile) (*string, error) {
+	carDownloadUrlPrefix := config.GetConfig().DealClient.CarDownloadUrlPrefix
+	if carDownloadUrlPrefix == "" {
+		err := fmt.Errorf("deal_client.car_download_url_prefix is required for http transfer")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carFileRelPath, err := filepath.Rel(config.GetConfig().SwanTask.DirDeal, carFile.CarFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carFileUrl := libutils.UrlJoin(carDownloadUrlPrefix, filepath.ToSlash(carFileRelPath))
+	return &carFileUrl, nil
+}
+
+// encodeDealProposal returns the dag-cbor of the market deal proposal, which is what the client signs,
+// the addresses in it are id addresses
+func encodeDealProposal(proposal boostDealProposal) ([]byte, error) {
+	pieceCid, err := cidutil.Decode(proposal.PieceCID.Cid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	client, err := encodeIdAddress(proposal.Client)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	provider, err := encodeIdAddress(proposal.Provider)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeCborHeader(&buf, 4, 11)
+
+	// a cid is tag 42 of its bytes after the identity multibase prefix
+	buf.Write([]byte{0xd8, 42})
+	writeCborBytes(&buf, append([]byte{0x00}, pieceCid...))
+
+	writeCborInt(&buf, proposal.PieceSize)
+	writeCborBool(&buf, proposal.VerifiedDeal)
+	writeCborBytes(&buf, client)
+	writeCborBytes(&buf, provider)
+
+	writeCborHeader(&buf, 3, uint64(len(proposal.Label)))
+	buf.WriteString(proposal.Label)
+
+	writeCborInt(&buf, proposal.StartEpoch)
+	writeCborInt(&buf, proposal.EndEpoch)
+
+	for _, amount := range []string{proposal.StoragePricePerEpoch, proposal.ProviderCollateral, proposal.ClientCollateral} {
+		err := writeCborBigInt(&buf, amount)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeIdAddress returns the bytes of an id address, such as f01234, the protocol byte 0 followed by the uvarint of the id
+func encodeIdAddress(address string) ([]byte, error) {
+	if len(address) < 3 || (address[0] != 'f' && address[0] != 't') || address[1] != '0' {
+		err := fmt.Errorf("not an id address:%s", address)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	id, err := strconv.ParseUint(address[2:], 10, 63)
+	if err != nil {
+		err := fmt.Errorf("not an id address:%s, %s", address, err.Error())
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	idBytes := make([]byte, binary.MaxVarintLen64)
+	idSize := binary.PutUvarint(idBytes, id)
+	return append([]byte{0x00}, idBytes[:idSize]...), nil
+}
+
+func writeCborHeader(buf *bytes.Buffer, majorType byte, value uint64) {
+	major := majorType << 5
+	switch {
+	case value < 24:
+		buf.WriteByte(major | byte(value))
+	case value <= 0xff:
+		buf.Write([]byte{major | 24, byte(value)})
+	case value <= 0xffff:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(value))
+	case value <= 0xffffffff:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(value))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, value)
+	}
+}
+
+func writeCborInt(buf *bytes.Buffer, value int64) {
+	if value < 0 {
+		writeCborHeader(buf, 1, uint64(-1-value))
+		return
+	}
+
+	writeCborHeader(buf, 0, uint64(value))
+}
+
+func writeCborBool(buf *bytes.Buffer, value bool) {
+	if value {
+		buf.WriteByte(0xf5)
+		return
+	}
+
+	buf.WriteByte(0xf4)
+}
+
+func writeCborBytes(buf *bytes.Buffer, value []byte) {
+	writeCborHeader(buf, 2, uint64(len(value)))
+	buf.Write(value)
+}
+
+// writeCborBigInt writes the filecoin big int of the decimal string, empty bytes for zero, otherwise the sign byte
+// followed by the big endian bytes of the absolute value
+func writeCborBigInt(buf *bytes.Buffer, value string) error {
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		err := fmt.Errorf("invalid amount:%s", value)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if amount.Sign() == 0 {
+		writeCborBytes(buf, []byte{})
+		return nil
+	}
+
+	sign := byte(0x00)
+	if amount.Sign() < 0 {
+		sign = 0x01
+	}
+
+	writeCborBytes(buf, append([]byte{sign}, new(big.Int).Abs(amount).Bytes()...))
+	return nil
+}
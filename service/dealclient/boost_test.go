@@ -0,0 +1,100 @@
+package dealclient
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncodeIdAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		address   string
+		encoded   string
+		wantError bool
+	}{
+		{name: "mainnet", address: "f01234", encoded: "00d209"},
+		{name: "testnet", address: "t01000", encoded: "00e807"},
+		{name: "small id", address: "f05", encoded: "0005"},
+		{name: "secp256k1 address", address: "f1abjxfbp274xpdqcpuaykwkfb43omjotacm2p3za", wantError: true},
+		{name: "not a number", address: "f0abc", wantError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := encodeIdAddress(test.address)
+			if (err != nil) != test.wantError {
+				t.Fatalf("error:%v, want error:%t", err, test.wantError)
+			}
+
+			if err == nil && hex.EncodeToString(encoded) != test.encoded {
+				t.Errorf("encoded:%x, want:%s", encoded, test.encoded)
+			}
+		})
+	}
+}
+
+func TestWriteCbor(t *testing.T) {
+	tests := []struct {
+		name    string
+		write   func(*bytes.Buffer) error
+		encoded string
+	}{
+		{name: "small int", write: func(buf *bytes.Buffer) error { writeCborInt(buf, 10); return nil }, encoded: "0a"},
+		{name: "one byte int", write: func(buf *bytes.Buffer) error { writeCborInt(buf, 500); return nil }, encoded: "1901f4"},
+		{name: "piece size", write: func(buf *bytes.Buffer) error { writeCborInt(buf, 34359738368); return nil }, encoded: "1b0000000800000000"},
+		{name: "negative int", write: func(buf *bytes.Buffer) error { writeCborInt(buf, -1); return nil }, encoded: "20"},
+		{name: "false", write: func(buf *bytes.Buffer) error { writeCborBool(buf, false); return nil }, encoded: "f4"},
+		{name: "zero big int", write: func(buf *bytes.Buffer) error { return writeCborBigInt(buf, "0") }, encoded: "40"},
+		{name: "big int", write: func(buf *bytes.Buffer) error { return writeCborBigInt(buf, "1000000000000000000") }, encoded: "49000de0b6b3a7640000"},
+		{name: "negative big int", write: func(buf *bytes.Buffer) error { return writeCborBigInt(buf, "-256") }, encoded: "43010100"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := test.write(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hex.EncodeToString(buf.Bytes()) != test.encoded {
+				t.Errorf("encoded:%x, want:%s", buf.Bytes(), test.encoded)
+			}
+		})
+	}
+}
+
+func TestEncodeDealProposal(t *testing.T) {
+	proposal := boostDealProposal{
+		PieceCID:             lotusCid{Cid: "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq"},
+		PieceSize:            2048,
+		Client:               "f01000",
+		Provider:             "f01234",
+		Label:                "bafybeierhgbz4zp2x2u67urqrgfnrnlukciupzenpqpipiz5nwtq7uxpx4",
+		StartEpoch:           100,
+		EndEpoch:             200,
+		StoragePricePerEpoch: "0",
+		ProviderCollateral:   "0",
+		ClientCollateral:     "0",
+	}
+
+	encoded, err := encodeDealProposal(proposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if encoded[0] != 0x8b || !bytes.Equal(encoded[1:3], []byte{0xd8, 42}) {
+		t.Errorf("encoded:%x, want an array of 11 starting with a cid", encoded)
+	}
+
+	if !bytes.HasSuffix(encoded, []byte{0x18, 100, 0x18, 200, 0x40, 0x40, 0x40}) {
+		t.Errorf("encoded:%x, want the epochs and the zero amounts at the end", encoded)
+	}
+
+	proposal.Provider = "f1abjxfbp274xpdqcpuaykwkfb43omjotacm2p3za"
+	_, err = encodeDealProposal(proposal)
+	if err == nil {
+		t.Errorf("no error encoding a proposal of a non id provider")
+	}
+}
@@ -0,0 +1,118 @@
+package dealclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"sync"
+
+	libconstants "github.com/filswan/go-swan-lib/constants"
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/shopspring/decimal"
+)
+
+// ErrDealNotFound is returned by GetDealInfo when the deal client does not know the deal at all
+var ErrDealNotFound = errors.New("deal not found")
+
+type Deal struct {
+	DealCid    string `json:"deal_cid"` // proposal cid
+	MinerFid   string `json:"miner_fid"`
+	StartEpoch int    `json:"start_epoch"`
+}
+
+type DealInfo struct {
+	DealId  int64  `json:"deal_id"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type DealClient interface {
+	// SendDeals proposes deals of the car file to the miners given, the clients choosing miners themselves ignore them,
+	// no more deal is proposed once ctx is done, while the deal being proposed is not abandoned, to be recorded
+	SendDeals(ctx context.Context, carFile *models.CarFile, minerFids []string) ([]*Deal, error)
+	GetDealInfo(ctx context.Context, dealCid string) (*DealInfo, error)
+}
+
+var dealClient DealClient
+var dealClientOnce sync.Once
+var dealClientErr error
+
+func GetDealClient() (DealClient, error) {
+	dealClientOnce.Do(func() {
+		if dealClient != nil {
+			return
+		}
+
+		dealClient, dealClientErr = newDealClient(config.GetConfig().DealClient.Type)
+	})
+
+	if dealClientErr != nil {
+		logs.GetLogger().Error(dealClientErr)
+		return nil, dealClientErr
+	}
+
+	return dealClient, nil
+}
+
+// SetDealClient replaces the deal client in config, such as with a fake one when no network is available
+func SetDealClient(client DealClient) {
+	dealClientOnce.Do(func() {})
+	dealClient = client
+	dealClientErr = nil
+}
+
+func newDealClient(dealClientType string) (DealClient, error) {
+	switch dealClientType {
+	case constants.DEAL_CLIENT_TYPE_SWAN:
+		return NewSwanDealClient(), nil
+	case constants.DEAL_CLIENT_TYPE_LOTUS:
+		return NewLotusDealClient(), nil
+	case constants.DEAL_CLIENT_TYPE_BOOST:
+		return NewBoostDealClient(), nil
+	case constants.DEAL_CLIENT_TYPE_FAKE:
+		return NewFakeDealClient(), nil
+	default:
+		err := fmt.Errorf("invalid deal client type:%s", dealClientType)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+}
+
+type dealProposal struct {
+	PieceSize     int64  // padded
+	PricePerEpoch string // attoFIL
+	StartEpoch    int64
+	Duration      int64 // epochs
+}
+
+// getDealProposal builds the deal terms of the car file shared by the direct deal clients,
+// the price per epoch is the max price of the car file, in FIL/GiB/epoch, for its piece size
+func getDealProposal(ctx context.Context, carFile *models.CarFile) (*dealProposal, error) {
+	currentEpoch, err := utils.GetCurrentEpoch(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pieceSize, _ := libutils.CalculatePieceSize(carFile.CarFileSize)
+
+	pricePerEpoch := decimal.Zero
+	if !config.GetConfig().SwanTask.VerifiedDeal {
+		pieceSizeGB := decimal.NewFromInt(pieceSize).Div(decimal.NewFromInt(constants.BYTES_1GB))
+		pricePerEpoch = carFile.MaxPrice.Mul(pieceSizeGB).Mul(decimal.NewFromFloat(libconstants.LOTUS_PRICE_MULTIPLE_1E18)).Floor()
+	}
+
+	proposal := &dealProposal{
+		PieceSize:     pieceSize,
+		PricePerEpoch: pricePerEpoch.String(),
+		StartEpoch:    *currentEpoch + int64(config.GetConfig().SwanTask.StartEpochHours*constants.EPOCH_PER_HOUR),
+		Duration:      int64(carFile.Duration * constants.EPOCH_PER_DAY),
+	}
+
+	return proposal, nil
+}
@@ -0,0 +1,72 @@
+package dealclient
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// FakeDealClient keeps the deals in memory, every deal is active once sent unless its info is set otherwise
+type FakeDealClient struct {
+	mutex      sync.Mutex
+	dealIdLast int64
+	dealInfos  map[string]*DealInfo
+}
+
+func NewFakeDealClient() *FakeDealClient {
+	return &FakeDealClient{
+		dealInfos: map[string]*DealInfo{},
+	}
+}
+
+func (c *FakeDealClient) SendDeals(ctx context.Context, carFile *models.CarFile, minerFids []string) ([]*Deal, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(minerFids) == 0 {
+		minerFids = []string{"f01000"}
+	}
+
+	var deals []*Deal
+	for _, minerFid := range minerFids {
+		c.dealIdLast++
+		dealCid := uuid.NewString()
+		c.dealInfos[dealCid] = &DealInfo{
+			DealId:  c.dealIdLast,
+			Status:  constants.ON_CHAIN_DEAL_STATUS_ACTIVE,
+			Message: fmt.Sprintf("fake deal of car file:%d", carFile.ID),
+		}
+
+		deals = append(deals, &Deal{
+			DealCid:  dealCid,
+			MinerFid: minerFid,
+		})
+	}
+
+	return deals, nil
+}
+
+func (c *FakeDealClient) GetDealInfo(ctx context.Context, dealCid string) (*DealInfo, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	dealInfo, ok := c.dealInfos[dealCid]
+	if !ok {
+		return nil, fmt.Errorf("%w, deal cid:%s", ErrDealNotFound, dealCid)
+	}
+
+	dealInfoCopy := *dealInfo
+	return &dealInfoCopy, nil
+}
+
+// SetDealInfo changes the status of a deal sent, such as to simulate a failed deal
+func (c *FakeDealClient) SetDealInfo(dealCid string, dealInfo DealInfo) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.dealInfos[dealCid] = &dealInfo
+}
@@ -0,0 +1,201 @@
+package dealclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/client/lotus"
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const LOTUS_ERROR_DEAL_NOT_FOUND = "datastore: key not found"
+
+// LotusDealClient proposes offline deals through the lotus node directly, the car files are imported by the miners manually
+type LotusDealClient struct {
+	apiUrl      string
+	accessToken string
+}
+
+func NewLotusDealClient() *LotusDealClient {
+	return &LotusDealClient{
+		apiUrl:      config.GetConfig().Lotus.ClientApiUrl,
+		accessToken: config.GetConfig().Lotus.ClientAccessToken,
+	}
+}
+
+type lotusCid struct {
+	Cid string `json:"/"`
+}
+
+type lotusDataRef struct {
+	TransferType string
+	Root         lotusCid
+	PieceCid     *lotusCid
+	PieceSize    int64
+}
+
+type lotusStartDealParams struct {
+	Data              *lotusDataRef
+	Wallet            string
+	Miner             string
+	EpochPrice        string
+	MinBlocksDuration int64
+	DealStartEpoch    int64
+	FastRetrieval     bool
+	VerifiedDeal      bool
+}
+
+type lotusStartDealResult struct {
+	Result *lotusCid `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *LotusDealClient) SendDeals(ctx context.Context, carFile *models.CarFile, minerFids []string) ([]*Deal, error) {
+	if len(minerFids) == 0 {
+		err := fmt.Errorf("no miner given for car file:%d", carFile.ID)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	proposal, err := getDealProposal(ctx, carFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var deals []*Deal
+	for _, minerFid := range minerFids {
+		if ctx.Err() != nil {
+			break
+		}
+
+		dealCid, err := c.startDeal(carFile, proposal, minerFid)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		logs.GetLogger().Info("deal:", *dealCid, " sent to miner:", minerFid, " for car file:", carFile.ID)
+		deals = append(deals, &Deal{
+			DealCid:    *dealCid,
+			MinerFid:   minerFid,
+			StartEpoch: int(proposal.StartEpoch),
+		})
+	}
+
+	if len(deals) == 0 {
+		err := fmt.Errorf("no deal sent for car file:%d", carFile.ID)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return deals, nil
+}
+
+func (c *LotusDealClient) startDeal(carFile *models.CarFile, proposal *dealProposal, minerFid string) (*string, error) {
+	startDealParams := lotusStartDealParams{
+		Data: &lotusDataRef{
+			TransferType: "manual",
+			Root:         lotusCid{Cid: carFile.PayloadCid},
+			PieceCid:     &lotusCid{Cid: carFile.PieceCid},
+			PieceSize:    proposal.PieceSize / 128 * 127,
+		},
+		Wallet:            config.GetConfig().FilecoinWallet,
+		Miner:             minerFid,
+		EpochPrice:        proposal.PricePerEpoch,
+		MinBlocksDuration: proposal.Duration,
+		DealStartEpoch:    proposal.StartEpoch,
+		FastRetrieval:     config.GetConfig().SwanTask.FastRetrieval,
+		VerifiedDeal:      config.GetConfig().SwanTask.VerifiedDeal,
+	}
+
+	jsonRpcParams := utils.LotusJsonRpcParams{
+		JsonRpc: utils.LOTUS_JSON_RPC_VERSION,
+		Method:  "Filecoin.ClientStartDeal",
+		Params:  []interface{}{startDealParams},
+		Id:      utils.LOTUS_JSON_RPC_ID,
+	}
+
+	// not cancelled with the caller, the deal may be made by lotus without its cid returned to be recorded
+	response, err := utils.HttpPostJsonRpc(context.Background(), c.apiUrl, c.accessToken, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var startDealResult lotusStartDealResult
+	err = json.Unmarshal(response, &startDealResult)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if startDealResult.Error != nil {
+		err := fmt.Errorf("start deal with miner:%s failed, code:%d,message:%s", minerFid, startDealResult.Error.Code, startDealResult.Error.Message)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if startDealResult.Result == nil || startDealResult.Result.Cid == "" {
+		err := fmt.Errorf("no deal cid returned from miner:%s", minerFid)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &startDealResult.Result.Cid, nil
+}
+
+type lotusDealInfoResult struct {
+	dealInfo *DealInfo
+	err      error
+}
+
+func (c *LotusDealClient) GetDealInfo(ctx context.Context, dealCid string) (*DealInfo, error) {
+	lotusClient, err := lotus.LotusGetClient(c.apiUrl, c.accessToken)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	// the lotus client takes no context, its call is abandoned once ctx is done
+	dealInfoResult := make(chan *lotusDealInfoResult, 1)
+	go func() {
+		lotusDealInfo, err := lotusClient.LotusClientGetDealInfo(dealCid)
+		if err != nil {
+			dealInfoResult <- &lotusDealInfoResult{err: err}
+			return
+		}
+
+		dealInfo := &DealInfo{
+			DealId:  lotusDealInfo.DealId,
+			Status:  lotusDealInfo.Status,
+			Message: lotusDealInfo.Message,
+		}
+		dealInfoResult <- &lotusDealInfoResult{dealInfo: dealInfo}
+	}()
+
+	var result *lotusDealInfoResult
+	select {
+	case <-ctx.Done():
+		result = &lotusDealInfoResult{err: ctx.Err()}
+	case result = <-dealInfoResult:
+	}
+
+	if result.err != nil {
+		logs.GetLogger().Error(result.err)
+		if strings.Contains(result.err.Error(), LOTUS_ERROR_DEAL_NOT_FOUND) {
+			return nil, fmt.Errorf("%w, %s", ErrDealNotFound, result.err.Error())
+		}
+		return nil, result.err
+	}
+
+	return result.dealInfo, nil
+}
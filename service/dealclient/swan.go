@@ -0,0 +1,64 @@
+package dealclient
+
+import (
+	"context"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-client/command"
+	libconstants "github.com/filswan/go-swan-lib/constants"
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// SwanDealClient sends the deals of the swan task created for the car file, the miners are chosen by swan auto-bid
+type SwanDealClient struct {
+	lotusDealClient *LotusDealClient
+}
+
+func NewSwanDealClient() *SwanDealClient {
+	return &SwanDealClient{
+		lotusDealClient: NewLotusDealClient(),
+	}
+}
+
+func (c *SwanDealClient) SendDeals(ctx context.Context, carFile *models.CarFile, minerFids []string) ([]*Deal, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	cmdAutoBidDeal := &command.CmdAutoBidDeal{
+		SwanApiUrl:             config.GetConfig().SwanApi.ApiUrl,
+		SwanApiKey:             config.GetConfig().SwanApi.ApiKey,
+		SwanAccessToken:        config.GetConfig().SwanApi.AccessToken,
+		LotusClientApiUrl:      config.GetConfig().Lotus.ClientApiUrl,
+		LotusClientAccessToken: config.GetConfig().Lotus.ClientAccessToken,
+		SenderWallet:           config.GetConfig().FilecoinWallet,
+		DealSourceIds:          []int{libconstants.TASK_SOURCE_ID_SWAN_PAYMENT},
+		OutputDir:              filepath.Dir(carFile.CarFilePath),
+	}
+
+	_, fileDescs, err := cmdAutoBidDeal.SendAutoBidDealsByTaskUuid(carFile.TaskUuid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var deals []*Deal
+	for _, fileDesc := range fileDescs {
+		for _, deal := range fileDesc.Deals {
+			deals = append(deals, &Deal{
+				DealCid:    deal.DealCid,
+				MinerFid:   deal.MinerFid,
+				StartEpoch: deal.StartEpoch,
+			})
+		}
+	}
+
+	return deals, nil
+}
+
+// GetDealInfo queries the lotus node sending the deals, the same as the direct lotus deals
+func (c *SwanDealClient) GetDealInfo(ctx context.Context, dealCid string) (*DealInfo, error) {
+	return c.lotusDealClient.GetDealInfo(ctx, dealCid)
+}
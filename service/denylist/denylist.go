@@ -0,0 +1,222 @@
+package denylist
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"multi-chain-storage/common/cidutil"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+var ErrContentDenied = errors.New("content is denied by the content policy")
+
+// NormalizeCid converts a cid to the cid v1 in base32 of the same content, such as Qm... or zdj... to bafy..., so the
+// cids of the same content match, the strings not decoded as cids are returned as they are, lower cased if in base32
+func NormalizeCid(cid string) string {
+	cid = strings.TrimSpace(cid)
+	cidBytes, err := cidutil.Decode(cid)
+	if err != nil {
+		if strings.HasPrefix(cid, "b") {
+			return strings.ToLower(cid)
+		}
+		return cid
+	}
+
+	return cidutil.Encode(cidBytes)
+}
+
+// GetDoubleHash returns the hash of the cid in the compact denylist format, the sha256 of the cid v1 in base32
+// followed by a slash
+func GetDoubleHash(cid string) string {
+	hash := sha256.Sum256([]byte(NormalizeCid(cid) + "/"))
+	return hex.EncodeToString(hash[:])
+}
+
+// GetFileSha256 returns the sha256 in hex of the content of the file
+func GetFileSha256(filepath string) (string, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CheckContent fails by ErrContentDenied if the cid or the content hash is in the denylist, either can be empty, such as
+// the cid before the content is put
+func CheckContent(cid, contentSha256 string) error {
+	doubleHash := ""
+	if cid != "" {
+		doubleHash = GetDoubleHash(cid)
+	}
+
+	denylist, err := models.GetDenylistMatched(NormalizeCid(cid), doubleHash, strings.ToLower(contentSha256))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if denylist != nil {
+		err := fmt.Errorf("%w, cid:%s, sha256:%s, denylist:%d", ErrContentDenied, cid, contentSha256, denylist.ID)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// DenylistEntry is an entry of a denylist, its value normalized for its kind
+type DenylistEntry struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// NewDenylistEntry checks and normalizes the value of the kind
+func NewDenylistEntry(kind, value string) (*DenylistEntry, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case constants.DENYLIST_KIND_CID:
+		value = NormalizeCid(value)
+	case constants.DENYLIST_KIND_DOUBLE_HASH, constants.DENYLIST_KIND_SHA256:
+		value = strings.ToLower(value)
+		hash, err := hex.DecodeString(value)
+		if err != nil || len(hash) != sha256.Size {
+			err := fmt.Errorf("%s must be sha256 in hex, value:%s", kind, value)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	default:
+		err := fmt.Errorf("invalid denylist kind:%s", kind)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if value == "" {
+		err := errors.New("denylist value is required")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &DenylistEntry{Kind: kind, Value: value}, nil
+}
+
+// ParseDenylist parses a list in the compact denylist format, the header till the line --- if any, then one entry a
+// line: //<double hash>, /ipfs/<cid> or a bare cid, the rest of the line after the cid is ignored, such as a path.
+// Comments starting by #, allow rules starting by ! and unknown lines are skipped
+func ParseDenylist(reader io.Reader) ([]*DenylistEntry, error) {
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	for i, line := range lines {
+		if line == "---" {
+			lines = lines[i+1:]
+			break
+		}
+	}
+
+	var denylistEntries []*DenylistEntry
+	for _, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		kind := constants.DENYLIST_KIND_CID
+		value := line
+		if strings.HasPrefix(line, "//") {
+			kind = constants.DENYLIST_KIND_DOUBLE_HASH
+			value = strings.TrimPrefix(line, "//")
+		} else {
+			value = strings.TrimPrefix(value, "/ipfs/")
+			if strings.HasPrefix(value, "/") {
+				continue
+			}
+			value = strings.SplitN(value, "/", 2)[0]
+		}
+
+		denylistEntry, err := NewDenylistEntry(kind, strings.Fields(value + " ")[0])
+		if err != nil {
+			continue
+		}
+
+		denylistEntries = append(denylistEntries, denylistEntry)
+	}
+
+	return denylistEntries, nil
+}
+
+// ImportDenylist saves the entries of the list at the url, the entries imported from the url before but no longer in
+// the list are removed. It returns the count of the entries saved and removed, the download is cancelled once ctx is done
+func ImportDenylist(ctx context.Context, url string) (int, int64, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, 0, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err := fmt.Errorf("downloading denylist from %s failed, status:%s", url, response.Status)
+		logs.GetLogger().Error(err)
+		return 0, 0, err
+	}
+
+	denylistEntries, err := ParseDenylist(response.Body)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, 0, err
+	}
+
+	importAt := libutils.GetCurrentUtcSecond()
+	for _, denylistEntry := range denylistEntries {
+		err := models.SaveDenylist(denylistEntry.Kind, denylistEntry.Value, url, nil)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return 0, 0, err
+		}
+	}
+
+	removedCnt, err := models.DeleteDenylistsNotUpdatedSince(url, importAt)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, 0, err
+	}
+
+	logs.GetLogger().Info(len(denylistEntries), " denylist entries imported from ", url, ", ", removedCnt, " removed")
+	return len(denylistEntries), removedCnt, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/encryption"
+	"os"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+var ErrSourceFileUploadForbidden = errors.New("source file upload belongs to another wallet")
+
+// sourceFileEncryption is how a source file is encrypted, saved to its upload
+type sourceFileEncryption struct {
+	scheme            string
+	keyWrapScheme     string
+	wrappedKey        string
+	kmsKeyId          *string
+	plainFileSize     int64
+	encryptedFileSize int64
+}
+
+// getWalletKmsKeyId returns the kms key of the wallet, each wallet has its own key
+func getWalletKmsKeyId(wallet *models.Wallet) string {
+	return "wallet:" + strings.ToLower(wallet.Address)
+}
+
+// encryptSrcFile encrypts the source file by a new data key, which is wrapped to the encryption public key of the wallet
+// or by the kms key of the wallet, the plain source file is removed once encrypted
+func encryptSrcFile(wallet *models.Wallet, srcFilepath, filename, encryptionType, walletPublicKey string) (string, *sourceFileEncryption, error) {
+	defer os.Remove(srcFilepath)
+
+	dataKey, err := encryption.GenerateDataKey()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", nil, err
+	}
+
+	sourceFileEncryption := &sourceFileEncryption{
+		scheme: constants.ENCRYPTION_SCHEME_AES_256_GCM,
+	}
+
+	err = wrapDataKey(wallet, dataKey, encryptionType, walletPublicKey, sourceFileEncryption)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", nil, err
+	}
+
+	srcFileInfo, err := os.Stat(srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", nil, err
+	}
+	sourceFileEncryption.plainFileSize = srcFileInfo.Size()
+
+	encryptedFilepath, err := saveSrcFile(filename+".encrypted", func(encryptedFilepath string) error {
+		encryptedFileSize, err := encryption.EncryptFile(srcFilepath, encryptedFilepath, dataKey)
+		sourceFileEncryption.encryptedFileSize = encryptedFileSize
+		return err
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", nil, err
+	}
+
+	return encryptedFilepath, sourceFileEncryption, nil
+}
+
+func wrapDataKey(wallet *models.Wallet, dataKey []byte, encryptionType, walletPublicKey string, sourceFileEncryption *sourceFileEncryption) error {
+	switch encryptionType {
+	case constants.ENCRYPTION_TYPE_WALLET:
+		wrappedKey, err := encryption.WrapKeyToWallet(dataKey, walletPublicKey)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		sourceFileEncryption.keyWrapScheme = constants.KEY_WRAP_SCHEME_WALLET
+		sourceFileEncryption.wrappedKey = wrappedKey
+		return nil
+	case constants.ENCRYPTION_TYPE_KMS:
+		kms, err := encryption.GetKms()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		kmsKeyId := getWalletKmsKeyId(wallet)
+		wrappedKey, err := kms.Wrap(kmsKeyId, dataKey)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		sourceFileEncryption.keyWrapScheme = constants.KEY_WRAP_SCHEME_KMS
+		sourceFileEncryption.wrappedKey = wrappedKey
+		sourceFileEncryption.kmsKeyId = &kmsKeyId
+		return nil
+	default:
+		err := fmt.Errorf("invalid encryption:%s", encryptionType)
+		logs.GetLogger().Error(err)
+		return err
+	}
+}
+
+// UnlockSourceFileContent gets the data key of the encrypted content for the wallet owning it, or a member of the
+// organization owning it, the data key wrapped by the kms is unwrapped here, while the one wrapped to the wallet
+// uploading it has to be unwrapped by that wallet, by eth_decrypt
+func UnlockSourceFileContent(sourceFileContent *SourceFileContent, wallet *models.Wallet, dataKeyHex string) error {
+	sourceFileUpload := sourceFileContent.sourceFileUpload
+	err := checkSourceFileUploadRole(wallet, sourceFileUpload, constants.ORGANIZATION_ROLE_VIEWER)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if dataKeyHex != "" {
+		dataKey, err := encryption.ParseDataKey(dataKeyHex)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		sourceFileContent.dataKey = dataKey
+		return nil
+	}
+
+	if *sourceFileUpload.KeyWrapScheme != constants.KEY_WRAP_SCHEME_KMS {
+		err := fmt.Errorf("the data key wrapped to the wallet is required to decrypt source file upload:%d", sourceFileUpload.Id)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	kms, err := encryption.GetKms()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	dataKey, err := kms.Unwrap(*sourceFileUpload.KmsKeyId, *sourceFileUpload.WrappedKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	sourceFileContent.dataKey = dataKey
+	return nil
+}
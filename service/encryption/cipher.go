@@ -0,0 +1,280 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"multi-chain-storage/common/constants"
+	"os"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// The content is sealed by AES-256-GCM chunk by chunk, so a range can be decrypted without the chunks before it. Each
+// chunk of ENCRYPTION_CHUNK_SIZE bytes, the last one may be shorter or empty, is sealed with the chunk index as the
+// nonce, which is safe since each data key encrypts one file only, and whether it is the last chunk as the additional
+// data, so the content cannot be truncated at a chunk boundary unnoticed
+var ErrNotAuthentic = errors.New("encrypted content is not authentic, or the data key is wrong")
+
+const (
+	dataKeySize        = 32
+	chunkOverheadSize  = 16
+	encryptedChunkSize = constants.ENCRYPTION_CHUNK_SIZE + chunkOverheadSize
+)
+
+func GenerateDataKey() ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return dataKey, nil
+}
+
+func newAead(dataKey []byte) (cipher.AEAD, error) {
+	if len(dataKey) != dataKeySize {
+		err := errors.New("data key must be 32 bytes")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return aead, nil
+}
+
+func getChunkNonce(aead cipher.AEAD, chunkIndex int64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(chunkIndex))
+	return nonce
+}
+
+func getChunkAdditionalData(isLast bool) []byte {
+	if isLast {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func getChunkCnt(plainSize int64) int64 {
+	if plainSize == 0 {
+		return 1
+	}
+	return (plainSize + constants.ENCRYPTION_CHUNK_SIZE - 1) / constants.ENCRYPTION_CHUNK_SIZE
+}
+
+// GetEncryptedSize returns the size of the content of plainSize bytes once encrypted
+func GetEncryptedSize(plainSize int64) int64 {
+	return plainSize + getChunkCnt(plainSize)*chunkOverheadSize
+}
+
+// EncryptFile encrypts the file to the dst file by the data key, it returns the size of the encrypted file
+func EncryptFile(srcFilepath, dstFilepath string, dataKey []byte) (int64, error) {
+	aead, err := newAead(dataKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	srcFile, err := os.Open(srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+	defer srcFile.Close()
+
+	srcFileInfo, err := srcFile.Stat()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	dstFile, err := os.Create(dstFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+	defer dstFile.Close()
+
+	writer := bufio.NewWriter(dstFile)
+	chunkCnt := getChunkCnt(srcFileInfo.Size())
+	chunk := make([]byte, constants.ENCRYPTION_CHUNK_SIZE)
+	sealed := make([]byte, 0, encryptedChunkSize)
+	for chunkIndex := int64(0); chunkIndex < chunkCnt; chunkIndex++ {
+		n, err := io.ReadFull(srcFile, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+
+		isLast := chunkIndex == chunkCnt-1
+		if !isLast && n != constants.ENCRYPTION_CHUNK_SIZE {
+			err := errors.New("file changed while being encrypted")
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+
+		sealed = aead.Seal(sealed[:0], getChunkNonce(aead, chunkIndex), chunk[:n], getChunkAdditionalData(isLast))
+		_, err = writer.Write(sealed)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	err = dstFile.Close()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return GetEncryptedSize(srcFileInfo.Size()), nil
+}
+
+// GetEncryptedRange returns the range of the encrypted content to be read for length bytes of the plain content from
+// offset, or till the end if length is negative, which covers the whole chunks of the range. The encrypted length is
+// negative if the range is till the end of the encrypted content
+func GetEncryptedRange(plainSize, offset, length int64) (int64, int64) {
+	firstChunkIndex := offset / constants.ENCRYPTION_CHUNK_SIZE
+	encryptedOffset := firstChunkIndex * encryptedChunkSize
+
+	end := offset + length
+	if length < 0 || end >= plainSize {
+		return encryptedOffset, -1
+	}
+
+	lastChunkIndex := firstChunkIndex
+	if end > offset {
+		lastChunkIndex = (end - 1) / constants.ENCRYPTION_CHUNK_SIZE
+	}
+
+	if lastChunkIndex >= getChunkCnt(plainSize)-1 {
+		return encryptedOffset, -1
+	}
+
+	return encryptedOffset, (lastChunkIndex - firstChunkIndex + 1) * encryptedChunkSize
+}
+
+// decryptReader decrypts the chunks read from the range of the encrypted content from GetEncryptedRange
+type decryptReader struct {
+	encrypted  io.ReadCloser
+	aead       cipher.AEAD
+	chunkIndex int64
+	chunkCnt   int64
+	skip       int64
+	remaining  int64
+	sealed     []byte
+	plain      []byte
+}
+
+// DecryptRange returns length bytes of the plain content from offset, or till the end if length is negative, decrypted
+// from the encrypted range of GetEncryptedRange read by encrypted. Reading fails by ErrNotAuthentic if any chunk is not
+// authentic
+func DecryptRange(encrypted io.ReadCloser, dataKey []byte, plainSize, offset, length int64) (io.ReadCloser, error) {
+	aead, err := newAead(dataKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if length < 0 || offset+length > plainSize {
+		length = plainSize - offset
+	}
+
+	firstChunkIndex := offset / constants.ENCRYPTION_CHUNK_SIZE
+	decryptReader := &decryptReader{
+		encrypted:  encrypted,
+		aead:       aead,
+		chunkIndex: firstChunkIndex,
+		chunkCnt:   getChunkCnt(plainSize),
+		skip:       offset - firstChunkIndex*constants.ENCRYPTION_CHUNK_SIZE,
+		remaining:  length,
+		sealed:     make([]byte, encryptedChunkSize),
+	}
+
+	// the first chunk is decrypted at once, so a wrong data key fails here rather than in the middle of reading
+	if length > 0 {
+		err := decryptReader.decryptChunk()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	return decryptReader, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	for len(r.plain) == 0 {
+		err := r.decryptChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	if int64(n) > r.remaining {
+		n = int(r.remaining)
+	}
+	r.plain = r.plain[n:]
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+func (r *decryptReader) decryptChunk() error {
+	if r.chunkIndex >= r.chunkCnt {
+		return io.ErrUnexpectedEOF
+	}
+
+	isLast := r.chunkIndex == r.chunkCnt-1
+	n, err := io.ReadFull(r.encrypted, r.sealed)
+	if err != nil && !(isLast && err == io.ErrUnexpectedEOF) {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	plain, err := r.aead.Open(r.sealed[:0], getChunkNonce(r.aead, r.chunkIndex), r.sealed[:n], getChunkAdditionalData(isLast))
+	if err != nil {
+		return ErrNotAuthentic
+	}
+
+	r.chunkIndex++
+	if r.skip > int64(len(plain)) {
+		return errors.New("encrypted content is shorter than expected")
+	}
+	r.plain = plain[r.skip:]
+	r.skip = 0
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.encrypted.Close()
+}
@@ -0,0 +1,198 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"multi-chain-storage/common/constants"
+	"path/filepath"
+	"testing"
+)
+
+func encryptTestContent(t *testing.T, plain []byte, dataKey []byte) []byte {
+	dir := t.TempDir()
+	srcFilepath := filepath.Join(dir, "plain")
+	dstFilepath := filepath.Join(dir, "encrypted")
+
+	err := ioutil.WriteFile(srcFilepath, plain, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedSize, err := EncryptFile(srcFilepath, dstFilepath, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := ioutil.ReadFile(dstFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(len(encrypted)) != encryptedSize || encryptedSize != GetEncryptedSize(int64(len(plain))) {
+		t.Fatalf("encrypted size:%d, returned:%d, expected:%d", len(encrypted), encryptedSize, GetEncryptedSize(int64(len(plain))))
+	}
+
+	return encrypted
+}
+
+// decryptTestRange decrypts the range as the retrieval does, reading only the encrypted range of GetEncryptedRange
+func decryptTestRange(encrypted []byte, dataKey []byte, plainSize, offset, length int64) ([]byte, error) {
+	encryptedOffset, encryptedLength := GetEncryptedRange(plainSize, offset, length)
+	encryptedEnd := int64(len(encrypted))
+	if encryptedLength >= 0 && encryptedOffset+encryptedLength < encryptedEnd {
+		encryptedEnd = encryptedOffset + encryptedLength
+	}
+	if encryptedOffset > encryptedEnd {
+		encryptedOffset = encryptedEnd
+	}
+
+	reader, err := DecryptRange(ioutil.NopCloser(bytes.NewReader(encrypted[encryptedOffset:encryptedEnd])), dataKey, plainSize, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	chunkSize := int64(constants.ENCRYPTION_CHUNK_SIZE)
+	tests := []struct {
+		name      string
+		plainSize int64
+		offset    int64
+		length    int64
+	}{
+		{name: "empty", plainSize: 0, offset: 0, length: -1},
+		{name: "one byte", plainSize: 1, offset: 0, length: -1},
+		{name: "one chunk", plainSize: chunkSize, offset: 0, length: -1},
+		{name: "one chunk and one byte", plainSize: chunkSize + 1, offset: 0, length: -1},
+		{name: "first byte", plainSize: 3*chunkSize + 5, offset: 0, length: 1},
+		{name: "within a chunk", plainSize: 3*chunkSize + 5, offset: chunkSize + 10, length: 100},
+		{name: "across chunks", plainSize: 3*chunkSize + 5, offset: chunkSize - 10, length: chunkSize + 20},
+		{name: "last chunk", plainSize: 3*chunkSize + 5, offset: 3 * chunkSize, length: 5},
+		{name: "till the end", plainSize: 3*chunkSize + 5, offset: chunkSize + 1, length: -1},
+		{name: "beyond the end", plainSize: 3*chunkSize + 5, offset: 3*chunkSize + 1, length: 100},
+	}
+
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := make([]byte, test.plainSize)
+			rand.Read(plain)
+			encrypted := encryptTestContent(t, plain, dataKey)
+
+			decrypted, err := decryptTestRange(encrypted, dataKey, test.plainSize, test.offset, test.length)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			end := test.offset + test.length
+			if test.length < 0 || end > test.plainSize {
+				end = test.plainSize
+			}
+
+			if !bytes.Equal(decrypted, plain[test.offset:end]) {
+				t.Errorf("%d bytes decrypted not matching the %d bytes from offset:%d", len(decrypted), end-test.offset, test.offset)
+			}
+		})
+	}
+}
+
+func TestEncryptionNotAuthentic(t *testing.T) {
+	chunkSize := int64(constants.ENCRYPTION_CHUNK_SIZE)
+	encryptedChunkSize := int64(encryptedChunkSize)
+	plainSize := 2*chunkSize + 5
+
+	tests := []struct {
+		name      string
+		plainSize int64 // the size the content is decrypted by
+		alter     func(encrypted []byte) []byte
+		wrongKey  bool
+		wantError error
+	}{
+		{
+			name:      "last chunk dropped",
+			plainSize: plainSize,
+			alter:     func(encrypted []byte) []byte { return encrypted[:2*encryptedChunkSize] },
+			wantError: io.ErrUnexpectedEOF,
+		},
+		{
+			name:      "last chunk dropped with the size",
+			plainSize: 2 * chunkSize,
+			alter:     func(encrypted []byte) []byte { return encrypted[:2*encryptedChunkSize] },
+			wantError: ErrNotAuthentic,
+		},
+		{
+			name:      "truncated in the middle of a chunk",
+			plainSize: plainSize,
+			alter:     func(encrypted []byte) []byte { return encrypted[:encryptedChunkSize+100] },
+			wantError: io.ErrUnexpectedEOF,
+		},
+		{
+			name:      "truncated in the middle of the last chunk",
+			plainSize: plainSize,
+			alter:     func(encrypted []byte) []byte { return encrypted[:len(encrypted)-1] },
+			wantError: ErrNotAuthentic,
+		},
+		{
+			name:      "byte flipped",
+			plainSize: plainSize,
+			alter: func(encrypted []byte) []byte {
+				encrypted[chunkSize+10] ^= 1
+				return encrypted
+			},
+			wantError: ErrNotAuthentic,
+		},
+		{
+			name:      "chunks swapped",
+			plainSize: plainSize,
+			alter: func(encrypted []byte) []byte {
+				swapped := append([]byte{}, encrypted[encryptedChunkSize:2*encryptedChunkSize]...)
+				swapped = append(swapped, encrypted[:encryptedChunkSize]...)
+				return append(swapped, encrypted[2*encryptedChunkSize:]...)
+			},
+			wantError: ErrNotAuthentic,
+		},
+		{
+			name:      "data key wrong",
+			plainSize: plainSize,
+			alter:     func(encrypted []byte) []byte { return encrypted },
+			wrongKey:  true,
+			wantError: ErrNotAuthentic,
+		},
+	}
+
+	dataKey, err := GenerateDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plain := make([]byte, plainSize)
+			rand.Read(plain)
+			encrypted := test.alter(encryptTestContent(t, plain, dataKey))
+
+			decryptKey := dataKey
+			if test.wrongKey {
+				decryptKey, err = GenerateDataKey()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := decryptTestRange(encrypted, decryptKey, test.plainSize, 0, -1)
+			if !errors.Is(err, test.wantError) {
+				t.Errorf("error:%v, want:%v", err, test.wantError)
+			}
+		})
+	}
+}
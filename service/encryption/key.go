@@ -0,0 +1,205 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// walletWrappedKey is the format of eth_decrypt of metamask, the data key is sealed as a hex string
+type walletWrappedKey struct {
+	Version        string `json:"version"`
+	Nonce          string `json:"nonce"`
+	EphemPublicKey string `json:"ephemPublicKey"`
+	Ciphertext     string `json:"ciphertext"`
+}
+
+// WrapKeyToWallet seals the data key to the encryption public key of the wallet, the base64 result of
+// eth_getEncryptionPublicKey, only the wallet can unwrap it by eth_decrypt
+func WrapKeyToWallet(dataKey []byte, walletPublicKey string) (string, error) {
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(walletPublicKey)
+	if err != nil || len(publicKeyBytes) != 32 {
+		err := fmt.Errorf("invalid wallet encryption public key:%s", walletPublicKey)
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	var publicKey [32]byte
+	copy(publicKey[:], publicKeyBytes)
+
+	ephemPublicKey, ephemPrivateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	var nonce [24]byte
+	_, err = rand.Read(nonce[:])
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	ciphertext := box.Seal(nil, []byte(hex.EncodeToString(dataKey)), &nonce, &publicKey, ephemPrivateKey)
+	wrappedKey, err := json.Marshal(walletWrappedKey{
+		Version:        constants.KEY_WRAP_SCHEME_WALLET,
+		Nonce:          base64.StdEncoding.EncodeToString(nonce[:]),
+		EphemPublicKey: base64.StdEncoding.EncodeToString(ephemPublicKey[:]),
+		Ciphertext:     base64.StdEncoding.EncodeToString(ciphertext),
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return string(wrappedKey), nil
+}
+
+// ParseDataKey parses the data key unwrapped by the wallet, as a hex string
+func ParseDataKey(dataKeyHex string) ([]byte, error) {
+	dataKey, err := hex.DecodeString(dataKeyHex)
+	if err != nil || len(dataKey) != dataKeySize {
+		err := errors.New("data key must be 32 bytes in hex")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return dataKey, nil
+}
+
+// Kms wraps the data keys by the key of the key id, which never leaves the kms
+type Kms interface {
+	Wrap(keyId string, dataKey []byte) (string, error)
+	Unwrap(keyId, wrappedKey string) ([]byte, error)
+}
+
+var kms Kms
+var kmsOnce sync.Once
+var kmsErr error
+
+func GetKms() (Kms, error) {
+	kmsOnce.Do(func() {
+		if kms != nil {
+			return
+		}
+
+		kms, kmsErr = newKms(config.GetConfig().Encryption.KmsType)
+	})
+
+	if kmsErr != nil {
+		logs.GetLogger().Error(kmsErr)
+		return nil, kmsErr
+	}
+
+	return kms, nil
+}
+
+// SetKms replaces the kms in config, such as with a remote one
+func SetKms(k Kms) {
+	kmsOnce.Do(func() {})
+	kms = k
+	kmsErr = nil
+}
+
+func newKms(kmsType string) (Kms, error) {
+	switch kmsType {
+	case constants.KMS_TYPE_LOCAL:
+		return NewLocalKms(config.GetConfig().Encryption.KmsMasterKey)
+	default:
+		err := fmt.Errorf("invalid kms type:%s", kmsType)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+}
+
+// LocalKms derives a key per key id from the master key in [encryption].kms_master_key, which wraps the data keys by
+// AES-256-GCM with the key id as the additional data
+type LocalKms struct {
+	masterKey []byte
+}
+
+func NewLocalKms(masterKeyHex string) (*LocalKms, error) {
+	masterKey, err := hex.DecodeString(masterKeyHex)
+	if err != nil || len(masterKey) != 32 {
+		err := errors.New("[encryption].kms_master_key must be 32 bytes in hex")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &LocalKms{masterKey: masterKey}, nil
+}
+
+func (k *LocalKms) getAead(keyId string) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, k.masterKey)
+	mac.Write([]byte(keyId))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return aead, nil
+}
+
+func (k *LocalKms) Wrap(keyId string, dataKey []byte) (string, error) {
+	aead, err := k.getAead(keyId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	wrappedKey := aead.Seal(nonce, nonce, dataKey, []byte(keyId))
+	return base64.StdEncoding.EncodeToString(wrappedKey), nil
+}
+
+func (k *LocalKms) Unwrap(keyId, wrappedKey string) ([]byte, error) {
+	aead, err := k.getAead(keyId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	wrappedKeyBytes, err := base64.StdEncoding.DecodeString(wrappedKey)
+	if err != nil || len(wrappedKeyBytes) < aead.NonceSize() {
+		err := errors.New("invalid wrapped key")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	dataKey, err := aead.Open(nil, wrappedKeyBytes[:nonceSize], wrappedKeyBytes[nonceSize:], []byte(keyId))
+	if err != nil {
+		err := fmt.Errorf("data key not unwrapped by key:%s", keyId)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return dataKey, nil
+}
@@ -0,0 +1,156 @@
+package hotstorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"multi-chain-storage/common/cidutil"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// ErrObjectNotFound is returned when the hot storage does not have the content of the cid
+var ErrObjectNotFound = errors.New("object not found")
+
+type Object struct {
+	Cid    string `json:"cid"`
+	Size   int64  `json:"size"` // 0 if unknown
+	Pinned bool   `json:"pinned"`
+}
+
+// HotStorage keeps the content retrievable before and while it is stored on filecoin, the calls to a remote storage
+// are cancelled once ctx is done
+type HotStorage interface {
+	// Put stores the content of the file and pins it, it returns the cid of the content
+	Put(ctx context.Context, filepath string) (string, error)
+	// Get returns the content of the cid, the caller should close it
+	Get(ctx context.Context, cid string) (io.ReadCloser, error)
+	// GetRange returns length bytes of the content of the cid from offset, or till the end if length is negative,
+	// the caller should close it
+	GetRange(ctx context.Context, cid string, offset, length int64) (io.ReadCloser, error)
+	Pin(ctx context.Context, cid string) error
+	// Unpin releases the content of the cid, it is not an error if the cid is not pinned
+	Unpin(ctx context.Context, cid string) error
+	Stat(ctx context.Context, cid string) (*Object, error)
+	// List returns the objects pinned
+	List(ctx context.Context) ([]*Object, error)
+	// GetUrl returns the url the content of the cid is downloaded from
+	GetUrl(cid string) string
+}
+
+var hotStorage HotStorage
+var hotStorageOnce sync.Once
+var hotStorageErr error
+
+func GetHotStorage() (HotStorage, error) {
+	hotStorageOnce.Do(func() {
+		if hotStorage != nil {
+			return
+		}
+
+		hotStorage, hotStorageErr = newHotStorage(config.GetConfig().HotStorage.Type)
+	})
+
+	if hotStorageErr != nil {
+		logs.GetLogger().Error(hotStorageErr)
+		return nil, hotStorageErr
+	}
+
+	return hotStorage, nil
+}
+
+// SetHotStorage replaces the hot storage in config, such as with a memory one when no network is available
+func SetHotStorage(storage HotStorage) {
+	hotStorageOnce.Do(func() {})
+	hotStorage = storage
+	hotStorageErr = nil
+}
+
+func newHotStorage(hotStorageType string) (HotStorage, error) {
+	downloadUrlPrefix := config.GetConfig().HotStorage.DownloadUrlPrefix
+
+	switch hotStorageType {
+	case constants.HOT_STORAGE_TYPE_IPFS:
+		return NewIpfsHotStorage(config.GetConfig().IpfsServer.UploadUrlPrefix, downloadUrlPrefix), nil
+	case constants.HOT_STORAGE_TYPE_IPFS_CLUSTER:
+		return NewIpfsClusterHotStorage(config.GetConfig().HotStorage.ClusterApiUrl, config.GetConfig().HotStorage.ClusterAccessToken, downloadUrlPrefix), nil
+	case constants.HOT_STORAGE_TYPE_LOCAL:
+		return NewLocalHotStorage(config.GetConfig().HotStorage.LocalDir, downloadUrlPrefix)
+	case constants.HOT_STORAGE_TYPE_MEMORY:
+		return NewMemoryHotStorage(downloadUrlPrefix), nil
+	default:
+		err := fmt.Errorf("invalid hot storage type:%s", hotStorageType)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+}
+
+// getIpfsUrl returns the url of the cid under the gateway, in the form of ipfs gateways
+func getIpfsUrl(downloadUrlPrefix, cid string) string {
+	return libutils.UrlJoin(downloadUrlPrefix, constants.IPFS_URL_PREFIX_BEFORE_HASH, cid)
+}
+
+// GetCidFromUrl returns the cid in the url returned by GetUrl, which is the last part of its path
+func GetCidFromUrl(url string) string {
+	url = strings.TrimRight(url, "/")
+	return url[strings.LastIndex(url, "/")+1:]
+}
+
+// getRawCid returns the cid v1 of the content as a single raw block hashed by sha2-256,
+// it differs from the cid given by ipfs for the content chunked into several blocks there
+func getRawCid(digest []byte) string {
+	multihash := append([]byte{cidutil.MULTIHASH_SHA2_256, cidutil.MULTIHASH_SHA2_256_SIZE}, digest...)
+	return cidutil.Encode(cidutil.NewV1(cidutil.CODEC_RAW, multihash))
+}
+
+func getFileRawCid(filepath string) (string, int64, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", 0, err
+	}
+
+	return getRawCid(hash.Sum(nil)), size, nil
+}
+
+// rangeReadCloser reads a range of the content, and closes the whole content read from
+type rangeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// newRangeReadCloser skips the content read before offset and limits it to length bytes if length is not negative
+func newRangeReadCloser(content io.ReadCloser, offset, length int64) (io.ReadCloser, error) {
+	if offset > 0 {
+		_, err := io.CopyN(ioutil.Discard, content, offset)
+		if err != nil {
+			content.Close()
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	var reader io.Reader = content
+	if length >= 0 {
+		reader = io.LimitReader(content, length)
+	}
+
+	return &rangeReadCloser{Reader: reader, Closer: content}, nil
+}
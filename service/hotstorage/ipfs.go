@@ -0,0 +1,298 @@
+package hotstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"multi-chain-storage/common/constants"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// IpfsHotStorage stores the content on an ipfs kubo node by its rpc api
+type IpfsHotStorage struct {
+	apiUrl            string
+	downloadUrlPrefix string
+	apiClient         *http.Client // for the calls answered in json, limited as a whole
+	pinClient         *http.Client // for pinning, which may fetch the content from the network
+	addClient         *http.Client // for adding the content, limited by the context of the caller only
+	contentClient     *http.Client // for the calls reading the content, only the wait for the response is limited
+}
+
+func NewIpfsHotStorage(apiUrl, downloadUrlPrefix string) *IpfsHotStorage {
+	// kubo answers the calls other than reading the content after they are done, so only the latter wait for the
+	// response with a limit of their own
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	contentTransport := http.DefaultTransport.(*http.Transport).Clone()
+	contentTransport.ResponseHeaderTimeout = constants.IPFS_API_RESPONSE_HEADER_TIMEOUT_SECOND * time.Second
+
+	return &IpfsHotStorage{
+		apiUrl:            apiUrl,
+		downloadUrlPrefix: downloadUrlPrefix,
+		apiClient: &http.Client{
+			Transport: transport,
+			Timeout:   constants.IPFS_API_TIMEOUT_SECOND * time.Second,
+		},
+		pinClient: &http.Client{
+			Transport: transport,
+			Timeout:   constants.IPFS_API_PIN_TIMEOUT_SECOND * time.Second,
+		},
+		addClient: &http.Client{
+			Transport: transport,
+		},
+		contentClient: &http.Client{
+			Transport: contentTransport,
+		},
+	}
+}
+
+// ipfsError is the error returned by the rpc api of kubo
+type ipfsError struct {
+	Message string `json:"Message"`
+	Code    int    `json:"Code"`
+}
+
+func (e *ipfsError) Error() string {
+	return e.Message
+}
+
+// isIpfsNotFound checks whether kubo failed since it does not have the content, such as
+// "block was not found locally (offline): ipld: could not find <cid>"
+func isIpfsNotFound(err error) bool {
+	var ipfsErr *ipfsError
+	if !errors.As(err, &ipfsErr) {
+		return false
+	}
+
+	return strings.Contains(ipfsErr.Message, "not found") || strings.Contains(ipfsErr.Message, "could not find")
+}
+
+// call posts to the rpc api of the command by the client, the caller should close the response body returned
+func (s *IpfsHotStorage) call(ctx context.Context, client *http.Client, command string, args url.Values) (io.ReadCloser, error) {
+	return s.callWithBody(ctx, client, command, args, "", nil)
+}
+
+func (s *IpfsHotStorage) callWithBody(ctx context.Context, client *http.Client, command string, args url.Values, contentType string, requestBody io.Reader) (io.ReadCloser, error) {
+	apiUrl := libutils.UrlJoin(s.apiUrl, "api/v0", command) + "?" + args.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, apiUrl, requestBody)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+
+		ipfsErr := &ipfsError{}
+		if json.Unmarshal(body, ipfsErr) == nil && ipfsErr.Message != "" {
+			err = fmt.Errorf("ipfs %s failed, %w", command, ipfsErr)
+		} else {
+			err = fmt.Errorf("ipfs %s failed, status:%s", command, response.Status)
+		}
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+func (s *IpfsHotStorage) callJson(ctx context.Context, client *http.Client, command string, args url.Values, result interface{}) error {
+	body, err := s.call(ctx, client, command, args)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	defer body.Close()
+
+	err = json.NewDecoder(body).Decode(result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *IpfsHotStorage) Put(ctx context.Context, srcFilepath string) (string, error) {
+	file, err := os.Open(srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	bodyReader, bodyWriter := io.Pipe()
+	multipartWriter := multipart.NewWriter(bodyWriter)
+	go func() {
+		part, err := multipartWriter.CreateFormFile("file", filepath.Base(srcFilepath))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = multipartWriter.Close()
+		}
+		bodyWriter.CloseWithError(err)
+	}()
+
+	args := url.Values{"stream-channels": {"true"}, "pin": {"true"}}
+	body, err := s.callWithBody(ctx, s.addClient, "add", args, multipartWriter.FormDataContentType(), bodyReader)
+	if err != nil {
+		bodyReader.Close()
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer body.Close()
+
+	// one object for each file added, the file is the last
+	var added struct {
+		Hash string `json:"Hash"`
+	}
+	decoder := json.NewDecoder(body)
+	for decoder.More() {
+		err := decoder.Decode(&added)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+	}
+
+	if added.Hash == "" {
+		err := fmt.Errorf("no cid returned when adding %s to ipfs", srcFilepath)
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return added.Hash, nil
+}
+
+func (s *IpfsHotStorage) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+	body, err := s.call(ctx, s.contentClient, "cat", url.Values{"arg": {cid}})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func (s *IpfsHotStorage) GetRange(ctx context.Context, cid string, offset, length int64) (io.ReadCloser, error) {
+	args := url.Values{"arg": {cid}, "offset": {strconv.FormatInt(offset, 10)}}
+	if length >= 0 {
+		args.Set("length", strconv.FormatInt(length, 10))
+	}
+
+	body, err := s.call(ctx, s.contentClient, "cat", args)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func (s *IpfsHotStorage) Pin(ctx context.Context, cid string) error {
+	var result interface{}
+	err := s.callJson(ctx, s.pinClient, "pin/add", url.Values{"arg": {cid}}, &result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *IpfsHotStorage) Unpin(ctx context.Context, cid string) error {
+	var result interface{}
+	err := s.callJson(ctx, s.apiClient, "pin/rm", url.Values{"arg": {cid}}, &result)
+	if err != nil {
+		if strings.Contains(err.Error(), "not pinned") {
+			return nil
+		}
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *IpfsHotStorage) Stat(ctx context.Context, cid string) (*Object, error) {
+	var fileStat struct {
+		Hash           string `json:"Hash"`
+		CumulativeSize int64  `json:"CumulativeSize"`
+	}
+	// offline, so the content not on the node is not searched for on the network
+	err := s.callJson(ctx, s.apiClient, "files/stat", url.Values{"arg": {"/ipfs/" + cid}, "offline": {"true"}}, &fileStat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		if isIpfsNotFound(err) {
+			return nil, fmt.Errorf("%w, cid:%s, %s", ErrObjectNotFound, cid, err.Error())
+		}
+		return nil, err
+	}
+
+	object := &Object{
+		Cid:  cid,
+		Size: fileStat.CumulativeSize,
+	}
+
+	var pins interface{}
+	err = s.callJson(ctx, s.apiClient, "pin/ls", url.Values{"arg": {cid}, "type": {"recursive"}}, &pins)
+	if err == nil {
+		object.Pinned = true
+	} else if !strings.Contains(err.Error(), "not pinned") {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func (s *IpfsHotStorage) List(ctx context.Context) ([]*Object, error) {
+	var pins struct {
+		Keys map[string]struct {
+			Type string `json:"Type"`
+		} `json:"Keys"`
+	}
+	err := s.callJson(ctx, s.apiClient, "pin/ls", url.Values{"type": {"recursive"}}, &pins)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var objects []*Object
+	for cid := range pins.Keys {
+		objects = append(objects, &Object{
+			Cid:    cid,
+			Pinned: true,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *IpfsHotStorage) GetUrl(cid string) string {
+	return getIpfsUrl(s.downloadUrlPrefix, cid)
+}
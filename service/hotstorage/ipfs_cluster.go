@@ -0,0 +1,342 @@
+package hotstorage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// IpfsClusterHotStorage pins the content on an ipfs cluster by its rest api, the content is got from the gateway
+type IpfsClusterHotStorage struct {
+	apiUrl            string
+	accessToken       string
+	downloadUrlPrefix string
+}
+
+func NewIpfsClusterHotStorage(apiUrl, accessToken, downloadUrlPrefix string) *IpfsClusterHotStorage {
+	return &IpfsClusterHotStorage{
+		apiUrl:            apiUrl,
+		accessToken:       accessToken,
+		downloadUrlPrefix: downloadUrlPrefix,
+	}
+}
+
+// clusterCid is a cid in the responses, which is a string in cluster v1 and {"/":cid} before
+type clusterCid string
+
+func (c *clusterCid) UnmarshalJSON(data []byte) error {
+	var cid string
+	if json.Unmarshal(data, &cid) == nil {
+		*c = clusterCid(cid)
+		return nil
+	}
+
+	var cidLink struct {
+		Cid string `json:"/"`
+	}
+	err := json.Unmarshal(data, &cidLink)
+	if err != nil {
+		return err
+	}
+
+	*c = clusterCid(cidLink.Cid)
+	return nil
+}
+
+type clusterAdded struct {
+	Cid clusterCid `json:"cid"`
+}
+
+type clusterPinInfo struct {
+	Cid     clusterCid `json:"cid"`
+	PeerMap map[string]struct {
+		Status string `json:"status"`
+	} `json:"peer_map"`
+}
+
+func (s *IpfsClusterHotStorage) request(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, libutils.UrlJoin(s.apiUrl, path), body)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if s.accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+s.accessToken)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, fmt.Errorf("%w, %s %s", ErrObjectNotFound, method, path)
+	}
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		defer response.Body.Close()
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		err := fmt.Errorf("ipfs cluster %s %s failed, status:%s, %s", method, path, response.Status, string(responseBody))
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// readJsons decodes the response body, which is a json array, or json objects one by one in streaming apis of cluster v1
+func readJsons(body io.Reader, newItem func() interface{}) error {
+	reader := bufio.NewReader(body)
+	firstByte, err := reader.Peek(1)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if firstByte[0] == '[' {
+		var items []json.RawMessage
+		err := json.NewDecoder(reader).Decode(&items)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			err := json.Unmarshal(item, newItem())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	decoder := json.NewDecoder(reader)
+	for decoder.More() {
+		err := decoder.Decode(newItem())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *IpfsClusterHotStorage) Put(ctx context.Context, srcFilepath string) (string, error) {
+	file, err := os.Open(srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	bodyReader, bodyWriter := io.Pipe()
+	multipartWriter := multipart.NewWriter(bodyWriter)
+	go func() {
+		part, err := multipartWriter.CreateFormFile("file", filepath.Base(srcFilepath))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = multipartWriter.Close()
+		}
+		bodyWriter.CloseWithError(err)
+	}()
+
+	response, err := s.request(ctx, http.MethodPost, "add?local=false&stream-channels=false", multipartWriter.FormDataContentType(), bodyReader)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer response.Body.Close()
+
+	var addeds []*clusterAdded
+	err = readJsons(response.Body, func() interface{} {
+		added := &clusterAdded{}
+		addeds = append(addeds, added)
+		return added
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	if len(addeds) == 0 {
+		err := fmt.Errorf("no cid returned when adding %s to ipfs cluster", srcFilepath)
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return string(addeds[len(addeds)-1].Cid), nil
+}
+
+func (s *IpfsClusterHotStorage) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.GetUrl(cid), nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		err := fmt.Errorf("%w, cid:%s, status:%s", ErrObjectNotFound, cid, response.Status)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// GetRange asks the gateway for the range, the content is skipped and limited here if the gateway ignores the range
+func (s *IpfsClusterHotStorage) GetRange(ctx context.Context, cid string, offset, length int64) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.GetUrl(cid), nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if length >= 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		return response.Body, nil
+	case http.StatusOK:
+		return newRangeReadCloser(response.Body, offset, length)
+	default:
+		response.Body.Close()
+		err := fmt.Errorf("%w, cid:%s, status:%s", ErrObjectNotFound, cid, response.Status)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+}
+
+func (s *IpfsClusterHotStorage) Pin(ctx context.Context, cid string) error {
+	response, err := s.request(ctx, http.MethodPost, "pins/"+cid, "", nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (s *IpfsClusterHotStorage) Unpin(ctx context.Context, cid string) error {
+	response, err := s.request(ctx, http.MethodDelete, "pins/"+cid, "", nil)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil
+		}
+		logs.GetLogger().Error(err)
+		return err
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (s *IpfsClusterHotStorage) Stat(ctx context.Context, cid string) (*Object, error) {
+	response, err := s.request(ctx, http.MethodGet, "pins/"+cid, "", nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var pinInfo clusterPinInfo
+	err = json.NewDecoder(response.Body).Decode(&pinInfo)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	object := &Object{
+		Cid: cid,
+	}
+	for _, peerPinInfo := range pinInfo.PeerMap {
+		if peerPinInfo.Status == "pinned" {
+			object.Pinned = true
+		}
+	}
+
+	headRequest, err := http.NewRequestWithContext(ctx, http.MethodHead, s.GetUrl(cid), nil)
+	if err == nil {
+		headResponse, err := http.DefaultClient.Do(headRequest)
+		if err == nil {
+			headResponse.Body.Close()
+			if headResponse.ContentLength > 0 {
+				object.Size = headResponse.ContentLength
+			}
+		}
+	}
+
+	return object, nil
+}
+
+func (s *IpfsClusterHotStorage) List(ctx context.Context) ([]*Object, error) {
+	response, err := s.request(ctx, http.MethodGet, "allocations?filter=pin", "", nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var pins []*clusterPinInfo
+	err = readJsons(response.Body, func() interface{} {
+		pin := &clusterPinInfo{}
+		pins = append(pins, pin)
+		return pin
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var objects []*Object
+	for _, pin := range pins {
+		objects = append(objects, &Object{
+			Cid:    string(pin.Cid),
+			Pinned: true,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *IpfsClusterHotStorage) GetUrl(cid string) string {
+	return getIpfsUrl(s.downloadUrlPrefix, cid)
+}
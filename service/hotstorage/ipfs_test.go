@@ -0,0 +1,80 @@
+package hotstorage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIpfsStat(t *testing.T) {
+	tests := []struct {
+		name       string
+		statStatus int
+		statBody   string
+		notFound   bool
+		failed     bool
+		pinned     bool
+	}{
+		{
+			name:       "pinned",
+			statStatus: http.StatusOK,
+			statBody:   `{"Hash":"cid","CumulativeSize":100}`,
+			pinned:     true,
+		},
+		{
+			name:       "not found on the node",
+			statStatus: http.StatusInternalServerError,
+			statBody:   `{"Message":"block was not found locally (offline): ipld: could not find cid","Code":0,"Type":"error"}`,
+			notFound:   true,
+			failed:     true,
+		},
+		{
+			name:       "node failed",
+			statStatus: http.StatusInternalServerError,
+			statBody:   `{"Message":"context deadline exceeded","Code":0,"Type":"error"}`,
+			failed:     true,
+		},
+		{
+			name:       "node unavailable",
+			statStatus: http.StatusBadGateway,
+			statBody:   "bad gateway",
+			failed:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v0/files/stat":
+					if r.URL.Query().Get("offline") != "true" {
+						t.Errorf("files/stat not offline")
+					}
+					w.WriteHeader(test.statStatus)
+					w.Write([]byte(test.statBody))
+				case "/api/v0/pin/ls":
+					w.Write([]byte(`{"Keys":{"cid":{"Type":"recursive"}}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			hotStorage := NewIpfsHotStorage(server.URL, server.URL)
+			object, err := hotStorage.Stat(context.Background(), "cid")
+			if errors.Is(err, ErrObjectNotFound) != test.notFound {
+				t.Fatalf("error:%v, not found expected:%t", err, test.notFound)
+			}
+
+			if (err != nil) != test.failed {
+				t.Fatalf("error:%v, failure expected:%t", err, test.failed)
+			}
+
+			if err == nil && (object.Size != 100 || object.Pinned != test.pinned) {
+				t.Errorf("object:%+v", object)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package hotstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// LocalHotStorage keeps the content in files named by their cid under a directory, every file kept is pinned,
+// the cid is the raw cid of the whole content, see getRawCid
+type LocalHotStorage struct {
+	dir               string
+	downloadUrlPrefix string
+}
+
+func NewLocalHotStorage(dir, downloadUrlPrefix string) (*LocalHotStorage, error) {
+	if dir == "" {
+		err := fmt.Errorf("local_dir is required by local hot storage")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err := libutils.CreateDir(dir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	storage := &LocalHotStorage{
+		dir:               dir,
+		downloadUrlPrefix: downloadUrlPrefix,
+	}
+
+	return storage, nil
+}
+
+func (s *LocalHotStorage) getPath(cid string) string {
+	return filepath.Join(s.dir, filepath.Base(cid))
+}
+
+func (s *LocalHotStorage) Put(ctx context.Context, srcFilepath string) (string, error) {
+	cid, _, err := getFileRawCid(srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	if libutils.IsFileExistsFullPath(s.getPath(cid)) {
+		return cid, nil
+	}
+
+	tempFilepath := s.getPath(cid) + ".tmp"
+	_, err = libutils.CopyFile(srcFilepath, tempFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.Remove(tempFilepath)
+		return "", err
+	}
+
+	err = os.Rename(tempFilepath, s.getPath(cid))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.Remove(tempFilepath)
+		return "", err
+	}
+
+	return cid, nil
+}
+
+func (s *LocalHotStorage) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+	file, err := os.Open(s.getPath(cid))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w, cid:%s", ErrObjectNotFound, cid)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (s *LocalHotStorage) GetRange(ctx context.Context, cid string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(s.getPath(cid))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w, cid:%s", ErrObjectNotFound, cid)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return newRangeReadCloser(file, 0, length)
+}
+
+func (s *LocalHotStorage) Pin(ctx context.Context, cid string) error {
+	if !libutils.IsFileExistsFullPath(s.getPath(cid)) {
+		return fmt.Errorf("%w, cid:%s", ErrObjectNotFound, cid)
+	}
+
+	return nil
+}
+
+func (s *LocalHotStorage) Unpin(ctx context.Context, cid string) error {
+	err := os.Remove(s.getPath(cid))
+	if err != nil && !os.IsNotExist(err) {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *LocalHotStorage) Stat(ctx context.Context, cid string) (*Object, error) {
+	fileInfo, err := os.Stat(s.getPath(cid))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w, cid:%s", ErrObjectNotFound, cid)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	object := &Object{
+		Cid:    cid,
+		Size:   fileInfo.Size(),
+		Pinned: true,
+	}
+
+	return object, nil
+}
+
+func (s *LocalHotStorage) List(ctx context.Context) ([]*Object, error) {
+	fileInfos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var objects []*Object
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() || filepath.Ext(fileInfo.Name()) == ".tmp" {
+			continue
+		}
+
+		objects = append(objects, &Object{
+			Cid:    fileInfo.Name(),
+			Size:   fileInfo.Size(),
+			Pinned: true,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *LocalHotStorage) GetUrl(cid string) string {
+	return libutils.UrlJoin(s.downloadUrlPrefix, cid)
+}
@@ -0,0 +1,122 @@
+package hotstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// MemoryHotStorage keeps the content in memory, for testing only, every object kept is pinned
+type MemoryHotStorage struct {
+	mutex             sync.Mutex
+	objects           map[string][]byte
+	downloadUrlPrefix string
+}
+
+func NewMemoryHotStorage(downloadUrlPrefix string) *MemoryHotStorage {
+	return &MemoryHotStorage{
+		objects:           map[string][]byte{},
+		downloadUrlPrefix: downloadUrlPrefix,
+	}
+}
+
+func (s *MemoryHotStorage) Put(ctx context.Context, filepath string) (string, error) {
+	content, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	digest := sha256.Sum256(content)
+	cid := getRawCid(digest[:])
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.objects[cid] = content
+
+	return cid, nil
+}
+
+func (s *MemoryHotStorage) Get(ctx context.Context, cid string) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, ok := s.objects[cid]
+	if !ok {
+		return nil, fmt.Errorf("%w, cid:%s", ErrObjectNotFound, cid)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (s *MemoryHotStorage) GetRange(ctx context.Context, cid string, offset, length int64) (io.ReadCloser, error) {
+	content, err := s.Get(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRangeReadCloser(content, offset, length)
+}
+
+func (s *MemoryHotStorage) Pin(ctx context.Context, cid string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.objects[cid]; !ok {
+		return fmt.Errorf("%w, cid:%s", ErrObjectNotFound, cid)
+	}
+
+	return nil
+}
+
+func (s *MemoryHotStorage) Unpin(ctx context.Context, cid string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.objects, cid)
+	return nil
+}
+
+func (s *MemoryHotStorage) Stat(ctx context.Context, cid string) (*Object, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, ok := s.objects[cid]
+	if !ok {
+		return nil, fmt.Errorf("%w, cid:%s", ErrObjectNotFound, cid)
+	}
+
+	object := &Object{
+		Cid:    cid,
+		Size:   int64(len(content)),
+		Pinned: true,
+	}
+
+	return object, nil
+}
+
+func (s *MemoryHotStorage) List(ctx context.Context) ([]*Object, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var objects []*Object
+	for cid, content := range s.objects {
+		objects = append(objects, &Object{
+			Cid:    cid,
+			Size:   int64(len(content)),
+			Pinned: true,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *MemoryHotStorage) GetUrl(cid string) string {
+	return getIpfsUrl(s.downloadUrlPrefix, cid)
+}
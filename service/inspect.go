@@ -0,0 +1,123 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/denylist"
+	"multi-chain-storage/service/plan"
+	"multi-chain-storage/service/scan"
+	"os"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// sourceFileInspection is what is learned of the content received before it is put, saved to its source file and
+// upload
+type sourceFileInspection struct {
+	contentSha256 string
+	scanResult    *scan.Result
+}
+
+func (i *sourceFileInspection) getScanResult() *scan.Result {
+	if i == nil {
+		return nil
+	}
+
+	return i.scanResult
+}
+
+// inspectSrcFile checks the content received against the denylist by its hash, then runs the scan hooks on it by the
+// tier of the upload, the source file is removed if denied or rejected
+func inspectSrcFile(wallet *models.Wallet, organizationId *int64, srcFilepath, filename string, fileSize int64, fileType int) (*sourceFileInspection, error) {
+	contentSha256, err := denylist.GetFileSha256(srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.Remove(srcFilepath)
+		return nil, err
+	}
+
+	err = checkContentAllowed(wallet, srcFilepath, "", contentSha256)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	tier := constants.SCAN_TIER_PAID
+	isFree, err := isUploadFree(plan.GetSubject(wallet.ID, organizationId), fileType, fileSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.Remove(srcFilepath)
+		return nil, err
+	}
+	if isFree {
+		tier = constants.SCAN_TIER_FREE
+	}
+
+	scanFile := &scan.File{
+		Filepath: srcFilepath,
+		Filename: filename,
+		Size:     fileSize,
+		Tier:     tier,
+	}
+
+	scanResult, err := scan.ScanFile(scanFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.Remove(srcFilepath)
+
+		var rejectedErr *scan.RejectedError
+		if errors.As(err, &rejectedErr) {
+			detail := err.Error()
+			createAuditLog(constants.AUDIT_LOG_ACTOR_SYSTEM, "", constants.AUDIT_LOG_ACTION_UPLOAD_REJECTED, constants.AUDIT_LOG_TARGET_TYPE_WALLET, wallet.Address, &detail)
+		}
+
+		return nil, err
+	}
+
+	sourceFileInspection := &sourceFileInspection{
+		contentSha256: contentSha256,
+		scanResult:    scanResult,
+	}
+
+	return sourceFileInspection, nil
+}
+
+// isUploadFree returns whether the upload is within the monthly free bytes of the plan of the subject
+func isUploadFree(subject plan.Subject, fileType int, fileSize int64) (bool, error) {
+	if fileType != constants.SOURCE_FILE_TYPE_NORMAL {
+		return false, nil
+	}
+
+	isFree, err := plan.IsUploadFree(subject, fileSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return isFree, nil
+}
+
+// setSourceFileScanResult sets the latest scan of the content to its source file, kept if the content is not scanned
+func setSourceFileScanResult(sourceFile *models.SourceFile, scanResult *scan.Result) error {
+	if scanResult == nil {
+		return nil
+	}
+
+	scanVerdicts, err := json.Marshal(scanResult.Verdicts)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	scanVerdictsStr := string(scanVerdicts)
+	sourceFile.ScanStatus = &scanResult.Status
+	sourceFile.ScanVerdicts = &scanVerdictsStr
+	sourceFile.ScannedAt = &scanResult.ScannedAt
+	if scanResult.MimeType != "" {
+		sourceFile.MimeType = &scanResult.MimeType
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/scheduler"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+func GetMiners(status string) ([]*models.Miner, error) {
+	miners, err := models.GetMiners(status)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return miners, nil
+}
+
+func RankMiners(minerFids []string) ([]*models.Miner, error) {
+	miners, err := scheduler.SelectMiners(minerFids)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return miners, nil
+}
+
+func UpdateMinerStatus(minerFid, status, note string) error {
+	if status != constants.MINER_STATUS_NORMAL && status != constants.MINER_STATUS_ALLOWLISTED && status != constants.MINER_STATUS_BLOCKLISTED {
+		err := fmt.Errorf("invalid miner status:%s", status)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	miner, err := models.GeMinerByFid(minerFid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.UpdateMinerStatus(miner.ID, status, note)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("miner:", minerFid, " status changed from ", miner.Status, " to ", status)
+	return nil
+}
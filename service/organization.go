@@ -0,0 +1,248 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+var ErrOrganizationNotFound = errors.New("organization not found")
+var ErrOrganizationForbidden = errors.New("wallet not allowed in organization")
+
+// organizationRoleRanks ranks the roles, a role is allowed what the roles ranked lower are
+var organizationRoleRanks = map[string]int{
+	constants.ORGANIZATION_ROLE_VIEWER:   1,
+	constants.ORGANIZATION_ROLE_UPLOADER: 2,
+	constants.ORGANIZATION_ROLE_ADMIN:    3,
+	constants.ORGANIZATION_ROLE_OWNER:    4,
+}
+
+// checkOrganizationRole returns the membership of the wallet in the organization, ErrOrganizationForbidden if the
+// wallet is not a member with the role or a more privileged one
+func checkOrganizationRole(wallet *models.Wallet, organizationId int64, role string) (*models.OrganizationMember, error) {
+	organization, err := models.GetOrganizationById(organizationId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if organization == nil {
+		err := fmt.Errorf("%w, id:%d", ErrOrganizationNotFound, organizationId)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	organizationMember, err := models.GetOrganizationMember(organizationId, wallet.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if organizationMember == nil || organizationRoleRanks[organizationMember.Role] < organizationRoleRanks[role] {
+		err := fmt.Errorf("%w, wallet:%s, organization:%d, %s required", ErrOrganizationForbidden, wallet.Address, organizationId, role)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return organizationMember, nil
+}
+
+// CheckOrganizationRole is checkOrganizationRole by the wallet address
+func CheckOrganizationRole(walletAddress string, organizationId int64, role string) error {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = checkOrganizationRole(wallet, organizationId, role)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetSourceFileUploadOrganizationId returns the organization owning the upload, nil if it is owned by a wallet or not
+// found
+func GetSourceFileUploadOrganizationId(sourceFileUploadId int64) (*int64, error) {
+	sourceFileUpload, err := models.GetSourceFileUploadById(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if sourceFileUpload == nil {
+		return nil, nil
+	}
+
+	return sourceFileUpload.OrganizationId, nil
+}
+
+// CreateOrganization creates the organization owned by the wallet
+func CreateOrganization(walletAddress, name string) (*models.Organization, error) {
+	name = strings.Trim(name, " ")
+	if name == "" {
+		err := fmt.Errorf("name is required")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if wallet.IsBlocked {
+		err := fmt.Errorf("%w, wallet:%s", ErrWalletBlocked, walletAddress)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	organization, err := models.CreateOrganization(name, wallet.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	logs.GetLogger().Info("organization:", organization.ID, " created by wallet:", walletAddress)
+	return organization, nil
+}
+
+// GetOrganizations returns the organizations the wallet is a member of, with its role in each
+func GetOrganizations(walletAddress string) ([]*models.OrganizationOut, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return models.GetOrganizationsByWalletId(wallet.ID)
+}
+
+func GetOrganizationMembers(walletAddress string, organizationId int64) ([]*models.OrganizationMemberOut, error) {
+	err := CheckOrganizationRole(walletAddress, organizationId, constants.ORGANIZATION_ROLE_VIEWER)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return models.GetOrganizationMembers(organizationId)
+}
+
+// checkOrganizationMemberManaged returns the memberships of the wallet and of the member wallet managed by it, nil for
+// the member wallet not a member. It is ErrOrganizationForbidden unless the wallet is the owner, or an admin managing
+// an uploader or a viewer
+func checkOrganizationMemberManaged(wallet *models.Wallet, organizationId int64, memberWallet *models.Wallet) (*models.OrganizationMember, *models.OrganizationMember, error) {
+	organizationMember, err := checkOrganizationRole(wallet, organizationId, constants.ORGANIZATION_ROLE_ADMIN)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	memberManaged, err := models.GetOrganizationMember(organizationId, memberWallet.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	if memberManaged != nil && organizationRoleRanks[memberManaged.Role] >= organizationRoleRanks[organizationMember.Role] {
+		err := fmt.Errorf("%w, wallet:%s cannot manage %s:%s", ErrOrganizationForbidden, wallet.Address, memberManaged.Role, memberWallet.Address)
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	return organizationMember, memberManaged, nil
+}
+
+// SaveOrganizationMember adds the member wallet to the organization with the role, or changes its role, by the owner,
+// or by an admin for the uploaders and viewers. The owner is not changed
+func SaveOrganizationMember(walletAddress string, organizationId int64, memberWalletAddress, role string) error {
+	role = strings.Trim(role, " ")
+	if role != constants.ORGANIZATION_ROLE_ADMIN && role != constants.ORGANIZATION_ROLE_UPLOADER && role != constants.ORGANIZATION_ROLE_VIEWER {
+		err := fmt.Errorf("role must be %s, %s or %s", constants.ORGANIZATION_ROLE_ADMIN, constants.ORGANIZATION_ROLE_UPLOADER, constants.ORGANIZATION_ROLE_VIEWER)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	memberWallet, err := models.GetWalletByAddress(strings.Trim(memberWalletAddress, " "), constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	organizationMember, memberManaged, err := checkOrganizationMemberManaged(wallet, organizationId, memberWallet)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if memberManaged == nil && memberWallet.IsBlocked {
+		err := fmt.Errorf("%w, wallet:%s", ErrWalletBlocked, memberWallet.Address)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	// an admin cannot make another admin
+	if organizationRoleRanks[role] >= organizationRoleRanks[organizationMember.Role] {
+		err := fmt.Errorf("%w, wallet:%s cannot grant %s", ErrOrganizationForbidden, walletAddress, role)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.SaveOrganizationMember(organizationId, memberWallet.ID, role)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("wallet:", memberWallet.Address, " is ", role, " of organization:", organizationId, " by wallet:", walletAddress)
+	return nil
+}
+
+// RemoveOrganizationMember removes the member wallet from the organization, by the owner, or by an admin for the
+// uploaders and viewers. The uploads made by the member stay owned by the organization
+func RemoveOrganizationMember(walletAddress string, organizationId int64, memberWalletAddress string) error {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	memberWallet, err := models.GetWalletByAddress(strings.Trim(memberWalletAddress, " "), constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, memberManaged, err := checkOrganizationMemberManaged(wallet, organizationId, memberWallet)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if memberManaged == nil {
+		return nil
+	}
+
+	err = models.DeleteOrganizationMember(organizationId, memberWallet.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("wallet:", memberWallet.Address, " removed from organization:", organizationId, " by wallet:", walletAddress)
+	return nil
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/denylist"
+	"multi-chain-storage/service/plan"
+	"multi-chain-storage/service/scheduler"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+)
+
+var ErrPinNotFound = errors.New("pin not found")
+
+// Pin, PinStatus and PinResults are the objects of the ipfs pinning service api
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    *string           `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type PinStatus struct {
+	RequestId string            `json:"requestid"`
+	Status    string            `json:"status"`
+	Created   string            `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+type PinResults struct {
+	Count   int64        `json:"count"`
+	Results []*PinStatus `json:"results"`
+}
+
+type PinFilter struct {
+	Cids           []string
+	NameLike       *string // like pattern, the name given should be escaped by utils.EscapeLike
+	NameIgnoreCase bool
+	Statuses       []string
+	Before         *int64
+	After          *int64
+	Meta           map[string]string
+	Limit          int
+}
+
+func getPinStatus(pinRequest *models.PinRequest) (*PinStatus, error) {
+	pinStatus := &PinStatus{
+		RequestId: pinRequest.RequestId,
+		Status:    pinRequest.Status,
+		Created:   time.Unix(pinRequest.CreateAt, 0).UTC().Format(time.RFC3339),
+		Pin: Pin{
+			Cid:  pinRequest.Cid,
+			Name: pinRequest.Name,
+		},
+		Delegates: config.GetConfig().HotStorage.Delegates,
+	}
+
+	if pinStatus.Delegates == nil {
+		pinStatus.Delegates = []string{}
+	}
+
+	if pinRequest.Origins != nil {
+		err := json.Unmarshal([]byte(*pinRequest.Origins), &pinStatus.Pin.Origins)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	if pinRequest.Meta != nil {
+		err := json.Unmarshal([]byte(*pinRequest.Meta), &pinStatus.Pin.Meta)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	if pinRequest.Info != nil {
+		pinStatus.Info = map[string]string{
+			"status_details": *pinRequest.Info,
+		}
+	}
+
+	return pinStatus, nil
+}
+
+func getPinRequest(wallet *models.Wallet, requestId string) (*models.PinRequest, error) {
+	pinRequest, err := models.GetPinRequestByRequestId(requestId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if pinRequest == nil || pinRequest.WalletId != wallet.ID {
+		return nil, ErrPinNotFound
+	}
+
+	return pinRequest, nil
+}
+
+// CreatePin queues the pin, the content is pinned by the job ProcessPinRequest, the cid in the denylist is not accepted
+func CreatePin(wallet *models.Wallet, pin *Pin) (*PinStatus, error) {
+	err := denylist.CheckContent(pin.Cid, "")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	// the size of the content is checked against the plan of the wallet once pinned
+	err = plan.CheckUpload(plan.GetSubject(wallet.ID, nil), 0)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	pinRequest := &models.PinRequest{
+		RequestId: uuid.NewString(),
+		WalletId:  wallet.ID,
+		Cid:       pin.Cid,
+		Name:      pin.Name,
+		Status:    constants.PIN_REQUEST_STATUS_QUEUED,
+		CreateAt:  currentUtcSecond,
+		UpdateAt:  currentUtcSecond,
+	}
+
+	if len(pin.Origins) > 0 {
+		origins, err := json.Marshal(pin.Origins)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		originsStr := string(origins)
+		pinRequest.Origins = &originsStr
+	}
+
+	if len(pin.Meta) > 0 {
+		meta, err := json.Marshal(pin.Meta)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		metaStr := string(meta)
+		pinRequest.Meta = &metaStr
+	}
+
+	pinRequest, err = models.CreatePinRequest(pinRequest)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = scheduler.TriggerJob(scheduler.JOB_NAME_PROCESS_PIN_REQUEST)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+
+	return getPinStatus(pinRequest)
+}
+
+func GetPins(wallet *models.Wallet, pinFilter *PinFilter) (*PinResults, error) {
+	pinRequests, count, err := models.GetPinRequests(wallet.ID, pinFilter.Cids, pinFilter.NameLike, pinFilter.NameIgnoreCase, pinFilter.Statuses, pinFilter.Before, pinFilter.After, pinFilter.Meta, pinFilter.Limit)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pinResults := &PinResults{
+		Count:   count,
+		Results: []*PinStatus{},
+	}
+
+	for _, pinRequest := range pinRequests {
+		pinStatus, err := getPinStatus(pinRequest)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		pinResults.Results = append(pinResults.Results, pinStatus)
+	}
+
+	return pinResults, nil
+}
+
+func GetPin(wallet *models.Wallet, requestId string) (*PinStatus, error) {
+	pinRequest, err := getPinRequest(wallet, requestId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return getPinStatus(pinRequest)
+}
+
+// ReplacePin creates a new pin for the request and removes the old one, the request id changes
+func ReplacePin(wallet *models.Wallet, requestId string, pin *Pin) (*PinStatus, error) {
+	pinRequest, err := getPinRequest(wallet, requestId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pinStatus, err := CreatePin(wallet, pin)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = deletePinRequest(pinRequest)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return pinStatus, nil
+}
+
+func DeletePin(wallet *models.Wallet, requestId string) error {
+	pinRequest, err := getPinRequest(wallet, requestId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return deletePinRequest(pinRequest)
+}
+
+// deletePinRequest unpins the source file upload of the request, the content is unpinned from the hot storage
+// when no other upload keeps it pinned, the filecoin deals are not affected
+func deletePinRequest(pinRequest *models.PinRequest) error {
+	if pinRequest.SourceFileUploadId != nil {
+		err := UnpinSourceFile(*pinRequest.SourceFileUploadId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	err := models.DeletePinRequest(pinRequest.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
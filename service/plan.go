@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/plan"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+var ErrPlanNotFound = errors.New("plan not found")
+
+func GetPlans() ([]*models.Plan, error) {
+	return models.GetPlans()
+}
+
+// SavePlan adds the plan, or updates the plan of the same name, the wallets on it are limited by it once their cached
+// plans expire
+func SavePlan(planSaved *models.Plan, adminIp string) error {
+	planSaved.Name = strings.Trim(planSaved.Name, " ")
+	if planSaved.Name == "" {
+		err := fmt.Errorf("name is required")
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if planSaved.MonthlyFreeBytes < 0 || planSaved.MaxFileSize < 0 || planSaved.MaxFiles < 0 || planSaved.RequestsPerMinute < 0 || planSaved.UploadsPerMinute < 0 {
+		err := fmt.Errorf("monthly free bytes and limits of plan:%s should not be negative", planSaved.Name)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err := models.SavePlan(planSaved)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	plan.ClearPlanCache()
+
+	detail := fmt.Sprintf("monthly_free_bytes:%d,max_file_size:%d,max_files:%d,requests_per_minute:%d,uploads_per_minute:%d",
+		planSaved.MonthlyFreeBytes, planSaved.MaxFileSize, planSaved.MaxFiles, planSaved.RequestsPerMinute, planSaved.UploadsPerMinute)
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_PLAN_SAVE, constants.AUDIT_LOG_TARGET_TYPE_PLAN, planSaved.Name, &detail)
+
+	return nil
+}
+
+// AssignPlan assigns the plan to the organization if given, otherwise to the wallet, the usage in the current month is
+// kept
+func AssignPlan(walletAddress string, organizationId *int64, planName string, adminIp string) error {
+	planAssigned, err := models.GetPlanByName(strings.Trim(planName, " "))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if planAssigned == nil {
+		err := fmt.Errorf("%w, plan:%s", ErrPlanNotFound, planName)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	var subject plan.Subject
+	targetType := constants.AUDIT_LOG_TARGET_TYPE_WALLET
+	targetId := strings.Trim(walletAddress, " ")
+	if organizationId != nil {
+		organization, err := models.GetOrganizationById(*organizationId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		if organization == nil {
+			err := fmt.Errorf("%w, id:%d", ErrOrganizationNotFound, *organizationId)
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		subject = plan.GetSubject(0, organizationId)
+		targetType = constants.AUDIT_LOG_TARGET_TYPE_ORGANIZATION
+		targetId = strconv.FormatInt(organization.ID, 10)
+	} else {
+		wallet, err := models.GetWalletByAddress(targetId, constants.WALLET_TYPE_META_MASK)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		subject = plan.GetSubject(wallet.ID, nil)
+	}
+
+	err = models.SavePlanAssignment(subject.Type, subject.Id, planAssigned.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	plan.ClearPlanCache()
+
+	detail := "plan:" + planAssigned.Name
+	createAuditLog(constants.AUDIT_LOG_ACTOR_ADMIN, adminIp, constants.AUDIT_LOG_ACTION_PLAN_ASSIGN, targetType, targetId, &detail)
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrPlanLimitExceeded is wrapped by the errors of an upload exceeding the limits of the plan, for errors.Is
+var ErrPlanLimitExceeded = errors.New("plan limit exceeded")
+
+// Subject is the wallet or the organization whose plan and usage an upload counts to
+type Subject struct {
+	Type string
+	Id   int64
+}
+
+// GetSubject returns the organization the upload is owned by if given, otherwise the wallet uploading it
+func GetSubject(walletId int64, organizationId *int64) Subject {
+	if organizationId != nil {
+		return Subject{Type: constants.PLAN_SUBJECT_TYPE_ORGANIZATION, Id: *organizationId}
+	}
+
+	return Subject{Type: constants.PLAN_SUBJECT_TYPE_WALLET, Id: walletId}
+}
+
+func (s Subject) String() string {
+	return fmt.Sprintf("%s:%d", s.Type, s.Id)
+}
+
+// Usage is the usage of a subject in the current calendar month, with the plan limiting it
+type Usage struct {
+	Plan          *models.Plan `json:"plan"`
+	PeriodStart   int64        `json:"period_start"`
+	UploadedCnt   int          `json:"uploaded_cnt"`
+	UploadedBytes int64        `json:"uploaded_bytes"`
+	FreeBytes     int64        `json:"free_bytes"`
+}
+
+type cachedPlan struct {
+	plan     *models.Plan
+	expireAt int64
+}
+
+var subjectPlans = map[Subject]*cachedPlan{}
+var subjectPlansMutex sync.Mutex
+
+// GetPlan returns the plan assigned to the subject, or [plan].default_plan if none, cached for PLAN_CACHE_SECOND
+// as it is read on each request for the rate limits
+func GetPlan(subject Subject) (*models.Plan, error) {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+
+	subjectPlansMutex.Lock()
+	subjectPlan, ok := subjectPlans[subject]
+	subjectPlansMutex.Unlock()
+	if ok && subjectPlan.expireAt > currentUtcSecond {
+		return subjectPlan.plan, nil
+	}
+
+	plan, err := models.GetAssignedPlan(subject.Type, subject.Id)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if plan == nil {
+		plan, err = models.GetPlanByName(config.GetConfig().Plan.DefaultPlan)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if plan == nil {
+			err := fmt.Errorf("default plan:%s not found", config.GetConfig().Plan.DefaultPlan)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	subjectPlansMutex.Lock()
+	subjectPlans[subject] = &cachedPlan{
+		plan:     plan,
+		expireAt: currentUtcSecond + constants.PLAN_CACHE_SECOND,
+	}
+	subjectPlansMutex.Unlock()
+
+	return plan, nil
+}
+
+// ClearPlanCache drops the plans cached, after a plan is changed or assigned
+func ClearPlanCache() {
+	subjectPlansMutex.Lock()
+	subjectPlans = map[Subject]*cachedPlan{}
+	subjectPlansMutex.Unlock()
+}
+
+// GetUsage returns the usage of the subject in the current calendar month
+func GetUsage(subject Subject) (*Usage, error) {
+	plan, err := GetPlan(subject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	usage := &Usage{
+		Plan:        plan,
+		PeriodStart: utils.GetMonthStart(),
+	}
+
+	usageCounter, err := models.GetUsageCounter(subject.Type, subject.Id, usage.PeriodStart)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if usageCounter != nil {
+		usage.UploadedCnt = usageCounter.UploadedCnt
+		usage.UploadedBytes = usageCounter.UploadedBytes
+		usage.FreeBytes = usageCounter.FreeBytes
+	}
+
+	return usage, nil
+}
+
+// checkLimits returns ErrPlanLimitExceeded if an upload of the file size exceeds the plan with the usage so far
+func checkLimits(plan *models.Plan, uploadedCnt int, fileSize int64) error {
+	if plan.MaxFileSize > 0 && fileSize > plan.MaxFileSize {
+		err := fmt.Errorf("%w, file size:%d exceeds %d of plan:%s", ErrPlanLimitExceeded, fileSize, plan.MaxFileSize, plan.Name)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if plan.MaxFiles > 0 && uploadedCnt >= plan.MaxFiles {
+		err := fmt.Errorf("%w, %d files uploaded this month, max:%d of plan:%s", ErrPlanLimitExceeded, uploadedCnt, plan.MaxFiles, plan.Name)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// CheckUpload checks an upload of the file size against the plan of the subject before the file is received,
+// counted to the upload rate of the subject. The file size is 0 if not known yet
+func CheckUpload(subject Subject, fileSize int64) error {
+	usage, err := GetUsage(subject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = checkLimits(usage.Plan, usage.UploadedCnt, fileSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = AllowUpload(subject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// IsUploadFree returns whether an upload of the file size is within the monthly free bytes of the plan of the subject
+// so far, the upload is only made free by ReserveUploadInTransaction
+func IsUploadFree(subject Subject, fileSize int64) (bool, error) {
+	usage, err := GetUsage(subject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return usage.Plan.MonthlyFreeBytes-usage.FreeBytes >= fileSize, nil
+}
+
+// ReserveUploadInTransaction counts an upload of the file size to the usage of the subject in the current month, the
+// usage is locked till the transaction ends, so concurrent uploads do not exceed the plan. The upload is free if
+// asked for and within the monthly free bytes left
+func ReserveUploadInTransaction(db *gorm.DB, subject Subject, fileSize int64, wantFree bool) (bool, error) {
+	plan, err := GetPlan(subject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	usageCounter, err := models.GetUsageCounterForUpdateInTransaction(db, subject.Type, subject.Id, utils.GetMonthStart())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	err = checkLimits(plan, usageCounter.UploadedCnt, fileSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	isFree := wantFree && plan.MonthlyFreeBytes-usageCounter.FreeBytes >= fileSize
+	err = models.AddUsageCounterInTransaction(db, usageCounter.ID, fileSize, isFree)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return isFree, nil
+}
@@ -0,0 +1,86 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/models"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// ErrRateLimited is wrapped by the errors of a request exceeding the rate limits of the plan, for errors.Is
+var ErrRateLimited = errors.New("rate limited")
+
+// rateLimiter counts the requests of each subject in the current minute, on this instance only
+type rateLimiter struct {
+	mutex       sync.Mutex
+	minute      int64
+	counts      map[Subject]int
+	description string
+	getLimit    func(plan *models.Plan) int
+}
+
+func newRateLimiter(description string, getLimit func(plan *models.Plan) int) *rateLimiter {
+	return &rateLimiter{
+		counts:      map[Subject]int{},
+		description: description,
+		getLimit:    getLimit,
+	}
+}
+
+// allow counts a request of the subject, false if the subject made limit requests in the current minute already, a
+// limit of 0 means no limit
+func (l *rateLimiter) allow(subject Subject, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	minute := libutils.GetCurrentUtcSecond() / 60
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if minute != l.minute {
+		l.minute = minute
+		l.counts = map[Subject]int{}
+	}
+
+	if l.counts[subject] >= limit {
+		return false
+	}
+
+	l.counts[subject] = l.counts[subject] + 1
+	return true
+}
+
+var requestLimiter = newRateLimiter("requests", func(plan *models.Plan) int { return plan.RequestsPerMinute })
+var uploadLimiter = newRateLimiter("uploads", func(plan *models.Plan) int { return plan.UploadsPerMinute })
+
+// AllowRequest counts an api request of the wallet, ErrRateLimited if exceeding requests_per_minute of its plan
+func AllowRequest(walletId int64) error {
+	return allow(requestLimiter, GetSubject(walletId, nil))
+}
+
+// AllowUpload counts an upload of the subject, ErrRateLimited if exceeding uploads_per_minute of its plan
+func AllowUpload(subject Subject) error {
+	return allow(uploadLimiter, subject)
+}
+
+func allow(limiter *rateLimiter, subject Subject) error {
+	plan, err := GetPlan(subject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	limit := limiter.getLimit(plan)
+	if !limiter.allow(subject, limit) {
+		err := fmt.Errorf("%w, more than %d %s per minute of plan:%s, %s", ErrRateLimited, limit, limiter.description, plan.Name, subject)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
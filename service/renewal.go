@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+func GetRenewals(walletAddress string, status *string) ([]*models.RenewalOut, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	renewals, err := models.GetRenewalsByWalletId(wallet.ID, status)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return renewals, nil
+}
+
+// ErrRenewalPaymentInvalid is returned when the tx is not a payment locked for the renewal as quoted
+var ErrRenewalPaymentInvalid = errors.New("invalid renewal payment")
+
+// PayRenewal records the tx hash of the payment locked for the renewal, the renewal will be dealt by the scheduler then.
+// The tx should be sent by the wallet of the source file upload, and lock at least the quoted amount for the renewal
+// to the payment recipient
+func PayRenewal(renewalId int64, txHash string) error {
+	renewal, err := models.GetRenewalById(renewalId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if renewal == nil {
+		err := fmt.Errorf("%w, renewal:%d not exists", ErrRenewalPaymentInvalid, renewalId)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if renewal.Status != constants.RENEWAL_STATUS_QUOTED {
+		err := fmt.Errorf("%w, renewal:%d status is %s, only %s renewal can be paid", ErrRenewalPaymentInvalid, renewalId, renewal.Status, constants.RENEWAL_STATUS_QUOTED)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	isUsed, err := models.IsPayTxHashUsed(txHash)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if isUsed {
+		err := fmt.Errorf("%w, tx:%s already used", ErrRenewalPaymentInvalid, txHash)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = verifyRenewalPayment(renewal, txHash)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.UpdateRenewalPaid(renewalId, txHash)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// verifyRenewalPayment checks on the payment chain that the tx succeeded, was sent by the wallet of the source file
+// upload to the payment contract, and that the payment locked by it for the w_cid of the renewal is owned by the
+// wallet, to the payment recipient and not less than the quoted amount
+func verifyRenewalPayment(renewal *models.Renewal, txHash string) error {
+	rpcUrl := config.GetConfig().PaymentChainRpcUrl
+	if rpcUrl == "" {
+		err := fmt.Errorf("payment_chain_rpc_url not set, renewal payments cannot be verified")
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	sourceFileUpload, err := models.GetSourceFileUploadById(renewal.SourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if sourceFileUpload == nil {
+		err := fmt.Errorf("source file upload:%d not exists", renewal.SourceFileUploadId)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	sourceFile, err := models.GetSourceFileById(sourceFileUpload.SourceFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if sourceFile == nil {
+		err := fmt.Errorf("source file:%d not exists", sourceFileUpload.SourceFileId)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	wallet, err := models.GetWalletById(sourceFileUpload.WalletId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if wallet == nil {
+		err := fmt.Errorf("wallet:%d not exists", sourceFileUpload.WalletId)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	systemParam, err := utils.GetSystemParam("")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	receipt, err := utils.GetEvmTxReceipt(rpcUrl, txHash)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if receipt == nil {
+		err := fmt.Errorf("%w, tx:%s not found or not mined yet", ErrRenewalPaymentInvalid, txHash)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if receipt.Status != utils.EVM_TX_STATUS_SUCCESS {
+		err := fmt.Errorf("%w, tx:%s failed", ErrRenewalPaymentInvalid, txHash)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if !strings.EqualFold(receipt.To, systemParam.PaymentContractAddress) {
+		err := fmt.Errorf("%w, tx:%s is sent to:%s, not the payment contract", ErrRenewalPaymentInvalid, txHash, receipt.To)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if !strings.EqualFold(receipt.From, wallet.Address) {
+		err := fmt.Errorf("%w, tx:%s is sent by:%s, not the wallet of the renewal", ErrRenewalPaymentInvalid, txHash, receipt.From)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	wCid := renewal.Uuid + sourceFile.PayloadCid
+	lockedPaymentInfo, err := utils.GetLockedPaymentInfo(rpcUrl, systemParam.PaymentContractAddress, wCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	receiptBlockNumber, ok := new(big.Int).SetString(strings.TrimPrefix(receipt.BlockNumber, "0x"), 16)
+	if !lockedPaymentInfo.IsExisted || !ok || lockedPaymentInfo.BlockNumber.Cmp(receiptBlockNumber) != 0 {
+		err := fmt.Errorf("%w, tx:%s does not lock payment for:%s", ErrRenewalPaymentInvalid, txHash, wCid)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if !strings.EqualFold(lockedPaymentInfo.Owner, wallet.Address) {
+		err := fmt.Errorf("%w, payment for:%s is locked by:%s, not the wallet of the renewal", ErrRenewalPaymentInvalid, wCid, lockedPaymentInfo.Owner)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if !strings.EqualFold(lockedPaymentInfo.Recipient, systemParam.PaymentRecipientAddress) {
+		err := fmt.Errorf("%w, payment for:%s is locked to:%s, not the payment recipient", ErrRenewalPaymentInvalid, wCid, lockedPaymentInfo.Recipient)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	payAmount, ok := new(big.Int).SetString(renewal.PayAmount, 10)
+	if !ok {
+		err := fmt.Errorf("invalid pay amount:%s of renewal:%d", renewal.PayAmount, renewal.ID)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if lockedPaymentInfo.LockedFee.Cmp(payAmount) < 0 {
+		err := fmt.Errorf("%w, payment locked for:%s is %s, less than the quoted %s", ErrRenewalPaymentInvalid, wCid, lockedPaymentInfo.LockedFee.String(), renewal.PayAmount)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
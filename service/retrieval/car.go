@@ -0,0 +1,455 @@
+package retrieval
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"multi-chain-storage/common/cidutil"
+	"os"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const (
+	carSectionSizeMax = 8 * 1024 * 1024 // blocks of ipfs are at most 2MiB, larger ones are taken as corrupted
+
+	unixfsTypeRaw  = 0
+	unixfsTypeFile = 2
+)
+
+// carV2Pragma is the beginning of a car v2 file, followed by its fixed size header
+var carV2Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+// carBlock is where the data of a block is in the car file
+type carBlock struct {
+	codec  uint64
+	offset int64
+	size   int64
+}
+
+// ExtractFileFromCar writes the content of the unixfs file of the cid in the car file to dstFilepath, the car may be
+// followed by zeros, as the car in a piece retrieved from a miner. The file is found by the multihash of the cid,
+// since the cid of a file added to ipfs may be in the car as either cid v0 or v1
+func ExtractFileFromCar(carFilepath, cid, dstFilepath string) error {
+	_, err := ExtractFileRangeFromCar(carFilepath, cid, 0, -1, dstFilepath)
+	return err
+}
+
+// ExtractFileRangeFromCar writes length bytes of the unixfs file of the cid from offset, or till the end if length is
+// negative, the car needs only the blocks of the range if the nodes have the sizes of their links. Each block read is
+// checked against its cid, so the content written is the content of the cid. It returns the bytes written
+func ExtractFileRangeFromCar(carFilepath, cid string, offset, length int64, dstFilepath string) (int64, error) {
+	multihash, err := cidutil.GetMultihash(cid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	carFile, err := os.Open(carFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+	defer carFile.Close()
+
+	carBlocks, err := indexCar(carFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	dstFile, err := os.Create(dstFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	extractor := &unixfsExtractor{
+		carFile:   carFile,
+		carBlocks: carBlocks,
+		start:     offset,
+		end:       -1,
+		writer:    bufio.NewWriter(dstFile),
+	}
+	if length >= 0 {
+		extractor.end = offset + length
+	}
+
+	_, err = extractor.extract(multihash, 0)
+	if err == nil {
+		err = extractor.writer.Flush()
+	}
+	if err != nil {
+		dstFile.Close()
+		os.Remove(dstFilepath)
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	err = dstFile.Close()
+	if err != nil {
+		os.Remove(dstFilepath)
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return extractor.written, nil
+}
+
+// indexCar returns the blocks of the car file by their multihash
+func indexCar(carFile *os.File) (map[string]*carBlock, error) {
+	dataOffset := int64(0)
+	dataSize := int64(-1)
+
+	pragma := make([]byte, len(carV2Pragma))
+	_, err := io.ReadFull(carFile, pragma)
+	if err != nil {
+		err := fmt.Errorf("reading car header failed, %w", err)
+		return nil, err
+	}
+
+	if bytes.Equal(pragma, carV2Pragma) {
+		// characteristics 16 bytes, data offset 8 bytes, data size 8 bytes, index offset 8 bytes, in little endian
+		headerV2 := make([]byte, 40)
+		_, err := io.ReadFull(carFile, headerV2)
+		if err != nil {
+			err := fmt.Errorf("reading car v2 header failed, %w", err)
+			return nil, err
+		}
+
+		dataOffset = int64(binary.LittleEndian.Uint64(headerV2[16:24]))
+		dataSize = int64(binary.LittleEndian.Uint64(headerV2[24:32]))
+	}
+
+	_, err = carFile.Seek(dataOffset, io.SeekStart)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var dataReader io.Reader = carFile
+	if dataSize >= 0 {
+		dataReader = io.LimitReader(carFile, dataSize)
+	}
+	reader := &countingReader{reader: bufio.NewReaderSize(dataReader, 1024*1024)}
+
+	headerSize, err := binary.ReadUvarint(reader)
+	if err != nil {
+		err := fmt.Errorf("reading car header failed, %w", err)
+		return nil, err
+	}
+
+	_, err = io.CopyN(ioutil.Discard, reader, int64(headerSize))
+	if err != nil {
+		err := fmt.Errorf("reading car header failed, %w", err)
+		return nil, err
+	}
+
+	carBlocks := map[string]*carBlock{}
+	for {
+		sectionSize, err := binary.ReadUvarint(reader)
+		if err == io.EOF || (err == nil && sectionSize == 0) {
+			break
+		}
+		if err != nil {
+			err := fmt.Errorf("reading car section failed, %w", err)
+			return nil, err
+		}
+
+		if sectionSize > carSectionSizeMax {
+			err := fmt.Errorf("car section of %d bytes at %d too large", sectionSize, dataOffset+reader.count)
+			return nil, err
+		}
+
+		section := make([]byte, sectionSize)
+		_, err = io.ReadFull(reader, section)
+		if err != nil {
+			err := fmt.Errorf("reading car section failed, %w", err)
+			return nil, err
+		}
+
+		codec, multihash, cidSize, err := cidutil.Parse(section)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		carBlocks[string(multihash)] = &carBlock{
+			codec:  codec,
+			offset: dataOffset + reader.count - int64(sectionSize) + int64(cidSize),
+			size:   int64(sectionSize) - int64(cidSize),
+		}
+	}
+
+	return carBlocks, nil
+}
+
+type countingReader struct {
+	reader *bufio.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.count++
+	}
+	return b, err
+}
+
+// unixfsExtractor writes the range [start,end) of the unixfs file, end is -1 for the end of the file
+type unixfsExtractor struct {
+	carFile   *os.File
+	carBlocks map[string]*carBlock
+	start     int64
+	end       int64
+	writer    *bufio.Writer
+	written   int64
+}
+
+// extract writes the part in the range of the node beginning at nodeStart of the file, the data of a node is followed
+// by the data of its links in order, it returns the size of the node
+func (e *unixfsExtractor) extract(multihash []byte, nodeStart int64) (int64, error) {
+	codec, data, err := e.readBlock(multihash)
+	if err != nil {
+		return 0, err
+	}
+
+	if codec == cidutil.CODEC_RAW {
+		err := e.write(data, nodeStart)
+		return int64(len(data)), err
+	}
+
+	if codec != cidutil.CODEC_DAG_PB {
+		err := fmt.Errorf("block:%x of codec:0x%x is not unixfs", multihash, codec)
+		return 0, err
+	}
+
+	links, unixfsData, err := decodeDagPbNode(data)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	unixfsType, fileData, blockSizes, err := decodeUnixfsData(unixfsData)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	if unixfsType != unixfsTypeFile && unixfsType != unixfsTypeRaw {
+		err := fmt.Errorf("block:%x of unixfs type:%d is not a file", multihash, unixfsType)
+		return 0, err
+	}
+
+	err = e.write(fileData, nodeStart)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	linkStart := nodeStart + int64(len(fileData))
+	for i, link := range links {
+		// the links out of the range are skipped if their sizes are known, their blocks may not be in the car
+		if len(blockSizes) == len(links) {
+			linkEnd := linkStart + int64(blockSizes[i])
+			if linkEnd <= e.start || (e.end >= 0 && linkStart >= e.end) {
+				linkStart = linkEnd
+				continue
+			}
+		}
+
+		_, linkMultihash, _, err := cidutil.Parse(link)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return 0, err
+		}
+
+		linkSize, err := e.extract(linkMultihash, linkStart)
+		if err != nil {
+			return 0, err
+		}
+		linkStart += linkSize
+	}
+
+	return linkStart - nodeStart, nil
+}
+
+// readBlock reads the block of the multihash, and checks the data against the multihash
+func (e *unixfsExtractor) readBlock(multihash []byte) (uint64, []byte, error) {
+	block, ok := e.carBlocks[string(multihash)]
+	if !ok {
+		err := fmt.Errorf("block:%x not in the car", multihash)
+		return 0, nil, err
+	}
+
+	data := make([]byte, block.size)
+	_, err := e.carFile.ReadAt(data, block.offset)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, nil, err
+	}
+
+	if len(multihash) != 2+cidutil.MULTIHASH_SHA2_256_SIZE || multihash[0] != cidutil.MULTIHASH_SHA2_256 || multihash[1] != cidutil.MULTIHASH_SHA2_256_SIZE {
+		err := fmt.Errorf("block:%x not hashed by sha2-256, not supported", multihash)
+		return 0, nil, err
+	}
+
+	digest := sha256.Sum256(data)
+	if !bytes.Equal(digest[:], multihash[2:]) {
+		err := fmt.Errorf("block:%x corrupted, its data hashed to %x", multihash, digest)
+		return 0, nil, err
+	}
+
+	return block.codec, data, nil
+}
+
+// write writes the part in the range of the data beginning at dataStart of the file
+func (e *unixfsExtractor) write(data []byte, dataStart int64) error {
+	from := e.start - dataStart
+	if from < 0 {
+		from = 0
+	}
+
+	to := int64(len(data))
+	if e.end >= 0 && e.end-dataStart < to {
+		to = e.end - dataStart
+	}
+
+	if from >= to {
+		return nil
+	}
+
+	n, err := e.writer.Write(data[from:to])
+	e.written += int64(n)
+	return err
+}
+
+// decodeDagPbNode returns the hashes of the links and the data of the dag-pb node:
+// message PBNode { repeated PBLink Links = 2; optional bytes Data = 1; }
+// message PBLink { optional bytes Hash = 1; optional string Name = 2; optional uint64 Tsize = 3; }
+func decodeDagPbNode(node []byte) ([][]byte, []byte, error) {
+	var links [][]byte
+	var data []byte
+	err := decodeProtobuf(node, func(fieldNumber int, value []byte, _ uint64) error {
+		switch fieldNumber {
+		case 1:
+			data = value
+		case 2:
+			return decodeProtobuf(value, func(fieldNumber int, value []byte, _ uint64) error {
+				if fieldNumber == 1 {
+					links = append(links, value)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return links, data, nil
+}
+
+// decodeUnixfsData returns the type, the data and the sizes of the links of the unixfs node:
+// message Data { required DataType Type = 1; optional bytes Data = 2; optional uint64 filesize = 3; repeated uint64 blocksizes = 4; ... }
+func decodeUnixfsData(unixfsData []byte) (uint64, []byte, []uint64, error) {
+	var unixfsType uint64
+	var data []byte
+	var blockSizes []uint64
+	err := decodeProtobuf(unixfsData, func(fieldNumber int, value []byte, varint uint64) error {
+		switch fieldNumber {
+		case 1:
+			unixfsType = varint
+		case 2:
+			data = value
+		case 4:
+			if value == nil {
+				blockSizes = append(blockSizes, varint)
+				return nil
+			}
+
+			// packed
+			reader := bytes.NewReader(value)
+			for reader.Len() > 0 {
+				blockSize, err := binary.ReadUvarint(reader)
+				if err != nil {
+					return err
+				}
+				blockSizes = append(blockSizes, blockSize)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return unixfsType, data, blockSizes, nil
+}
+
+// decodeProtobuf calls onField with each field of the message, with the bytes of a length delimited field,
+// or the value of a varint field
+func decodeProtobuf(message []byte, onField func(fieldNumber int, value []byte, varint uint64) error) error {
+	reader := bytes.NewReader(message)
+	for reader.Len() > 0 {
+		key, err := binary.ReadUvarint(reader)
+		if err != nil {
+			err := fmt.Errorf("invalid protobuf, %w", err)
+			return err
+		}
+
+		fieldNumber := int(key >> 3)
+		var value []byte
+		var varint uint64
+		switch key & 0x7 {
+		case 0:
+			varint, err = binary.ReadUvarint(reader)
+		case 1:
+			_, err = skipBytes(reader, 8)
+		case 2:
+			var size uint64
+			size, err = binary.ReadUvarint(reader)
+			if err == nil {
+				value, err = skipBytes(reader, size)
+			}
+		case 5:
+			_, err = skipBytes(reader, 4)
+		default:
+			err = fmt.Errorf("wire type:%d not supported", key&0x7)
+		}
+		if err != nil {
+			err := fmt.Errorf("invalid protobuf, %w", err)
+			return err
+		}
+
+		err = onField(fieldNumber, value, varint)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipBytes returns the next size bytes of the message read by the reader
+func skipBytes(reader *bytes.Reader, size uint64) ([]byte, error) {
+	if size > uint64(reader.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	value := make([]byte, size)
+	_, err := reader.Read(value)
+	return value, err
+}
@@ -0,0 +1,125 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"multi-chain-storage/config"
+	"net/http"
+	"os"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// HttpRetrievalClient downloads the whole piece from the http retrieval endpoint of the miner, such as
+// /piece/<piece cid> of boost, the miners are looked up in [retrieval].miner_urls
+type HttpRetrievalClient struct {
+	minerUrls map[string]string
+}
+
+func NewHttpRetrievalClient() *HttpRetrievalClient {
+	return &HttpRetrievalClient{
+		minerUrls: config.GetConfig().Retrieval.MinerUrls,
+	}
+}
+
+// Retrieve saves the piece as the car file if isCar, since the car in the piece is the dag of the car file,
+// otherwise extracts the file of the cid from the car in the piece
+func (c *HttpRetrievalClient) Retrieve(ctx context.Context, minerFid, pieceCid, cid, filepath string, isCar bool) error {
+	minerUrl, ok := c.minerUrls[minerFid]
+	if !ok {
+		err := fmt.Errorf("http retrieval url of miner:%s not configured", minerFid)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if isCar {
+		return c.downloadPiece(ctx, libutils.UrlJoin(minerUrl, "piece", pieceCid), filepath)
+	}
+
+	pieceFilepath := filepath + ".piece"
+	defer os.Remove(pieceFilepath)
+
+	err := c.downloadPiece(ctx, libutils.UrlJoin(minerUrl, "piece", pieceCid), pieceFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = ExtractFileFromCar(pieceFilepath, cid, filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// RetrieveRange asks the trustless gateway of the miner, such as booster-http, for the blocks of the entity bytes
+func (c *HttpRetrievalClient) RetrieveRange(ctx context.Context, minerFid, pieceCid, cid string, offset, length int64, filepath string) error {
+	minerUrl, ok := c.minerUrls[minerFid]
+	if !ok {
+		err := fmt.Errorf("http retrieval url of miner:%s not configured", minerFid)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	entityBytes := fmt.Sprintf("%d:*", offset)
+	if length >= 0 {
+		entityBytes = fmt.Sprintf("%d:%d", offset, offset+length-1)
+	}
+
+	carUrl := libutils.UrlJoin(minerUrl, "ipfs", cid) + "?format=car&dag-scope=entity&entity-bytes=" + entityBytes
+	return c.download(ctx, carUrl, filepath)
+}
+
+func (c *HttpRetrievalClient) downloadPiece(ctx context.Context, pieceUrl, filepath string) error {
+	return c.download(ctx, pieceUrl, filepath)
+}
+
+func (c *HttpRetrievalClient) download(ctx context.Context, downloadUrl, filepath string) error {
+	logs.GetLogger().Info("downloading from ", downloadUrl)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadUrl, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	request.Header.Set("Accept", "application/vnd.ipld.car")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err := fmt.Errorf("downloading from %s failed, status:%s", downloadUrl, response.Status)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = io.Copy(file, response.Body)
+	if err != nil {
+		file.Close()
+		os.Remove(filepath)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		os.Remove(filepath)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
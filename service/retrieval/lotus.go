@@ -0,0 +1,191 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// LotusRetrievalClient retrieves through the lotus node, which saves the content to the path given,
+// so the lotus node should be on the same machine, paying the miners from [filecoin_wallet]
+type LotusRetrievalClient struct {
+	apiUrl      string
+	accessToken string
+	wallet      string
+}
+
+func NewLotusRetrievalClient() *LotusRetrievalClient {
+	return &LotusRetrievalClient{
+		apiUrl:      config.GetConfig().Lotus.ClientApiUrl,
+		accessToken: config.GetConfig().Lotus.ClientAccessToken,
+		wallet:      config.GetConfig().FilecoinWallet,
+	}
+}
+
+type lotusCid struct {
+	Cid string `json:"/"`
+}
+
+type lotusRetrievalPeer struct {
+	Address  string
+	ID       string
+	PieceCID *lotusCid
+}
+
+type lotusQueryOffer struct {
+	Err                     string
+	Root                    lotusCid
+	Piece                   *lotusCid
+	Size                    uint64
+	MinPrice                string
+	UnsealPrice             string
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+	Miner                   string
+	MinerPeer               lotusRetrievalPeer
+}
+
+type lotusRetrievalOrder struct {
+	Root                    lotusCid
+	Piece                   *lotusCid
+	Size                    uint64
+	Total                   string
+	UnsealPrice             string
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+	Client                  string
+	Miner                   string
+	MinerPeer               *lotusRetrievalPeer
+}
+
+type lotusRetrievalResult struct {
+	DealID uint64
+}
+
+type lotusExportRef struct {
+	Root   lotusCid
+	DealID uint64
+}
+
+type lotusFileRef struct {
+	Path  string
+	IsCAR bool
+}
+
+type lotusJsonRpcResult struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call calls the method of the lotus json rpc api, and decodes its result to the result given if not nil
+func (c *LotusRetrievalClient) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	jsonRpcParams := utils.LotusJsonRpcParams{
+		JsonRpc: utils.LOTUS_JSON_RPC_VERSION,
+		Method:  method,
+		Params:  params,
+		Id:      utils.LOTUS_JSON_RPC_ID,
+	}
+
+	response, err := utils.HttpPostJsonRpc(ctx, c.apiUrl, c.accessToken, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	var jsonRpcResult lotusJsonRpcResult
+	err = json.Unmarshal(response, &jsonRpcResult)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if jsonRpcResult.Error != nil {
+		err := fmt.Errorf("%s failed, code:%d,message:%s", method, jsonRpcResult.Error.Code, jsonRpcResult.Error.Message)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(jsonRpcResult.Result, result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Retrieve queries the offer of the miner, retrieves the dag by the offer, waits till the retrieval ends,
+// then exports the dag retrieved to the file
+func (c *LotusRetrievalClient) Retrieve(ctx context.Context, minerFid, pieceCid, cid, filepath string, isCar bool) error {
+	var offer lotusQueryOffer
+	err := c.call(ctx, "Filecoin.ClientMinerQueryOffer", []interface{}{minerFid, lotusCid{Cid: cid}, &lotusCid{Cid: pieceCid}}, &offer)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if offer.Err != "" {
+		err := fmt.Errorf("miner:%s has no offer for cid:%s in piece:%s, %s", minerFid, cid, pieceCid, offer.Err)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	retrievalOrder := lotusRetrievalOrder{
+		Root:                    offer.Root,
+		Piece:                   offer.Piece,
+		Size:                    offer.Size,
+		Total:                   offer.MinPrice,
+		UnsealPrice:             offer.UnsealPrice,
+		PaymentInterval:         offer.PaymentInterval,
+		PaymentIntervalIncrease: offer.PaymentIntervalIncrease,
+		Client:                  c.wallet,
+		Miner:                   offer.Miner,
+		MinerPeer:               &offer.MinerPeer,
+	}
+
+	var retrievalResult lotusRetrievalResult
+	err = c.call(ctx, "Filecoin.ClientRetrieve", []interface{}{retrievalOrder}, &retrievalResult)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("retrieving cid:", cid, " in piece:", pieceCid, " from miner:", minerFid, ", retrieval deal:", retrievalResult.DealID)
+	err = c.call(ctx, "Filecoin.ClientRetrieveWait", []interface{}{retrievalResult.DealID}, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	exportRef := lotusExportRef{
+		Root:   lotusCid{Cid: cid},
+		DealID: retrievalResult.DealID,
+	}
+	fileRef := lotusFileRef{
+		Path:  filepath,
+		IsCAR: isCar,
+	}
+	err = c.call(ctx, "Filecoin.ClientExport", []interface{}{exportRef, fileRef}, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// RetrieveRange retrieves the whole dag of the cid as a car, since the lotus retrieval has no byte range
+func (c *LotusRetrievalClient) RetrieveRange(ctx context.Context, minerFid, pieceCid, cid string, offset, length int64, filepath string) error {
+	return c.Retrieve(ctx, minerFid, pieceCid, cid, filepath, true)
+}
@@ -0,0 +1,63 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// RetrievalClient retrieves the content stored in filecoin deals from the miners keeping it, the retrieval is
+// cancelled once ctx is done
+type RetrievalClient interface {
+	// Retrieve retrieves the dag of the cid in the piece kept by the miner and saves it to the file,
+	// as a car file of the dag if isCar, otherwise as the file the dag represents
+	Retrieve(ctx context.Context, minerFid, pieceCid, cid, filepath string, isCar bool) error
+	// RetrieveRange retrieves the blocks of the unixfs file of the cid in the piece covering length bytes from offset,
+	// and saves them to the file as a car, which may hold more blocks than the range if the miner cannot retrieve a range
+	RetrieveRange(ctx context.Context, minerFid, pieceCid, cid string, offset, length int64, filepath string) error
+}
+
+var retrievalClient RetrievalClient
+var retrievalClientOnce sync.Once
+var retrievalClientErr error
+
+func GetRetrievalClient() (RetrievalClient, error) {
+	retrievalClientOnce.Do(func() {
+		if retrievalClient != nil {
+			return
+		}
+
+		retrievalClient, retrievalClientErr = newRetrievalClient(config.GetConfig().Retrieval.Type)
+	})
+
+	if retrievalClientErr != nil {
+		logs.GetLogger().Error(retrievalClientErr)
+		return nil, retrievalClientErr
+	}
+
+	return retrievalClient, nil
+}
+
+// SetRetrievalClient replaces the retrieval client in config, such as with a fake one when no network is available
+func SetRetrievalClient(client RetrievalClient) {
+	retrievalClientOnce.Do(func() {})
+	retrievalClient = client
+	retrievalClientErr = nil
+}
+
+func newRetrievalClient(retrievalClientType string) (RetrievalClient, error) {
+	switch retrievalClientType {
+	case constants.RETRIEVAL_CLIENT_TYPE_LOTUS:
+		return NewLotusRetrievalClient(), nil
+	case constants.RETRIEVAL_CLIENT_TYPE_HTTP:
+		return NewHttpRetrievalClient(), nil
+	default:
+		err := fmt.Errorf("invalid retrieval client type:%s", retrievalClientType)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+}
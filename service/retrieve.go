@@ -0,0 +1,416 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/encryption"
+	"multi-chain-storage/service/hotstorage"
+	"multi-chain-storage/service/retrieval"
+	"multi-chain-storage/service/scheduler"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+)
+
+var ErrSourceFileUploadNotFound = errors.New("source file upload not found")
+
+// SourceFileContent is the content of a source file upload to be downloaded, the encrypted content is decrypted once
+// unlocked by UnlockSourceFileContent, and the file size is the size before encrypted
+type SourceFileContent struct {
+	FileName         string
+	FileSize         int64
+	WalletId         int64
+	PayloadCid       string
+	IsEncrypted      bool
+	sourceFile       *models.SourceFile
+	sourceFileUpload *models.SourceFileUpload
+	dataKey          []byte
+}
+
+// fileRange is a range of the file, onClose is called once it is closed
+type fileRange struct {
+	io.Reader
+	file    *os.File
+	onClose func()
+}
+
+func (f *fileRange) Close() error {
+	err := f.file.Close()
+	if f.onClose != nil {
+		f.onClose()
+	}
+	return err
+}
+
+func GetSourceFileContent(sourceFileUploadId int64) (*SourceFileContent, error) {
+	sourceFileUpload, err := models.GetSourceFileUploadById(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	// the content removed by the admin is not served, even if still in the deals
+	if sourceFileUpload == nil || sourceFileUpload.BlockedAt != nil {
+		err := fmt.Errorf("%w, id:%d", ErrSourceFileUploadNotFound, sourceFileUploadId)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	sourceFile, err := models.GetSourceFileById(sourceFileUpload.SourceFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	sourceFileContent := &SourceFileContent{
+		FileName:         sourceFileUpload.FileName,
+		FileSize:         sourceFile.FileSize,
+		WalletId:         sourceFileUpload.WalletId,
+		PayloadCid:       sourceFile.PayloadCid,
+		IsEncrypted:      sourceFileUpload.EncryptionScheme != nil,
+		sourceFile:       sourceFile,
+		sourceFileUpload: sourceFileUpload,
+	}
+
+	if sourceFileContent.IsEncrypted {
+		sourceFileContent.FileSize = *sourceFileUpload.PlainFileSize
+	}
+
+	return sourceFileContent, nil
+}
+
+// RetrieveSourceFile returns length bytes of the content from offset, or till the end if length is negative. The content
+// is read from the hot storage if pinned, or the local copy if kept, otherwise retrieved from the active deals of the
+// source file one by one, which may take minutes, and is cancelled once ctx is done. It returns where the content is
+// read from too. The encrypted content is decrypted by the data key unlocked, only the chunks covering the range are read
+func RetrieveSourceFile(ctx context.Context, sourceFileContent *SourceFileContent, offset, length int64) (io.ReadCloser, string, error) {
+	if !sourceFileContent.IsEncrypted {
+		return retrieveSourceFileRange(ctx, sourceFileContent.sourceFile, offset, length)
+	}
+
+	if sourceFileContent.dataKey == nil {
+		err := fmt.Errorf("source file upload:%d is encrypted and not unlocked", sourceFileContent.sourceFileUpload.Id)
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	encryptedOffset, encryptedLength := encryption.GetEncryptedRange(sourceFileContent.FileSize, offset, length)
+	encryptedContent, retrievedFrom, err := retrieveSourceFileRange(ctx, sourceFileContent.sourceFile, encryptedOffset, encryptedLength)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	content, err := encryption.DecryptRange(encryptedContent, sourceFileContent.dataKey, sourceFileContent.FileSize, offset, length)
+	if err != nil {
+		encryptedContent.Close()
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	return content, retrievedFrom, nil
+}
+
+func retrieveSourceFileRange(ctx context.Context, sourceFile *models.SourceFile, offset, length int64) (io.ReadCloser, string, error) {
+	if sourceFile.PinStatus == constants.IPFS_File_PINNED_STATUS {
+		hotStorage, err := hotstorage.GetHotStorage()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, "", err
+		}
+
+		content, err := hotStorage.GetRange(ctx, sourceFile.PayloadCid, offset, length)
+		if err == nil {
+			return content, constants.RETRIEVED_FROM_HOT_STORAGE, nil
+		}
+		logs.GetLogger().Error(err)
+	}
+
+	if sourceFile.LocalDeletedAt == nil && libutils.IsFileExistsFullPath(sourceFile.ResourceUri) {
+		content, err := openFileRange(sourceFile.ResourceUri, offset, length, nil)
+		if err == nil {
+			return content, constants.RETRIEVED_FROM_LOCAL, nil
+		}
+		logs.GetLogger().Error(err)
+	}
+
+	content, err := retrieveSourceFileRangeFromDeals(ctx, sourceFile, offset, length)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	return content, constants.RETRIEVED_FROM_FILECOIN, nil
+}
+
+func openFileRange(srcFilepath string, offset, length int64, onClose func()) (io.ReadCloser, error) {
+	file, err := os.Open(srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		file.Close()
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var reader io.Reader = file
+	if length >= 0 {
+		reader = io.LimitReader(file, length)
+	}
+
+	return &fileRange{Reader: reader, file: file, onClose: onClose}, nil
+}
+
+// retrievedFile is a file retrieved from the deals of a source file, the retrieval is shared by the requests of the same
+// content while in flight, and the file is kept for RETRIEVED_FILE_CACHE_SECOND after the last of them is done
+type retrievedFile struct {
+	key      string
+	filepath string
+	done     chan struct{}
+	err      error
+	cancel   context.CancelFunc
+	readers  int
+	timer    *time.Timer
+}
+
+var retrievedFiles = map[string]*retrievedFile{}
+var retrievedFilesMutex sync.Mutex
+
+// getRetrievedFile returns the file of the key once retrieved, the retrieval in flight is waited for till ctx is done,
+// or started by retrieve if none, nil is returned if retrieve is nil then. The retrieval is not bound to ctx since it is
+// shared, but cancelled once no request waits for it. The file returned must be released after read
+func getRetrievedFile(ctx context.Context, key string, retrieve func(ctx context.Context, dstFilepath string) error) (*retrievedFile, error) {
+	retrievedFilesMutex.Lock()
+	file, ok := retrievedFiles[key]
+	if !ok {
+		if retrieve == nil {
+			retrievedFilesMutex.Unlock()
+			return nil, nil
+		}
+
+		retrieveCtx, cancel := context.WithCancel(context.Background())
+		file = &retrievedFile{
+			key:      key,
+			filepath: filepath.Join(scheduler.GetSrcDir(), "retrieved_"+uuid.NewString()),
+			done:     make(chan struct{}),
+			cancel:   cancel,
+		}
+		retrievedFiles[key] = file
+
+		go func() {
+			err := retrieve(retrieveCtx, file.filepath)
+			cancel()
+
+			retrievedFilesMutex.Lock()
+			defer retrievedFilesMutex.Unlock()
+			if err != nil {
+				os.Remove(file.filepath)
+				if retrievedFiles[key] == file {
+					delete(retrievedFiles, key)
+				}
+			}
+			file.err = err
+			close(file.done)
+		}()
+	}
+
+	file.readers++
+	if file.timer != nil {
+		file.timer.Stop()
+		file.timer = nil
+	}
+	retrievedFilesMutex.Unlock()
+
+	select {
+	case <-file.done:
+	case <-ctx.Done():
+		file.release()
+		return nil, ctx.Err()
+	}
+
+	if file.err != nil {
+		file.release()
+		return nil, file.err
+	}
+
+	return file, nil
+}
+
+// release is called by each request done with the file, the retrieval in flight is cancelled when no request waits for
+// it any more, and the file retrieved is removed RETRIEVED_FILE_CACHE_SECOND after the last request
+func (file *retrievedFile) release() {
+	retrievedFilesMutex.Lock()
+	defer retrievedFilesMutex.Unlock()
+
+	file.readers--
+	if file.readers > 0 {
+		return
+	}
+
+	select {
+	case <-file.done:
+	default:
+		file.cancel()
+		return
+	}
+
+	if file.err != nil {
+		return
+	}
+
+	file.timer = time.AfterFunc(constants.RETRIEVED_FILE_CACHE_SECOND*time.Second, func() {
+		retrievedFilesMutex.Lock()
+		defer retrievedFilesMutex.Unlock()
+
+		if file.readers > 0 || retrievedFiles[file.key] != file {
+			return
+		}
+
+		delete(retrievedFiles, file.key)
+		os.Remove(file.filepath)
+	})
+}
+
+// retrieveSourceFileRangeFromDeals returns the range of the file retrieved from the deals of the source file, read from
+// the whole file if it has been retrieved or is being retrieved, otherwise only the range is retrieved for a partial
+// request, so that each request of a range does not retrieve the whole file
+func retrieveSourceFileRangeFromDeals(ctx context.Context, sourceFile *models.SourceFile, offset, length int64) (io.ReadCloser, error) {
+	key := fmt.Sprintf("%d", sourceFile.ID)
+	isPartial := offset > 0 || (length >= 0 && length < sourceFile.FileSize)
+
+	var retrieveWhole func(ctx context.Context, dstFilepath string) error
+	if !isPartial {
+		retrieveWhole = func(ctx context.Context, dstFilepath string) error {
+			return retrieveSourceFileFromDeals(ctx, sourceFile, 0, -1, dstFilepath)
+		}
+	}
+
+	file, err := getRetrievedFile(ctx, key, retrieveWhole)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if file == nil {
+		key = fmt.Sprintf("%d:%d:%d", sourceFile.ID, offset, length)
+		file, err = getRetrievedFile(ctx, key, func(ctx context.Context, dstFilepath string) error {
+			return retrieveSourceFileFromDeals(ctx, sourceFile, offset, length, dstFilepath)
+		})
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		// the file retrieved holds the range only
+		offset = 0
+		length = -1
+	}
+
+	content, err := openFileRange(file.filepath, offset, length, file.release)
+	if err != nil {
+		file.release()
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// retrieveSourceFileFromDeals retrieves length bytes of the file of the source file from offset, or the whole file if
+// length is negative from 0, from its active deals one by one, by the retrieval client in [retrieval]. The range is
+// extracted from the car of the blocks covering it, which the miner retrieves if able to, instead of the whole file
+func retrieveSourceFileFromDeals(ctx context.Context, sourceFile *models.SourceFile, offset, length int64, dstFilepath string) error {
+	sourceFileDeals, err := models.GetSourceFileActiveDeals(sourceFile.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(sourceFileDeals) == 0 {
+		err := fmt.Errorf("source file:%d is neither pinned nor kept locally, and has no active deal to retrieve from", sourceFile.ID)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	retrievalClient, err := retrieval.GetRetrievalClient()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, sourceFileDeal := range sourceFileDeals {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if offset == 0 && length < 0 {
+			err = retrievalClient.Retrieve(ctx, sourceFileDeal.MinerFid, sourceFileDeal.PieceCid, sourceFile.PayloadCid, dstFilepath, false)
+		} else {
+			err = retrieveRangeFromDeal(ctx, retrievalClient, sourceFileDeal, sourceFile.PayloadCid, offset, length, dstFilepath)
+		}
+		if err != nil {
+			logs.GetLogger().Error(err)
+			os.Remove(dstFilepath)
+			continue
+		}
+
+		logs.GetLogger().Info("source file:", sourceFile.ID, " retrieved from deal:", sourceFileDeal.DealId, " of miner:", sourceFileDeal.MinerFid)
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	err = fmt.Errorf("source file:%d not retrieved from any of its %d active deals", sourceFile.ID, len(sourceFileDeals))
+	logs.GetLogger().Error(err)
+	return err
+}
+
+// retrieveRangeFromDeal retrieves the car of the range from the miner, and extracts the range from it to the file
+func retrieveRangeFromDeal(ctx context.Context, retrievalClient retrieval.RetrievalClient, sourceFileDeal *models.SourceFileDeal, payloadCid string, offset, length int64, dstFilepath string) error {
+	carFilepath := dstFilepath + ".car"
+	defer os.Remove(carFilepath)
+
+	err := retrievalClient.RetrieveRange(ctx, sourceFileDeal.MinerFid, sourceFileDeal.PieceCid, payloadCid, offset, length, carFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = retrieval.ExtractFileRangeFromCar(carFilepath, payloadCid, offset, length, dstFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetDealRetrievalChecks returns the latest retrieval checks of the deal, none if the deal id is not given
+func GetDealRetrievalChecks(dealId int64) ([]*models.RetrievalCheck, error) {
+	if dealId <= 0 {
+		return []*models.RetrievalCheck{}, nil
+	}
+
+	retrievalChecks, err := models.GetRetrievalChecksByDealId(dealId, constants.RETRIEVAL_CHECK_DEAL_DETAIL_LIMIT)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return retrievalChecks, nil
+}
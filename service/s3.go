@@ -0,0 +1,665 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/hotstorage"
+	"multi-chain-storage/service/plan"
+	"multi-chain-storage/service/scheduler"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoSuchBucket             = errors.New("the specified bucket does not exist")
+	ErrBucketAlreadyExists      = errors.New("the requested bucket name is not available")
+	ErrBucketAlreadyOwnedByYou  = errors.New("the bucket you tried to create already exists, and you own it")
+	ErrBucketNotEmpty           = errors.New("the bucket you tried to delete is not empty")
+	ErrInvalidBucketName        = errors.New("the specified bucket is not valid")
+	ErrNoSuchKey                = errors.New("the specified key does not exist")
+	ErrNoSuchUpload             = errors.New("the specified multipart upload does not exist")
+	ErrInvalidPart              = errors.New("one or more of the specified parts could not be found")
+	ErrInvalidPartOrder         = errors.New("the list of parts was not in ascending order")
+	ErrEntityTooSmall           = errors.New("your proposed upload is smaller than the minimum allowed object size")
+	ErrS3AccessDenied           = errors.New("access denied")
+	bucketNameRegexp            = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	multipartUploadPartFileMode = os.FileMode(0644)
+)
+
+// S3Object is an object with its metadata, including the status of its filecoin deals
+type S3Object struct {
+	*models.BucketObject
+	Metadata map[string]string
+}
+
+type ObjectList struct {
+	Objects        []*models.BucketObject `json:"objects"`
+	CommonPrefixes []string               `json:"common_prefixes"`
+	IsTruncated    bool                   `json:"is_truncated"`
+	NextMarker     string                 `json:"next_marker"` // the key or common prefix listed last, listing again after it continues the list
+}
+
+type CompletedPart struct {
+	PartNumber int
+	Etag       string
+}
+
+func ListBuckets(wallet *models.Wallet) ([]*models.Bucket, error) {
+	return models.GetBucketsByWalletId(wallet.ID)
+}
+
+func CreateBucket(wallet *models.Wallet, bucketName string) error {
+	if !bucketNameRegexp.MatchString(bucketName) || strings.Contains(bucketName, "..") {
+		return fmt.Errorf("%w, bucket:%s", ErrInvalidBucketName, bucketName)
+	}
+
+	bucket, err := models.GetBucketByName(bucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if bucket != nil {
+		if bucket.WalletId == wallet.ID {
+			return fmt.Errorf("%w, bucket:%s", ErrBucketAlreadyOwnedByYou, bucketName)
+		}
+		return fmt.Errorf("%w, bucket:%s", ErrBucketAlreadyExists, bucketName)
+	}
+
+	_, err = models.CreateBucket(wallet.ID, bucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetBucket returns the bucket of the wallet
+func GetBucket(wallet *models.Wallet, bucketName string) (*models.Bucket, error) {
+	bucket, err := models.GetBucketByName(bucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if bucket == nil {
+		return nil, fmt.Errorf("%w, bucket:%s", ErrNoSuchBucket, bucketName)
+	}
+
+	if bucket.WalletId != wallet.ID {
+		return nil, fmt.Errorf("%w, bucket:%s", ErrS3AccessDenied, bucketName)
+	}
+
+	return bucket, nil
+}
+
+func DeleteBucket(wallet *models.Wallet, bucketName string) error {
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		return err
+	}
+
+	bucketObjects, err := models.GetBucketObjects(bucket.ID, "", "", 1)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	multipartUploadCnt, err := models.GetMultipartUploadCntByBucketId(bucket.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(bucketObjects) > 0 || multipartUploadCnt > 0 {
+		return fmt.Errorf("%w, bucket:%s", ErrBucketNotEmpty, bucketName)
+	}
+
+	err = models.DeleteBucket(bucket.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// getObjectFilename returns the name of the source file saving the object, the last part of the key
+func getObjectFilename(objectKey string) string {
+	filename := path.Base(objectKey)
+	if filename == "." || filename == "/" {
+		filename = "object"
+	}
+
+	return filename
+}
+
+// saveObject records the content saved to the source directory as a source file upload of the wallet,
+// and maps the key to it, the source file upload replaced by it is unpinned. The content denied or rejected by the scan
+// hooks is not saved
+func saveObject(wallet *models.Wallet, bucket *models.Bucket, objectKey, contentType, etag, srcFilepath string, size int64) (*models.BucketObject, error) {
+	filename := getObjectFilename(objectKey)
+	inspection, err := inspectSrcFile(wallet, nil, srcFilepath, filename, size, constants.SOURCE_FILE_TYPE_NORMAL)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	uploadResult, err := saveSourceFileUpload(wallet, nil, srcFilepath, filename, size, constants.DURATION_DAYS_DEFAULT, constants.SOURCE_FILE_TYPE_NORMAL, inspection, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	bucketObject := &models.BucketObject{
+		BucketId:           bucket.ID,
+		ObjectKey:          objectKey,
+		SourceFileUploadId: uploadResult.SourceFileUploadId,
+		ContentType:        contentType,
+		Etag:               etag,
+		Size:               size,
+	}
+
+	sourceFileUploadIdReplaced, err := models.SaveBucketObject(bucketObject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if sourceFileUploadIdReplaced != nil {
+		err = UnpinSourceFile(*sourceFileUploadIdReplaced)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+
+	return bucketObject, nil
+}
+
+// writeContent writes the content to the file and returns its size and md5
+func writeContent(filepath string, content io.Reader, md5Hash hash.Hash) (int64, error) {
+	file, err := os.OpenFile(filepath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, multipartUploadPartFileMode)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+	defer file.Close()
+
+	size, err := io.Copy(io.MultiWriter(file, md5Hash), content)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return size, nil
+}
+
+// PutObject saves the content by the same way as the files uploaded, the content is read till EOF,
+// any error from it fails the put. The size of the content is checked against the plan of the wallet once saved
+func PutObject(wallet *models.Wallet, bucketName, objectKey, contentType string, content io.Reader) (*models.BucketObject, error) {
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = plan.CheckUpload(plan.GetSubject(wallet.ID, nil), 0)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	md5Hash := md5.New()
+	var size int64
+	srcFilepath, err := saveSrcFile(getObjectFilename(objectKey), func(srcFilepath string) error {
+		size, err = writeContent(srcFilepath, content, md5Hash)
+		return err
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return saveObject(wallet, bucket, objectKey, contentType, hex.EncodeToString(md5Hash.Sum(nil)), srcFilepath, size)
+}
+
+func getBucketObject(wallet *models.Wallet, bucketName, objectKey string) (*models.BucketObject, error) {
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketObject, err := models.GetBucketObject(bucket.ID, objectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if bucketObject == nil {
+		return nil, fmt.Errorf("%w, bucket:%s, key:%s", ErrNoSuchKey, bucketName, objectKey)
+	}
+
+	return bucketObject, nil
+}
+
+// getObjectMetadata returns the status of the source file upload of the object and its filecoin deals
+func getObjectMetadata(bucketObject *models.BucketObject) (map[string]string, error) {
+	sourceFileUpload, err := GetSourceFileUpload(bucketObject.SourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	metadata := map[string]string{
+		"mcs-source-file-upload-id": strconv.FormatInt(bucketObject.SourceFileUploadId, 10),
+		"mcs-w-cid":                 sourceFileUpload.WCid,
+		"mcs-status":                sourceFileUpload.Status,
+	}
+
+	replicaHealth, err := GetReplicaHealth(bucketObject.SourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if replicaHealth != nil {
+		metadata["mcs-replica-target"] = strconv.Itoa(replicaHealth.TargetReplicaCnt)
+		metadata["mcs-replica-active"] = strconv.Itoa(replicaHealth.ActiveReplicaCnt)
+		metadata["mcs-replica-pending"] = strconv.Itoa(replicaHealth.PendingDealCnt)
+	}
+
+	offlineDeals, err := models.GetOfflineDealsBySourceFileUploadId(bucketObject.SourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var dealIds []string
+	for _, offlineDeal := range offlineDeals {
+		if offlineDeal.DealId != nil {
+			dealIds = append(dealIds, strconv.FormatInt(*offlineDeal.DealId, 10))
+		}
+	}
+	if len(dealIds) > 0 {
+		metadata["mcs-deal-ids"] = strings.Join(dealIds, ",")
+	}
+
+	return metadata, nil
+}
+
+func HeadObject(wallet *models.Wallet, bucketName, objectKey string) (*S3Object, error) {
+	bucketObject, err := getBucketObject(wallet, bucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := getObjectMetadata(bucketObject)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	s3Object := &S3Object{
+		BucketObject: bucketObject,
+		Metadata:     metadata,
+	}
+
+	return s3Object, nil
+}
+
+// GetObject returns the object and its content from the hot storage, the content should be closed by the caller
+func GetObject(wallet *models.Wallet, bucketName, objectKey string) (*S3Object, io.ReadCloser, error) {
+	s3Object, err := HeadObject(wallet, bucketName, objectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sourceFileUpload, err := models.GetSourceFileUploadById(s3Object.SourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	sourceFile, err := models.GetSourceFileById(sourceFileUpload.SourceFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	content, err := hotStorage.Get(context.Background(), sourceFile.PayloadCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	return s3Object, content, nil
+}
+
+// DeleteObject removes the key and unpins its source file upload, the filecoin deals are not affected,
+// deleting a key not existing succeeds like s3
+func DeleteObject(wallet *models.Wallet, bucketName, objectKey string) error {
+	bucketObject, err := getBucketObject(wallet, bucketName, objectKey)
+	if errors.Is(err, ErrNoSuchKey) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = models.DeleteBucketObject(bucketObject.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = UnpinSourceFile(bucketObject.SourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// getCommonPrefix returns the prefix of the key till the first delimiter after the prefix listed, or empty if none
+func getCommonPrefix(objectKey, prefix, delimiter string) string {
+	if delimiter == "" || !strings.HasPrefix(objectKey, prefix) {
+		return ""
+	}
+
+	index := strings.Index(objectKey[len(prefix):], delimiter)
+	if index < 0 {
+		return ""
+	}
+
+	return objectKey[:len(prefix)+index+len(delimiter)]
+}
+
+// ListObjects lists the objects in the order of keys after startAfter, the keys containing the delimiter after the
+// prefix are rolled up to common prefixes, which count toward maxKeys too
+func ListObjects(wallet *models.Wallet, bucketName, prefix, delimiter, startAfter string, maxKeys int) (*ObjectList, error) {
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	objectList := &ObjectList{}
+	marker := startAfter
+	if delimiter != "" && startAfter != "" && getCommonPrefix(startAfter, prefix, delimiter) == startAfter {
+		// listed after a common prefix, skip all the keys under it, the byte 0xff is not in any utf-8 key
+		marker = startAfter + "\xff"
+	}
+
+	for {
+		bucketObjects, err := models.GetBucketObjects(bucket.ID, prefix, marker, constants.S3_LIST_BATCH_SIZE)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if len(bucketObjects) == 0 {
+			return objectList, nil
+		}
+
+		for _, bucketObject := range bucketObjects {
+			if bucketObject.ObjectKey <= marker {
+				continue
+			}
+
+			if len(objectList.Objects)+len(objectList.CommonPrefixes) >= maxKeys {
+				objectList.IsTruncated = true
+				return objectList, nil
+			}
+
+			commonPrefix := getCommonPrefix(bucketObject.ObjectKey, prefix, delimiter)
+			if commonPrefix != "" {
+				objectList.CommonPrefixes = append(objectList.CommonPrefixes, commonPrefix)
+				objectList.NextMarker = commonPrefix
+				marker = commonPrefix + "\xff"
+				continue
+			}
+
+			objectList.Objects = append(objectList.Objects, bucketObject)
+			objectList.NextMarker = bucketObject.ObjectKey
+			marker = bucketObject.ObjectKey
+		}
+	}
+}
+
+func getMultipartUploadDir(uploadId string) string {
+	return filepath.Join(scheduler.GetMultipartDir(), filepath.Base(uploadId))
+}
+
+// CreateMultipartUpload starts a multipart upload, its parts are kept in the local multipart directory till completed
+func CreateMultipartUpload(wallet *models.Wallet, bucketName, objectKey, contentType string) (string, error) {
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		return "", err
+	}
+
+	err = plan.CheckUpload(plan.GetSubject(wallet.ID, nil), 0)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	uploadId := uuid.NewString()
+	err = libutils.CreateDir(getMultipartUploadDir(uploadId))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	multipartUpload := &models.MultipartUpload{
+		UploadId:    uploadId,
+		BucketId:    bucket.ID,
+		ObjectKey:   objectKey,
+		ContentType: contentType,
+		CreateAt:    currentUtcSecond,
+		UpdateAt:    currentUtcSecond,
+	}
+
+	_, err = models.CreateMultipartUpload(multipartUpload)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.RemoveAll(getMultipartUploadDir(uploadId))
+		return "", err
+	}
+
+	return uploadId, nil
+}
+
+func getMultipartUpload(wallet *models.Wallet, bucketName, objectKey, uploadId string) (*models.MultipartUpload, error) {
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	multipartUpload, err := models.GetMultipartUploadByUploadId(uploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if multipartUpload == nil || multipartUpload.BucketId != bucket.ID || multipartUpload.ObjectKey != objectKey {
+		return nil, fmt.Errorf("%w, upload id:%s", ErrNoSuchUpload, uploadId)
+	}
+
+	return multipartUpload, nil
+}
+
+// UploadPart saves the part, replacing the part uploaded before with the same number, it returns the etag of the part
+func UploadPart(wallet *models.Wallet, bucketName, objectKey, uploadId string, partNumber int, content io.Reader) (string, error) {
+	multipartUpload, err := getMultipartUpload(wallet, bucketName, objectKey, uploadId)
+	if err != nil {
+		return "", err
+	}
+
+	partFilepath := filepath.Join(getMultipartUploadDir(uploadId), strconv.Itoa(partNumber))
+	tempFilepath := partFilepath + "." + uuid.NewString()
+	md5Hash := md5.New()
+	size, err := writeContent(tempFilepath, content, md5Hash)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.Remove(tempFilepath)
+		return "", err
+	}
+
+	err = os.Rename(tempFilepath, partFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		os.Remove(tempFilepath)
+		return "", err
+	}
+
+	etag := hex.EncodeToString(md5Hash.Sum(nil))
+	err = models.SaveMultipartUploadPart(multipartUpload.ID, partNumber, etag, size)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return etag, nil
+}
+
+// CompleteMultipartUpload concatenates the parts given to the object, the etag of the object is the md5 of the md5s
+// of the parts with the part count like s3
+func CompleteMultipartUpload(wallet *models.Wallet, bucketName, objectKey, uploadId string, completedParts []*CompletedPart) (*models.BucketObject, error) {
+	multipartUpload, err := getMultipartUpload(wallet, bucketName, objectKey, uploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := models.GetMultipartUploadParts(multipartUpload.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	partMap := map[int]*models.MultipartUploadPart{}
+	for _, part := range parts {
+		partMap[part.PartNumber] = part
+	}
+
+	if len(completedParts) == 0 {
+		return nil, fmt.Errorf("%w, no part given", ErrInvalidPart)
+	}
+
+	etagMd5 := md5.New()
+	var size int64
+	for i, completedPart := range completedParts {
+		if i > 0 && completedPart.PartNumber <= completedParts[i-1].PartNumber {
+			return nil, fmt.Errorf("%w, part:%d", ErrInvalidPartOrder, completedPart.PartNumber)
+		}
+
+		part := partMap[completedPart.PartNumber]
+		if part == nil || part.Etag != strings.Trim(completedPart.Etag, `"`) {
+			return nil, fmt.Errorf("%w, part:%d", ErrInvalidPart, completedPart.PartNumber)
+		}
+
+		if i < len(completedParts)-1 && part.Size < constants.S3_MULTIPART_PART_SIZE_MIN {
+			return nil, fmt.Errorf("%w, part:%d, size:%d", ErrEntityTooSmall, completedPart.PartNumber, part.Size)
+		}
+
+		partMd5, err := hex.DecodeString(part.Etag)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		etagMd5.Write(partMd5)
+		size = size + part.Size
+	}
+
+	srcFilepath, err := saveSrcFile(getObjectFilename(objectKey), func(srcFilepath string) error {
+		file, err := os.OpenFile(srcFilepath, os.O_TRUNC|os.O_WRONLY, multipartUploadPartFileMode)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		for _, completedPart := range completedParts {
+			partFile, err := os.Open(filepath.Join(getMultipartUploadDir(uploadId), strconv.Itoa(completedPart.PartNumber)))
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(file, partFile)
+			partFile.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	etag := hex.EncodeToString(etagMd5.Sum(nil)) + "-" + strconv.Itoa(len(completedParts))
+	bucketObject, err := saveObject(wallet, bucket, objectKey, multipartUpload.ContentType, etag, srcFilepath, size)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = deleteMultipartUpload(multipartUpload)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+
+	return bucketObject, nil
+}
+
+func AbortMultipartUpload(wallet *models.Wallet, bucketName, objectKey, uploadId string) error {
+	multipartUpload, err := getMultipartUpload(wallet, bucketName, objectKey, uploadId)
+	if err != nil {
+		return err
+	}
+
+	return deleteMultipartUpload(multipartUpload)
+}
+
+func deleteMultipartUpload(multipartUpload *models.MultipartUpload) error {
+	err := models.DeleteMultipartUpload(multipartUpload.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = os.RemoveAll(getMultipartUploadDir(multipartUpload.UploadId))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/errorinfo"
+	"multi-chain-storage/config"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+// ErrUploadRejected is wrapped by RejectedError, for errors.Is
+var ErrUploadRejected = errors.New("upload rejected")
+
+// File is a file received, to be scanned before it is put to the hot storage
+type File struct {
+	Filepath string
+	Filename string
+	Size     int64
+	Tier     string
+
+	mimeType string
+}
+
+// GetMimeType returns the mime type sniffed from the content, without parameters such as charset
+func (f *File) GetMimeType() (string, error) {
+	if f.mimeType != "" {
+		return f.mimeType, nil
+	}
+
+	mimeType, err := detectMimeType(f.Filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	f.mimeType = mimeType
+	return f.mimeType, nil
+}
+
+// Verdict is the result of a hook on a file, the error code from errorinfo is set if rejected
+type Verdict struct {
+	Hook      string `json:"hook"`
+	Result    string `json:"result"`
+	Reason    string `json:"reason,omitempty"`
+	ErrorCode int    `json:"error_code,omitempty"`
+}
+
+// Hook inspects a file received before it is put to the hot storage
+type Hook interface {
+	Name() string
+	// Scan returns the verdict on the file, or an error if the file cannot be inspected
+	Scan(file *File) (*Verdict, error)
+}
+
+// Result is the verdicts of all the hooks on a file passed, saved to its source file
+type Result struct {
+	Status    string     `json:"status"`
+	MimeType  string     `json:"mime_type"` // empty if no hook sniffed it
+	Verdicts  []*Verdict `json:"verdicts"`
+	ScannedAt int64      `json:"scanned_at"`
+}
+
+// RejectedError is the verdict rejecting the upload, or the hook failed when not [scan].fail_open
+type RejectedError struct {
+	Verdict *Verdict
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s by %s hook, %s", ErrUploadRejected.Error(), e.Verdict.Hook, e.Verdict.Reason)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return ErrUploadRejected
+}
+
+var hooks []Hook
+var hooksOnce sync.Once
+var hooksErr error
+
+// GetHooks returns the hooks in [scan].hooks, in the order they run
+func GetHooks() ([]Hook, error) {
+	hooksOnce.Do(func() {
+		if hooks != nil {
+			return
+		}
+
+		for _, hookName := range config.GetConfig().Scan.Hooks {
+			hook, err := newHook(hookName)
+			if err != nil {
+				hooks, hooksErr = nil, err
+				return
+			}
+			hooks = append(hooks, hook)
+		}
+	})
+
+	if hooksErr != nil {
+		logs.GetLogger().Error(hooksErr)
+		return nil, hooksErr
+	}
+
+	return hooks, nil
+}
+
+// SetHooks replaces the hooks in config, such as with hooks of other checks
+func SetHooks(hooksSet []Hook) {
+	hooksOnce.Do(func() {})
+	hooks = hooksSet
+	hooksErr = nil
+}
+
+func newHook(hookName string) (Hook, error) {
+	switch hookName {
+	case constants.SCAN_HOOK_MIME:
+		return &MimeHook{}, nil
+	case constants.SCAN_HOOK_POLICY:
+		return NewPolicyHook(), nil
+	case constants.SCAN_HOOK_MALWARE:
+		scanner, err := newScanner(config.GetConfig().Scan.ScannerType)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		return NewMalwareHook(scanner, config.GetConfig().Scan.MalwareMaxFileSize), nil
+	default:
+		err := fmt.Errorf("invalid scan hook:%s", hookName)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+}
+
+// ScanFile runs the hooks on the file in order, till one rejects it. A hook failing rejects the file by
+// ERROR_UPLOAD_SCAN_FAILED, unless [scan].fail_open, then the file passes with the error in its verdicts
+func ScanFile(file *File) (*Result, error) {
+	hooks, err := GetHooks()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	result := &Result{
+		Status: constants.SCAN_STATUS_PASSED,
+	}
+
+	for _, hook := range hooks {
+		verdict, err := hook.Scan(file)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			verdict = &Verdict{
+				Hook:      hook.Name(),
+				Result:    constants.SCAN_VERDICT_ERROR,
+				Reason:    err.Error(),
+				ErrorCode: errorinfo.ERROR_UPLOAD_SCAN_FAILED,
+			}
+
+			if !config.GetConfig().Scan.FailOpen {
+				return nil, &RejectedError{Verdict: verdict}
+			}
+
+			result.Status = constants.SCAN_STATUS_PASSED_WITH_ERROR
+		}
+
+		if verdict.Result == constants.SCAN_VERDICT_REJECTED {
+			err := &RejectedError{Verdict: verdict}
+			logs.GetLogger().Error(err, ", file:", file.Filepath)
+			return nil, err
+		}
+
+		result.Verdicts = append(result.Verdicts, verdict)
+	}
+
+	result.MimeType = file.mimeType
+	result.ScannedAt = libutils.GetCurrentUtcSecond()
+	return result, nil
+}
@@ -0,0 +1,262 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/errorinfo"
+	"multi-chain-storage/config"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const clamdChunkSize = 64 * 1024
+
+// eicarSignature is the eicar anti-virus test file, flagged by the stub scanner
+const eicarSignature = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Scanner scans the content of a file for malware
+type Scanner interface {
+	// Scan returns the signature found in the file, empty if the file is clean
+	Scan(filepath string) (string, error)
+}
+
+func newScanner(scannerType string) (Scanner, error) {
+	switch scannerType {
+	case constants.SCANNER_TYPE_CLAMD:
+		return NewClamdScanner(), nil
+	case constants.SCANNER_TYPE_STUB:
+		return &StubScanner{}, nil
+	default:
+		err := fmt.Errorf("invalid scanner type:%s", scannerType)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+}
+
+// MalwareHook rejects the file in which the scanner finds a signature, the files larger than maxFileSize are skipped,
+// so that they are not rejected for the scanner failing on them, such as beyond StreamMaxLength of clamd
+type MalwareHook struct {
+	scanner     Scanner
+	maxFileSize int64 // no limit if negative
+}
+
+func NewMalwareHook(scanner Scanner, maxFileSize int64) *MalwareHook {
+	return &MalwareHook{
+		scanner:     scanner,
+		maxFileSize: maxFileSize,
+	}
+}
+
+func (h *MalwareHook) Name() string {
+	return constants.SCAN_HOOK_MALWARE
+}
+
+func (h *MalwareHook) Scan(file *File) (*Verdict, error) {
+	if h.maxFileSize >= 0 && file.Size > h.maxFileSize {
+		verdict := &Verdict{
+			Hook:   h.Name(),
+			Result: constants.SCAN_VERDICT_SKIPPED,
+			Reason: fmt.Sprintf("file size:%d exceeds malware_max_file_size:%d", file.Size, h.maxFileSize),
+		}
+		logs.GetLogger().Info(verdict.Reason, ", file:", file.Filepath, " not scanned for malware")
+		return verdict, nil
+	}
+
+	signature, err := h.scanner.Scan(file.Filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if signature != "" {
+		verdict := &Verdict{
+			Hook:      h.Name(),
+			Result:    constants.SCAN_VERDICT_REJECTED,
+			Reason:    "found:" + signature,
+			ErrorCode: errorinfo.ERROR_UPLOAD_REJECTED_MALWARE,
+		}
+		return verdict, nil
+	}
+
+	verdict := &Verdict{
+		Hook:   h.Name(),
+		Result: constants.SCAN_VERDICT_PASSED,
+	}
+
+	return verdict, nil
+}
+
+// ClamdScanner streams the file to the clamav daemon at [scan].clamd_address by the INSTREAM command, the file should
+// not exceed StreamMaxLength of clamd, otherwise the scan fails. The timeout applies to each chunk sent and to the reply,
+// not to the whole stream, so that large files on slow links are not cut off
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func NewClamdScanner() *ClamdScanner {
+	clamdScanner := &ClamdScanner{
+		network: "tcp",
+		address: config.GetConfig().Scan.ClamdAddress,
+		timeout: time.Duration(config.GetConfig().Scan.ClamdTimeoutSecond) * time.Second,
+	}
+
+	if strings.HasPrefix(clamdScanner.address, "unix://") {
+		clamdScanner.network = "unix"
+		clamdScanner.address = strings.TrimPrefix(clamdScanner.address, "unix://")
+	} else {
+		clamdScanner.address = strings.TrimPrefix(clamdScanner.address, "tcp://")
+	}
+
+	return clamdScanner
+}
+
+func (s *ClamdScanner) Scan(filepath string) (string, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(s.timeout))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	// each chunk is prefixed by its size in 4 bytes, a chunk of size 0 ends the stream
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := file.Read(chunk[4:])
+		if n > 0 {
+			errWrite := conn.SetWriteDeadline(time.Now().Add(s.timeout))
+			if errWrite != nil {
+				logs.GetLogger().Error(errWrite)
+				return "", errWrite
+			}
+
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			_, errWrite = conn.Write(chunk[:4+n])
+			if errWrite != nil {
+				// clamd closes the connection once the stream exceeds its StreamMaxLength, the reply tells
+				logs.GetLogger().Error(errWrite)
+				break
+			}
+		}
+
+		if err == io.EOF {
+			err = conn.SetWriteDeadline(time.Now().Add(s.timeout))
+			if err != nil {
+				logs.GetLogger().Error(err)
+				return "", err
+			}
+
+			_, err = conn.Write([]byte{0, 0, 0, 0})
+			if err != nil {
+				logs.GetLogger().Error(err)
+				return "", err
+			}
+			break
+		}
+
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+	}
+
+	// clamd scans the stream once it ends, the timeout is for the scan from then on
+	err = conn.SetReadDeadline(time.Now().Add(s.timeout))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply returns the signature in the reply such as "stream: Eicar-Signature FOUND", empty for "stream: OK"
+func parseClamdReply(reply string) (string, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		signature = strings.TrimSpace(strings.TrimPrefix(signature, "stream:"))
+		return signature, nil
+	case strings.HasSuffix(reply, " OK"):
+		return "", nil
+	default:
+		err := fmt.Errorf("clamd scan failed, reply:%s", reply)
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+}
+
+// StubScanner finds only the eicar test file, so the malware hook can be tried without a clamav daemon
+type StubScanner struct {
+}
+
+func (s *StubScanner) Scan(filepath string) (string, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	// the signature may span two reads, so the tail of the previous read is kept
+	overlap := len(eicarSignature) - 1
+	buf := make([]byte, overlap+clamdChunkSize)
+	kept := 0
+	for {
+		n, err := file.Read(buf[kept:])
+		if bytes.Contains(buf[:kept+n], []byte(eicarSignature)) {
+			return "Eicar-Test-Signature", nil
+		}
+
+		if err == io.EOF {
+			return "", nil
+		}
+
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+
+		if kept+n > overlap {
+			copy(buf, buf[kept+n-overlap:kept+n])
+			kept = overlap
+		} else {
+			kept = kept + n
+		}
+	}
+}
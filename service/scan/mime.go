@@ -0,0 +1,67 @@
+package scan
+
+import (
+	"io"
+	"mime"
+	"multi-chain-storage/common/constants"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// MimeHook sniffs the mime type of the content, by its first 512 bytes, not trusting the name of the file. It never
+// rejects, the type is checked by the policy hook
+type MimeHook struct {
+}
+
+func (h *MimeHook) Name() string {
+	return constants.SCAN_HOOK_MIME
+}
+
+func (h *MimeHook) Scan(file *File) (*Verdict, error) {
+	mimeType, err := file.GetMimeType()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	reason := "sniffed:" + mimeType
+	mimeTypeByExt, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(file.Filename)))
+	if mimeTypeByExt != "" && mimeTypeByExt != mimeType {
+		reason = reason + ", by extension:" + mimeTypeByExt
+	}
+
+	verdict := &Verdict{
+		Hook:   h.Name(),
+		Result: constants.SCAN_VERDICT_PASSED,
+		Reason: reason,
+	}
+
+	return verdict, nil
+}
+
+func detectMimeType(filepath string) (string, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return mimeType, nil
+}
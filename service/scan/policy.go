@@ -0,0 +1,86 @@
+package scan
+
+import (
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/errorinfo"
+	"multi-chain-storage/config"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// PolicyHook checks the size and the sniffed mime type of the file against the rule of its tier in [scan.tiers], the
+// files of a tier without a rule pass
+type PolicyHook struct {
+	tiers map[string]config.ScanTier
+}
+
+func NewPolicyHook() *PolicyHook {
+	return &PolicyHook{
+		tiers: config.GetConfig().Scan.Tiers,
+	}
+}
+
+func (h *PolicyHook) Name() string {
+	return constants.SCAN_HOOK_POLICY
+}
+
+func (h *PolicyHook) Scan(file *File) (*Verdict, error) {
+	tier, ok := h.tiers[file.Tier]
+	if !ok {
+		return h.newVerdict(constants.SCAN_VERDICT_PASSED, "no rule of tier:"+file.Tier, 0), nil
+	}
+
+	if tier.MaxFileSize > 0 && file.Size > tier.MaxFileSize {
+		reason := fmt.Sprintf("file size:%d exceeds %d of tier:%s", file.Size, tier.MaxFileSize, file.Tier)
+		return h.newVerdict(constants.SCAN_VERDICT_REJECTED, reason, errorinfo.ERROR_UPLOAD_REJECTED_FILE_SIZE), nil
+	}
+
+	if len(tier.AllowedMimeTypes) == 0 && len(tier.DeniedMimeTypes) == 0 {
+		return h.newVerdict(constants.SCAN_VERDICT_PASSED, "", 0), nil
+	}
+
+	mimeType, err := file.GetMimeType()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if matchMimeType(mimeType, tier.DeniedMimeTypes) {
+		reason := fmt.Sprintf("mime type:%s denied for tier:%s", mimeType, file.Tier)
+		return h.newVerdict(constants.SCAN_VERDICT_REJECTED, reason, errorinfo.ERROR_UPLOAD_REJECTED_MIME_TYPE), nil
+	}
+
+	if len(tier.AllowedMimeTypes) > 0 && !matchMimeType(mimeType, tier.AllowedMimeTypes) {
+		reason := fmt.Sprintf("mime type:%s not allowed for tier:%s", mimeType, file.Tier)
+		return h.newVerdict(constants.SCAN_VERDICT_REJECTED, reason, errorinfo.ERROR_UPLOAD_REJECTED_MIME_TYPE), nil
+	}
+
+	return h.newVerdict(constants.SCAN_VERDICT_PASSED, "", 0), nil
+}
+
+func (h *PolicyHook) newVerdict(result, reason string, errorCode int) *Verdict {
+	return &Verdict{
+		Hook:      h.Name(),
+		Result:    result,
+		Reason:    reason,
+		ErrorCode: errorCode,
+	}
+}
+
+// matchMimeType returns whether the mime type matches any of the patterns, such as image/png, image/* or *
+func matchMimeType(mimeType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" || pattern == "*/*" || pattern == mimeType {
+			return true
+		}
+
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
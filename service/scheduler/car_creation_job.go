@@ -0,0 +1,603 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/hotstorage"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-client/command"
+	"github.com/filswan/go-swan-lib/logs"
+	libmodel "github.com/filswan/go-swan-lib/model"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/shopspring/decimal"
+)
+
+// carCreationSteps are the steps of a car creation job in order, the job records the last step done
+var carCreationSteps = []string{
+	constants.CAR_CREATION_STEP_CREATED,
+	constants.CAR_CREATION_STEP_COPIED,
+	constants.CAR_CREATION_STEP_CAR_CREATED,
+	constants.CAR_CREATION_STEP_UPLOADED,
+	constants.CAR_CREATION_STEP_TASK_CREATED,
+	constants.CAR_CREATION_STEP_SAVED,
+}
+
+func getCarCreationStepIndex(step string) int {
+	for i, carCreationStep := range carCreationSteps {
+		if carCreationStep == step {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// startCarCreationJob records the job with its work directories before anything is copied into them,
+// so they can be cleaned up if the instance crashes in the middle
+func startCarCreationJob(carSrcDir, carDestDir string, isFree bool) (*models.CarCreationJob, error) {
+	job, err := models.CreateCarCreationJob(isFree, decimal.Zero, carSrcDir, carDestDir, instanceId, constants.ROW_LEASE_SECOND)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = libutils.CreateDir(carSrcDir)
+	if err != nil {
+		logs.GetLogger().Error("creating dir:", carSrcDir, " failed,", err)
+		discardCarCreationJob(job)
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// discardCarCreationJob removes the job and its work directories when no car is to be created
+func discardCarCreationJob(job *models.CarCreationJob) {
+	os.RemoveAll(job.SrcDir)
+	os.RemoveAll(job.CarDir)
+
+	err := models.DeleteCarCreationJob(job.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+// copiedCarCreationJob records the source files copied to the source directory of the job, they must still be leased
+// by this instance
+func copiedCarCreationJob(job *models.CarCreationJob, srcFiles []*models.SourceFileUploadNeed2Car, maxPrice decimal.Decimal) error {
+	var srcFileUploadIds []int64
+	for _, srcFile := range srcFiles {
+		srcFileUploadIds = append(srcFileUploadIds, srcFile.SourceFileUploadId)
+	}
+
+	err := models.UpdateCarCreationJobCopied(job.ID, srcFileUploadIds, maxPrice, instanceId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	job.MaxPrice = maxPrice
+	job.Step = constants.CAR_CREATION_STEP_COPIED
+	return nil
+}
+
+// runCarCreationJob runs the steps after the one recorded in the job, the progress is recorded after each step.
+// When a step fails, the job is resumed in the next run of CreateTask, and rolled back after CAR_CREATION_JOB_ATTEMPT_MAX,
+// the steps interrupted by ctx done are not counted as attempts. The lease of the job is kept by jobLease while the steps
+// run, the job taken over by another instance after its lease was lost is left to that instance
+func runCarCreationJob(ctx context.Context, job *models.CarCreationJob, jobLease *rowLeases) error {
+	err := runCarCreationSteps(ctx, job, jobLease)
+	if err == nil {
+		err = os.RemoveAll(job.SrcDir)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+		return nil
+	}
+
+	logs.GetLogger().Error("car creation job:", job.ID, " failed at step after ", job.Step, ",", err)
+
+	if jobLease.isLost(job.ID) {
+		return err
+	}
+
+	attemptCnt := job.AttemptCnt + 1
+	if ctx.Err() != nil {
+		attemptCnt = job.AttemptCnt
+	}
+	if attemptCnt >= constants.CAR_CREATION_JOB_ATTEMPT_MAX {
+		job.AttemptCnt = attemptCnt
+		errRollback := rollbackCarCreationJob(ctx, job, err.Error())
+		if errRollback != nil {
+			logs.GetLogger().Error(errRollback)
+		}
+		return err
+	}
+
+	errUpdate := models.UpdateCarCreationJobStatus(job.ID, constants.CAR_CREATION_JOB_STATUS_RUNNING, attemptCnt, err.Error())
+	if errUpdate != nil {
+		logs.GetLogger().Error(errUpdate)
+	}
+
+	errUpdate = models.ReleaseCarCreationJobs([]int64{job.ID}, instanceId)
+	if errUpdate != nil {
+		logs.GetLogger().Error(errUpdate)
+	}
+
+	return err
+}
+
+// checkCarCreationJobLease makes sure the job is still leased by this instance before its next step, otherwise the
+// instance which has taken it over may run the same step, creating the car or the swan task twice
+func checkCarCreationJobLease(job *models.CarCreationJob, jobLease *rowLeases) error {
+	err := jobLease.check()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if jobLease.isLost(job.ID) {
+		err := fmt.Errorf("%w, car creation job:%d after step:%s", models.ErrLeaseLost, job.ID, job.Step)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func runCarCreationSteps(ctx context.Context, job *models.CarCreationJob, jobLease *rowLeases) error {
+	stepIndex := getCarCreationStepIndex(job.Step)
+	if stepIndex < getCarCreationStepIndex(constants.CAR_CREATION_STEP_COPIED) {
+		err := fmt.Errorf("car creation job:%d at step:%s cannot be run", job.ID, job.Step)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if stepIndex < getCarCreationStepIndex(constants.CAR_CREATION_STEP_CAR_CREATED) {
+		err := checkCarCreationJobLease(job, jobLease)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		os.RemoveAll(job.CarDir)
+		err = libutils.CreateDir(job.CarDir)
+		if err != nil {
+			logs.GetLogger().Error("creating dir:", job.CarDir, " failed,", err)
+			return err
+		}
+
+		cmdIpfsCar := &command.CmdIpfsCar{
+			LotusClientApiUrl:         config.GetConfig().Lotus.ClientApiUrl,
+			LotusClientAccessToken:    config.GetConfig().Lotus.ClientAccessToken,
+			InputDir:                  job.SrcDir,
+			OutputDir:                 job.CarDir,
+			GenerateMd5:               false,
+			IpfsServerUploadUrlPrefix: config.GetConfig().IpfsServer.UploadUrlPrefix,
+		}
+
+		fileDescs, err := cmdIpfsCar.CreateIpfsCarFiles()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		logs.GetLogger().Info("car files created to ", job.CarDir, " from ", job.SrcDir)
+
+		fields := map[string]interface{}{}
+		if len(fileDescs) > 0 {
+			fields["payload_cid"] = fileDescs[0].PayloadCid
+		}
+		err = models.UpdateCarCreationJobStep(job.ID, constants.CAR_CREATION_STEP_CAR_CREATED, fields)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		job.Step = constants.CAR_CREATION_STEP_CAR_CREATED
+	}
+
+	if stepIndex < getCarCreationStepIndex(constants.CAR_CREATION_STEP_UPLOADED) {
+		err := checkCarCreationJobLease(job, jobLease)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		carFileUrls, err := uploadCarFiles(ctx, job.CarDir)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		logs.GetLogger().Info("car files uploaded to hot storage from ", job.CarDir)
+
+		fields := map[string]interface{}{}
+		if len(carFileUrls) > 0 {
+			fields["car_file_url"] = carFileUrls[0]
+			job.CarFileUrl = &carFileUrls[0]
+		}
+		err = models.UpdateCarCreationJobStep(job.ID, constants.CAR_CREATION_STEP_UPLOADED, fields)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		job.Step = constants.CAR_CREATION_STEP_UPLOADED
+	}
+
+	if stepIndex < getCarCreationStepIndex(constants.CAR_CREATION_STEP_TASK_CREATED) {
+		err := checkCarCreationJobLease(job, jobLease)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		fileDesc, err := createSwanTask(job.CarDir, job.MaxPrice, config.GetConfig().SwanTask.ReplicaCount)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		fields := map[string]interface{}{
+			"task_uuid":     fileDesc.Uuid,
+			"car_file_name": fileDesc.CarFileName,
+			"car_file_path": fileDesc.CarFilePath,
+			"car_file_size": fileDesc.CarFileSize,
+			"payload_cid":   fileDesc.PayloadCid,
+			"piece_cid":     fileDesc.PieceCid,
+		}
+		err = models.UpdateCarCreationJobStep(job.ID, constants.CAR_CREATION_STEP_TASK_CREATED, fields)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		job.Step = constants.CAR_CREATION_STEP_TASK_CREATED
+		job.TaskUuid = &fileDesc.Uuid
+		job.CarFileName = &fileDesc.CarFileName
+		job.CarFilePath = &fileDesc.CarFilePath
+		job.CarFileSize = &fileDesc.CarFileSize
+		job.PayloadCid = &fileDesc.PayloadCid
+		job.PieceCid = &fileDesc.PieceCid
+	}
+
+	fileDesc := &libmodel.FileDesc{
+		Uuid:        *job.TaskUuid,
+		CarFileName: *job.CarFileName,
+		CarFilePath: *job.CarFilePath,
+		CarFileSize: *job.CarFileSize,
+		PayloadCid:  *job.PayloadCid,
+		PieceCid:    *job.PieceCid,
+	}
+
+	srcFileUploadIds, err := models.GetCarCreationJobUploadIds(job.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	var srcFiles []*models.SourceFileUploadNeed2Car
+	for _, srcFileUploadId := range srcFileUploadIds {
+		srcFiles = append(srcFiles, &models.SourceFileUploadNeed2Car{SourceFileUploadId: srcFileUploadId})
+	}
+
+	err = checkCarCreationJobLease(job, jobLease)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = saveCarInfo2DB(ctx, job, fileDesc, srcFiles)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	job.Step = constants.CAR_CREATION_STEP_SAVED
+
+	return nil
+}
+
+// uploadCarFiles puts the car files created in the car directory to the hot storage, and records their urls
+// in the car file json, which the swan task is created from
+func uploadCarFiles(ctx context.Context, carDir string) ([]string, error) {
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	jsonFilepath := filepath.Join(carDir, constants.CAR_FILE_DESC_JSON_FILE_NAME)
+	fileDescs, err := readCarFileDescs(jsonFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var carFileUrls []string
+	for _, fileDesc := range fileDescs {
+		carFilePath, _ := fileDesc["car_file_path"].(string)
+		cid, err := hotStorage.Put(ctx, carFilePath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		carFileUrl := hotStorage.GetUrl(cid)
+		fileDesc["car_file_url"] = carFileUrl
+		carFileUrls = append(carFileUrls, carFileUrl)
+	}
+
+	content, err := json.MarshalIndent(fileDescs, "", " ")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(jsonFilepath, content, 0644)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return carFileUrls, nil
+}
+
+// readCarFileDescs reads the car file json, kept as maps, so the fields unknown here are written back as they are
+func readCarFileDescs(jsonFilepath string) ([]map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(jsonFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var fileDescs []map[string]interface{}
+	err = json.Unmarshal(content, &fileDescs)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return fileDescs, nil
+}
+
+// rollbackCarCreationJob unpins the car file from ipfs and removes the work directories, the job is left RollingBack
+// when any of them fails, to be retried by SweepCarCreation. The swan task cannot be deleted, so the job which has
+// created it is not rolled back but kept running, to save the car file with the task in its next attempts
+func rollbackCarCreationJob(ctx context.Context, job *models.CarCreationJob, note string) error {
+	if getCarCreationStepIndex(job.Step) >= getCarCreationStepIndex(constants.CAR_CREATION_STEP_TASK_CREATED) {
+		err := keepCarCreationJobTask(job, note)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		return nil
+	}
+
+	err := models.UpdateCarCreationJobStatus(job.ID, constants.CAR_CREATION_JOB_STATUS_ROLLING_BACK, job.AttemptCnt, note)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	// unpinned before the car directory is removed, since the car files in it may be put again to find their cids
+	err = unpinCarCreationJobCarFiles(ctx, job)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = os.RemoveAll(job.SrcDir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = os.RemoveAll(job.CarDir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.UpdateCarCreationJobStatus(job.ID, constants.CAR_CREATION_JOB_STATUS_ROLLED_BACK, job.AttemptCnt, note)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("car creation job:", job.ID, " rolled back at step:", job.Step)
+	return nil
+}
+
+// keepCarCreationJobTask keeps the job which has created the swan task running and releases it, so it is resumed
+// by CreateTask with the task recorded, instead of leaving the task without a car file
+func keepCarCreationJobTask(job *models.CarCreationJob, note string) error {
+	err := models.UpdateCarCreationJobStatus(job.ID, constants.CAR_CREATION_JOB_STATUS_RUNNING, job.AttemptCnt, note)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.ReleaseCarCreationJobs([]int64{job.ID}, instanceId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Warn("car creation job:", job.ID, " not rolled back, its swan task:", *job.TaskUuid, " is kept for the car file to be saved")
+	return nil
+}
+
+// unpinCarCreationJobCarFiles unpins the car files of the job from the hot storage. When the job was interrupted
+// while uploading, the car files may have been pinned before their urls were recorded, they are put again from the
+// car directory recorded with the job to find their cids, which pins nothing new
+func unpinCarCreationJobCarFiles(ctx context.Context, job *models.CarCreationJob) error {
+	var cids []string
+	if job.CarFileUrl != nil && *job.CarFileUrl != "" {
+		cids = append(cids, hotstorage.GetCidFromUrl(*job.CarFileUrl))
+	}
+
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	jsonFilepath := filepath.Join(job.CarDir, constants.CAR_FILE_DESC_JSON_FILE_NAME)
+	if job.Step == constants.CAR_CREATION_STEP_CAR_CREATED && libutils.IsFileExistsFullPath(jsonFilepath) {
+		fileDescs, err := readCarFileDescs(jsonFilepath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		for _, fileDesc := range fileDescs {
+			carFilePath, _ := fileDesc["car_file_path"].(string)
+			if !libutils.IsFileExistsFullPath(carFilePath) {
+				continue
+			}
+
+			cid, err := hotStorage.Put(ctx, carFilePath)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				return err
+			}
+			cids = append(cids, cid)
+		}
+	}
+
+	for _, cid := range cids {
+		err = hotStorage.Unpin(ctx, cid)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resumeCarCreationJobs takes over the running jobs whose instance crashed or stopped, the jobs which had not copied
+// the source files are rolled back, others continue from the step recorded
+func resumeCarCreationJobs(ctx context.Context) {
+	jobs, err := models.GetCarCreationJobs2BeResumed(libutils.GetCurrentUtcSecond())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		ids, err := models.ClaimCarCreationJobs([]int64{job.ID}, instanceId, constants.ROW_LEASE_SECOND)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		if job.Step == constants.CAR_CREATION_STEP_CREATED {
+			err = rollbackCarCreationJob(ctx, job, "interrupted before source files copied")
+			if err != nil {
+				logs.GetLogger().Error(err)
+			}
+			continue
+		}
+
+		logs.GetLogger().Info("resuming car creation job:", job.ID, " after step:", job.Step)
+		jobLease, jobCtx := keepCarCreationJobLease(ctx, job)
+		err = runCarCreationJob(jobCtx, job, jobLease)
+		jobLease.stop()
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+}
+
+const JOB_NAME_SWEEP_CAR_CREATION = "SweepCarCreation"
+
+// SweepCarCreation retries the rollbacks failed, and removes the work directories left by crashes or earlier versions,
+// which are not used by any job not finished or car file, and not modified for CAR_CREATION_ORPHAN_DIR_SECOND
+func SweepCarCreation(ctx context.Context) error {
+	jobs, err := models.GetCarCreationJobsByStatus(constants.CAR_CREATION_JOB_STATUS_ROLLING_BACK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		note := ""
+		if job.Note != nil {
+			note = *job.Note
+		}
+
+		err = rollbackCarCreationJob(ctx, job, note)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+
+	fileInfos, err := ioutil.ReadDir(carDir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	modTimeMax := time.Now().Add(-constants.CAR_CREATION_ORPHAN_DIR_SECOND * time.Second)
+	for _, fileInfo := range fileInfos {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if !fileInfo.IsDir() || fileInfo.ModTime().After(modTimeMax) {
+			continue
+		}
+
+		dir := filepath.Join(carDir, fileInfo.Name())
+		isInUse, err := models.IsCarCreationDirInUse(dir)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		if !isInUse && !isCarSrcDir(fileInfo.Name()) {
+			isInUse, err = models.IsCarFileDirInUse(dir)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				continue
+			}
+		}
+
+		if isInUse {
+			continue
+		}
+
+		err = os.RemoveAll(dir)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		logs.GetLogger().Info("orphaned dir:", dir, " removed")
+	}
+
+	return nil
+}
+
+// isCarSrcDir checks whether the directory holds source files copied for a car, they are not needed after the car is created
+func isCarSrcDir(dirName string) bool {
+	return strings.HasPrefix(dirName, "src_") || strings.HasPrefix(dirName, "free_src_")
+}
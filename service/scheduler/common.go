@@ -1,13 +1,11 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
 	"multi-chain-storage/config"
 	"os"
 	"path/filepath"
-	"reflect"
-	"runtime"
-	"time"
 
 	"github.com/filswan/go-swan-lib/logs"
 	libutils "github.com/filswan/go-swan-lib/utils"
@@ -15,31 +13,38 @@ import (
 
 var carDir string
 var srcDir string
+var multipartDir string
 
 func GetSrcDir() string {
 	return srcDir
 }
 
-func InitScheduler() {
+func GetMultipartDir() string {
+	return multipartDir
+}
+
+func InitScheduler(ctx context.Context) {
 	createDir()
+	initInstanceId()
 
-	go runJob(CreateTask, config.GetConfig().ScheduleRule.CreateTaskIntervalSecond)
-	go runJob(SendDeal, config.GetConfig().ScheduleRule.SendDealIntervalSecond)
-	go runJob(ScanDeal, config.GetConfig().ScheduleRule.ScanDealStatusIntervalSecond)
-}
+	RegisterJob("CreateTask", CreateTask, config.GetConfig().ScheduleRule.CreateTaskIntervalSecond)
+	RegisterJob("SendDeal", SendDeal, config.GetConfig().ScheduleRule.SendDealIntervalSecond)
+	RegisterJob(JOB_NAME_GC_LOCAL_STORAGE, GcLocalStorage, config.GetConfig().ScheduleRule.GcLocalStorageIntervalSecond)
+	RegisterLeaderJob("ScanDeal", ScanDeal, config.GetConfig().ScheduleRule.ScanDealStatusIntervalSecond)
+	RegisterLeaderJob("MonitorReplica", MonitorReplica, config.GetConfig().ScheduleRule.MonitorReplicaIntervalSecond)
+	RegisterLeaderJob("ScanRenewal", ScanRenewal, config.GetConfig().ScheduleRule.ScanRenewalIntervalSecond)
+	RegisterLeaderJob("UpdateMinerReputation", UpdateMinerReputation, config.GetConfig().ScheduleRule.UpdateMinerReputationIntervalSecond)
+	RegisterLeaderJob(JOB_NAME_DISPATCH_EVENT, DispatchEvent, config.GetConfig().ScheduleRule.DispatchEventIntervalSecond)
+	RegisterLeaderJob(JOB_NAME_SWEEP_CAR_CREATION, SweepCarCreation, config.GetConfig().ScheduleRule.SweepCarCreationIntervalSecond)
+	RegisterLeaderJob(JOB_NAME_PROCESS_PIN_REQUEST, ProcessPinRequest, config.GetConfig().ScheduleRule.ProcessPinRequestIntervalSecond)
+	RegisterLeaderJob(JOB_NAME_RECONCILE_PIN, ReconcilePin, config.GetConfig().ScheduleRule.ReconcilePinIntervalSecond)
+	RegisterLeaderJob(JOB_NAME_UNPIN_SOURCE_FILE, UnpinSourceFile, config.GetConfig().ScheduleRule.UnpinSourceFileIntervalSecond)
+	RegisterLeaderJob(JOB_NAME_CHECK_RETRIEVAL, CheckRetrieval, config.GetConfig().ScheduleRule.CheckRetrievalIntervalSecond)
+	RegisterLeaderJob(JOB_NAME_SYNC_DENYLIST, SyncDenylist, config.GetConfig().ScheduleRule.SyncDenylistIntervalSecond)
 
-func runJob(func2Run func() error, intervalSecond time.Duration) {
-	for {
-		funcName := runtime.FuncForPC(reflect.ValueOf(func2Run).Pointer()).Name()
-		logs.GetLogger().Info(funcName, " start")
-		err := func2Run()
-		if err != nil {
-			logs.GetLogger().Error(err)
-		}
-		logs.GetLogger().Info(funcName, " end")
-
-		time.Sleep(intervalSecond * time.Second)
-	}
+	subscribeEvents()
+
+	startJobs(ctx)
 }
 
 func createDir() {
@@ -70,9 +75,16 @@ func createDir() {
 	}
 
 	carDir = filepath.Join(dealDir, "car")
-	err = libutils.CreateDir(srcDir)
+	err = libutils.CreateDir(carDir)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		logs.GetLogger().Fatal("creating dir:", carDir, " failed")
 	}
+
+	multipartDir = filepath.Join(dealDir, "multipart")
+	err = libutils.CreateDir(multipartDir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		logs.GetLogger().Fatal("creating dir:", multipartDir, " failed")
+	}
 }
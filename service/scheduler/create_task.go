@@ -1,11 +1,13 @@
 package scheduler
 
 import (
+	"context"
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/common/utils"
 	"multi-chain-storage/config"
 	"multi-chain-storage/database"
 	"multi-chain-storage/models"
+	"multi-chain-storage/service/denylist"
 	"os"
 	"path/filepath"
 	"time"
@@ -18,9 +20,11 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-func CreateTask() error {
-	for {
-		numSrcFiles, err := createTask()
+func CreateTask(ctx context.Context) error {
+	resumeCarCreationJobs(ctx)
+
+	for ctx.Err() == nil {
+		numSrcFiles, err := createTask(ctx)
 		if err != nil {
 			logs.GetLogger().Error(err)
 		} else {
@@ -33,8 +37,8 @@ func CreateTask() error {
 		}
 	}
 
-	for {
-		numSrcFiles, err := createTaskForFreeFiles()
+	for ctx.Err() == nil {
+		numSrcFiles, err := createTaskForFreeFiles(ctx)
 		if err != nil {
 			logs.GetLogger().Error(err)
 		} else {
@@ -50,13 +54,44 @@ func CreateTask() error {
 	return nil
 }
 
-func createTask() (*int, error) {
+// filterDeniedSourceFileUploads skips the uploads whose content is in the denylist, by its cid or its hash, the ones
+// removed by the admin or of blocked wallets are not returned by the query already
+func filterDeniedSourceFileUploads(srcFileUploads []*models.SourceFileUploadNeed2Car) []*models.SourceFileUploadNeed2Car {
+	var srcFileUploadsAllowed []*models.SourceFileUploadNeed2Car
+	for _, srcFileUpload := range srcFileUploads {
+		contentSha256 := ""
+		if srcFileUpload.ContentSha256 != nil {
+			contentSha256 = *srcFileUpload.ContentSha256
+		}
+
+		err := denylist.CheckContent(srcFileUpload.PayloadCid, contentSha256)
+		if err != nil {
+			logs.GetLogger().Error("source file upload:", srcFileUpload.SourceFileUploadId, " skipped, ", err)
+			continue
+		}
+
+		srcFileUploadsAllowed = append(srcFileUploadsAllowed, srcFileUpload)
+	}
+
+	return srcFileUploadsAllowed
+}
+
+func createTask(ctx context.Context) (*int, error) {
 	srcFileUploads, err := models.GetSourceFileUploadsNeed2Car()
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
+	srcFileUploads = filterDeniedSourceFileUploads(srcFileUploads)
+
+	srcFileUploads, err = claimSourceFileUploads(srcFileUploads, constants.SOURCE_FILE_UPLOAD_STATUS_PAID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer releaseSourceFileUploads(srcFileUploads)
+
 	if len(srcFileUploads) == 0 {
 		logs.GetLogger().Info("0 source file upload to be created to car file")
 		return nil, nil
@@ -66,12 +101,18 @@ func createTask() (*int, error) {
 	carSrcDir := filepath.Join(carDir, "src_"+currentTimeStr)
 	carDestDir := filepath.Join(carDir, "car_"+currentTimeStr)
 
-	err = libutils.CreateDir(carSrcDir)
+	job, err := startCarCreationJob(carSrcDir, carDestDir, false)
 	if err != nil {
-		logs.GetLogger().Error("creating dir:", carSrcDir, " failed,", err)
+		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
+	jobLease, ctx := keepCarCreationJobLease(ctx, job)
+	defer jobLease.stop()
+
+	srcFileUploadLeases, copyCtx := keepSourceFileUploadLeases(ctx, srcFileUploads)
+	defer srcFileUploadLeases.stop()
+
 	totalSize := int64(0)
 	currentUtcSec := libutils.GetCurrentUtcSecond()
 	createdTimeMin := currentUtcSec
@@ -80,19 +121,28 @@ func createTask() (*int, error) {
 	systemParam, err := utils.GetSystemParam("")
 	if err != nil {
 		logs.GetLogger().Error(err)
+		discardCarCreationJob(job)
 		return nil, err
 	}
 
 	fileSizeMin := config.GetConfig().SwanTask.MinFileSize
 	var srcFiles2Merged []*models.SourceFileUploadNeed2Car
 	for _, srcFileUpload := range srcFileUploads {
+		if copyCtx.Err() != nil {
+			break
+		}
+
+		if srcFileUploadLeases.isLost(srcFileUpload.SourceFileUploadId) {
+			continue
+		}
+
 		srcFilepathTemp := filepath.Join(carSrcDir, filepath.Base(srcFileUpload.ResourceUri))
 		bytesCopied, err := libutils.CopyFile(srcFileUpload.ResourceUri, srcFilepathTemp)
 		if err != nil {
 			logs.GetLogger().Info(err)
 			os.Remove(srcFilepathTemp)
 			logs.GetLogger().Info("downloading ", srcFileUpload.IpfsUrl, " to ", srcFilepathTemp)
-			err = utils.DownloadFile(srcFileUpload.IpfsUrl, srcFilepathTemp)
+			err = utils.DownloadFile(copyCtx, srcFileUpload.IpfsUrl, srcFilepathTemp)
 			if err != nil {
 				logs.GetLogger().Error(err)
 				os.Remove(srcFilepathTemp)
@@ -128,8 +178,21 @@ func createTask() (*int, error) {
 		}
 	}
 
+	if copyCtx.Err() != nil {
+		// the job taken over by another instance is left to it
+		if jobLease.isLost(job.ID) {
+			return nil, models.ErrLeaseLost
+		}
+
+		discardCarCreationJob(job)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, models.ErrLeaseLost
+	}
+
 	if totalSize == 0 {
-		os.RemoveAll(carSrcDir)
+		discardCarCreationJob(job)
 		logs.GetLogger().Info("0 source file to be created to car file")
 		return nil, nil
 	}
@@ -150,38 +213,23 @@ func createTask() (*int, error) {
 
 	if !createAnyway {
 		logs.GetLogger().Info("cannot meet conditions to create car file, wait")
-		os.RemoveAll(carSrcDir)
+		discardCarCreationJob(job)
 		return nil, nil
 	}
 
-	err = libutils.CreateDir(carDestDir)
-	if err != nil {
-		logs.GetLogger().Error("creating dir:", carDestDir, " failed,", err)
-		os.RemoveAll(carSrcDir)
-		return nil, err
-	}
-
-	fileDesc, err := createTask4SrcFiles(carSrcDir, carDestDir, *maxPrice)
+	err = copiedCarCreationJob(job, srcFiles2Merged, *maxPrice)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		os.RemoveAll(carSrcDir)
-		//os.RemoveAll(carDestDir)
+		discardCarCreationJob(job)
 		return nil, err
 	}
 
-	err = saveCarInfo2DB(fileDesc, srcFiles2Merged, *maxPrice, false)
+	err = runCarCreationJob(ctx, job, jobLease)
 	if err != nil {
-		os.RemoveAll(carSrcDir)
-		//os.RemoveAll(carDestDir)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	err = os.RemoveAll(carSrcDir)
-	if err != nil {
-		logs.GetLogger().Error(err)
-	}
-
 	numSrcFiles := len(srcFiles2Merged)
 	return &numSrcFiles, nil
 }
@@ -205,13 +253,22 @@ func getMaxPrice(fileSize int64, lockedFee decimal.Decimal, rate int64) (*decima
 	return &maxPrice, nil
 }
 
-func createTaskForFreeFiles() (*int, error) {
+func createTaskForFreeFiles(ctx context.Context) (*int, error) {
 	srcFileUploads, err := models.GetFreeSourceFileUploadsNeed2Car()
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
+	srcFileUploads = filterDeniedSourceFileUploads(srcFileUploads)
+
+	srcFileUploads, err = claimSourceFileUploads(srcFileUploads, constants.SOURCE_FILE_UPLOAD_STATUS_FREE)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer releaseSourceFileUploads(srcFileUploads)
+
 	if len(srcFileUploads) == 0 {
 		logs.GetLogger().Info("0 free source file upload to be created to car file")
 		return nil, nil
@@ -221,12 +278,18 @@ func createTaskForFreeFiles() (*int, error) {
 	carSrcDir := filepath.Join(carDir, "free_src_"+currentTimeStr)
 	carDestDir := filepath.Join(carDir, "free_car_"+currentTimeStr)
 
-	err = libutils.CreateDir(carSrcDir)
+	job, err := startCarCreationJob(carSrcDir, carDestDir, true)
 	if err != nil {
-		logs.GetLogger().Error("creating dir:", carSrcDir, " failed,", err)
+		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
+	jobLease, ctx := keepCarCreationJobLease(ctx, job)
+	defer jobLease.stop()
+
+	srcFileUploadLeases, copyCtx := keepSourceFileUploadLeases(ctx, srcFileUploads)
+	defer srcFileUploadLeases.stop()
+
 	totalSize := int64(0)
 	currentUtcSec := libutils.GetCurrentUtcSecond()
 	createdTimeMinSec := currentUtcSec
@@ -234,13 +297,21 @@ func createTaskForFreeFiles() (*int, error) {
 	fileSizeMin := config.GetConfig().SwanTask.MinFileSize
 	var srcFiles2Merged []*models.SourceFileUploadNeed2Car
 	for _, srcFileUpload := range srcFileUploads {
+		if copyCtx.Err() != nil {
+			break
+		}
+
+		if srcFileUploadLeases.isLost(srcFileUpload.SourceFileUploadId) {
+			continue
+		}
+
 		srcFilepathTemp := filepath.Join(carSrcDir, filepath.Base(srcFileUpload.ResourceUri))
 		bytesCopied, err := libutils.CopyFile(srcFileUpload.ResourceUri, srcFilepathTemp)
 		if err != nil {
 			logs.GetLogger().Info(err)
 			os.Remove(srcFilepathTemp)
 			logs.GetLogger().Info("downloading ", srcFileUpload.IpfsUrl, " to ", srcFilepathTemp)
-			err = utils.DownloadFile(srcFileUpload.IpfsUrl, srcFilepathTemp)
+			err = utils.DownloadFile(copyCtx, srcFileUpload.IpfsUrl, srcFilepathTemp)
 			if err != nil {
 				logs.GetLogger().Error(err)
 				os.Remove(srcFilepathTemp)
@@ -264,8 +335,21 @@ func createTaskForFreeFiles() (*int, error) {
 		}
 	}
 
+	if copyCtx.Err() != nil {
+		// the job taken over by another instance is left to it
+		if jobLease.isLost(job.ID) {
+			return nil, models.ErrLeaseLost
+		}
+
+		discardCarCreationJob(job)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, models.ErrLeaseLost
+	}
+
 	if totalSize == 0 {
-		os.RemoveAll(carSrcDir)
+		discardCarCreationJob(job)
 		logs.GetLogger().Info("0 source file to be created to car file")
 		return nil, nil
 	}
@@ -282,74 +366,29 @@ func createTaskForFreeFiles() (*int, error) {
 
 	if !createAnyway {
 		logs.GetLogger().Info("cannot meet conditions to create car file, wait")
-		os.RemoveAll(carSrcDir)
+		discardCarCreationJob(job)
 		return nil, nil
 	}
 
-	err = libutils.CreateDir(carDestDir)
-	if err != nil {
-		logs.GetLogger().Error("creating dir:", carDestDir, " failed,", err)
-		os.RemoveAll(carSrcDir)
-		return nil, err
-	}
-
-	maxPrice := config.GetConfig().SwanTask.MaxPrice
-	fileDesc, err := createTask4SrcFiles(carSrcDir, carDestDir, maxPrice)
+	err = copiedCarCreationJob(job, srcFiles2Merged, config.GetConfig().SwanTask.MaxPrice)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		os.RemoveAll(carSrcDir)
-		//os.RemoveAll(carDestDir)
+		discardCarCreationJob(job)
 		return nil, err
 	}
 
-	err = saveCarInfo2DB(fileDesc, srcFiles2Merged, maxPrice, true)
+	err = runCarCreationJob(ctx, job, jobLease)
 	if err != nil {
-		os.RemoveAll(carSrcDir)
-		//os.RemoveAll(carDestDir)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	err = os.RemoveAll(carSrcDir)
-	if err != nil {
-		logs.GetLogger().Error(err)
-	}
-
 	numSrcFiles := len(srcFiles2Merged)
 	return &numSrcFiles, nil
 }
 
-func createTask4SrcFiles(srcDir, carDir string, maxPrice decimal.Decimal) (*libmodel.FileDesc, error) {
-	cmdIpfsCar := &command.CmdIpfsCar{
-		LotusClientApiUrl:         config.GetConfig().Lotus.ClientApiUrl,
-		LotusClientAccessToken:    config.GetConfig().Lotus.ClientAccessToken,
-		InputDir:                  srcDir,
-		OutputDir:                 carDir,
-		GenerateMd5:               false,
-		IpfsServerUploadUrlPrefix: config.GetConfig().IpfsServer.UploadUrlPrefix,
-	}
-
-	_, err := cmdIpfsCar.CreateIpfsCarFiles()
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-	logs.GetLogger().Info("car files created to ", carDir, " from ", srcDir)
-
-	cmdUpload := command.CmdUpload{
-		StorageServerType:           libconstants.STORAGE_SERVER_TYPE_IPFS_SERVER,
-		IpfsServerDownloadUrlPrefix: config.GetConfig().IpfsServer.DownloadUrlPrefix,
-		IpfsServerUploadUrlPrefix:   config.GetConfig().IpfsServer.UploadUrlPrefix,
-		InputDir:                    carDir,
-	}
-
-	_, err = cmdUpload.UploadCarFiles()
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-	logs.GetLogger().Info("car files uploaded to ipfs from ", carDir)
-
+// createSwanTask creates a swan auto-bid task for the car files in carDir, which must have been uploaded already
+func createSwanTask(carDir string, maxPrice decimal.Decimal, replicaCount int) (*libmodel.FileDesc, error) {
 	cmdTask := command.CmdTask{
 		SwanApiUrl:                 config.GetConfig().SwanApi.ApiUrl,
 		SwanToken:                  "",
@@ -371,7 +410,7 @@ func createTask4SrcFiles(srcDir, carDir string, maxPrice decimal.Decimal) (*libm
 		StartEpochHours:            config.GetConfig().SwanTask.StartEpochHours,
 		SourceId:                   constants.SOURCE_ID_MCS,
 		Duration:                   constants.DURATION_DAYS_DEFAULT * 24 * 60 * 2,
-		MaxAutoBidCopyNumber:       5,
+		MaxAutoBidCopyNumber:       replicaCount,
 	}
 
 	_, fileDescs, _, err := cmdTask.CreateTask(nil)
@@ -387,8 +426,9 @@ func createTask4SrcFiles(srcDir, carDir string, maxPrice decimal.Decimal) (*libm
 	return fileDesc, nil
 }
 
-func saveCarInfo2DB(fileDesc *libmodel.FileDesc, srcFiles []*models.SourceFileUploadNeed2Car, maxPrice decimal.Decimal, isFree bool) error {
-	db := database.GetDBTransaction()
+// saveCarInfo2DB saves the car file and marks the car creation job succeeded in one transaction
+func saveCarInfo2DB(ctx context.Context, job *models.CarCreationJob, fileDesc *libmodel.FileDesc, srcFiles []*models.SourceFileUploadNeed2Car) error {
+	db := database.GetDBTransactionContext(ctx)
 	currentUtcSecond := libutils.GetCurrentUtcSecond()
 	carFile := models.CarFile{
 		CarFileName: fileDesc.CarFileName,
@@ -400,8 +440,8 @@ func saveCarInfo2DB(fileDesc *libmodel.FileDesc, srcFiles []*models.SourceFileUp
 		UpdateAt:    currentUtcSecond,
 		Duration:    constants.DURATION_DAYS_DEFAULT,
 		Status:      constants.CAR_FILE_STATUS_TASK_CREATED,
-		IsFree:      isFree,
-		MaxPrice:    maxPrice,
+		IsFree:      job.IsFree,
+		MaxPrice:    job.MaxPrice,
 		TaskUuid:    fileDesc.Uuid,
 	}
 
@@ -438,11 +478,26 @@ func saveCarInfo2DB(fileDesc *libmodel.FileDesc, srcFiles []*models.SourceFileUp
 		}
 	}
 
+	err = models.UpdateCarCreationJobSucceededInTransaction(db, job.ID, carFile.ID)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = publishEventInTransaction(db, constants.EVENT_TYPE_CAR_CREATED, carFile.ID)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
 	err = db.Commit().Error
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
+	notifyEventDispatcher()
 	return nil
 }
@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/denylist"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const JOB_NAME_SYNC_DENYLIST = "SyncDenylist"
+
+// SyncDenylist imports the lists in [denylist].urls, the entries no longer in a list are removed, nothing is done
+// without urls. A list failing to be imported keeps its entries imported before
+func SyncDenylist(ctx context.Context) error {
+	var lastErr error
+	for _, url := range config.GetConfig().Denylist.Urls {
+		if ctx.Err() != nil {
+			break
+		}
+
+		savedCnt, removedCnt, err := denylist.ImportDenylist(ctx, url)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			lastErr = err
+			continue
+		}
+
+		detail := fmt.Sprintf("saved:%d, removed:%d", savedCnt, removedCnt)
+		err = models.CreateAuditLog(constants.AUDIT_LOG_ACTOR_SYSTEM, nil, constants.AUDIT_LOG_ACTION_DENYLIST_IMPORT, constants.AUDIT_LOG_TARGET_TYPE_DENYLIST, url, &detail)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"strings"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/jinzhu/gorm"
+)
+
+type EventHandler func(event *models.EventOutbox) error
+
+var eventHandlers = map[string][]EventHandler{}
+var eventHandlersMutex sync.Mutex
+
+// SubscribeEvent adds a handler called for each event of the type once it is dispatched from the outbox
+func SubscribeEvent(eventType string, handler EventHandler) {
+	eventHandlersMutex.Lock()
+	defer eventHandlersMutex.Unlock()
+
+	eventHandlers[eventType] = append(eventHandlers[eventType], handler)
+}
+
+// subscribeJob runs the job once the event is dispatched, the job still runs on its interval as a fallback
+func subscribeJob(eventType, jobName string) {
+	SubscribeEvent(eventType, func(event *models.EventOutbox) error {
+		return TriggerJob(jobName)
+	})
+}
+
+func subscribeEvents() {
+	subscribeJob(constants.EVENT_TYPE_UPLOAD_PAID, "CreateTask")
+	subscribeJob(constants.EVENT_TYPE_CAR_CREATED, "SendDeal")
+	subscribeJob(constants.EVENT_TYPE_DEAL_SENT, "ScanDeal")
+	subscribeJob(constants.EVENT_TYPE_DEAL_ACTIVE, "MonitorReplica")
+}
+
+// PublishEvent records the event in the outbox and wakes up the dispatcher
+func PublishEvent(eventType string, entityId int64) {
+	err := models.CreateEvent(eventType, entityId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return
+	}
+
+	notifyEventDispatcher()
+}
+
+// publishEventInTransaction records the event with the state change, the dispatcher should be notified after commit
+func publishEventInTransaction(db *gorm.DB, eventType string, entityId int64) error {
+	err := models.CreateEventInTransaction(db, eventType, entityId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func notifyEventDispatcher() {
+	err := TriggerJob(JOB_NAME_DISPATCH_EVENT)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+const JOB_NAME_DISPATCH_EVENT = "DispatchEvent"
+
+// DispatchEvent passes the pending events in the outbox to their handlers in order, the events failed are retried
+// in the next runs till EVENT_ATTEMPT_MAX
+func DispatchEvent(ctx context.Context) error {
+	events, err := models.GetEventsPending(constants.EVENT_DISPATCH_BATCH_SIZE)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			break
+		}
+
+		eventHandlersMutex.Lock()
+		handlers := eventHandlers[event.EventType]
+		eventHandlersMutex.Unlock()
+
+		var errMsgs []string
+		for _, handler := range handlers {
+			err := handler(event)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				errMsgs = append(errMsgs, err.Error())
+			}
+		}
+
+		status := constants.EVENT_STATUS_DISPATCHED
+		attemptCnt := event.AttemptCnt + 1
+		note := ""
+		if len(errMsgs) > 0 {
+			note = strings.Join(errMsgs, ";")
+			status = constants.EVENT_STATUS_PENDING
+			if attemptCnt >= constants.EVENT_ATTEMPT_MAX {
+				status = constants.EVENT_STATUS_FAILED
+			}
+		}
+
+		err = models.UpdateEventStatus(event.ID, status, attemptCnt, note)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		logs.GetLogger().Info(fmt.Sprintf("event:%d %s of entity:%d %s", event.ID, event.EventType, event.EntityId, status))
+	}
+
+	dispatchAtMax := libutils.GetCurrentUtcSecond() - constants.EVENT_RETENTION_SECOND
+	err = models.DeleteEventsDispatched(dispatchAtMax)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
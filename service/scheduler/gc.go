@@ -0,0 +1,388 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/hotstorage"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+type GcItem struct {
+	Kind   string `json:"kind"`
+	Id     int64  `json:"id,omitempty"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+type GcReport struct {
+	DryRun                   bool             `json:"dry_run"`
+	StartAt                  int64            `json:"start_at"`
+	DiskUsage                *utils.DiskUsage `json:"disk_usage"`
+	DiskHighWatermarkPercent int              `json:"disk_high_watermark_percent"`
+	DiskLowWatermarkPercent  int              `json:"disk_low_watermark_percent"`
+	ItemCnt                  int              `json:"item_cnt"`
+	ItemSize                 int64            `json:"item_size"`
+	DeletedCnt               int              `json:"deleted_cnt"`
+	DeletedSize              int64            `json:"deleted_size"`
+	FailedCnt                int              `json:"failed_cnt"`
+	LatencyMillisecond       int64            `json:"latency_millisecond"`
+	Items                    []*GcItem        `json:"items,omitempty"`
+	itemPaths                map[string]bool
+}
+
+type GcStat struct {
+	LastRun          *GcReport `json:"last_run"`
+	RunCnt           int       `json:"run_cnt"`
+	TotalDeletedCnt  int       `json:"total_deleted_cnt"`
+	TotalDeletedSize int64     `json:"total_deleted_size"`
+	TotalFailedCnt   int       `json:"total_failed_cnt"`
+}
+
+var gcStat GcStat
+var gcStatMutex sync.Mutex
+
+// GetGcStat returns the stat of the latest run of GcLocalStorage and the totals since the instance started
+func GetGcStat() *GcStat {
+	gcStatMutex.Lock()
+	defer gcStatMutex.Unlock()
+
+	stat := gcStat
+	if gcStat.LastRun != nil {
+		lastRun := *gcStat.LastRun
+		stat.LastRun = &lastRun
+	}
+
+	return &stat
+}
+
+const JOB_NAME_GC_LOCAL_STORAGE = "GcLocalStorage"
+
+// GcLocalStorage removes the local copies no longer needed, it runs on each instance since the files are local to it
+func GcLocalStorage(ctx context.Context) error {
+	report, err := collectLocalGarbage(ctx, config.GetConfig().Retention.DryRun)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	report.Items = nil
+
+	gcStatMutex.Lock()
+	gcStat.LastRun = report
+	gcStat.RunCnt++
+	gcStat.TotalDeletedCnt += report.DeletedCnt
+	gcStat.TotalDeletedSize += report.DeletedSize
+	gcStat.TotalFailedCnt += report.FailedCnt
+	gcStatMutex.Unlock()
+
+	logs.GetLogger().Info("gc local storage, dry run:", report.DryRun, ", ", report.ItemCnt, " files of ", report.ItemSize, " bytes to be deleted, deleted:",
+		report.DeletedCnt, ", ", report.DeletedSize, " bytes, failed:", report.FailedCnt, ", latency:", report.LatencyMillisecond, "ms")
+	return nil
+}
+
+// GetGcReport returns the files GcLocalStorage would delete now, without deleting them
+func GetGcReport() (*GcReport, error) {
+	return collectLocalGarbage(context.Background(), true)
+}
+
+// collectLocalGarbage finds the local files to be deleted by the retention rules:
+// 1. source files pinned on ipfs and all of whose uploads have been created to car files
+// 2. car files with at least car_replica_active_min replicas active, and not being renewed or repaired
+// 3. when disk usage reaches the high watermark, car files with at least car_replica_active_min_under_pressure
+// replicas active, oldest first, till the usage drops to the low watermark
+// 4. parts of the s3 multipart uploads expired, or not recorded any more
+func collectLocalGarbage(ctx context.Context, dryRun bool) (*GcReport, error) {
+	retention := config.GetConfig().Retention
+	startTime := time.Now()
+	report := &GcReport{
+		DryRun:                   dryRun,
+		StartAt:                  libutils.GetCurrentUtcSecond(),
+		DiskHighWatermarkPercent: retention.DiskHighWatermarkPercent,
+		DiskLowWatermarkPercent:  retention.DiskLowWatermarkPercent,
+		itemPaths:                map[string]bool{},
+	}
+
+	diskUsage, err := utils.GetDiskUsage(carDir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+	report.DiskUsage = diskUsage
+
+	if !retention.KeepSrcFiles {
+		srcFiles, err := models.GetSourceFilesLocal2BeDeleted(srcDir)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		for _, srcFile := range srcFiles {
+			addGcItem(report, constants.GC_ITEM_KIND_SOURCE_FILE, srcFile.ID, srcFile.ResourceUri, "pinned on ipfs and created to car files")
+		}
+	}
+
+	if !retention.KeepCarFiles {
+		carFiles, err := models.GetCarFilesLocal2BeDeleted(retention.CarReplicaActiveMin)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		for _, carFile := range carFiles {
+			addGcItem(report, constants.GC_ITEM_KIND_CAR_FILE, 0, carFile.CarFilePath, fmt.Sprintf("%d replicas active", carFile.ActiveDealCnt))
+		}
+	}
+
+	err = addMultipartUploadGcItems(report)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	isUnderPressure := diskUsage != nil && diskUsage.UsedPercent >= float64(retention.DiskHighWatermarkPercent)
+	if isUnderPressure && !retention.KeepCarFiles && retention.CarReplicaActiveMinUnderPressure < retention.CarReplicaActiveMin {
+		carFiles, err := models.GetCarFilesLocal2BeDeleted(retention.CarReplicaActiveMinUnderPressure)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		usedTarget := int64(diskUsage.Total) * int64(retention.DiskLowWatermarkPercent) / 100
+		for _, carFile := range carFiles {
+			if int64(diskUsage.Used)-report.ItemSize <= usedTarget {
+				break
+			}
+
+			addGcItem(report, constants.GC_ITEM_KIND_CAR_FILE, 0, carFile.CarFilePath,
+				fmt.Sprintf("disk usage above %d%%, %d replicas active", retention.DiskHighWatermarkPercent, carFile.ActiveDealCnt))
+		}
+	}
+
+	if isUnderPressure && int64(diskUsage.Used)-report.ItemSize > int64(diskUsage.Total)*int64(retention.DiskLowWatermarkPercent)/100 {
+		logs.GetLogger().Warn("disk usage:", fmt.Sprintf("%.2f%%", diskUsage.UsedPercent), " above high watermark, cannot drop to low watermark by the retention rules")
+	}
+
+	if !dryRun {
+		for _, item := range report.Items {
+			if ctx.Err() != nil {
+				break
+			}
+
+			err := deleteGcItem(item)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				report.FailedCnt++
+				continue
+			}
+
+			report.DeletedCnt++
+			report.DeletedSize = report.DeletedSize + item.Size
+		}
+	}
+
+	report.LatencyMillisecond = time.Since(startTime).Milliseconds()
+	return report, nil
+}
+
+// addMultipartUploadGcItems adds the directories of the multipart uploads on this instance expired,
+// or not recorded any more, which are left when completed or aborted on another instance
+func addMultipartUploadGcItems(report *GcReport) error {
+	fileInfos, err := ioutil.ReadDir(multipartDir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() {
+			continue
+		}
+
+		multipartUpload, err := models.GetMultipartUploadByUploadId(fileInfo.Name())
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		path := filepath.Join(multipartDir, fileInfo.Name())
+		if multipartUpload == nil {
+			if fileInfo.ModTime().Unix() < currentUtcSecond-constants.S3_MULTIPART_UPLOAD_ORPHAN_SECOND {
+				addGcItem(report, constants.GC_ITEM_KIND_MULTIPART, 0, path, "multipart upload not recorded")
+			}
+			continue
+		}
+
+		if multipartUpload.CreateAt < currentUtcSecond-constants.S3_MULTIPART_UPLOAD_EXPIRE_SECOND {
+			addGcItem(report, constants.GC_ITEM_KIND_MULTIPART, multipartUpload.ID, path, "multipart upload expired")
+		}
+	}
+
+	return nil
+}
+
+// addGcItem adds the file to the report if it exists on this instance and is not added yet,
+// directories are added only for multipart uploads
+func addGcItem(report *GcReport, kind string, id int64, path, reason string) {
+	if report.itemPaths[path] {
+		return
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	size := fileInfo.Size()
+	if fileInfo.IsDir() {
+		if kind != constants.GC_ITEM_KIND_MULTIPART {
+			return
+		}
+
+		size = 0
+		filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				size = size + info.Size()
+			}
+			return nil
+		})
+	}
+
+	report.Items = append(report.Items, &GcItem{
+		Kind:   kind,
+		Id:     id,
+		Path:   path,
+		Size:   size,
+		Reason: reason,
+	})
+	report.itemPaths[path] = true
+	report.ItemCnt++
+	report.ItemSize = report.ItemSize + size
+}
+
+func deleteGcItem(item *GcItem) error {
+	var err error
+	if item.Kind == constants.GC_ITEM_KIND_MULTIPART {
+		err = os.RemoveAll(item.Path)
+	} else {
+		err = os.Remove(item.Path)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	switch item.Kind {
+	case constants.GC_ITEM_KIND_SOURCE_FILE:
+		err = models.UpdateSourceFileLocalDeleted(item.Id)
+	case constants.GC_ITEM_KIND_CAR_FILE:
+		err = models.UpdateCarFilesLocalDeleted(item.Path)
+	case constants.GC_ITEM_KIND_MULTIPART:
+		if item.Id > 0 {
+			err = models.DeleteMultipartUpload(item.Id)
+		}
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info(item.Kind, ":", item.Path, " of ", item.Size, " bytes deleted, ", item.Reason)
+	return nil
+}
+
+// errCarFileUnrecoverable is wrapped in the errors of the car files deleted locally that cannot be downloaded again
+var errCarFileUnrecoverable = errors.New("car file cannot be restored")
+
+// restoreCarFileLocal makes sure the car file is kept locally, it is downloaded again from the hot storage where its
+// car creation job uploaded it, if it has been deleted by GcLocalStorage
+func restoreCarFileLocal(ctx context.Context, carFile *models.CarFile) error {
+	if carFile.LocalDeletedAt == nil && libutils.IsFileExistsFullPath(carFile.CarFilePath) {
+		return nil
+	}
+
+	job, err := models.GetCarCreationJobByCarFilePath(carFile.CarFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if job == nil {
+		err := fmt.Errorf("%w, car file:%d not exists at %s, deleted from local storage and not uploaded to hot storage", errCarFileUnrecoverable, carFile.ID, carFile.CarFilePath)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	content, err := hotStorage.Get(ctx, hotstorage.GetCidFromUrl(*job.CarFileUrl))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	defer content.Close()
+
+	err = os.MkdirAll(filepath.Dir(carFile.CarFilePath), 0755)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	tmpFilepath := carFile.CarFilePath + ".restoring"
+	defer os.Remove(tmpFilepath)
+
+	tmpFile, err := os.Create(tmpFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	size, err := io.Copy(tmpFile, content)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if size != carFile.CarFileSize {
+		err := fmt.Errorf("car file:%d got %d bytes from hot storage, %d expected", carFile.ID, size, carFile.CarFileSize)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = os.Rename(tmpFilepath, carFile.CarFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.UpdateCarFilesLocalRestored(carFile.CarFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carFile.LocalDeletedAt = nil
+	logs.GetLogger().Info("car file:", carFile.ID, " restored from hot storage to ", carFile.CarFilePath)
+	return nil
+}
@@ -0,0 +1,270 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"multi-chain-storage/common/constants"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+type JobStatus struct {
+	Name               string  `json:"name"`
+	IntervalSecond     int64   `json:"interval_second"`
+	LeaderOnly         bool    `json:"leader_only"`
+	Paused             bool    `json:"paused"`
+	IsLeader           bool    `json:"is_leader"`
+	Running            bool    `json:"running"`
+	RunCnt             int64   `json:"run_cnt"`
+	FailCnt            int64   `json:"fail_cnt"`
+	LastRunAt          int64   `json:"last_run_at"`
+	LastDurationSecond float64 `json:"last_duration_second"`
+	LastError          string  `json:"last_error"`
+}
+
+type job struct {
+	func2Run       func(ctx context.Context) error
+	intervalSecond time.Duration
+	trigger        chan struct{}
+	mutex          sync.Mutex
+	status         JobStatus
+}
+
+var jobs = map[string]*job{}
+var jobNames []string
+var jobsMutex sync.Mutex
+
+var jobsWaitGroup sync.WaitGroup
+
+// RegisterJob adds a job run every intervalSecond once the scheduler starts, the name is used by the admin apis,
+// the job should claim its units of work itself when several instances share the same database. The ctx given to
+// the job is cancelled when the scheduler stops, the job should check it between its units of work and pass it to
+// the calls which may block, so that the scheduler can be drained in time
+func RegisterJob(name string, func2Run func(ctx context.Context) error, intervalSecond time.Duration) {
+	registerJob(name, func2Run, intervalSecond, false)
+}
+
+// RegisterLeaderJob adds a job run by one instance only at a time, among the instances sharing the same database
+func RegisterLeaderJob(name string, func2Run func(ctx context.Context) error, intervalSecond time.Duration) {
+	registerJob(name, func2Run, intervalSecond, true)
+}
+
+func registerJob(name string, func2Run func(ctx context.Context) error, intervalSecond time.Duration, leaderOnly bool) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	if _, ok := jobs[name]; ok {
+		logs.GetLogger().Fatal("job:", name, " registered more than once")
+	}
+
+	jobs[name] = &job{
+		func2Run:       func2Run,
+		intervalSecond: intervalSecond,
+		trigger:        make(chan struct{}, 1),
+		status: JobStatus{
+			Name:           name,
+			IntervalSecond: int64(intervalSecond),
+			LeaderOnly:     leaderOnly,
+		},
+	}
+	jobNames = append(jobNames, name)
+}
+
+func startJobs(ctx context.Context) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	for _, name := range jobNames {
+		jobsWaitGroup.Add(1)
+		go runJob(ctx, jobs[name])
+	}
+}
+
+// WaitJobs waits for the running jobs to end after the context of the scheduler is cancelled, it returns false on timeout
+func WaitJobs(timeout time.Duration) bool {
+	jobsDone := make(chan struct{})
+	go func() {
+		jobsWaitGroup.Wait()
+		close(jobsDone)
+	}()
+
+	select {
+	case <-jobsDone:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func runJob(ctx context.Context, job *job) {
+	defer jobsWaitGroup.Done()
+
+	runForced := false
+	for {
+		job.mutex.Lock()
+		paused := job.status.Paused
+		job.mutex.Unlock()
+
+		if runForced || !paused {
+			job.run(ctx)
+		}
+		runForced = false
+
+		select {
+		case <-ctx.Done():
+			if job.status.LeaderOnly {
+				releaseJobLease(job)
+			}
+			logs.GetLogger().Info(job.status.Name, " stopped")
+			return
+		case <-job.trigger:
+			runForced = true
+		case <-time.After(withJitter(job.intervalSecond * time.Second)):
+		}
+	}
+}
+
+func (job *job) run(ctx context.Context) {
+	if job.status.LeaderOnly {
+		isLeader := acquireJobLease(job)
+
+		job.mutex.Lock()
+		job.status.IsLeader = isLeader
+		job.mutex.Unlock()
+
+		if !isLeader {
+			logs.GetLogger().Info(job.status.Name, " is run by another instance, skip")
+			return
+		}
+
+		runDone := make(chan struct{})
+		defer close(runDone)
+		go renewJobLease(job, runDone)
+	}
+
+	job.mutex.Lock()
+	job.status.Running = true
+	job.status.LastRunAt = libutils.GetCurrentUtcSecond()
+	job.mutex.Unlock()
+
+	logs.GetLogger().Info(job.status.Name, " start")
+	startTime := time.Now()
+	err := job.runWithRecover(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+	logs.GetLogger().Info(job.status.Name, " end")
+
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.status.Running = false
+	job.status.RunCnt++
+	job.status.LastDurationSecond = time.Since(startTime).Seconds()
+	job.status.LastError = ""
+	if err != nil {
+		job.status.FailCnt++
+		job.status.LastError = err.Error()
+	}
+}
+
+func (job *job) runWithRecover(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job:%s panic:%v, stack:%s", job.status.Name, r, debug.Stack())
+		}
+	}()
+
+	return job.func2Run(ctx)
+}
+
+// withJitter spreads the runs of the jobs by a random part of their interval
+func withJitter(interval time.Duration) time.Duration {
+	jitterMax := int64(interval) * constants.JOB_JITTER_PERCENT / 100
+	if jitterMax <= 0 {
+		return interval
+	}
+
+	return interval - time.Duration(jitterMax/2) + time.Duration(rand.Int63n(jitterMax))
+}
+
+func getJob(name string) (*job, error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	job, ok := jobs[name]
+	if !ok {
+		err := fmt.Errorf("job:%s not exists", name)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func GetJobStatuses() []*JobStatus {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	var jobStatuses []*JobStatus
+	for _, name := range jobNames {
+		job := jobs[name]
+		job.mutex.Lock()
+		jobStatus := job.status
+		job.mutex.Unlock()
+		jobStatuses = append(jobStatuses, &jobStatus)
+	}
+
+	return jobStatuses
+}
+
+func PauseJob(name string) error {
+	job, err := getJob(name)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	job.mutex.Lock()
+	job.status.Paused = true
+	job.mutex.Unlock()
+
+	logs.GetLogger().Info("job:", name, " paused")
+	return nil
+}
+
+func ResumeJob(name string) error {
+	job, err := getJob(name)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	job.mutex.Lock()
+	job.status.Paused = false
+	job.mutex.Unlock()
+
+	logs.GetLogger().Info("job:", name, " resumed")
+	return nil
+}
+
+// TriggerJob runs the job once right after its current run or wait, even if it is paused
+func TriggerJob(name string) error {
+	job, err := getJob(name)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	select {
+	case job.trigger <- struct{}{}:
+	default:
+	}
+
+	logs.GetLogger().Info("job:", name, " triggered")
+	return nil
+}
@@ -0,0 +1,278 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/google/uuid"
+)
+
+// instanceId identifies this process as the owner of the leases, when several instances share the same database
+var instanceId string
+
+func initInstanceId() {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		hostname = "unknown"
+	}
+
+	instanceId = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+	logs.GetLogger().Info("scheduler instance id:", instanceId)
+}
+
+// claimSourceFileUploads returns the source file uploads still in the status leased by this instance, others are being
+// or have been handled by other instances
+func claimSourceFileUploads(srcFileUploads []*models.SourceFileUploadNeed2Car, status string) ([]*models.SourceFileUploadNeed2Car, error) {
+	var ids []int64
+	for _, srcFileUpload := range srcFileUploads {
+		ids = append(ids, srcFileUpload.SourceFileUploadId)
+	}
+
+	idsClaimed, err := models.ClaimSourceFileUploads(ids, status, instanceId, constants.ROW_LEASE_SECOND)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	claimed := map[int64]bool{}
+	for _, id := range idsClaimed {
+		claimed[id] = true
+	}
+
+	var srcFileUploadsClaimed []*models.SourceFileUploadNeed2Car
+	for _, srcFileUpload := range srcFileUploads {
+		if claimed[srcFileUpload.SourceFileUploadId] {
+			srcFileUploadsClaimed = append(srcFileUploadsClaimed, srcFileUpload)
+		}
+	}
+
+	return srcFileUploadsClaimed, nil
+}
+
+func releaseSourceFileUploads(srcFileUploads []*models.SourceFileUploadNeed2Car) {
+	var ids []int64
+	for _, srcFileUpload := range srcFileUploads {
+		ids = append(ids, srcFileUpload.SourceFileUploadId)
+	}
+
+	err := models.ReleaseSourceFileUploads(ids, instanceId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+// claimCarFiles returns the car files still in the status leased by this instance
+func claimCarFiles(carFiles []*models.CarFile, status string) ([]*models.CarFile, error) {
+	var ids []int64
+	for _, carFile := range carFiles {
+		ids = append(ids, carFile.ID)
+	}
+
+	idsClaimed, err := models.ClaimCarFiles(ids, status, instanceId, constants.ROW_LEASE_SECOND)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	claimed := map[int64]bool{}
+	for _, id := range idsClaimed {
+		claimed[id] = true
+	}
+
+	var carFilesClaimed []*models.CarFile
+	for _, carFile := range carFiles {
+		if claimed[carFile.ID] {
+			carFilesClaimed = append(carFilesClaimed, carFile)
+		}
+	}
+
+	return carFilesClaimed, nil
+}
+
+func releaseCarFiles(carFiles []*models.CarFile) {
+	var ids []int64
+	for _, carFile := range carFiles {
+		ids = append(ids, carFile.ID)
+	}
+
+	err := models.ReleaseCarFiles(ids, instanceId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+// rowLeases keeps the leases of the rows claimed by this instance while they are handled, the rows whose leases expired
+// and were claimed by another instance are lost, and must not be handled any more
+type rowLeases struct {
+	name   string
+	renew  func(ids []int64, owner string, leaseSecond int64) ([]int64, error)
+	mutex  sync.Mutex
+	ids    []int64
+	lost   map[int64]bool
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// keepRowLeases renews the leases of the rows every third of ROW_LEASE_SECOND till stop is called, so that handling
+// them longer than the lease keeps them. The context returned is cancelled once all of them are lost
+func keepRowLeases(ctx context.Context, name string, ids []int64, renew func(ids []int64, owner string, leaseSecond int64) ([]int64, error)) (*rowLeases, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	leases := &rowLeases{
+		name:   name,
+		renew:  renew,
+		ids:    ids,
+		lost:   map[int64]bool{},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(constants.ROW_LEASE_SECOND) * time.Second / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-leases.done:
+				return
+			case <-ticker.C:
+				err := leases.check()
+				if err != nil {
+					logs.GetLogger().Error(err)
+				}
+			}
+		}
+	}()
+
+	return leases, ctx
+}
+
+func keepSourceFileUploadLeases(ctx context.Context, srcFileUploads []*models.SourceFileUploadNeed2Car) (*rowLeases, context.Context) {
+	var ids []int64
+	for _, srcFileUpload := range srcFileUploads {
+		ids = append(ids, srcFileUpload.SourceFileUploadId)
+	}
+
+	return keepRowLeases(ctx, "source file upload", ids, models.RenewSourceFileUploads)
+}
+
+func keepCarFileLeases(ctx context.Context, carFiles []*models.CarFile) (*rowLeases, context.Context) {
+	var ids []int64
+	for _, carFile := range carFiles {
+		ids = append(ids, carFile.ID)
+	}
+
+	return keepRowLeases(ctx, "car file", ids, models.RenewCarFiles)
+}
+
+func keepCarCreationJobLease(ctx context.Context, job *models.CarCreationJob) (*rowLeases, context.Context) {
+	return keepRowLeases(ctx, "car creation job", []int64{job.ID}, models.RenewCarCreationJobs)
+}
+
+// check renews the leases still kept now, the rows not renewed are recorded as lost
+func (leases *rowLeases) check() error {
+	leases.mutex.Lock()
+	defer leases.mutex.Unlock()
+
+	if len(leases.ids) == 0 {
+		return nil
+	}
+
+	idsRenewed, err := leases.renew(leases.ids, instanceId, constants.ROW_LEASE_SECOND)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	renewed := map[int64]bool{}
+	for _, id := range idsRenewed {
+		renewed[id] = true
+	}
+
+	var ids []int64
+	for _, id := range leases.ids {
+		if renewed[id] {
+			ids = append(ids, id)
+			continue
+		}
+
+		leases.lost[id] = true
+		logs.GetLogger().Error(leases.name, ":", id, " lost its lease to another instance while being handled")
+	}
+	leases.ids = ids
+
+	if len(leases.ids) == 0 {
+		leases.cancel()
+	}
+
+	return nil
+}
+
+func (leases *rowLeases) isLost(id int64) bool {
+	leases.mutex.Lock()
+	defer leases.mutex.Unlock()
+
+	return leases.lost[id]
+}
+
+// stop stops renewing the leases, it is called before they are released
+func (leases *rowLeases) stop() {
+	close(leases.done)
+	leases.cancel()
+}
+
+func getJobLeaseSecond(job *job) int64 {
+	leaseSecond := int64(job.intervalSecond) * 2
+	if leaseSecond < constants.JOB_LEASE_SECOND_MIN {
+		leaseSecond = constants.JOB_LEASE_SECOND_MIN
+	}
+
+	return leaseSecond
+}
+
+// acquireJobLease makes sure only one instance runs the job at a time, the lease is kept by the instance till it stops
+// or fails to renew it in time, then another instance takes it over
+func acquireJobLease(job *job) bool {
+	acquired, err := models.AcquireJobLease(job.status.Name, instanceId, getJobLeaseSecond(job))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false
+	}
+
+	return acquired
+}
+
+func releaseJobLease(job *job) {
+	err := models.ReleaseJobLease(job.status.Name, instanceId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+// renewJobLease renews the lease of the job every third of the lease while the job runs, till done is closed, so that
+// a run longer than the lease keeps the leadership. It returns when the lease is lost to another instance
+func renewJobLease(job *job, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(getJobLeaseSecond(job)) * time.Second / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if !acquireJobLease(job) {
+				logs.GetLogger().Error(job.status.Name, " lost its lease to another instance while running")
+				job.mutex.Lock()
+				job.status.IsLeader = false
+				job.mutex.Unlock()
+				return
+			}
+		}
+	}
+}
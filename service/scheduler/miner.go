@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"context"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/models"
+	"sort"
+
+	libconstants "github.com/filswan/go-swan-lib/constants"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/shopspring/decimal"
+)
+
+func UpdateMinerReputation(ctx context.Context) error {
+	minerStats, err := models.GetMinerStats()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, minerStat := range minerStats {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		successRate := getMinerSuccessRate(minerStat)
+		retrievalSuccessRate := getMinerRetrievalSuccessRate(minerStat)
+		score := getMinerScore(minerStat, successRate, retrievalSuccessRate)
+
+		var price *decimal.Decimal
+		if minerStat.LatestDealId != nil {
+			price, err = getMinerPrice(ctx, *minerStat.LatestDealId)
+			if err != nil {
+				logs.GetLogger().Error(err)
+			}
+		}
+
+		err = models.UpdateMinerReputation(minerStat, successRate, retrievalSuccessRate, price, score)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+// getMinerSuccessRate only counts the deals with a final result, deals still being made are not counted
+func getMinerSuccessRate(minerStat *models.MinerStat) float64 {
+	dealFinishedCnt := minerStat.DealActiveCnt + minerStat.DealFailedCnt
+	if dealFinishedCnt == 0 {
+		return 0
+	}
+
+	return float64(minerStat.DealActiveCnt) / float64(dealFinishedCnt)
+}
+
+func getMinerRetrievalSuccessRate(minerStat *models.MinerStat) float64 {
+	if minerStat.RetrievalCheckCnt == 0 {
+		return 0
+	}
+
+	return float64(minerStat.RetrievalSucceededCnt) / float64(minerStat.RetrievalCheckCnt)
+}
+
+// getMinerScore scales part of the score by the retrieval success rate once the miner has been checked, so a miner
+// storing the deals but failing the retrievals ranks lower
+func getMinerScore(minerStat *models.MinerStat, successRate, retrievalSuccessRate float64) float64 {
+	dealFinishedCnt := minerStat.DealActiveCnt + minerStat.DealFailedCnt
+	if dealFinishedCnt == 0 {
+		return 0
+	}
+
+	slashRate := float64(minerStat.DealSlashedCnt*constants.MINER_SLASH_PENALTY) / float64(dealFinishedCnt)
+	score := (successRate - slashRate) * 100
+	if score < 0 {
+		score = 0
+	}
+
+	if minerStat.RetrievalCheckCnt > 0 {
+		score = score * (1 - constants.MINER_RETRIEVAL_WEIGHT + constants.MINER_RETRIEVAL_WEIGHT*retrievalSuccessRate)
+	}
+
+	return score
+}
+
+// getMinerPrice converts the price per epoch of the deal to FIL/GiB/epoch, the same unit as swan_task.max_price
+func getMinerPrice(ctx context.Context, dealId int64) (*decimal.Decimal, error) {
+	dealState, err := utils.GetDealState(ctx, dealId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if dealState.Error != nil || dealState.Result.Proposal.PieceSize <= 0 {
+		return nil, nil
+	}
+
+	pricePerEpoch, err := decimal.NewFromString(dealState.Result.Proposal.StoragePricePerEpoch)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pieceSizeGB := decimal.NewFromInt(dealState.Result.Proposal.PieceSize).Div(decimal.NewFromInt(constants.BYTES_1GB))
+	price := pricePerEpoch.Div(decimal.NewFromFloat(libconstants.LOTUS_PRICE_MULTIPLE_1E18)).Div(pieceSizeGB)
+
+	return &price, nil
+}
+
+func isMinerSelectable(miner *models.Miner) bool {
+	return miner.Status != constants.MINER_STATUS_BLOCKLISTED
+}
+
+// SelectMiners filters out the blocklisted miners and ranks the rest, allowlisted first, then by score and price
+func SelectMiners(minerFids []string) ([]*models.Miner, error) {
+	var miners []*models.Miner
+	for _, minerFid := range minerFids {
+		miner, err := models.GeMinerByFid(minerFid)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if !isMinerSelectable(miner) {
+			continue
+		}
+
+		miners = append(miners, miner)
+	}
+
+	sort.SliceStable(miners, func(i, j int) bool {
+		iAllowlisted := miners[i].Status == constants.MINER_STATUS_ALLOWLISTED
+		jAllowlisted := miners[j].Status == constants.MINER_STATUS_ALLOWLISTED
+		if iAllowlisted != jAllowlisted {
+			return iAllowlisted
+		}
+
+		if miners[i].Score != miners[j].Score {
+			return miners[i].Score > miners[j].Score
+		}
+
+		if miners[i].Price == nil || miners[j].Price == nil {
+			return miners[i].Price != nil
+		}
+
+		return miners[i].Price.LessThan(*miners[j].Price)
+	})
+
+	return miners, nil
+}
@@ -0,0 +1,327 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+func MonitorReplica(ctx context.Context) error {
+	err := checkActiveDeals(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = repairReplicas(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// checkActiveDeals marks the active deals slashed or expired by their market state, the deals whose state cannot be
+// got now are checked again in the next run
+func checkActiveDeals(ctx context.Context) error {
+	offlineDeals, err := models.GetOfflineDealsActive()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(offlineDeals) == 0 {
+		return nil
+	}
+
+	currentEpoch, err := utils.GetCurrentEpoch(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, offlineDeal := range offlineDeals {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		onChainStatus, onChainMessage, err := getActiveDealOnChainStatus(ctx, offlineDeal, *currentEpoch)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		if onChainStatus == "" {
+			continue
+		}
+
+		logs.GetLogger().Warn(onChainMessage, ", offline deal:", offlineDeal.Id, " marked as ", onChainStatus)
+
+		err = models.CreateOfflineDealLog(offlineDeal.Id, onChainStatus, onChainMessage)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		err = models.UpdateOfflineDealOnChainStatus(offlineDeal.Id, onChainStatus)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+// getActiveDealOnChainStatus returns slashed or expired with the reason when the deal is so by its market state, and
+// empty when it is still active. A deal in the market state is slashed when its slash epoch is set, and expired when
+// its end epoch has passed. A deal no longer in the market state is expired when its end epoch has passed, otherwise
+// it has been slashed and removed, its end epoch is the one recorded while it was active, or estimated by its duration.
+// Errors of lotus other than the deal not found are returned, since they do not tell anything about the deal
+func getActiveDealOnChainStatus(ctx context.Context, offlineDeal *models.OfflineDeal, currentEpoch int64) (string, string, error) {
+	dealState, err := utils.GetDealState(ctx, *offlineDeal.DealId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", "", err
+	}
+
+	if dealState.Error == nil {
+		proposal := dealState.Result.Proposal
+		state := dealState.Result.State
+
+		if state.SlashEpoch > -1 {
+			message := fmt.Sprintf("deal:%d slashed at epoch:%d", *offlineDeal.DealId, state.SlashEpoch)
+			return constants.ON_CHAIN_DEAL_STATUS_SLASHED, message, nil
+		}
+
+		if proposal.EndEpoch <= currentEpoch {
+			message := fmt.Sprintf("deal:%d expired at epoch:%d", *offlineDeal.DealId, proposal.EndEpoch)
+			return constants.ON_CHAIN_DEAL_STATUS_EXPIRED, message, nil
+		}
+
+		if offlineDeal.EndEpoch == nil || *offlineDeal.EndEpoch != proposal.EndEpoch {
+			err = models.UpdateOfflineDealEndEpoch(offlineDeal.Id, proposal.EndEpoch)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				return "", "", err
+			}
+		}
+
+		return "", "", nil
+	}
+
+	if !utils.IsDealNotFound(dealState) {
+		err := fmt.Errorf("get state of deal:%d failed, code:%d,message:%s", *offlineDeal.DealId, dealState.Error.Code, dealState.Error.Message)
+		logs.GetLogger().Error(err)
+		return "", "", err
+	}
+
+	endEpoch := offlineDeal.EndEpoch
+	if endEpoch == nil {
+		carFile, err := models.GetCarFileById(offlineDeal.CarFileId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return "", "", err
+		}
+
+		if carFile == nil {
+			err := fmt.Errorf("car file:%d not exists", offlineDeal.CarFileId)
+			logs.GetLogger().Error(err)
+			return "", "", err
+		}
+
+		endEpochEstimated := int64(offlineDeal.StartEpoch) + int64(carFile.Duration*constants.EPOCH_PER_DAY)
+		endEpoch = &endEpochEstimated
+	}
+
+	if currentEpoch >= *endEpoch {
+		message := fmt.Sprintf("deal:%d not found in market state at epoch:%d, after its end epoch:%d", *offlineDeal.DealId, currentEpoch, *endEpoch)
+		return constants.ON_CHAIN_DEAL_STATUS_EXPIRED, message, nil
+	}
+
+	message := fmt.Sprintf("deal:%d not found in market state at epoch:%d, before its end epoch:%d", *offlineDeal.DealId, currentEpoch, *endEpoch)
+	return constants.ON_CHAIN_DEAL_STATUS_SLASHED, message, nil
+}
+
+func repairReplicas(ctx context.Context) error {
+	replicaCountTarget := config.GetConfig().SwanTask.ReplicaCount
+
+	replicaRepairs, err := models.GetReplicaRepairsByStatus(constants.REPLICA_REPAIR_STATUS_TASK_CREATED)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carFileIdsRepairing := map[int64]bool{}
+	for _, replicaRepair := range replicaRepairs {
+		finished, err := finishReplicaRepair(replicaRepair, replicaCountTarget)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+
+		if err != nil || !finished {
+			carFileIdsRepairing[replicaRepair.CarFileId] = true
+		}
+	}
+
+	carFileReplicas, err := models.GetCarFileReplicas()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, carFileReplica := range carFileReplicas {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if carFileIdsRepairing[carFileReplica.CarFileId] || carFileReplica.ActiveReplicaCnt >= replicaCountTarget {
+			continue
+		}
+
+		// deals are still being made for this car file, wait for them
+		if carFileReplica.PendingDealCnt > 0 {
+			continue
+		}
+
+		// replicas are repaired only after they are lost, car files never reaching the target are not handled here
+		if carFileReplica.LostReplicaCnt == 0 {
+			continue
+		}
+
+		replicaRepairs, err := models.GetReplicaRepairsByCarFileId(carFileReplica.CarFileId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		if len(replicaRepairs) >= constants.REPLICA_REPAIR_MAX_TIMES {
+			logs.GetLogger().Warn("car file:", carFileReplica.CarFileId, " has been repaired ", len(replicaRepairs), " times, skip")
+			continue
+		}
+
+		err = startReplicaRepair(ctx, carFileReplica, replicaCountTarget)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+	}
+
+	return nil
+}
+
+// finishReplicaRepair sets the final status of a repair after all the deals of its task are sent and scanned
+func finishReplicaRepair(replicaRepair *models.ReplicaRepair, replicaCountTarget int) (bool, error) {
+	carFile, err := models.GetCarFileById(replicaRepair.CarFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	if carFile == nil {
+		err := fmt.Errorf("car file:%d not exists", replicaRepair.CarFileId)
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	status := constants.REPLICA_REPAIR_STATUS_COMPLETED
+	note := ""
+	switch carFile.Status {
+	case constants.CAR_FILE_STATUS_TASK_CREATED:
+		return false, nil
+	case constants.CAR_FILE_STATUS_DEAL_SENT_FAILED, constants.CAR_FILE_STATUS_DEAL_SEND_EXPIRED:
+		status = constants.REPLICA_REPAIR_STATUS_FAILED
+		note = fmt.Sprintf("car file status:%s after repair", carFile.Status)
+
+		// the car file still has its former deals, keep it monitored
+		err = models.UpdateCarFileStatus(carFile.ID, constants.CAR_FILE_STATUS_DEAL_SENT)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return false, err
+		}
+	default:
+		carFileReplica, err := models.GetCarFileReplicaByCarFileId(carFile.ID)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return false, err
+		}
+
+		if carFileReplica.PendingDealCnt > 0 {
+			return false, nil
+		}
+
+		if carFileReplica.ActiveReplicaCnt < replicaCountTarget {
+			status = constants.REPLICA_REPAIR_STATUS_FAILED
+		}
+		note = fmt.Sprintf("%d active replicas after repair, target:%d", carFileReplica.ActiveReplicaCnt, replicaCountTarget)
+	}
+
+	err = models.UpdateReplicaRepairStatus(replicaRepair.ID, status, note)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	logs.GetLogger().Info("replica repair:", replicaRepair.ID, " for car file:", carFile.ID, " ", status, ", ", note)
+	return true, nil
+}
+
+// startReplicaRepair creates a new swan task for the same piece, the deals will be sent by SendDeal and linked to the same car file
+func startReplicaRepair(ctx context.Context, carFileReplica *models.CarFileReplica, replicaCountTarget int) error {
+	carFile, err := models.GetCarFileById(carFileReplica.CarFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if carFile == nil {
+		err := fmt.Errorf("car file:%d not exists", carFileReplica.CarFileId)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = restoreCarFileLocal(ctx, carFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carFileDir := filepath.Dir(carFile.CarFilePath)
+
+	replicaCountMissing := replicaCountTarget - carFileReplica.ActiveReplicaCnt
+	logs.GetLogger().Info("car file:", carFile.ID, " has ", carFileReplica.ActiveReplicaCnt, " active replicas, target:", replicaCountTarget, ", start to make ", replicaCountMissing, " new deals")
+
+	fileDesc, err := createSwanTask(carFileDir, carFile.MaxPrice, replicaCountMissing)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if fileDesc.PieceCid != "" && fileDesc.PieceCid != carFile.PieceCid {
+		err := fmt.Errorf("piece cid:%s of the repair task differs from car file:%d piece cid:%s", fileDesc.PieceCid, carFile.ID, carFile.PieceCid)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = models.CreateReplicaRepair(carFile.ID, carFileReplica.ActiveReplicaCnt, replicaCountTarget, fileDesc.Uuid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.UpdateCarFileTaskUuid(carFile.ID, fileDesc.Uuid, constants.CAR_FILE_STATUS_TASK_CREATED)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	PublishEvent(constants.EVENT_TYPE_CAR_CREATED, carFile.ID)
+	return nil
+}
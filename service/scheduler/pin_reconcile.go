@@ -0,0 +1,246 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/hotstorage"
+	"multi-chain-storage/service/retrieval"
+	"os"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+)
+
+const JOB_NAME_RECONCILE_PIN = "ReconcilePin"
+
+type pinReconcileStat struct {
+	CheckedCnt    int
+	MissingCnt    int
+	UnexpectedCnt int
+	RepairedCnt   int
+	FailedCnt     int
+}
+
+// ReconcilePin compares the pins on the hot storage with the pin status of the source files:
+// 1. the content pinned in the database but missing from the hot storage is put again from the local copy, or retrieved
+// from an active deal, otherwise the source file and its uploads are marked unpinned, since the content is not there
+// 2. the content unpinned in the database but still on the hot storage is unpinned
+// 3. the source files left unpinning by UnpinSourceFile are unpinned again
+// each drift is saved to pin_drift, the source files updated after the pins listed are left to the next run
+func ReconcilePin(ctx context.Context) error {
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	listedAt := libutils.GetCurrentUtcSecond()
+	objects, err := hotStorage.List(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	cidsPinned := map[string]bool{}
+	for _, object := range objects {
+		if object.Pinned {
+			cidsPinned[object.Cid] = true
+		}
+	}
+
+	stat := &pinReconcileStat{}
+	err = reconcileSourceFiles(ctx, constants.IPFS_File_PINNED_STATUS, listedAt, func(sourceFile *models.SourceFile) {
+		if cidsPinned[sourceFile.PayloadCid] {
+			return
+		}
+
+		stat.MissingCnt++
+		err := repairMissingPin(ctx, hotStorage, sourceFile)
+		savePinDrift(stat, sourceFile, constants.PIN_DRIFT_KIND_MISSING, err)
+	}, stat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = reconcileSourceFiles(ctx, constants.IPFS_File_UNPINNED_STATUS, listedAt, func(sourceFile *models.SourceFile) {
+		if !cidsPinned[sourceFile.PayloadCid] {
+			return
+		}
+
+		stat.UnexpectedCnt++
+		err := hotStorage.Unpin(ctx, sourceFile.PayloadCid)
+		savePinDrift(stat, sourceFile, constants.PIN_DRIFT_KIND_UNEXPECTED, err)
+	}, stat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = reconcileSourceFiles(ctx, constants.IPFS_File_UNPINNING_STATUS, listedAt, func(sourceFile *models.SourceFile) {
+		err := finishSourceFileUnpin(ctx, hotStorage, sourceFile)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			stat.FailedCnt++
+		}
+	}, stat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("pins reconciled, ", len(cidsPinned), " pinned on hot storage, ", stat.CheckedCnt, " source files checked, missing:",
+		stat.MissingCnt, ", unexpected:", stat.UnexpectedCnt, ", repaired:", stat.RepairedCnt, ", failed:", stat.FailedCnt)
+	return nil
+}
+
+// reconcileSourceFiles reconciles the source files of the pin status in batches
+func reconcileSourceFiles(ctx context.Context, pinStatus string, updateAtBefore int64, reconcile func(sourceFile *models.SourceFile), stat *pinReconcileStat) error {
+	var idLast int64
+	for ctx.Err() == nil {
+		sourceFiles, err := models.GetSourceFilesByPinStatus(pinStatus, idLast, updateAtBefore, constants.RECONCILE_PIN_BATCH_SIZE)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		for _, sourceFile := range sourceFiles {
+			if ctx.Err() != nil {
+				break
+			}
+
+			stat.CheckedCnt++
+			reconcile(sourceFile)
+			idLast = sourceFile.ID
+		}
+
+		if len(sourceFiles) < constants.RECONCILE_PIN_BATCH_SIZE {
+			break
+		}
+	}
+
+	return nil
+}
+
+func savePinDrift(stat *pinReconcileStat, sourceFile *models.SourceFile, kind string, err error) {
+	status := constants.PIN_DRIFT_STATUS_REPAIRED
+	var message *string
+	if err != nil {
+		logs.GetLogger().Error(err)
+		status = constants.PIN_DRIFT_STATUS_FAILED
+		errMsg := err.Error()
+		message = &errMsg
+		stat.FailedCnt++
+	} else {
+		stat.RepairedCnt++
+	}
+
+	logs.GetLogger().Warn("pin drift, kind:", kind, ", source file:", sourceFile.ID, ", cid:", sourceFile.PayloadCid, ", status:", status)
+	err = models.SavePinDrift(sourceFile.ID, sourceFile.PayloadCid, kind, status, message)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
+
+// repairMissingPin puts the content of the source file to the hot storage again, from the local copy if kept,
+// otherwise from the active deals one by one, if none works, the source file and its uploads are marked unpinned
+func repairMissingPin(ctx context.Context, hotStorage hotstorage.HotStorage, sourceFile *models.SourceFile) error {
+	err := putSourceFileFromLocal(ctx, hotStorage, sourceFile)
+	if err == nil {
+		return nil
+	}
+	logs.GetLogger().Error(err)
+
+	err = putSourceFileFromDeals(ctx, hotStorage, sourceFile)
+	if err == nil {
+		return nil
+	}
+	logs.GetLogger().Error(err)
+
+	errUnpinned := models.UpdateSourceFileUploadsPinStatusBySourceFileId(sourceFile.ID, constants.IPFS_File_UNPINNED_STATUS)
+	if errUnpinned == nil {
+		errUnpinned = models.UpdateSourceFilePinStatus(sourceFile.ID, constants.IPFS_File_UNPINNED_STATUS)
+	}
+	if errUnpinned != nil {
+		logs.GetLogger().Error(errUnpinned)
+		return errUnpinned
+	}
+
+	return fmt.Errorf("not repaired and marked unpinned, %w", err)
+}
+
+func putSourceFileFromLocal(ctx context.Context, hotStorage hotstorage.HotStorage, sourceFile *models.SourceFile) error {
+	if sourceFile.LocalDeletedAt != nil || !libutils.IsFileExistsFullPath(sourceFile.ResourceUri) {
+		err := fmt.Errorf("source file:%d not kept locally", sourceFile.ID)
+		return err
+	}
+
+	return putSourceFile(ctx, hotStorage, sourceFile, sourceFile.ResourceUri)
+}
+
+func putSourceFileFromDeals(ctx context.Context, hotStorage hotstorage.HotStorage, sourceFile *models.SourceFile) error {
+	sourceFileDeals, err := models.GetSourceFileActiveDeals(sourceFile.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(sourceFileDeals) == 0 {
+		err := fmt.Errorf("source file:%d has no active deal to retrieve from", sourceFile.ID)
+		return err
+	}
+
+	retrievalClient, err := retrieval.GetRetrievalClient()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	retrievedFilepath := filepath.Join(srcDir, "retrieved_"+uuid.NewString())
+	defer os.Remove(retrievedFilepath)
+
+	for _, sourceFileDeal := range sourceFileDeals {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = retrievalClient.Retrieve(ctx, sourceFileDeal.MinerFid, sourceFileDeal.PieceCid, sourceFile.PayloadCid, retrievedFilepath, false)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		err = putSourceFile(ctx, hotStorage, sourceFile, retrievedFilepath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		logs.GetLogger().Info("source file:", sourceFile.ID, " retrieved from deal:", sourceFileDeal.DealId, " of miner:", sourceFileDeal.MinerFid)
+		return nil
+	}
+
+	err = fmt.Errorf("source file:%d not retrieved from any of its %d active deals", sourceFile.ID, len(sourceFileDeals))
+	return err
+}
+
+// putSourceFile puts the file to the hot storage, the cid must be the payload cid of the source file, the content put
+// with another cid is left pinned, since it may be pinned for others
+func putSourceFile(ctx context.Context, hotStorage hotstorage.HotStorage, sourceFile *models.SourceFile, srcFilepath string) error {
+	cid, err := hotStorage.Put(ctx, srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if cid != sourceFile.PayloadCid {
+		err := fmt.Errorf("cid:%s of %s not matching the payload cid:%s of source file:%d", cid, srcFilepath, sourceFile.PayloadCid, sourceFile.ID)
+		return err
+	}
+
+	return nil
+}
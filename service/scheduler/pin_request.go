@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/database"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/denylist"
+	"multi-chain-storage/service/hotstorage"
+	"multi-chain-storage/service/plan"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const JOB_NAME_PROCESS_PIN_REQUEST = "ProcessPinRequest"
+
+// ProcessPinRequest pins the content of the queued pin requests on the hot storage and maps each of them to a source
+// file upload, which is free and created to a car file when the deal is asked for in the meta and the monthly free
+// bytes of the plan of the wallet are enough, otherwise pending till paid
+func ProcessPinRequest(ctx context.Context) error {
+	err := models.ResetPinRequestsPinning()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	pinRequests, err := models.GetPinRequestsByStatus(constants.PIN_REQUEST_STATUS_QUEUED, constants.PIN_REQUEST_BATCH_SIZE)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, pinRequest := range pinRequests {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err := processPinRequest(ctx, pinRequest)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			// the request stopped by the scheduler is left pinning, and queued again by the next run
+			if ctx.Err() != nil {
+				break
+			}
+
+			info := err.Error()
+			err = models.UpdatePinRequestStatus(pinRequest.ID, constants.PIN_REQUEST_STATUS_FAILED, &info, nil)
+			if err != nil {
+				logs.GetLogger().Error(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func processPinRequest(ctx context.Context, pinRequest *models.PinRequest) error {
+	err := models.UpdatePinRequestStatus(pinRequest.ID, constants.PIN_REQUEST_STATUS_PINNING, nil, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	// the cid may be added to the denylist after the request is queued
+	err = denylist.CheckContent(pinRequest.Cid, "")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("pinning ", pinRequest.Cid, " of pin request:", pinRequest.RequestId)
+	err = hotStorage.Pin(ctx, pinRequest.Cid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	object, err := hotStorage.Stat(ctx, pinRequest.Cid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	// the source file is locked till the upload is created, so the content is not unpinned meanwhile
+	db := database.GetDBTransactionContext(ctx)
+	sourceFile, err := savePinnedSourceFile(ctx, db, hotStorage, pinRequest.Cid, object.Size)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	sourceFileUpload, err := createPinnedSourceFileUpload(db, pinRequest, sourceFile)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.UpdatePinRequestStatus(pinRequest.ID, constants.PIN_REQUEST_STATUS_PINNED, nil, &sourceFileUpload.Id)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info(pinRequest.Cid, " of pin request:", pinRequest.RequestId, " pinned, source file upload:", sourceFileUpload.Id, ", status:", sourceFileUpload.Status)
+	return nil
+}
+
+// savePinnedSourceFile records the content pinned as a source file, which is not kept locally,
+// it is downloaded from ipfs when creating the car file
+func savePinnedSourceFile(ctx context.Context, db *gorm.DB, hotStorage hotstorage.HotStorage, cid string, size int64) (*models.SourceFile, error) {
+	sourceFile, err := models.GetSourceFileByPayloadCidForUpdate(db, cid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	if sourceFile == nil {
+		sourceFile = &models.SourceFile{
+			FileSize:       size,
+			ResourceUri:    filepath.Join(srcDir, cid),
+			IpfsUrl:        hotStorage.GetUrl(cid),
+			PinStatus:      constants.IPFS_File_PINNED_STATUS,
+			PayloadCid:     cid,
+			LocalDeletedAt: &currentUtcSecond,
+			CreateAt:       currentUtcSecond,
+			UpdateAt:       currentUtcSecond,
+		}
+
+		err = database.SaveOneInTransaction(db, sourceFile)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		return sourceFile, nil
+	}
+
+	// the content may have been unpinned after it was pinned above, by the unpin of the last upload of it
+	if sourceFile.PinStatus != constants.IPFS_File_PINNED_STATUS {
+		err := hotStorage.Pin(ctx, cid)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	sourceFile.PinStatus = constants.IPFS_File_PINNED_STATUS
+	sourceFile.UpdateAt = currentUtcSecond
+	err = database.SaveOneInTransaction(db, sourceFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFile, nil
+}
+
+func createPinnedSourceFileUpload(db *gorm.DB, pinRequest *models.PinRequest, sourceFile *models.SourceFile) (*models.SourceFileUpload, error) {
+	meta := map[string]string{}
+	if pinRequest.Meta != nil {
+		err := json.Unmarshal([]byte(*pinRequest.Meta), &meta)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	// the upload is counted to the usage of the wallet, and is free if the deal is asked for and the monthly free
+	// bytes of its plan are enough
+	isFree, err := plan.ReserveUploadInTransaction(db, plan.GetSubject(pinRequest.WalletId, nil), sourceFile.FileSize, meta[constants.PIN_META_KEY_DEAL] == "true")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	status := constants.SOURCE_FILE_UPLOAD_STATUS_PENDING
+	if isFree {
+		status = constants.SOURCE_FILE_UPLOAD_STATUS_FREE
+	}
+
+	fileName := pinRequest.Cid
+	if pinRequest.Name != nil && *pinRequest.Name != "" {
+		fileName = *pinRequest.Name
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	sourceFileUpload := &models.SourceFileUpload{
+		SourceFileId: sourceFile.ID,
+		FileType:     constants.SOURCE_FILE_TYPE_NORMAL,
+		FileName:     fileName,
+		Uuid:         uuid.NewString(),
+		WalletId:     pinRequest.WalletId,
+		Status:       status,
+		Duration:     constants.DURATION_DAYS_DEFAULT,
+		PinStatus:    constants.IPFS_File_PINNED_STATUS,
+		IsFree:       isFree,
+		CreateAt:     currentUtcSecond,
+		UpdateAt:     currentUtcSecond,
+	}
+
+	err = database.SaveOneInTransaction(db, sourceFileUpload)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return sourceFileUpload, nil
+}
@@ -0,0 +1,283 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/common/utils"
+	"multi-chain-storage/config"
+	"multi-chain-storage/database"
+	"multi-chain-storage/models"
+	"path/filepath"
+
+	libconstants "github.com/filswan/go-swan-lib/constants"
+	"github.com/filswan/go-swan-lib/logs"
+	libmodel "github.com/filswan/go-swan-lib/model"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func ScanRenewal(ctx context.Context) error {
+	currentEpoch, err := utils.GetCurrentEpoch(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.ExpireRenewals(*currentEpoch)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = quoteRenewals(*currentEpoch)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = renewPaidRenewals(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func quoteRenewals(currentEpoch int64) error {
+	endEpochMax := currentEpoch + int64(config.GetConfig().Renewal.WindowDays*constants.EPOCH_PER_DAY)
+	sourceFileUploads2Renew, err := models.GetSourceFileUploads2Renew(endEpochMax)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(sourceFileUploads2Renew) == 0 {
+		logs.GetLogger().Info("0 source file upload to be renewed")
+		return nil
+	}
+
+	systemParam, err := utils.GetSystemParam("")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, sourceFileUpload2Renew := range sourceFileUploads2Renew {
+		currentUtcSecond := libutils.GetCurrentUtcSecond()
+		renewal := &models.Renewal{
+			Uuid:               uuid.NewString(),
+			SourceFileUploadId: sourceFileUpload2Renew.SourceFileUploadId,
+			CarFileId:          sourceFileUpload2Renew.CarFileId,
+			EndEpoch:           sourceFileUpload2Renew.EndEpoch,
+			Duration:           constants.DURATION_DAYS_DEFAULT,
+			PayAmount:          getRenewalPrice(sourceFileUpload2Renew.FileSize, systemParam.FilecoinPrice).String(),
+			Status:             constants.RENEWAL_STATUS_QUOTED,
+			CreateAt:           currentUtcSecond,
+			UpdateAt:           currentUtcSecond,
+		}
+
+		err = models.CreateRenewal(renewal)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		logs.GetLogger().Info("renewal quoted for source file upload:", renewal.SourceFileUploadId, ", end epoch:", renewal.EndEpoch, ", price:", renewal.PayAmount)
+	}
+
+	return nil
+}
+
+// getRenewalPrice is the reverse of getMaxPrice, it returns the amount to be locked for the configured max price
+func getRenewalPrice(fileSize int64, rate int64) decimal.Decimal {
+	_, sectorSize := libutils.CalculatePieceSize(fileSize)
+
+	durationEpoch := decimal.NewFromInt(constants.DURATION_DAYS_DEFAULT * constants.EPOCH_PER_DAY)
+	sectorSizeGB := decimal.NewFromFloat(sectorSize).Div(decimal.NewFromInt(constants.BYTES_1GB))
+
+	priceInFileCoin := config.GetConfig().SwanTask.MaxPrice.Mul(sectorSizeGB).Mul(durationEpoch)
+	price := priceInFileCoin.Mul(decimal.NewFromInt(rate)).Mul(decimal.NewFromFloat(libconstants.LOTUS_PRICE_MULTIPLE_1E18))
+
+	return price.Ceil()
+}
+
+// errRenewalPermanent is wrapped in the errors of the renewals that cannot succeed by trying again
+var errRenewalPermanent = errors.New("renewal failed permanently")
+
+// renewPaidRenewals renews the paid renewals whose attempt is due, the failed renewals are tried again after
+// RENEWAL_RETRY_INTERVAL_SECOND_BASE doubled for each failed attempt, and set failed on errors that cannot be recovered
+// or after RENEWAL_ATTEMPT_MAX attempts
+func renewPaidRenewals(ctx context.Context) error {
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	renewals, err := models.GetRenewals2Renew(currentUtcSecond)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, renewal := range renewals {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = renew(ctx, renewal)
+		if err == nil {
+			continue
+		}
+
+		// the renewal stopped by the scheduler is not counted as an attempt
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		logs.GetLogger().Error(err)
+		attemptCnt := renewal.AttemptCnt + 1
+		if errors.Is(err, errRenewalPermanent) || errors.Is(err, errCarFileUnrecoverable) || attemptCnt >= constants.RENEWAL_ATTEMPT_MAX {
+			err = models.UpdateRenewalStatus(renewal.ID, constants.RENEWAL_STATUS_FAILED, err.Error())
+			if err != nil {
+				logs.GetLogger().Error(err)
+			}
+			continue
+		}
+
+		nextAttemptAt := currentUtcSecond + getRenewalRetryIntervalSecond(attemptCnt)
+		logs.GetLogger().Info("renewal:", renewal.ID, " failed ", attemptCnt, " times, try again at:", nextAttemptAt)
+		err = models.UpdateRenewalAttempt(renewal.ID, attemptCnt, nextAttemptAt, err.Error())
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+
+	return nil
+}
+
+func getRenewalRetryIntervalSecond(attemptCnt int) int64 {
+	retryIntervalSecond := int64(constants.RENEWAL_RETRY_INTERVAL_SECOND_BASE)
+	for i := 1; i < attemptCnt && retryIntervalSecond < constants.RENEWAL_RETRY_INTERVAL_SECOND_MAX; i++ {
+		retryIntervalSecond = retryIntervalSecond * 2
+	}
+
+	if retryIntervalSecond > constants.RENEWAL_RETRY_INTERVAL_SECOND_MAX {
+		retryIntervalSecond = constants.RENEWAL_RETRY_INTERVAL_SECOND_MAX
+	}
+
+	return retryIntervalSecond
+}
+
+// renew creates a swan task for the same piece, the car file created is linked to the original source file upload
+func renew(ctx context.Context, renewal *models.Renewal) error {
+	carFile, err := models.GetCarFileById(renewal.CarFileId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if carFile == nil {
+		err := fmt.Errorf("%w, car file:%d not exists", errRenewalPermanent, renewal.CarFileId)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = restoreCarFileLocal(ctx, carFile)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carFileDir := filepath.Dir(carFile.CarFilePath)
+
+	maxPrice := config.GetConfig().SwanTask.MaxPrice
+	fileDesc, err := createSwanTask(carFileDir, maxPrice, config.GetConfig().SwanTask.ReplicaCount)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if fileDesc.PieceCid != "" && fileDesc.PieceCid != carFile.PieceCid {
+		err := fmt.Errorf("%w, piece cid:%s of the renewal task differs from car file:%d piece cid:%s", errRenewalPermanent, fileDesc.PieceCid, carFile.ID, carFile.PieceCid)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = saveRenewalCarFile2DB(renewal, carFile, fileDesc, maxPrice)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("renewal:", renewal.ID, " task created for car file:", carFile.ID, ",task uuid:", fileDesc.Uuid)
+	return nil
+}
+
+// saveRenewalCarFile2DB saves the renewed car file linked to the source file upload and the renewal, its deals go through
+// the dao signature with the w_cid of the renewal, so the payment locked by the renewal is unlocked to the payment recipient
+// as the payments of uploads are. The transaction is not bound to the scheduler context, since the swan task has been
+// created and would be created again by the next attempt
+func saveRenewalCarFile2DB(renewal *models.Renewal, carFile *models.CarFile, fileDesc *libmodel.FileDesc, maxPrice decimal.Decimal) error {
+	db := database.GetDBTransaction()
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	carFileRenewed := models.CarFile{
+		CarFileName: carFile.CarFileName,
+		CarFilePath: carFile.CarFilePath,
+		CarFileSize: carFile.CarFileSize,
+		PayloadCid:  carFile.PayloadCid,
+		PieceCid:    carFile.PieceCid,
+		CreateAt:    currentUtcSecond,
+		UpdateAt:    currentUtcSecond,
+		Duration:    renewal.Duration,
+		Status:      constants.CAR_FILE_STATUS_TASK_CREATED,
+		MaxPrice:    maxPrice,
+		TaskUuid:    fileDesc.Uuid,
+	}
+
+	err := database.SaveOneInTransaction(db, &carFileRenewed)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carFileSource := models.CarFileSource{
+		CarFileId:          carFileRenewed.ID,
+		SourceFileUploadId: renewal.SourceFileUploadId,
+		CreateAt:           currentUtcSecond,
+	}
+	err = database.SaveOneInTransaction(db, &carFileSource)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	fields2BeUpdated := make(map[string]interface{})
+	fields2BeUpdated["car_file_id_renewed"] = carFileRenewed.ID
+	fields2BeUpdated["status"] = constants.RENEWAL_STATUS_TASK_CREATED
+	fields2BeUpdated["update_at"] = currentUtcSecond
+
+	err = db.Model(models.Renewal{}).Where("id=?", renewal.ID).Update(fields2BeUpdated).Error
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = publishEventInTransaction(db, constants.EVENT_TYPE_CAR_CREATED, carFileRenewed.ID)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	notifyEventDispatcher()
+	return nil
+}
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/retrieval"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+	"github.com/google/uuid"
+)
+
+const JOB_NAME_CHECK_RETRIEVAL = "CheckRetrieval"
+
+// CheckRetrieval retrieves a source file from each of the sampled active deals by the retrieval client in [retrieval],
+// the files not larger than [retrieval].check_range_length in full, the others by a random range of that length. The
+// retrieved blocks are verified against the payload cid of the source file, each check is saved to retrieval_check and
+// counted in the miner reputation
+func CheckRetrieval(ctx context.Context) error {
+	retrievalClient, err := retrieval.GetRetrievalClient()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	retrievalCheckDeals, err := models.GetRetrievalCheckDeals(config.GetConfig().Retrieval.CheckDealCount)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	succeededCnt, failedCnt := 0, 0
+	for _, retrievalCheckDeal := range retrievalCheckDeals {
+		if ctx.Err() != nil {
+			break
+		}
+
+		retrievalCheck := checkDealRetrieval(ctx, retrievalClient, retrievalCheckDeal)
+		// the check stopped by the scheduler tells nothing about the miner, so it is not saved
+		if ctx.Err() != nil {
+			break
+		}
+
+		err := models.CreateRetrievalCheck(retrievalCheck)
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+
+		if retrievalCheck.Status == constants.RETRIEVAL_CHECK_STATUS_SUCCEEDED {
+			succeededCnt++
+		} else {
+			failedCnt++
+		}
+	}
+
+	logs.GetLogger().Info("retrieval checks succeeded:", succeededCnt, ", failed:", failedCnt)
+	return nil
+}
+
+func checkDealRetrieval(ctx context.Context, retrievalClient retrieval.RetrievalClient, retrievalCheckDeal *models.RetrievalCheckDeal) *models.RetrievalCheck {
+	retrievalCheck := &models.RetrievalCheck{
+		OfflineDealId: retrievalCheckDeal.OfflineDealId,
+		MinerId:       retrievalCheckDeal.MinerId,
+		SourceFileId:  retrievalCheckDeal.SourceFileId,
+		PayloadCid:    retrievalCheckDeal.PayloadCid,
+		Mode:          constants.RETRIEVAL_CHECK_MODE_FULL,
+		RangeLength:   retrievalCheckDeal.FileSize,
+		CreateAt:      libutils.GetCurrentUtcSecond(),
+	}
+
+	rangeLength := config.GetConfig().Retrieval.CheckRangeLength
+	if retrievalCheckDeal.FileSize > rangeLength {
+		retrievalCheck.Mode = constants.RETRIEVAL_CHECK_MODE_RANGE
+		retrievalCheck.RangeOffset = rand.Int63n(retrievalCheckDeal.FileSize - rangeLength + 1)
+		retrievalCheck.RangeLength = rangeLength
+	}
+
+	startAt := time.Now()
+	err := retrieveRange(ctx, retrievalClient, retrievalCheckDeal, retrievalCheck.RangeOffset, retrievalCheck.RangeLength)
+	retrievalCheck.LatencyMs = time.Since(startAt).Milliseconds()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		message := err.Error()
+		retrievalCheck.Status = constants.RETRIEVAL_CHECK_STATUS_FAILED
+		retrievalCheck.Message = &message
+		return retrievalCheck
+	}
+
+	logs.GetLogger().Info("retrieval check of deal:", retrievalCheckDeal.DealId, " from miner:", retrievalCheckDeal.MinerFid, " succeeded in ", retrievalCheck.LatencyMs, "ms")
+	retrievalCheck.Status = constants.RETRIEVAL_CHECK_STATUS_SUCCEEDED
+	return retrievalCheck
+}
+
+// retrieveRange retrieves the car of the range from the miner, and extracts the range from it, which verifies each block
+// against its cid from the payload cid down, the retrieved files are removed afterwards
+func retrieveRange(ctx context.Context, retrievalClient retrieval.RetrievalClient, retrievalCheckDeal *models.RetrievalCheckDeal, offset, length int64) error {
+	carFilepath := filepath.Join(GetSrcDir(), "retrieval_check_"+uuid.NewString()+".car")
+	defer os.Remove(carFilepath)
+
+	var err error
+	if offset == 0 && length == retrievalCheckDeal.FileSize {
+		err = retrievalClient.Retrieve(ctx, retrievalCheckDeal.MinerFid, retrievalCheckDeal.PieceCid, retrievalCheckDeal.PayloadCid, carFilepath, true)
+	} else {
+		err = retrievalClient.RetrieveRange(ctx, retrievalCheckDeal.MinerFid, retrievalCheckDeal.PieceCid, retrievalCheckDeal.PayloadCid, offset, length, carFilepath)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	dstFilepath := carFilepath + ".range"
+	defer os.Remove(dstFilepath)
+
+	written, err := retrieval.ExtractFileRangeFromCar(carFilepath, retrievalCheckDeal.PayloadCid, offset, length, dstFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if written != length {
+		err := fmt.Errorf("%d bytes retrieved from offset:%d of source file:%d, expected:%d", written, offset, retrievalCheckDeal.SourceFileId, length)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
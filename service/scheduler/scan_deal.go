@@ -1,27 +1,57 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/common/utils"
 	"multi-chain-storage/config"
 	"multi-chain-storage/database"
 	"multi-chain-storage/models"
+	"multi-chain-storage/service/dealclient"
 	"strings"
+	"sync"
+	"time"
 
 	libutils "github.com/filswan/go-swan-lib/utils"
 
 	"github.com/filswan/go-swan-lib/logs"
-
-	"github.com/filswan/go-swan-lib/client/lotus"
 )
 
-func ScanDeal() error {
-	err := ScanDealBeforeActive()
+type ScanDealStat struct {
+	Name                      string `json:"name"`
+	StartAt                   int64  `json:"start_at"`
+	DealCnt                   int    `json:"deal_cnt"`
+	ChangedCnt                int    `json:"changed_cnt"`
+	FailedCnt                 int    `json:"failed_cnt"`
+	LatencyMillisecond        int64  `json:"latency_millisecond"`
+	AvgDealLatencyMillisecond int64  `json:"avg_deal_latency_millisecond"`
+}
+
+var scanDealStats = map[string]*ScanDealStat{}
+var scanDealStatsMutex sync.Mutex
+
+// GetScanDealStats returns the stat of the latest scan of each kind
+func GetScanDealStats() []*ScanDealStat {
+	scanDealStatsMutex.Lock()
+	defer scanDealStatsMutex.Unlock()
+
+	var stats []*ScanDealStat
+	for _, stat := range scanDealStats {
+		statCopy := *stat
+		stats = append(stats, &statCopy)
+	}
+
+	return stats
+}
+
+func ScanDeal(ctx context.Context) error {
+	err := ScanDealBeforeActive(ctx)
 	if err != nil {
 		logs.GetLogger().Error(err)
 	}
 
-	err = ScanDealAfterActive()
+	err = ScanDealAfterActive(ctx)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
@@ -30,141 +60,254 @@ func ScanDeal() error {
 	return nil
 }
 
-func ScanDealBeforeActive() error {
-	offlineDeals, err := models.GetOfflineDeals2BeScanned()
+func ScanDealBeforeActive(ctx context.Context) error {
+	offlineDeals, err := models.GetOfflineDeals2BeScanned(libutils.GetCurrentUtcSecond(), config.GetConfig().ScheduleRule.ScanDealBatchSize)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	lotusClient, err := lotus.LotusGetClient(config.GetConfig().Lotus.ClientApiUrl, config.GetConfig().Lotus.ClientAccessToken)
+	dealClient, err := dealclient.GetDealClient()
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	for _, offlineDeal := range offlineDeals {
-		offlineDealStatusChanged := false
-		dealInfo, err := lotusClient.LotusClientGetDealInfo(offlineDeal.DealCid)
+	scanDeals(ctx, "ScanDealBeforeActive", offlineDeals, func(offlineDeal *models.OfflineDeal) (bool, error) {
+		return scanDealBeforeActive(ctx, dealClient, offlineDeal)
+	})
 
+	return nil
+}
+
+func scanDealBeforeActive(ctx context.Context, dealClient dealclient.DealClient, offlineDeal *models.OfflineDeal) (bool, error) {
+	dealInfo, err := dealClient.GetDealInfo(ctx, offlineDeal.DealCid)
+	offlineDealStatusChanged, err := applyDealInfo(offlineDeal, dealInfo, err)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	if offlineDeal.DealId != nil && !strings.EqualFold(offlineDeal.Status, constants.OFFLINE_DEAL_STATUS_ACTIVE) {
+		isDealActive, err := utils.IsDealActive(ctx, *offlineDeal.DealId)
 		if err != nil {
 			logs.GetLogger().Error(err)
-			if strings.Contains(err.Error(), "datastore: key not found") {
-				offlineDealStatusChanged = true
-				note := err.Error()
-				offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_FAILED
-				offlineDeal.Note = &note
-			} else {
-				continue
-			}
-		} else {
-			if offlineDeal.OnChainStatus == nil || *offlineDeal.OnChainStatus != dealInfo.Status || offlineDeal.DealId == nil || *offlineDeal.DealId != dealInfo.DealId ||
-				offlineDeal.Note == nil || *offlineDeal.Note != dealInfo.Message {
-				offlineDealStatusChanged = true
-				offlineDeal.OnChainStatus = &dealInfo.Status
-				if dealInfo.DealId != 0 {
-					offlineDeal.DealId = &dealInfo.DealId
-				}
+			return false, err
+		}
 
-				switch dealInfo.Status {
-				case constants.ON_CHAIN_DEAL_STATUS_ERROR:
-					if !strings.Contains(dealInfo.Message, constants.ON_CHAIN_MESSAGE_NOT_COMPLETED) {
-						offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_FAILED
-					}
-				case constants.ON_CHAIN_DEAL_STATUS_ACTIVE:
-					offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_ACTIVE
-				}
+		if *isDealActive {
+			offlineDealStatusChanged = true
+			offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_ACTIVE
+		}
+	}
 
-				offlineDeal.Note = &dealInfo.Message
-			}
+	if !offlineDealStatusChanged {
+		return false, nil
+	}
+
+	onChainStatus := ""
+	if offlineDeal.OnChainStatus != nil {
+		onChainStatus = *offlineDeal.OnChainStatus
+	}
+
+	onChainMessage := ""
+	if offlineDeal.Note != nil {
+		onChainMessage = *offlineDeal.Note
+	}
+
+	if offlineDeal.Status == constants.OFFLINE_DEAL_STATUS_ACTIVE {
+		carFile, err := models.GetCarFileById(offlineDeal.CarFileId)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return false, err
+		}
+		if carFile.IsFree {
+			offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_SUCCESS
 		}
+	}
+	err = models.CreateOfflineDealLog(offlineDeal.Id, onChainStatus, onChainMessage)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
 
-		if offlineDeal.DealId != nil && !strings.EqualFold(offlineDeal.Status, constants.OFFLINE_DEAL_STATUS_ACTIVE) {
-			isDealActive, err := utils.IsDealActive(*offlineDeal.DealId)
-			if err != nil {
-				logs.GetLogger().Error(err)
-				continue
-			}
+	offlineDeal.UpdateAt = libutils.GetCurrentUtcSecond()
+	err = database.SaveOne(offlineDeal)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
 
-			if *isDealActive {
-				offlineDealStatusChanged = true
-				offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_ACTIVE
-			}
+	if offlineDeal.Status == constants.OFFLINE_DEAL_STATUS_ACTIVE || offlineDeal.Status == constants.OFFLINE_DEAL_STATUS_SUCCESS {
+		PublishEvent(constants.EVENT_TYPE_DEAL_ACTIVE, offlineDeal.Id)
+	}
+
+	return true, nil
+}
+
+// applyDealInfo updates the offline deal by the deal info got from the deal client, or by the error getting it, the
+// deals unknown to the deal client are failed. It returns whether the deal is changed, and the error if not known
+func applyDealInfo(offlineDeal *models.OfflineDeal, dealInfo *dealclient.DealInfo, err error) (bool, error) {
+	if err != nil {
+		if !errors.Is(err, dealclient.ErrDealNotFound) {
+			return false, err
 		}
 
-		if offlineDealStatusChanged {
-			onChainStatus := ""
-			if offlineDeal.OnChainStatus != nil {
-				onChainStatus = *offlineDeal.OnChainStatus
-			}
+		note := err.Error()
+		offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_FAILED
+		offlineDeal.Note = &note
+		return true, nil
+	}
 
-			onChainMessage := ""
-			if offlineDeal.Note != nil {
-				onChainMessage = *offlineDeal.Note
-			}
+	if offlineDeal.OnChainStatus != nil && *offlineDeal.OnChainStatus == dealInfo.Status && offlineDeal.DealId != nil && *offlineDeal.DealId == dealInfo.DealId &&
+		offlineDeal.Note != nil && *offlineDeal.Note == dealInfo.Message {
+		return false, nil
+	}
 
-			if offlineDeal.Status == constants.OFFLINE_DEAL_STATUS_ACTIVE {
-				carFile, err := models.GetCarFileById(offlineDeal.CarFileId)
-				if err != nil {
-					logs.GetLogger().Error(err)
-					continue
-				}
-				if carFile.IsFree {
-					offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_SUCCESS
-				}
-			}
-			err = models.CreateOfflineDealLog(offlineDeal.Id, onChainStatus, onChainMessage)
-			if err != nil {
-				logs.GetLogger().Error(err)
-				continue
-			}
+	offlineDeal.OnChainStatus = &dealInfo.Status
+	if dealInfo.DealId != 0 {
+		offlineDeal.DealId = &dealInfo.DealId
+	}
 
-			offlineDeal.UpdateAt = libutils.GetCurrentUtcSecond()
-			err = database.SaveOne(offlineDeal)
-			if err != nil {
-				logs.GetLogger().Error(err)
-				continue
-			}
+	switch dealInfo.Status {
+	case constants.ON_CHAIN_DEAL_STATUS_ERROR:
+		if !strings.Contains(dealInfo.Message, constants.ON_CHAIN_MESSAGE_NOT_COMPLETED) {
+			offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_FAILED
 		}
+	case constants.ON_CHAIN_DEAL_STATUS_ACTIVE:
+		offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_ACTIVE
 	}
 
-	return nil
+	offlineDeal.Note = &dealInfo.Message
+	return true, nil
 }
 
-func ScanDealAfterActive() error {
-	offlineDeals, err := models.GetOfflineDeals2BeScannedAfterActive()
+func ScanDealAfterActive(ctx context.Context) error {
+	offlineDeals, err := models.GetOfflineDeals2BeScannedAfterActive(libutils.GetCurrentUtcSecond(), config.GetConfig().ScheduleRule.ScanDealBatchSize)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	lotusClient, err := lotus.LotusGetClient(config.GetConfig().Lotus.ClientApiUrl, config.GetConfig().Lotus.ClientAccessToken)
+	dealClient, err := dealclient.GetDealClient()
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
+	scanDeals(ctx, "ScanDealAfterActive", offlineDeals, func(offlineDeal *models.OfflineDeal) (bool, error) {
+		return scanDealAfterActive(ctx, dealClient, offlineDeal)
+	})
+
+	return nil
+}
+
+func scanDealAfterActive(ctx context.Context, dealClient dealclient.DealClient, offlineDeal *models.OfflineDeal) (bool, error) {
+	dealInfo, err := dealClient.GetDealInfo(ctx, offlineDeal.DealCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	if offlineDeal.OnChainStatus != nil && *offlineDeal.OnChainStatus == dealInfo.Status {
+		return false, nil
+	}
+
+	err = models.CreateOfflineDealLog(offlineDeal.Id, dealInfo.Status, dealInfo.Message)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	err = models.UpdateOfflineDealOnChainStatus(offlineDeal.Id, dealInfo.Status)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// scanDeals scans the deals with a bounded worker pool, each deal is scheduled for its next scan afterwards,
+// the interval is doubled while its status is not changed, up to scan_deal_interval_max_second
+func scanDeals(ctx context.Context, name string, offlineDeals []*models.OfflineDeal, scanDeal func(*models.OfflineDeal) (bool, error)) {
+	stat := &ScanDealStat{
+		Name:    name,
+		StartAt: libutils.GetCurrentUtcSecond(),
+		DealCnt: len(offlineDeals),
+	}
+	startTime := time.Now()
+
+	var statMutex sync.Mutex
+	var dealLatencyTotal time.Duration
+
+	offlineDealChan := make(chan *models.OfflineDeal)
+	var wg sync.WaitGroup
+	for i := 0; i < config.GetConfig().ScheduleRule.ScanDealWorkerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for offlineDeal := range offlineDealChan {
+				dealStartTime := time.Now()
+				changed, err := scanDeal(offlineDeal)
+
+				err4NextScan := scheduleNextScan(offlineDeal, changed, err)
+				if err4NextScan != nil {
+					logs.GetLogger().Error(err4NextScan)
+				}
+
+				statMutex.Lock()
+				dealLatencyTotal += time.Since(dealStartTime)
+				if err != nil {
+					stat.FailedCnt++
+				} else if changed {
+					stat.ChangedCnt++
+				}
+				statMutex.Unlock()
+			}
+		}()
+	}
+
 	for _, offlineDeal := range offlineDeals {
-		dealInfo, err := lotusClient.LotusClientGetDealInfo(offlineDeal.DealCid)
-		if err != nil {
-			logs.GetLogger().Error(err)
-			continue
+		if ctx.Err() != nil {
+			break
 		}
+		offlineDealChan <- offlineDeal
+	}
+	close(offlineDealChan)
+	wg.Wait()
 
-		if offlineDeal.OnChainStatus == nil || *offlineDeal.OnChainStatus != dealInfo.Status {
-			err = models.CreateOfflineDealLog(offlineDeal.Id, dealInfo.Status, dealInfo.Message)
-			if err != nil {
-				logs.GetLogger().Error(err)
-				continue
-			}
+	stat.LatencyMillisecond = time.Since(startTime).Milliseconds()
+	if stat.DealCnt > 0 {
+		stat.AvgDealLatencyMillisecond = dealLatencyTotal.Milliseconds() / int64(stat.DealCnt)
+	}
 
-			err = models.UpdateOfflineDealOnChainStatus(offlineDeal.Id, dealInfo.Status)
-			if err != nil {
-				logs.GetLogger().Error(err)
-				continue
-			}
+	scanDealStatsMutex.Lock()
+	scanDealStats[name] = stat
+	scanDealStatsMutex.Unlock()
+
+	logs.GetLogger().Info(name, " scanned ", stat.DealCnt, " deals, changed:", stat.ChangedCnt, ", failed:", stat.FailedCnt,
+		", latency:", stat.LatencyMillisecond, "ms, avg deal latency:", stat.AvgDealLatencyMillisecond, "ms")
+}
+
+func scheduleNextScan(offlineDeal *models.OfflineDeal, changed bool, err error) error {
+	scanIntervalMin := int64(config.GetConfig().ScheduleRule.ScanDealStatusIntervalSecond)
+	scanIntervalMax := int64(config.GetConfig().ScheduleRule.ScanDealIntervalMaxSecond)
+
+	scanInterval := scanIntervalMin
+	if err == nil && !changed && offlineDeal.ScanInterval > 0 {
+		scanInterval = offlineDeal.ScanInterval * 2
+		if scanInterval > scanIntervalMax {
+			scanInterval = scanIntervalMax
 		}
 	}
 
+	nextScanAt := libutils.GetCurrentUtcSecond() + scanInterval
+	err = models.UpdateOfflineDealNextScan(offlineDeal.Id, nextScanAt, scanInterval)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/dealclient"
+	"testing"
+)
+
+func TestApplyDealInfo(t *testing.T) {
+	errLotus := errors.New("lotus unreachable")
+
+	tests := []struct {
+		name      string
+		dealInfo  *dealclient.DealInfo // nil to keep the info the fake deal client set when sending
+		unknown   bool                 // scan a deal the deal client never sent
+		scanErr   error                // error returned by the deal client instead
+		rescan    bool                 // scan the deal twice, the second scan is checked
+		updated   bool
+		status    string
+		wantError error
+	}{
+		{
+			name:    "deal active",
+			updated: true,
+			status:  constants.OFFLINE_DEAL_STATUS_ACTIVE,
+		},
+		{
+			name:     "deal error",
+			dealInfo: &dealclient.DealInfo{DealId: 1, Status: constants.ON_CHAIN_DEAL_STATUS_ERROR, Message: "deal rejected"},
+			updated:  true,
+			status:   constants.OFFLINE_DEAL_STATUS_FAILED,
+		},
+		{
+			name:     "deal error not completed",
+			dealInfo: &dealclient.DealInfo{DealId: 1, Status: constants.ON_CHAIN_DEAL_STATUS_ERROR, Message: constants.ON_CHAIN_MESSAGE_NOT_COMPLETED},
+			updated:  true,
+			status:   constants.OFFLINE_DEAL_STATUS_CREATED,
+		},
+		{
+			name:    "deal unknown",
+			unknown: true,
+			updated: true,
+			status:  constants.OFFLINE_DEAL_STATUS_FAILED,
+		},
+		{
+			name:    "deal unchanged",
+			rescan:  true,
+			updated: false,
+			status:  constants.OFFLINE_DEAL_STATUS_ACTIVE,
+		},
+		{
+			name:      "deal client failed",
+			scanErr:   errLotus,
+			updated:   false,
+			status:    constants.OFFLINE_DEAL_STATUS_CREATED,
+			wantError: errLotus,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dealClient := dealclient.NewFakeDealClient()
+			carFile := &models.CarFile{ID: 1}
+
+			deals, err := dealClient.SendDeals(context.Background(), carFile, []string{"f01001"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			miner := &models.Miner{ID: 1, Fid: deals[0].MinerFid, Status: constants.MINER_STATUS_NORMAL}
+			offlineDeal := newOfflineDeal(carFile, deals[0], miner, 2, 100)
+			if test.unknown {
+				offlineDeal.DealCid = "unknown"
+			}
+			if test.dealInfo != nil {
+				dealClient.SetDealInfo(offlineDeal.DealCid, *test.dealInfo)
+			}
+
+			scan := func() (bool, error) {
+				dealInfo, err := dealClient.GetDealInfo(context.Background(), offlineDeal.DealCid)
+				if test.scanErr != nil {
+					dealInfo, err = nil, test.scanErr
+				}
+				return applyDealInfo(offlineDeal, dealInfo, err)
+			}
+
+			if test.rescan {
+				if _, err := scan(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			updated, err := scan()
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("error:%v, want:%v", err, test.wantError)
+			}
+
+			if updated != test.updated {
+				t.Errorf("updated:%t, want:%t", updated, test.updated)
+			}
+
+			if offlineDeal.Status != test.status {
+				t.Errorf("status:%s, want:%s", offlineDeal.Status, test.status)
+			}
+
+			if test.status == constants.OFFLINE_DEAL_STATUS_ACTIVE && (offlineDeal.DealId == nil || *offlineDeal.DealId == 0) {
+				t.Errorf("deal id not saved for deal active")
+			}
+		})
+	}
+}
@@ -1,48 +1,68 @@
 package scheduler
 
 import (
-	"github.com/filswan/go-swan-client/command"
-
+	"context"
+	"fmt"
 	"multi-chain-storage/common/constants"
 	"multi-chain-storage/config"
 	"multi-chain-storage/database"
 	"multi-chain-storage/models"
-	"path/filepath"
+	"multi-chain-storage/service/dealclient"
 
 	libutils "github.com/filswan/go-swan-lib/utils"
 
 	"github.com/filswan/go-swan-lib/logs"
-
-	libconstants "github.com/filswan/go-swan-lib/constants"
 )
 
-func SendDeal() error {
+func SendDeal(ctx context.Context) error {
 	carFiles, err := models.GetCarFilesByStatus(constants.CAR_FILE_STATUS_TASK_CREATED)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	cmdAutoBidDeal := &command.CmdAutoBidDeal{
-		SwanApiUrl:             config.GetConfig().SwanApi.ApiUrl,
-		SwanApiKey:             config.GetConfig().SwanApi.ApiKey,
-		SwanAccessToken:        config.GetConfig().SwanApi.AccessToken,
-		LotusClientApiUrl:      config.GetConfig().Lotus.ClientApiUrl,
-		LotusClientAccessToken: config.GetConfig().Lotus.ClientAccessToken,
-		SenderWallet:           config.GetConfig().FilecoinWallet,
-		DealSourceIds:          []int{libconstants.TASK_SOURCE_ID_SWAN_PAYMENT},
+	carFiles, err = claimCarFiles(carFiles, constants.CAR_FILE_STATUS_TASK_CREATED)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	defer releaseCarFiles(carFiles)
+
+	carFileLeases, ctx := keepCarFileLeases(ctx, carFiles)
+	defer carFileLeases.stop()
+
+	dealClient, err := dealclient.GetDealClient()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
 	}
 
 	currentUtcSec := libutils.GetCurrentUtcSecond()
 
-	wallet, err := models.GetWalletByAddress(cmdAutoBidDeal.SenderWallet, constants.WALLET_TYPE_FILE_COIN)
+	wallet, err := models.GetWalletByAddress(config.GetConfig().FilecoinWallet, constants.WALLET_TYPE_FILE_COIN)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
 	for _, carFile := range carFiles {
-		if currentUtcSec-carFile.CreateAt > 3*24*60*60 {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// the deals cannot be taken back, so the lease is checked right before they are sent
+		err = carFileLeases.check()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		if carFileLeases.isLost(carFile.ID) {
+			continue
+		}
+
+		// update_at is reset when a task is created again for the car file, such as when repairing its replicas
+		if currentUtcSec-carFile.UpdateAt > 3*24*60*60 {
 			carFile.Status = constants.CAR_FILE_STATUS_DEAL_SEND_EXPIRED
 			err = database.SaveOne(carFile)
 			if err != nil {
@@ -53,11 +73,21 @@ func SendDeal() error {
 		}
 
 		logs.GetLogger().Info("start to send deal for task:", carFile.TaskUuid)
-		cmdAutoBidDeal.OutputDir = filepath.Dir(carFile.CarFilePath)
 
-		_, fileDescs, err := cmdAutoBidDeal.SendAutoBidDealsByTaskUuid(carFile.TaskUuid)
+		minerFids, err := getMinerFids2Deal(carFile)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		deals, err := dealClient.SendDeals(ctx, carFile, minerFids)
 		if err != nil {
 			logs.GetLogger().Error(err)
+			// the car file stopped by the scheduler before any deal is sent is left to the next run
+			if ctx.Err() != nil {
+				break
+			}
+
 			carFile.Status = constants.CAR_FILE_STATUS_DEAL_SENT_FAILED
 			carFile.UpdateAt = currentUtcSec
 			err = database.SaveOne(carFile)
@@ -67,36 +97,23 @@ func SendDeal() error {
 			continue
 		}
 
-		if len(fileDescs) == 0 {
+		if len(deals) == 0 {
 			logs.GetLogger().Info("no deals sent")
 			continue
 		}
 
-		for _, fileDesc := range fileDescs {
-			for _, deal := range fileDesc.Deals {
-				miner, err := models.GeMinerByFid(deal.MinerFid)
-				if err != nil {
-					logs.GetLogger().Error(err)
-					continue
-				}
-
-				offlineDeal := models.OfflineDeal{
-					CarFileId:      carFile.ID,
-					DealCid:        deal.DealCid,
-					MinerId:        miner.ID,
-					StartEpoch:     deal.StartEpoch,
-					SenderWalletId: wallet.ID,
-					Status:         constants.OFFLINE_DEAL_STATUS_CREATED,
-					DealId:         nil,
-					CreateAt:       currentUtcSec,
-					UpdateAt:       currentUtcSec,
-				}
-
-				err = database.SaveOne(&offlineDeal)
-				if err != nil {
-					logs.GetLogger().Error(err)
-					continue
-				}
+		for _, deal := range deals {
+			miner, err := models.GeMinerByFid(deal.MinerFid)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				continue
+			}
+
+			offlineDeal := newOfflineDeal(carFile, deal, miner, wallet.ID, currentUtcSec)
+			err = database.SaveOne(offlineDeal)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				continue
 			}
 		}
 
@@ -108,7 +125,86 @@ func SendDeal() error {
 			logs.GetLogger().Error(err)
 			continue
 		}
+
+		PublishEvent(constants.EVENT_TYPE_DEAL_SENT, carFile.ID)
 	}
 
 	return nil
 }
+
+// newOfflineDeal returns the offline deal to be saved for the deal sent to the miner
+func newOfflineDeal(carFile *models.CarFile, deal *dealclient.Deal, miner *models.Miner, senderWalletId int64, currentUtcSec int64) *models.OfflineDeal {
+	offlineDeal := &models.OfflineDeal{
+		CarFileId:      carFile.ID,
+		DealCid:        deal.DealCid,
+		MinerId:        miner.ID,
+		StartEpoch:     deal.StartEpoch,
+		SenderWalletId: senderWalletId,
+		Status:         constants.OFFLINE_DEAL_STATUS_CREATED,
+		DealId:         nil,
+		CreateAt:       currentUtcSec,
+		UpdateAt:       currentUtcSec,
+	}
+
+	// miners chosen by swan auto-bid may be blocklisted, such deals are not counted as replicas, never unlocked,
+	// and not counted against the miner reputation either, since the miner did not fail them
+	if !isMinerSelectable(miner) {
+		note := fmt.Sprintf("miner:%s is %s", miner.Fid, miner.Status)
+		logs.GetLogger().Warn("deal:", deal.DealCid, " sent to ", note)
+		offlineDeal.Status = constants.OFFLINE_DEAL_STATUS_MINER_BLOCKLISTED
+		offlineDeal.Note = &note
+	}
+
+	return offlineDeal
+}
+
+// getMinerFids2Deal picks the best ranked miners in deal_client.miner_fids for the replicas missing,
+// the miners already having a deal of the car file not failed are skipped
+func getMinerFids2Deal(carFile *models.CarFile) ([]string, error) {
+	minerFidsCandidate := config.GetConfig().DealClient.MinerFids
+	if len(minerFidsCandidate) == 0 {
+		return nil, nil
+	}
+
+	offlineDeals, err := models.GetOfflineDealOutsByCarFileId(carFile.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	replicaCountMissing := config.GetConfig().SwanTask.ReplicaCount
+	minerFidsDealt := map[string]bool{}
+	for _, offlineDeal := range offlineDeals {
+		if offlineDeal.Status == constants.OFFLINE_DEAL_STATUS_FAILED || offlineDeal.Status == constants.OFFLINE_DEAL_STATUS_MINER_BLOCKLISTED {
+			continue
+		}
+
+		if offlineDeal.OnChainStatus != nil && (*offlineDeal.OnChainStatus == constants.ON_CHAIN_DEAL_STATUS_SLASHED || *offlineDeal.OnChainStatus == constants.ON_CHAIN_DEAL_STATUS_EXPIRED) {
+			continue
+		}
+
+		minerFidsDealt[offlineDeal.MinerFid] = true
+		replicaCountMissing--
+	}
+
+	miners, err := SelectMiners(minerFidsCandidate)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var minerFids []string
+	for _, miner := range miners {
+		if len(minerFids) >= replicaCountMissing {
+			break
+		}
+
+		if minerFidsDealt[miner.Fid] {
+			continue
+		}
+
+		minerFids = append(minerFids, miner.Fid)
+	}
+
+	return minerFids, nil
+}
@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"context"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/dealclient"
+	"testing"
+)
+
+func TestNewOfflineDeal(t *testing.T) {
+	tests := []struct {
+		name       string
+		minerFids  []string
+		minerStats map[string]string
+		statuses   []string
+	}{
+		{
+			name:       "miners normal and allowlisted",
+			minerFids:  []string{"f01001", "f01002"},
+			minerStats: map[string]string{"f01001": constants.MINER_STATUS_NORMAL, "f01002": constants.MINER_STATUS_ALLOWLISTED},
+			statuses:   []string{constants.OFFLINE_DEAL_STATUS_CREATED, constants.OFFLINE_DEAL_STATUS_CREATED},
+		},
+		{
+			name:       "miner blocklisted",
+			minerFids:  []string{"f01001", "f01003"},
+			minerStats: map[string]string{"f01001": constants.MINER_STATUS_NORMAL, "f01003": constants.MINER_STATUS_BLOCKLISTED},
+			statuses:   []string{constants.OFFLINE_DEAL_STATUS_CREATED, constants.OFFLINE_DEAL_STATUS_MINER_BLOCKLISTED},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dealClient := dealclient.NewFakeDealClient()
+			carFile := &models.CarFile{ID: 1}
+
+			deals, err := dealClient.SendDeals(context.Background(), carFile, test.minerFids)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(deals) != len(test.statuses) {
+				t.Fatalf("deals sent:%d, want:%d", len(deals), len(test.statuses))
+			}
+
+			for i, deal := range deals {
+				miner := &models.Miner{ID: int64(i + 1), Fid: deal.MinerFid, Status: test.minerStats[deal.MinerFid]}
+				offlineDeal := newOfflineDeal(carFile, deal, miner, 2, 100)
+
+				if offlineDeal.Status != test.statuses[i] {
+					t.Errorf("deal to miner:%s status:%s, want:%s", deal.MinerFid, offlineDeal.Status, test.statuses[i])
+				}
+
+				if offlineDeal.DealCid != deal.DealCid || offlineDeal.MinerId != miner.ID || offlineDeal.CarFileId != carFile.ID || offlineDeal.SenderWalletId != 2 {
+					t.Errorf("deal to miner:%s saved as %+v", deal.MinerFid, offlineDeal)
+				}
+
+				if (offlineDeal.Note != nil) != (test.statuses[i] == constants.OFFLINE_DEAL_STATUS_MINER_BLOCKLISTED) {
+					t.Errorf("deal to miner:%s note:%v", deal.MinerFid, offlineDeal.Note)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/config"
+	"multi-chain-storage/database"
+	"multi-chain-storage/models"
+	"multi-chain-storage/service/hotstorage"
+
+	"github.com/filswan/go-swan-lib/logs"
+	libutils "github.com/filswan/go-swan-lib/utils"
+)
+
+const JOB_NAME_UNPIN_SOURCE_FILE = "UnpinSourceFile"
+
+// UnpinSourceFile unpins the uploads whose grace period has ended, with [unpin].keep_until_deal_active, the upload is
+// kept being unpinned till its source file has an active deal. The content is unpinned from the hot storage once no
+// upload of its source file is pinned or being unpinned
+func UnpinSourceFile(ctx context.Context) error {
+	hotStorage, err := hotstorage.GetHotStorage()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	currentUtcSecond := libutils.GetCurrentUtcSecond()
+	unpinnedCnt, postponedCnt, failedCnt := 0, 0, 0
+	var idLast int64
+	for ctx.Err() == nil {
+		sourceFileUploads, err := models.GetSourceFileUploadsUnpinDue(currentUtcSecond, idLast, constants.UNPIN_SOURCE_FILE_BATCH_SIZE)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		for _, sourceFileUpload := range sourceFileUploads {
+			if ctx.Err() != nil {
+				break
+			}
+
+			idLast = sourceFileUpload.Id
+
+			if config.GetConfig().Unpin.KeepUntilDealActive {
+				sourceFileDeals, err := models.GetSourceFileActiveDeals(sourceFileUpload.SourceFileId)
+				if err != nil {
+					logs.GetLogger().Error(err)
+					failedCnt++
+					continue
+				}
+
+				if len(sourceFileDeals) == 0 {
+					postponedCnt++
+					continue
+				}
+			}
+
+			err := unpinSourceFileUpload(ctx, hotStorage, sourceFileUpload)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				failedCnt++
+				continue
+			}
+
+			unpinnedCnt++
+		}
+
+		if len(sourceFileUploads) < constants.UNPIN_SOURCE_FILE_BATCH_SIZE {
+			break
+		}
+	}
+
+	logs.GetLogger().Info("source file uploads unpinned:", unpinnedCnt, ", postponed without active deal:", postponedCnt, ", failed:", failedCnt)
+	return nil
+}
+
+// unpinSourceFileUpload marks the upload unpinned, and the source file unpinning if no other upload of it is pinned,
+// with the source file locked, which is locked as well when the same content is saved. The content is unpinned from the
+// hot storage after the transaction is committed, so the lock is not held while calling the hot storage
+func unpinSourceFileUpload(ctx context.Context, hotStorage hotstorage.HotStorage, sourceFileUpload *models.SourceFileUpload) error {
+	db := database.GetDBTransactionContext(ctx)
+	sourceFile, err := models.GetSourceFileByIdForUpdate(db, sourceFileUpload.SourceFileId)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if sourceFile == nil {
+		db.Rollback()
+		err := fmt.Errorf("source file:%d of upload:%d not exists", sourceFileUpload.SourceFileId, sourceFileUpload.Id)
+		return err
+	}
+
+	unpinned, err := models.UpdateSourceFileUploadUnpinnedInTransaction(db, sourceFileUpload.Id)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if !unpinned {
+		db.Rollback()
+		logs.GetLogger().Info("unpin of source file upload:", sourceFileUpload.Id, " has been undone")
+		return nil
+	}
+
+	pinnedCnt, err := models.GetSourceFileUploadPinnedCntInTransaction(db, sourceFile.ID)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if pinnedCnt == 0 && sourceFile.PinStatus == constants.IPFS_File_PINNED_STATUS {
+		sourceFile.PinStatus = constants.IPFS_File_UNPINNING_STATUS
+		sourceFile.UpdateAt = libutils.GetCurrentUtcSecond()
+		err = database.SaveOneInTransaction(db, sourceFile)
+		if err != nil {
+			db.Rollback()
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("source file upload:", sourceFileUpload.Id, " unpinned, uploads of source file:", sourceFile.ID, " still pinned:", pinnedCnt)
+
+	if pinnedCnt == 0 && sourceFile.PinStatus == constants.IPFS_File_UNPINNING_STATUS {
+		err = finishSourceFileUnpin(ctx, hotStorage, sourceFile)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// finishSourceFileUnpin unpins the content of the source file marked unpinning from the hot storage, and marks it
+// unpinned. If the content has been saved or pin requested again meanwhile, the source file is pinned already, then the
+// content is pinned back. On failure, the source file is left unpinning and finished by ReconcilePin
+func finishSourceFileUnpin(ctx context.Context, hotStorage hotstorage.HotStorage, sourceFile *models.SourceFile) error {
+	err := hotStorage.Unpin(ctx, sourceFile.PayloadCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	unpinned, err := models.UpdateSourceFilePinStatusFrom(sourceFile.ID, constants.IPFS_File_UNPINNING_STATUS, constants.IPFS_File_UNPINNED_STATUS)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if unpinned {
+		logs.GetLogger().Info("source file:", sourceFile.ID, " unpinned from hot storage, cid:", sourceFile.PayloadCid)
+		return nil
+	}
+
+	err = hotStorage.Pin(ctx, sourceFile.PayloadCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	logs.GetLogger().Info("source file:", sourceFile.ID, " pinned again while being unpinned, cid:", sourceFile.PayloadCid)
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"multi-chain-storage/common/constants"
+	"multi-chain-storage/models"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+// checkSourceFileUploadTags trims the keys of the tags and checks their lengths
+func checkSourceFileUploadTags(tags map[string]string) (map[string]string, error) {
+	tagsChecked := map[string]string{}
+	for tagKey, tagValue := range tags {
+		tagKey = strings.Trim(tagKey, " ")
+		if tagKey == "" || utf8.RuneCountInString(tagKey) > constants.SOURCE_FILE_UPLOAD_TAG_KEY_LEN_MAX {
+			err := fmt.Errorf("tag key must be 1 to %d characters", constants.SOURCE_FILE_UPLOAD_TAG_KEY_LEN_MAX)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if utf8.RuneCountInString(tagValue) > constants.SOURCE_FILE_UPLOAD_TAG_VALUE_LEN_MAX {
+			err := fmt.Errorf("value of tag:%s must be at most %d characters", tagKey, constants.SOURCE_FILE_UPLOAD_TAG_VALUE_LEN_MAX)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		tagsChecked[tagKey] = tagValue
+	}
+
+	return tagsChecked, nil
+}
+
+// saveSourceFileUploadTags adds the tags to the upload, the values of the keys tagged already are replaced, at most
+// SOURCE_FILE_UPLOAD_TAG_CNT_MAX keys in all
+func saveSourceFileUploadTags(sourceFileUploadId int64, tags map[string]string) error {
+	tags, err := checkSourceFileUploadTags(tags)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagsExisting, err := models.GetSourceFileUploadTags(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	tagCnt := len(tagsExisting)
+	for tagKey := range tags {
+		if _, ok := tagsExisting[tagKey]; !ok {
+			tagCnt++
+		}
+	}
+
+	if tagCnt > constants.SOURCE_FILE_UPLOAD_TAG_CNT_MAX {
+		err := fmt.Errorf("source file upload:%d can have at most %d tags", sourceFileUploadId, constants.SOURCE_FILE_UPLOAD_TAG_CNT_MAX)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = models.SaveSourceFileUploadTags(sourceFileUploadId, tags)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetSourceFileUploadTags returns the tags of the upload, owned by the wallet or an organization it is a member of
+func GetSourceFileUploadTags(walletAddress string, sourceFileUploadId int64) (map[string]string, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	_, err = getSourceFileUploadByRole(wallet, sourceFileUploadId, constants.ORGANIZATION_ROLE_VIEWER)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return models.GetSourceFileUploadTags(sourceFileUploadId)
+}
+
+// SaveSourceFileUploadTags tags the upload owned by the wallet, or by an organization the wallet is an uploader of
+// at least, the values of the keys tagged already are replaced
+func SaveSourceFileUploadTags(walletAddress string, sourceFileUploadId int64, tags map[string]string) error {
+	wallet, err := getWalletNotBlocked(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = getSourceFileUploadByRole(wallet, sourceFileUploadId, constants.ORGANIZATION_ROLE_UPLOADER)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return saveSourceFileUploadTags(sourceFileUploadId, tags)
+}
+
+// RemoveSourceFileUploadTags removes the tags of the keys from the upload, the keys not tagged are ignored
+func RemoveSourceFileUploadTags(walletAddress string, sourceFileUploadId int64, tagKeys []string) error {
+	wallet, err := getWalletNotBlocked(walletAddress)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = getSourceFileUploadByRole(wallet, sourceFileUploadId, constants.ORGANIZATION_ROLE_UPLOADER)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if len(tagKeys) == 0 {
+		return nil
+	}
+
+	for i := range tagKeys {
+		tagKeys[i] = strings.Trim(tagKeys[i], " ")
+	}
+
+	err = models.DeleteSourceFileUploadTags(sourceFileUploadId, tagKeys)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"mime/multipart"
@@ -12,13 +13,14 @@ import (
 
 	"multi-chain-storage/config"
 	"multi-chain-storage/models"
+	"multi-chain-storage/service/hotstorage"
+	"multi-chain-storage/service/plan"
 	"multi-chain-storage/service/scheduler"
 	"os"
 	"path/filepath"
 	"strconv"
 	"sync"
 
-	"github.com/filswan/go-swan-lib/client/ipfs"
 	"github.com/filswan/go-swan-lib/client/web"
 	libconstants "github.com/filswan/go-swan-lib/constants"
 	"github.com/filswan/go-swan-lib/logs"
@@ -37,127 +39,385 @@ type UploadResult struct {
 	FileSize           int64  `json:"file_size"`
 	WCid               string `json:"w_cid"`
 	Status             string `json:"status"`
+
+	IsEncrypted   bool    `json:"is_encrypted"`
+	KeyWrapScheme *string `json:"key_wrap_scheme"`
+	WrappedKey    *string `json:"wrapped_key"`
 }
 
-func SaveFile(c *gin.Context, srcFile *multipart.FileHeader, duration, fileType int, walletAddress string) (*UploadResult, error) {
+// SaveFile saves the uploaded file as an upload of the wallet, owned by the organization if given, which requires the
+// wallet to be its uploader at least. It is encrypted first if encryptionType is given, then only the encrypted content
+// is kept, pinned and stored in deals. The upload is checked against the plan of the organization or the wallet before
+// the file is received, and the content is checked against the denylist by its hash and scanned by the scan hooks
+// before encrypted. The upload of the wallet is put at the key in its bucket if bucketName is given, the key is the
+// file name if not given, and tagged with the tags
+func SaveFile(c *gin.Context, srcFile *multipart.FileHeader, duration, fileType int, walletAddress string, organizationId *int64, encryptionType, walletPublicKey, bucketName, objectKey string, tags map[string]string) (*UploadResult, error) {
 	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
+	if wallet.IsBlocked {
+		err := fmt.Errorf("%w, wallet:%s", ErrWalletBlocked, walletAddress)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if organizationId != nil {
+		_, err := checkOrganizationRole(wallet, *organizationId, constants.ORGANIZATION_ROLE_UPLOADER)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	var bucket *models.Bucket
+	if bucketName != "" {
+		bucket, objectKey, err = checkUploadBucketObject(wallet, organizationId, bucketName, objectKey, srcFile.Filename)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	tags, err = checkSourceFileUploadTags(tags)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = plan.CheckUpload(plan.GetSubject(wallet.ID, organizationId), srcFile.Size)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	srcFilepath, err := saveSrcFile(srcFile.Filename, func(srcFilepath string) error {
+		return c.SaveUploadedFile(srcFile, srcFilepath)
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	inspection, err := inspectSrcFile(wallet, organizationId, srcFilepath, srcFile.Filename, srcFile.Size, fileType)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	uploadFilepath, uploadFileSize := srcFilepath, srcFile.Size
+	var encryption *sourceFileEncryption
+	if encryptionType != "" {
+		uploadFilepath, encryption, err = encryptSrcFile(wallet, srcFilepath, srcFile.Filename, encryptionType, walletPublicKey)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		uploadFileSize = encryption.encryptedFileSize
+	}
+
+	uploadResult, err := saveSourceFileUpload(wallet, organizationId, uploadFilepath, srcFile.Filename, uploadFileSize, duration, fileType, inspection, encryption)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = organizeSourceFileUpload(uploadResult.SourceFileUploadId, bucket, objectKey, tags)
+	if err != nil {
+		err := fmt.Errorf("source file upload:%d saved, but %w", uploadResult.SourceFileUploadId, err)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return uploadResult, nil
+}
+
+// checkUploadBucketObject returns the bucket of the wallet and the key, the file name if not given, to put the upload
+// at, ErrBucketObjectExists if the key is taken
+func checkUploadBucketObject(wallet *models.Wallet, organizationId *int64, bucketName, objectKey, filename string) (*models.Bucket, string, error) {
+	if organizationId != nil {
+		err := fmt.Errorf("%w, organization:%d", ErrBucketOrganizationUpload, *organizationId)
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	if objectKey == "" {
+		objectKey = filename
+	}
+
+	err := checkObjectKey(objectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	bucket, err := GetBucket(wallet, bucketName)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	bucketObject, err := models.GetBucketObject(bucket.ID, objectKey)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	if bucketObject != nil {
+		err := fmt.Errorf("%w, bucket:%s, key:%s", ErrBucketObjectExists, bucketName, objectKey)
+		logs.GetLogger().Error(err)
+		return nil, "", err
+	}
+
+	return bucket, objectKey, nil
+}
+
+// organizeSourceFileUpload tags the upload saved and puts it at the key in the bucket if given
+func organizeSourceFileUpload(sourceFileUploadId int64, bucket *models.Bucket, objectKey string, tags map[string]string) error {
+	if len(tags) > 0 {
+		err := saveSourceFileUploadTags(sourceFileUploadId, tags)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	if bucket == nil {
+		return nil
+	}
+
+	sourceFileUpload, err := models.GetSourceFileUploadById(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = putBucketObject(bucket, objectKey, sourceFileUpload)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// saveSrcFile saves the content to the source directory by save, the file is named after filename,
+// with a suffix when the name is taken
+func saveSrcFile(filename string, save func(srcFilepath string) error) (string, error) {
 	srcDir := scheduler.GetSrcDir()
 
 	uploadMutext.Lock()
-	filename := srcFile.Filename
-	if libutils.IsFileExists(srcDir, filename) {
+	srcFilename := filename
+	if libutils.IsFileExists(srcDir, srcFilename) {
 		for i := 0; ; i++ {
-			filename = srcFile.Filename + "_" + strconv.Itoa(i)
-			if !libutils.IsFileExists(srcDir, filename) {
+			srcFilename = filename + "_" + strconv.Itoa(i)
+			if !libutils.IsFileExists(srcDir, srcFilename) {
 				break
 			}
 		}
 	}
 
-	srcFilepath := filepath.Join(srcDir, filename)
+	// the name is taken by an empty file, so the content can be saved out of the lock
+	srcFilepath := filepath.Join(srcDir, srcFilename)
+	file, err := os.OpenFile(srcFilepath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	uploadMutext.Unlock()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	file.Close()
+
 	logs.GetLogger().Info("saving source file to ", srcFilepath)
-	err = c.SaveUploadedFile(srcFile, srcFilepath)
+	err = save(srcFilepath)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		uploadMutext.Unlock()
-		return nil, err
+		os.Remove(srcFilepath)
+		return "", err
 	}
 	logs.GetLogger().Info("source file saved to ", srcFilepath)
-	uploadMutext.Unlock()
 
-	logs.GetLogger().Info("uploading source file ", srcFilepath, " to ", config.GetConfig().IpfsServer.UploadUrlPrefix)
-	uploadUrl := libutils.UrlJoin(config.GetConfig().IpfsServer.UploadUrlPrefix, "api/v0/add?stream-channels=true&pin=true")
-	ipfsFileHash, err := ipfs.IpfsUploadFileByWebApi(uploadUrl, srcFilepath)
+	return srcFilepath, nil
+}
+
+// saveSourceFileUpload puts the source file saved to the hot storage, and records it as an upload of the wallet, owned by
+// the organization if given, free if the monthly free bytes of the plan of the organization or the wallet are enough, with the inspection of the content received and the encryption if the
+// source file is encrypted. The content denied by its cid is unpinned again unless pinned for other uploads before
+func saveSourceFileUpload(wallet *models.Wallet, organizationId *int64, srcFilepath, filename string, fileSize int64, duration, fileType int, inspection *sourceFileInspection, encryption *sourceFileEncryption) (*UploadResult, error) {
+	hotStorage, err := hotstorage.GetHotStorage()
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
-	logs.GetLogger().Info("source file ", srcFilepath, " uploaded to ", config.GetConfig().IpfsServer.UploadUrlPrefix)
 
-	ipfsUrl := libutils.UrlJoin(config.GetConfig().IpfsServer.DownloadUrlPrefix, constants.IPFS_URL_PREFIX_BEFORE_HASH, *ipfsFileHash)
+	logs.GetLogger().Info("uploading source file ", srcFilepath, " to ", config.GetConfig().HotStorage.Type, " hot storage")
+	payloadCid, err := hotStorage.Put(context.Background(), srcFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	logs.GetLogger().Info("source file ", srcFilepath, " uploaded to ", config.GetConfig().HotStorage.Type, " hot storage")
 
-	sourceFile, err := models.GetSourceFileByPayloadCid(*ipfsFileHash)
+	err = checkContentAllowed(wallet, srcFilepath, payloadCid, "")
 	if err != nil {
 		logs.GetLogger().Error(err)
+		unpinDeniedContent(hotStorage, payloadCid)
 		return nil, err
 	}
 
+	ipfsUrl := hotStorage.GetUrl(payloadCid)
+
+	// saving the same new content at the same time locks the gap of its cid in each transaction, all but one of them
+	// may fail on a deadlock or a duplicate key, they are run again then and find the source file saved
+	var sourceFile *models.SourceFile
+	var sourceFileUpload *models.SourceFileUpload
+	for attemptCnt := 1; ; attemptCnt++ {
+		sourceFile, sourceFileUpload, err = saveSourceFileUploadInTransaction(hotStorage, wallet, organizationId, srcFilepath, filename, fileSize, duration, fileType, payloadCid, ipfsUrl, inspection, encryption)
+		if err == nil {
+			break
+		}
+
+		if !database.IsRetryableError(err) {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if attemptCnt >= constants.SAVE_SOURCE_FILE_UPLOAD_ATTEMPT_MAX {
+			logs.GetLogger().Error(err)
+			removeSourceFileUploadCopy(srcFilepath)
+			return nil, err
+		}
+
+		logs.GetLogger().Warn("saving upload of ", payloadCid, " failed, try again, ", err)
+	}
+
+	// the content is kept in the copy of the source file saved before, remove the current copy, after committed so that
+	// it is still there if the transaction is run again
+	if !strings.EqualFold(sourceFile.ResourceUri, srcFilepath) {
+		removeSourceFileUploadCopy(srcFilepath)
+	}
+
+	uploadResult := &UploadResult{
+		SourceFileUploadId: sourceFileUpload.Id,
+		Status:             sourceFileUpload.Status,
+		PayloadCid:         payloadCid,
+		IpfsUrl:            ipfsUrl,
+		FileSize:           sourceFile.FileSize,
+		WCid:               sourceFileUpload.Uuid + payloadCid,
+		IsEncrypted:        encryption != nil,
+		KeyWrapScheme:      sourceFileUpload.KeyWrapScheme,
+		WrappedKey:         sourceFileUpload.WrappedKey,
+	}
+
+	return uploadResult, nil
+}
+
+// saveSourceFileUploadInTransaction saves the source file of the content if new, and the upload of it, in one transaction
+func saveSourceFileUploadInTransaction(hotStorage hotstorage.HotStorage, wallet *models.Wallet, organizationId *int64, srcFilepath, filename string, fileSize int64, duration, fileType int, payloadCid, ipfsUrl string, inspection *sourceFileInspection, encryption *sourceFileEncryption) (*models.SourceFile, *models.SourceFileUpload, error) {
+	// the source file is locked till the upload is created, so the content is not unpinned meanwhile
+	db := database.GetDBTransaction()
+	sourceFile, err := models.GetSourceFileByPayloadCidForUpdate(db, payloadCid)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	// the upload is counted to the usage of the organization or the wallet, and is free if the monthly free bytes of its
+	// plan are enough
+	isFree, err := plan.ReserveUploadInTransaction(db, plan.GetSubject(wallet.ID, organizationId), fileSize, fileType == constants.SOURCE_FILE_TYPE_NORMAL)
+	if err != nil {
+		db.Rollback()
+		logs.GetLogger().Error(err)
+		if !database.IsRetryableError(err) {
+			os.Remove(srcFilepath)
+			unpinDeniedContent(hotStorage, payloadCid)
+		}
+		return nil, nil, err
+	}
+
+	sourceFileUploadStatus := constants.SOURCE_FILE_UPLOAD_STATUS_PENDING
+	if isFree {
+		sourceFileUploadStatus = constants.SOURCE_FILE_UPLOAD_STATUS_FREE
+	}
+
 	currentUtcMilliSec := libutils.GetCurrentUtcSecond()
 
 	if sourceFile == nil {
 		sourceFile = &models.SourceFile{
-			FileSize:    srcFile.Size,
+			FileSize:    fileSize,
 			ResourceUri: srcFilepath,
 			IpfsUrl:     ipfsUrl,
 			PinStatus:   constants.IPFS_File_PINNED_STATUS,
-			PayloadCid:  *ipfsFileHash,
+			PayloadCid:  payloadCid,
 			CreateAt:    currentUtcMilliSec,
 			UpdateAt:    currentUtcMilliSec,
 		}
 
-		sourceFile, err = models.CreateSourceFile(sourceFile)
+		err = setSourceFileScanResult(sourceFile, inspection.getScanResult())
+		if err != nil {
+			db.Rollback()
+			logs.GetLogger().Error(err)
+			os.Remove(srcFilepath)
+			return nil, nil, err
+		}
+
+		err = database.SaveOneInTransaction(db, sourceFile)
 		if err != nil {
+			db.Rollback()
 			logs.GetLogger().Error(err)
-			err = os.Remove(srcFilepath)
+			if !database.IsRetryableError(err) {
+				removeSourceFileUploadCopy(srcFilepath)
+			}
+			return nil, nil, err
+		}
+	} else {
+		// the content may have been unpinned after it was put above, by the unpin of the last upload of it
+		if sourceFile.PinStatus != constants.IPFS_File_PINNED_STATUS {
+			err := hotStorage.Pin(context.Background(), payloadCid)
 			if err != nil {
+				db.Rollback()
 				logs.GetLogger().Error(err)
-				return nil, err
+				return nil, nil, err
 			}
-			return nil, err
 		}
-	} else {
+
+		err = setSourceFileScanResult(sourceFile, inspection.getScanResult())
+		if err != nil {
+			db.Rollback()
+			logs.GetLogger().Error(err)
+			return nil, nil, err
+		}
+
 		if !libutils.IsFileExistsFullPath(sourceFile.ResourceUri) {
 			sourceFile.ResourceUri = srcFilepath
+			sourceFile.LocalDeletedAt = nil
 			sourceFile.PinStatus = constants.IPFS_File_PINNED_STATUS
 			sourceFile.UpdateAt = currentUtcMilliSec
-			err := database.SaveOne(sourceFile)
+			err := database.SaveOneInTransaction(db, sourceFile)
 			if err != nil {
+				db.Rollback()
 				logs.GetLogger().Error(err)
-				return nil, err
+				return nil, nil, err
 			}
 		} else {
 			sourceFile.PinStatus = constants.IPFS_File_PINNED_STATUS
 			sourceFile.UpdateAt = currentUtcMilliSec
-			err := database.SaveOne(sourceFile)
+			err := database.SaveOneInTransaction(db, sourceFile)
 			if err != nil {
+				db.Rollback()
 				logs.GetLogger().Error(err)
-				return nil, err
-			}
-
-			if !strings.EqualFold(sourceFile.ResourceUri, srcFilepath) {
-				// remove the current copy of file
-				err = os.Remove(srcFilepath)
-				if err != nil {
-					logs.GetLogger().Error(err)
-					return nil, err
-				}
+				return nil, nil, err
 			}
 		}
 	}
 
-	freeUsage, err := models.GetSourceFileUploadFreeUsage(wallet.ID)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	isFree := false
-	sourceFileUploadStatus := constants.SOURCE_FILE_UPLOAD_STATUS_PENDING
-	if fileType == constants.SOURCE_FILE_TYPE_NORMAL && constants.FREE_SIZE_PER_WALLET_MONTH-*freeUsage >= srcFile.Size {
-		isFree = true
-		sourceFileUploadStatus = constants.SOURCE_FILE_UPLOAD_STATUS_FREE
-	}
-
 	sourceFileUploadUuid := uuid.NewString()
 	sourceFileUpload := &models.SourceFileUpload{
 		SourceFileId: sourceFile.ID,
 		FileType:     fileType,
-		FileName:     srcFile.Filename,
+		FileName:     filename,
 		Uuid:         sourceFileUploadUuid,
 		WalletId:     wallet.ID,
 		Status:       sourceFileUploadStatus,
@@ -166,51 +426,76 @@ func SaveFile(c *gin.Context, srcFile *multipart.FileHeader, duration, fileType
 		IsFree:       isFree,
 		CreateAt:     currentUtcMilliSec,
 		UpdateAt:     currentUtcMilliSec,
+
+		OrganizationId: organizationId,
+	}
+
+	if inspection != nil {
+		sourceFileUpload.ContentSha256 = &inspection.contentSha256
+	}
+
+	if encryption != nil {
+		sourceFileUpload.EncryptionScheme = &encryption.scheme
+		sourceFileUpload.KeyWrapScheme = &encryption.keyWrapScheme
+		sourceFileUpload.WrappedKey = &encryption.wrappedKey
+		sourceFileUpload.KmsKeyId = encryption.kmsKeyId
+		sourceFileUpload.PlainFileSize = &encryption.plainFileSize
 	}
 
-	sourceFileUpload, err = models.CreateSourceFileUpload(sourceFileUpload)
+	err = database.SaveOneInTransaction(db, sourceFileUpload)
 	if err != nil {
+		db.Rollback()
 		logs.GetLogger().Error(err)
-		err = os.Remove(srcFilepath)
-		if err != nil {
-			logs.GetLogger().Error(err)
-			return nil, err
+		if !database.IsRetryableError(err) {
+			removeSourceFileUploadCopy(srcFilepath)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
-	uploadResult := &UploadResult{
-		SourceFileUploadId: sourceFileUpload.Id,
-		Status:             sourceFileUploadStatus,
-		PayloadCid:         *ipfsFileHash,
-		IpfsUrl:            ipfsUrl,
-		FileSize:           sourceFile.FileSize,
-		WCid:               sourceFileUploadUuid + *ipfsFileHash,
+	err = db.Commit().Error
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
 	}
 
-	return uploadResult, nil
+	return sourceFile, sourceFileUpload, nil
 }
 
-func GetSourceFileUploads(walletAddress string, status, fileName, orderBy, isMinted *string, isAscend bool, limit, offset *int, uploadAtStart, uploadAtEnd *int64) ([]*models.SourceFileUploadResult, *int, *int64, error) {
-	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+// removeSourceFileUploadCopy removes the copy of the content uploaded, when the upload is not saved
+func removeSourceFileUploadCopy(srcFilepath string) {
+	err := os.Remove(srcFilepath)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil, nil, nil, err
 	}
+}
 
-	srcFileUploads, totalRecordCount, err := models.GetSourceFileUploads(wallet.ID, status, fileName, orderBy, isMinted, isAscend, limit, offset, uploadAtStart, uploadAtEnd)
+// fillSourceFileUploadResults sets the deals and the tags of the uploads, loaded in one query each, and shows the
+// statuses between pending and refundable or completed as processing
+func fillSourceFileUploadResults(srcFileUploads []*models.SourceFileUploadResult) error {
+	srcFileUploadIds := []int64{}
+	for _, srcFileUpload := range srcFileUploads {
+		srcFileUploadIds = append(srcFileUploadIds, srcFileUpload.SourceFileUploadId)
+	}
+
+	offlineDeals, err := models.GetOfflineDealOutsBySourceFileUploadIds(srcFileUploadIds)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil, nil, nil, err
+		return err
+	}
+
+	tags, err := models.GetSourceFileUploadTagsBySourceFileUploadIds(srcFileUploadIds)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
 	}
 
 	for _, srcFileUpload := range srcFileUploads {
-		offlineDeals, err := models.GetOfflineDealOutsBySourceFileUploadId(srcFileUpload.SourceFileUploadId)
-		if err != nil {
-			logs.GetLogger().Error(err)
-			return nil, nil, nil, err
+		srcFileUpload.OfflineDeals = offlineDeals[srcFileUpload.SourceFileUploadId]
+
+		srcFileUpload.Tags = tags[srcFileUpload.SourceFileUploadId]
+		if srcFileUpload.Tags == nil {
+			srcFileUpload.Tags = map[string]string{}
 		}
-		srcFileUpload.OfflineDeals = offlineDeals
 
 		if srcFileUpload.Status != constants.SOURCE_FILE_UPLOAD_STATUS_PENDING &&
 			srcFileUpload.Status != constants.SOURCE_FILE_UPLOAD_STATUS_REFUNDABLE &&
@@ -219,17 +504,100 @@ func GetSourceFileUploads(walletAddress string, status, fileName, orderBy, isMin
 		}
 	}
 
-	freeUsage, err := models.GetSourceFileUploadFreeUsage(wallet.ID)
+	return nil
+}
+
+// GetSourceFileUploads returns the page of the uploads of the wallet, or of the organization if given, which requires
+// the wallet to be its member, narrowed by the filter if given, with their deals and tags, the count of all the uploads
+// listed, the cursor of the next page, and the usage of the wallet or the organization in the current month
+func GetSourceFileUploads(walletAddress string, organizationId *int64, uploadFilter *UploadFilter, status, fileName, orderBy, isMinted *string, isAscend bool, page *models.Page, uploadAtStart, uploadAtEnd *int64) ([]*models.SourceFileUploadResult, *int, *string, *plan.Usage, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, nil, err
+	}
+
+	if organizationId != nil {
+		_, err := checkOrganizationRole(wallet, *organizationId, constants.ORGANIZATION_ROLE_VIEWER)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, nil, nil, nil, err
+		}
+	}
+
+	filter, err := getSourceFileUploadFilter(wallet, uploadFilter)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, nil, err
+	}
+
+	srcFileUploads, totalRecordCount, nextCursor, err := models.GetSourceFileUploads(wallet.ID, organizationId, filter, status, fileName, orderBy, isMinted, isAscend, page, uploadAtStart, uploadAtEnd)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, nil, err
+	}
+
+	err = fillSourceFileUploadResults(srcFileUploads)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, nil, err
+	}
+
+	usage, err := plan.GetUsage(plan.GetSubject(wallet.ID, organizationId))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, nil, err
+	}
+
+	return srcFileUploads, totalRecordCount, nextCursor, usage, nil
+}
+
+// SearchSourceFileUploads returns the page of the uploads of the wallet, or of the organization if given, which
+// requires the wallet to be its member, matching the query, narrowed by the filter and the others given, the most
+// relevant first, with their deals and tags, the count of all the uploads found, and the cursor of the next page
+func SearchSourceFileUploads(walletAddress string, organizationId *int64, uploadFilter *UploadFilter, query string, status, pinStatus, isMinted *string, page *models.Page, uploadAtStart, uploadAtEnd *int64) ([]*models.SourceFileUploadSearchResult, *int, *string, error) {
+	wallet, err := models.GetWalletByAddress(walletAddress, constants.WALLET_TYPE_META_MASK)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, nil, nil, err
 	}
 
-	return srcFileUploads, totalRecordCount, freeUsage, nil
+	if organizationId != nil {
+		_, err := checkOrganizationRole(wallet, *organizationId, constants.ORGANIZATION_ROLE_VIEWER)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, nil, nil, err
+		}
+	}
+
+	filter, err := getSourceFileUploadFilter(wallet, uploadFilter)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
+	}
+
+	searchResults, totalRecordCount, nextCursor, err := models.SearchSourceFileUploads(wallet.ID, organizationId, filter, query, status, pinStatus, isMinted, page, uploadAtStart, uploadAtEnd)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
+	}
+
+	srcFileUploads := []*models.SourceFileUploadResult{}
+	for _, searchResult := range searchResults {
+		srcFileUploads = append(srcFileUploads, &searchResult.SourceFileUploadResult)
+	}
+
+	err = fillSourceFileUploadResults(srcFileUploads)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, nil, err
+	}
+
+	return searchResults, totalRecordCount, nextCursor, nil
 }
 
-func DownloadSourceFileUploads(locationStr, walletAddress string, uploadAtStart, uploadAtEnd *int64) (*string, error) {
-	srcFileUploads, _, _, err := GetSourceFileUploads(walletAddress, nil, nil, nil, nil, true, nil, nil, uploadAtStart, uploadAtEnd)
+func DownloadSourceFileUploads(locationStr, walletAddress string, organizationId *int64, uploadFilter *UploadFilter, uploadAtStart, uploadAtEnd *int64) (*string, error) {
+	srcFileUploads, _, _, _, err := GetSourceFileUploads(walletAddress, organizationId, uploadFilter, nil, nil, nil, nil, true, nil, uploadAtStart, uploadAtEnd)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -315,9 +683,11 @@ func DownloadSourceFileUploads(locationStr, walletAddress string, uploadAtStart,
 }
 
 type SourceFileUpload struct {
-	WCid   string `json:"w_cid"`
-	Status string `json:"status"`
-	IsFree bool   `json:"is_free"`
+	WCid       string  `json:"w_cid"`
+	Status     string  `json:"status"`
+	IsFree     bool    `json:"is_free"`
+	MimeType   *string `json:"mime_type"`
+	ScanStatus *string `json:"scan_status"`
 }
 
 func GetSourceFileUpload(sourceFileUploadId int64) (*SourceFileUpload, error) {
@@ -340,9 +710,11 @@ func GetSourceFileUpload(sourceFileUploadId int64) (*SourceFileUpload, error) {
 	}
 
 	sourceFileUploadOut := &SourceFileUpload{
-		WCid:   sourceFileUpload.Uuid + sourceFile.PayloadCid,
-		Status: sourceFileUpload.Status,
-		IsFree: sourceFileUpload.IsFree,
+		WCid:       sourceFileUpload.Uuid + sourceFile.PayloadCid,
+		Status:     sourceFileUpload.Status,
+		IsFree:     sourceFileUpload.IsFree,
+		MimeType:   sourceFile.MimeType,
+		ScanStatus: sourceFile.ScanStatus,
 	}
 
 	if sourceFileUpload.Status != constants.SOURCE_FILE_UPLOAD_STATUS_PENDING &&
@@ -448,7 +820,7 @@ func GetSourceFileUploadDeal(sourceFileUploadId int64, dealId int64) (*SourceFil
 		return nil, nil, err
 	}
 
-	if sourceFileUpload.PinStatus == constants.IPFS_File_PINNED_STATUS {
+	if sourceFileUpload.PinStatus == constants.IPFS_File_PINNED_STATUS || sourceFileUpload.PinStatus == constants.IPFS_File_UNPINNING_STATUS {
 		sourceFileUploadDeal.IpfsUrl = sourceFile.IpfsUrl
 	} else {
 		sourceFileUploadDeal.IpfsUrl = ""
@@ -481,6 +853,50 @@ func GetSourceFileUploadDeal(sourceFileUploadId int64, dealId int64) (*SourceFil
 	return sourceFileUploadDeal, daoSignatures, nil
 }
 
+type ReplicaHealth struct {
+	CarFileId        int64                   `json:"car_file_id"`
+	TargetReplicaCnt int                     `json:"target_replica_cnt"`
+	ActiveReplicaCnt int                     `json:"active_replica_cnt"`
+	PendingDealCnt   int                     `json:"pending_deal_cnt"`
+	LostReplicaCnt   int                     `json:"lost_replica_cnt"`
+	ReplicaRepairs   []*models.ReplicaRepair `json:"replica_repair"`
+}
+
+func GetReplicaHealth(sourceFileUploadId int64) (*ReplicaHealth, error) {
+	carFile, err := models.GetCarFileBySourceFileUploadId(sourceFileUploadId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if carFile == nil {
+		return nil, nil
+	}
+
+	carFileReplica, err := models.GetCarFileReplicaByCarFileId(carFile.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	replicaRepairs, err := models.GetReplicaRepairsByCarFileId(carFile.ID)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	replicaHealth := &ReplicaHealth{
+		CarFileId:        carFile.ID,
+		TargetReplicaCnt: config.GetConfig().SwanTask.ReplicaCount,
+		ActiveReplicaCnt: carFileReplica.ActiveReplicaCnt,
+		PendingDealCnt:   carFileReplica.PendingDealCnt,
+		LostReplicaCnt:   carFileReplica.LostReplicaCnt,
+		ReplicaRepairs:   replicaRepairs,
+	}
+
+	return replicaHealth, nil
+}
+
 func RecordMintInfo(sourceFileIploadId int64, txHash string, tokenId int64, mintAddress string) (*models.SourceFileMint, error) {
 	/*
 		ethClient, _, err := client.GetEthClient()
@@ -520,13 +936,42 @@ func RecordMintInfo(sourceFileIploadId int64, txHash string, tokenId int64, mint
 	return sourceFileMint, nil
 }
 
+// UnpinSourceFile schedules the upload to be unpinned after the grace period, which can be undone till then, the content
+// is unpinned from the hot storage by the UnpinSourceFile job, once no upload of it is pinned
 func UnpinSourceFile(sourceFileUploadId int64) error {
-	err := models.UpdateSourceFileUploadPinStatus(sourceFileUploadId, constants.IPFS_File_UNPINNED_STATUS)
+	sourceFileUpload, err := models.GetSourceFileUploadById(sourceFileUploadId)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
+	if sourceFileUpload == nil {
+		err := fmt.Errorf("source file upload with id:%d not exists", sourceFileUploadId)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if sourceFileUpload.PinStatus != constants.IPFS_File_PINNED_STATUS {
+		logs.GetLogger().Info("source file upload:", sourceFileUploadId, " not pinned, pin status:", sourceFileUpload.PinStatus)
+		return nil
+	}
+
+	unpinAt := libutils.GetCurrentUtcSecond() + int64(config.GetConfig().Unpin.GracePeriodHours)*3600
+	scheduled, err := models.ScheduleSourceFileUploadUnpin(sourceFileUploadId, unpinAt)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if scheduled {
+		logs.GetLogger().Info("source file upload:", sourceFileUploadId, " to be unpinned at ", unpinAt)
+	}
+
+	return nil
+}
+
+// UndoUnpinSourceFile keeps the upload pinned, if its grace period has not ended yet
+func UndoUnpinSourceFile(sourceFileUploadId int64) error {
 	sourceFileUpload, err := models.GetSourceFileUploadById(sourceFileUploadId)
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -539,34 +984,18 @@ func UnpinSourceFile(sourceFileUploadId int64) error {
 		return err
 	}
 
-	sourceFile, err := models.GetSourceFileById(sourceFileUpload.SourceFileId)
+	undone, err := models.UndoSourceFileUploadUnpin(sourceFileUploadId)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	sourceFileUploadsPinned, err := models.GetSourceFileUploadsBySourceFileIdPinStatus(sourceFileUpload.SourceFileId, constants.IPFS_File_PINNED_STATUS)
-	if err != nil {
+	if !undone {
+		err := fmt.Errorf("source file upload:%d is not being unpinned, pin status:%s", sourceFileUploadId, sourceFileUpload.PinStatus)
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	if len(sourceFileUploadsPinned) == 0 {
-		unpinUrl := libutils.UrlJoin(config.GetConfig().IpfsServer.UploadUrlPrefix, "api/v0/pin/rm")
-		unpinUrl = unpinUrl + "?arg=" + sourceFile.PayloadCid
-		params := url.Values{}
-		_, err = web.HttpPostNoToken(unpinUrl, strings.NewReader(params.Encode()))
-		if err != nil {
-			logs.GetLogger().Info(err)
-			return err
-		}
-
-		err = models.UpdateSourceFilePinStatus(sourceFileUpload.SourceFileId, constants.IPFS_File_UNPINNED_STATUS)
-		if err != nil {
-			logs.GetLogger().Error(err)
-			return err
-		}
-	}
-
+	logs.GetLogger().Info("unpin of source file upload:", sourceFileUploadId, " undone")
 	return nil
 }